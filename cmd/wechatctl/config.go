@@ -0,0 +1,145 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	ACCOUNT_TYPE_MP   = "mp"   // 公众号
+	ACCOUNT_TYPE_CORP = "corp" // 企业号
+)
+
+// 配置文件, 格式为 json:
+//
+//  {
+//      "default": "mp-prod",
+//      "accounts": {
+//          "mp-prod": {
+//              "type":      "mp",
+//              "appid":     "wx0123456789abcdef",
+//              "appsecret": "APPSECRET"
+//          },
+//          "corp-oa": {
+//              "type":       "corp",
+//              "corpid":     "wx0123456789abcdef",
+//              "corpsecret": "CORPSECRET",
+//              "agentid":    1
+//          }
+//      }
+//  }
+type Config struct {
+	Default  string              `json:"default,omitempty"` // 没有指定 -account 时使用的帐号
+	Accounts map[string]*Account `json:"accounts"`
+}
+
+type Account struct {
+	Name string `json:"-"`
+
+	Type string `json:"type"` // mp 或者 corp, 默认为 mp
+
+	AppId     string `json:"appid,omitempty"`     // 公众号
+	AppSecret string `json:"appsecret,omitempty"` // 公众号
+
+	CorpId     string `json:"corpid,omitempty"`     // 企业号
+	CorpSecret string `json:"corpsecret,omitempty"` // 企业号
+	AgentId    int64  `json:"agentid,omitempty"`    // 企业号, 菜单 和 发送消息 默认使用的应用id
+}
+
+// 默认的配置文件路径, 优先使用环境变量 WECHATCTL_CONFIG, 否则为 $HOME/.wechatctl.json
+func defaultConfigFile() string {
+	if filename := os.Getenv("WECHATCTL_CONFIG"); filename != "" {
+		return filename
+	}
+	return filepath.Join(os.Getenv("HOME"), ".wechatctl.json")
+}
+
+func LoadConfig(filename string) (config *Config, err error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+
+	config = new(Config)
+	if err = json.Unmarshal(data, config); err != nil {
+		err = fmt.Errorf("invalid config file %s: %s", filename, err)
+		return
+	}
+	if len(config.Accounts) == 0 {
+		err = fmt.Errorf("invalid config file %s: no accounts", filename)
+		return
+	}
+
+	for name, account := range config.Accounts {
+		if account == nil {
+			err = fmt.Errorf("invalid config file %s: account %q is null", filename, name)
+			return
+		}
+		account.Name = name
+		if err = account.check(); err != nil {
+			err = fmt.Errorf("invalid config file %s: account %q: %s", filename, name, err)
+			return
+		}
+	}
+	return
+}
+
+func (account *Account) check() error {
+	switch account.Type {
+	case "":
+		account.Type = ACCOUNT_TYPE_MP
+		fallthrough
+	case ACCOUNT_TYPE_MP:
+		if account.AppId == "" || account.AppSecret == "" {
+			return errors.New("appid and appsecret are required")
+		}
+	case ACCOUNT_TYPE_CORP:
+		if account.CorpId == "" || account.CorpSecret == "" {
+			return errors.New("corpid and corpsecret are required")
+		}
+	default:
+		return fmt.Errorf("unknown type %q, must be mp or corp", account.Type)
+	}
+	return nil
+}
+
+// 获取名字为 name 的帐号, name 为空则使用 Default;
+// 如果 Default 也为空并且只有一个帐号, 则返回这个帐号.
+func (config *Config) Account(name string) (*Account, error) {
+	if name == "" {
+		name = config.Default
+	}
+	if name == "" {
+		if len(config.Accounts) == 1 {
+			for _, account := range config.Accounts {
+				return account, nil
+			}
+		}
+		return nil, fmt.Errorf("no account specified, use -account to choose one of %v", config.accountNames())
+	}
+
+	account := config.Accounts[name]
+	if account == nil {
+		return nil, fmt.Errorf("account %q not found, available accounts: %v", name, config.accountNames())
+	}
+	return account, nil
+}
+
+func (config *Config) accountNames() []string {
+	names := make([]string, 0, len(config.Accounts))
+	for name := range config.Accounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,161 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/chanxuehong/wechat/corp/client"
+	"github.com/chanxuehong/wechat/corp/media"
+	"github.com/chanxuehong/wechat/corp/menusync"
+	"github.com/chanxuehong/wechat/corp/message/active/common"
+	"github.com/chanxuehong/wechat/corp/tokencache"
+)
+
+const corpRootDepartmentId = 1 // 企业号的根部门id
+
+var errNoAgentId = errors.New("agentid is required, set it in config file or use -agentid")
+
+// 企业号的命令
+func runCorp(ctx *context, args []string) error {
+	clt := client.NewClient(ctx.account.CorpId, ctx.account.CorpSecret, new(tokencache.DefaultTokenCache), ctx.httpClient)
+
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "token":
+		token, err := clt.Token()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(ctx.stdout, token)
+		return err
+	case "menu":
+		return corpMenu(ctx, clt, args)
+	case "media":
+		return corpMedia(ctx, clt, args)
+	case "user":
+		return corpUser(ctx, clt, args)
+	case "send":
+		return corpSend(ctx, clt, args)
+	default:
+		return errUsage
+	}
+}
+
+func corpMenu(ctx *context, clt *client.Client, args []string) error {
+	if ctx.agentId == 0 {
+		return errNoAgentId
+	}
+
+	switch {
+	case len(args) == 1 && args[0] == "get":
+		menu_, err := clt.MenuGet(ctx.agentId)
+		if err != nil {
+			return err
+		}
+		return ctx.printJSON(menu_)
+	case len(args) == 2 && args[0] == "create":
+		menu_, err := menusync.LoadFile(args[1])
+		if err != nil {
+			return err
+		}
+		return clt.MenuCreate(*menu_, ctx.agentId)
+	case len(args) == 1 && args[0] == "delete":
+		return clt.MenuDelete(ctx.agentId)
+	default:
+		return errUsage
+	}
+}
+
+func corpMedia(ctx *context, clt *client.Client, args []string) error {
+	switch {
+	case len(args) == 3 && args[0] == "upload":
+		var upload func(string) (*media.MediaInfo, error)
+		switch args[1] {
+		case media.MEDIA_TYPE_IMAGE:
+			upload = clt.MediaUploadImage
+		case media.MEDIA_TYPE_VOICE:
+			upload = clt.MediaUploadVoice
+		case media.MEDIA_TYPE_VIDEO:
+			upload = clt.MediaUploadVideo
+		case media.MEDIA_TYPE_THUMB:
+			upload = clt.MediaUploadThumb
+		case media.MEDIA_TYPE_FILE:
+			upload = clt.MediaUploadFile
+		default:
+			return fmt.Errorf("unknown media type %q", args[1])
+		}
+		info, err := upload(args[2])
+		if err != nil {
+			return err
+		}
+		return ctx.printJSON(info)
+	case len(args) == 3 && args[0] == "download":
+		return clt.MediaDownload(args[1], args[2])
+	default:
+		return errUsage
+	}
+}
+
+func corpUser(ctx *context, clt *client.Client, args []string) error {
+	switch {
+	case len(args) == 2 && args[0] == "info":
+		info, err := clt.UserInfo(args[1])
+		if err != nil {
+			return err
+		}
+		return ctx.printJSON(info)
+	case (len(args) == 1 || len(args) == 2) && args[0] == "export":
+		var filename string
+		if len(args) == 2 {
+			filename = args[1]
+		}
+		w, closeFunc, err := ctx.createOutput(filename)
+		if err != nil {
+			return err
+		}
+		defer closeFunc()
+
+		users, err := clt.UserSimpleList(corpRootDepartmentId, true, 0)
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			if _, err = fmt.Fprintf(w, "%s\t%s\n", user.Id, user.Name); err != nil {
+				return err
+			}
+		}
+		return closeFunc()
+	default:
+		return errUsage
+	}
+}
+
+func corpSend(ctx *context, clt *client.Client, args []string) error {
+	if ctx.agentId == 0 {
+		return errNoAgentId
+	}
+
+	switch {
+	case len(args) == 3 && args[0] == "text":
+		var text common.Text
+		text.ToUser = args[1]
+		text.MsgType = common.MSG_TYPE_TEXT
+		text.AgentId = ctx.agentId
+		text.Text.Content = args[2]
+
+		result, err := clt.MsgSendText(&text)
+		if err != nil {
+			return err
+		}
+		if result.InvalidUser != "" || result.InvalidParty != "" || result.InvalidTag != "" {
+			return ctx.printJSON(result)
+		}
+		return nil
+	default:
+		return errUsage
+	}
+}
@@ -0,0 +1,136 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+// wechatctl 是公众号和企业号的命令行管理工具.
+//
+//  用法: wechatctl [-config file] [-account name] <command> [arguments]
+//
+//  帐号信息从配置文件读取, 默认为 $HOME/.wechatctl.json, 格式参考 Config.
+//  运行 wechatctl help 查看所有的命令.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+const usage = `用法: wechatctl [-config file] [-account name] <command> [arguments]
+
+公众号和企业号都支持的命令:
+  token                                  打印 access_token
+  menu get                               打印自定义菜单
+  menu create <file>                     从 json/yaml 文件创建自定义菜单
+  menu delete                            删除自定义菜单
+  media upload <type> <file>             上传多媒体文件, type 为 image, voice, video, thumb (企业号还支持 file)
+  media download <media_id> <file>       下载多媒体文件
+  user info <id>                         查询用户信息, 公众号为 openid, 企业号为 userid
+  user export [file]                     导出用户列表, 公众号每行一个 openid, 企业号每行为 userid<TAB>name;
+                                         没有 file 则输出到标准输出
+  send text <to> <content>               发送文本消息, 公众号为客服消息, 企业号为应用消息
+
+只有公众号支持的命令:
+  qrcode temp <scene_id> [expire]        创建临时二维码, expire 单位为秒, 默认 1800
+  qrcode perm <scene_id>                 创建永久二维码
+  send template <file>                   发送模版消息, file 为 json 格式的消息体
+
+企业号的命令可以用 -agentid 覆盖配置文件里的 agentid.
+
+参数:
+`
+
+// 一次命令执行的上下文
+type context struct {
+	account    *Account
+	agentId    int64
+	httpClient *http.Client
+	stdout     io.Writer
+}
+
+var errUsage = errors.New("invalid arguments")
+
+func main() {
+	flagSet := flag.NewFlagSet("wechatctl", flag.ExitOnError)
+	configFile := flagSet.String("config", defaultConfigFile(), "配置文件")
+	accountName := flagSet.String("account", "", "使用的帐号, 默认为配置文件里的 default")
+	agentId := flagSet.Int64("agentid", 0, "企业号的应用id, 默认为配置文件里的 agentid")
+	flagSet.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flagSet.PrintDefaults()
+	}
+	flagSet.Parse(os.Args[1:])
+
+	args := flagSet.Args()
+	if len(args) == 0 || args[0] == "help" {
+		flagSet.Usage()
+		os.Exit(2)
+	}
+
+	config, err := LoadConfig(*configFile)
+	if err != nil {
+		fatal(err)
+	}
+	account, err := config.Account(*accountName)
+	if err != nil {
+		fatal(err)
+	}
+
+	ctx := &context{
+		account: account,
+		agentId: account.AgentId,
+		stdout:  os.Stdout,
+	}
+	if *agentId != 0 {
+		ctx.agentId = *agentId
+	}
+
+	if err = run(ctx, args); err != nil {
+		if err == errUsage {
+			flagSet.Usage()
+			os.Exit(2)
+		}
+		fatal(err)
+	}
+}
+
+func run(ctx *context, args []string) error {
+	switch ctx.account.Type {
+	case ACCOUNT_TYPE_CORP:
+		return runCorp(ctx, args)
+	default:
+		return runMP(ctx, args)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "wechatctl:", err)
+	os.Exit(1)
+}
+
+// 以缩进的 json 格式打印 v
+func (ctx *context) printJSON(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(ctx.stdout, "%s\n", data)
+	return err
+}
+
+// 打开 user export 的输出, filename 为空则使用 stdout
+func (ctx *context) createOutput(filename string) (w io.Writer, closeFunc func() error, err error) {
+	if filename == "" {
+		return ctx.stdout, func() error { return nil }, nil
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return
+	}
+	return file, file.Close, nil
+}
@@ -0,0 +1,118 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chanxuehong/wechat/mp/user"
+	"github.com/chanxuehong/wechat/wechattest"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wechatctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "config.json")
+	data := `{
+		"default": "mp",
+		"accounts": {
+			"mp":   {"appid": "appid", "appsecret": "appsecret"},
+			"corp": {"type": "corp", "corpid": "corpid", "corpsecret": "corpsecret", "agentid": 1}
+		}
+	}`
+	if err = ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account, err := config.Account(""); err != nil || account.Name != "mp" || account.Type != ACCOUNT_TYPE_MP {
+		t.Errorf("Account(\"\"): have %+v, %v", account, err)
+	}
+	if account, err := config.Account("corp"); err != nil || account.AgentId != 1 {
+		t.Errorf("Account(corp): have %+v, %v", account, err)
+	}
+	if _, err = config.Account("none"); err == nil {
+		t.Error("Account(none): expected error")
+	}
+
+	if err = ioutil.WriteFile(filename, []byte(`{"accounts": {"x": {"type": "corp"}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadConfig(filename); err == nil {
+		t.Error("LoadConfig: expected error for account without corpid")
+	}
+}
+
+func TestRun(t *testing.T) {
+	srv := wechattest.NewServer(nil)
+	defer srv.Close()
+	srv.AddUser(user.UserInfo{OpenId: "openid-1"})
+	srv.AddUser(user.UserInfo{OpenId: "openid-2"})
+
+	dir, err := ioutil.TempDir("", "wechatctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	menuFile := filepath.Join(dir, "menu.json")
+	if err = ioutil.WriteFile(menuFile, []byte(`{"button": [{"type": "click", "name": "今日歌曲", "key": "V1001_TODAY_MUSIC"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout bytes.Buffer
+	mp := &context{
+		account:    &Account{Type: ACCOUNT_TYPE_MP, AppId: srv.AppId(), AppSecret: srv.AppSecret()},
+		httpClient: srv.Client(),
+		stdout:     &stdout,
+	}
+	corp := &context{
+		account:    &Account{Type: ACCOUNT_TYPE_CORP, CorpId: srv.CorpId(), CorpSecret: srv.CorpSecret()},
+		agentId:    1,
+		httpClient: srv.Client(),
+		stdout:     &stdout,
+	}
+
+	if err = run(mp, []string{"menu", "create", menuFile}); err != nil {
+		t.Fatal(err)
+	}
+	if menu_, ok := srv.Menu(); !ok || len(menu_.Buttons) != 1 {
+		t.Errorf("menu create: have %+v", menu_)
+	}
+
+	stdout.Reset()
+	if err = run(mp, []string{"user", "export"}); err != nil {
+		t.Fatal(err)
+	}
+	if have := strings.Fields(stdout.String()); len(have) != 2 {
+		t.Errorf("user export: have %q", stdout.String())
+	}
+
+	if err = run(mp, []string{"send", "text", "openid-1", "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = run(corp, []string{"send", "text", "@all", "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := srv.Messages(); len(msgs) != 2 {
+		t.Errorf("Messages: have %+v", msgs)
+	}
+
+	if err = run(mp, []string{"menu"}); err != errUsage {
+		t.Errorf("menu: have %v, want errUsage", err)
+	}
+}
@@ -0,0 +1,193 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/chanxuehong/wechat/mp/client"
+	"github.com/chanxuehong/wechat/mp/media"
+	"github.com/chanxuehong/wechat/mp/menusync"
+	"github.com/chanxuehong/wechat/mp/message/active/custom"
+	"github.com/chanxuehong/wechat/mp/tokenservice"
+)
+
+// 公众号的命令
+func runMP(ctx *context, args []string) error {
+	tokenService := tokenservice.NewDefaultTokenService(ctx.account.AppId, ctx.account.AppSecret, ctx.httpClient)
+	if _, err := tokenService.Token(); err != nil {
+		return err
+	}
+	clt := client.NewClient(tokenService, ctx.httpClient)
+
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "token":
+		token, err := clt.Token()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(ctx.stdout, token)
+		return err
+	case "menu":
+		return mpMenu(ctx, clt, args)
+	case "media":
+		return mpMedia(ctx, clt, args)
+	case "user":
+		return mpUser(ctx, clt, args)
+	case "qrcode":
+		return mpQRCode(ctx, clt, args)
+	case "send":
+		return mpSend(ctx, clt, args)
+	default:
+		return errUsage
+	}
+}
+
+func mpMenu(ctx *context, clt *client.Client, args []string) error {
+	switch {
+	case len(args) == 1 && args[0] == "get":
+		menu_, err := clt.MenuGet()
+		if err != nil {
+			return err
+		}
+		return ctx.printJSON(menu_)
+	case len(args) == 2 && args[0] == "create":
+		menu_, err := menusync.LoadFile(args[1])
+		if err != nil {
+			return err
+		}
+		return clt.MenuCreate(*menu_)
+	case len(args) == 1 && args[0] == "delete":
+		return clt.MenuDelete()
+	default:
+		return errUsage
+	}
+}
+
+func mpMedia(ctx *context, clt *client.Client, args []string) error {
+	switch {
+	case len(args) == 3 && args[0] == "upload":
+		var upload func(string) (*media.MediaInfo, error)
+		switch args[1] {
+		case media.MEDIA_TYPE_IMAGE:
+			upload = clt.MediaUploadImage
+		case media.MEDIA_TYPE_VOICE:
+			upload = clt.MediaUploadVoice
+		case media.MEDIA_TYPE_VIDEO:
+			upload = clt.MediaUploadVideo
+		case media.MEDIA_TYPE_THUMB:
+			upload = clt.MediaUploadThumb
+		default:
+			return fmt.Errorf("unknown media type %q", args[1])
+		}
+		info, err := upload(args[2])
+		if err != nil {
+			return err
+		}
+		return ctx.printJSON(info)
+	case len(args) == 3 && args[0] == "download":
+		return clt.MediaDownload(args[1], args[2])
+	default:
+		return errUsage
+	}
+}
+
+func mpUser(ctx *context, clt *client.Client, args []string) error {
+	switch {
+	case len(args) == 2 && args[0] == "info":
+		info, err := clt.UserInfo(args[1], "")
+		if err != nil {
+			return err
+		}
+		return ctx.printJSON(info)
+	case (len(args) == 1 || len(args) == 2) && args[0] == "export":
+		var filename string
+		if len(args) == 2 {
+			filename = args[1]
+		}
+		w, closeFunc, err := ctx.createOutput(filename)
+		if err != nil {
+			return err
+		}
+		defer closeFunc()
+
+		iter, err := clt.UserIterator("")
+		if err != nil {
+			return err
+		}
+		for iter.HasNext() {
+			openids, err := iter.NextPage()
+			if err != nil {
+				return err
+			}
+			for _, openid := range openids {
+				if _, err = fmt.Fprintln(w, openid); err != nil {
+					return err
+				}
+			}
+		}
+		return closeFunc()
+	default:
+		return errUsage
+	}
+}
+
+func mpQRCode(ctx *context, clt *client.Client, args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	sceneId, err := strconv.ParseUint(args[1], 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid scene_id %q", args[1])
+	}
+
+	switch {
+	case (len(args) == 2 || len(args) == 3) && args[0] == "temp":
+		expireSeconds := 1800
+		if len(args) == 3 {
+			if expireSeconds, err = strconv.Atoi(args[2]); err != nil {
+				return fmt.Errorf("invalid expire %q", args[2])
+			}
+		}
+		qrcode, err := clt.QRCodeTemporaryCreate(uint32(sceneId), expireSeconds)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(ctx.stdout, "ticket: %s\nexpire_seconds: %d\nurl: %s\n", qrcode.Ticket, qrcode.ExpiresIn, qrcode.URL())
+		return err
+	case len(args) == 2 && args[0] == "perm":
+		qrcode, err := clt.QRCodePermanentCreate(uint32(sceneId))
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(ctx.stdout, "ticket: %s\nurl: %s\n", qrcode.Ticket, qrcode.URL())
+		return err
+	default:
+		return errUsage
+	}
+}
+
+func mpSend(ctx *context, clt *client.Client, args []string) error {
+	switch {
+	case len(args) == 3 && args[0] == "text":
+		return clt.MsgCustomSendText(custom.NewText(args[1], args[2]))
+	case len(args) == 2 && args[0] == "template":
+		msg, err := ioutil.ReadFile(args[1])
+		if err != nil {
+			return err
+		}
+		msgid, err := clt.MsgTemplateSendRaw(msg)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(ctx.stdout, "msgid: %d\n", msgid)
+		return err
+	default:
+		return errUsage
+	}
+}
@@ -0,0 +1,219 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+// wechatsim 模拟微信服务器向本地的开发者 URL 推送消息, 并且解密打印回复的消息.
+//
+//  公众号:
+//  wechatsim -url http://localhost:8080/wechat -token TOKEN -to gh_xxx text
+//  wechatsim -url http://localhost:8080/wechat -token TOKEN -appid APPID -aeskey ENCODED_AES_KEY -mode aes -to gh_xxx event.CLICK
+//
+//  企业号:
+//  wechatsim -corp -url http://localhost:8080/wechat -token TOKEN -corpid CORPID -aeskey ENCODED_AES_KEY -agentid 1 text
+//
+//  wechatsim -list 列出所有支持的消息类型, -verify 模拟首次验证 URL, -file 推送文件里的明文 xml 消息.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	corpsimulator "github.com/chanxuehong/wechat/corp/simulator"
+	"github.com/chanxuehong/wechat/mp/simulator"
+	"github.com/chanxuehong/wechat/util"
+)
+
+type options struct {
+	url     string
+	token   string
+	corp    bool
+	appId   string
+	corpId  string
+	aesKey  string
+	mode    string
+	agentId int64
+
+	to      string
+	from    string
+	content string
+	key     string
+
+	file   string
+	verify bool
+	list   bool
+}
+
+func main() {
+	var opts options
+
+	flagSet := flag.NewFlagSet("wechatsim", flag.ExitOnError)
+	flagSet.StringVar(&opts.url, "url", "", "开发者服务器的 URL")
+	flagSet.StringVar(&opts.token, "token", "", "Token")
+	flagSet.BoolVar(&opts.corp, "corp", false, "模拟企业号的推送")
+	flagSet.StringVar(&opts.appId, "appid", "", "公众号的 AppId, 兼容模式和安全模式需要")
+	flagSet.StringVar(&opts.corpId, "corpid", "", "企业号的 CorpId")
+	flagSet.StringVar(&opts.aesKey, "aeskey", "", "EncodingAESKey, 43 个字符")
+	flagSet.StringVar(&opts.mode, "mode", simulator.MODE_RAW, "公众号的加密方式: raw, compatible, aes")
+	flagSet.Int64Var(&opts.agentId, "agentid", 0, "企业号的应用id")
+	flagSet.StringVar(&opts.to, "to", "", "ToUserName, 公众号为开发者微信号, 企业号默认为 -corpid")
+	flagSet.StringVar(&opts.from, "from", "", "FromUserName, 公众号为 OpenID, 企业号为 UserID")
+	flagSet.StringVar(&opts.content, "content", "", "文本消息的内容")
+	flagSet.StringVar(&opts.key, "key", "", "菜单事件和二维码事件的 EventKey")
+	flagSet.StringVar(&opts.file, "file", "", "推送文件里的明文 xml 消息, 而不是构造 kind 类型的消息")
+	flagSet.BoolVar(&opts.verify, "verify", false, "模拟首次验证 URL 的 GET 请求")
+	flagSet.BoolVar(&opts.list, "list", false, "列出所有支持的消息类型")
+	flagSet.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法: wechatsim [flags] <kind>")
+		flagSet.PrintDefaults()
+	}
+	flagSet.Parse(os.Args[1:])
+
+	var kind string
+	switch args := flagSet.Args(); {
+	case opts.list, opts.verify, opts.file != "":
+		if len(args) != 0 {
+			flagSet.Usage()
+			os.Exit(2)
+		}
+	case len(args) == 1:
+		kind = args[0]
+	default:
+		flagSet.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(os.Stdout, &opts, kind); err != nil {
+		fmt.Fprintln(os.Stderr, "wechatsim:", err)
+		os.Exit(1)
+	}
+}
+
+func run(w io.Writer, opts *options, kind string) (err error) {
+	if opts.list {
+		kinds := simulator.Kinds()
+		if opts.corp {
+			kinds = corpsimulator.Kinds()
+		}
+		_, err = fmt.Fprintln(w, strings.Join(kinds, "\n"))
+		return
+	}
+
+	if opts.url == "" || opts.token == "" {
+		return errors.New("-url and -token are required")
+	}
+
+	var AESKey []byte
+	if opts.aesKey != "" {
+		if AESKey, err = util.AESKeyDecode(opts.aesKey); err != nil {
+			return
+		}
+	}
+
+	var rawXMLMsg []byte
+	if opts.file != "" {
+		if rawXMLMsg, err = ioutil.ReadFile(opts.file); err != nil {
+			return
+		}
+	}
+
+	if opts.corp {
+		return runCorp(w, opts, kind, AESKey, rawXMLMsg)
+	}
+	return runMP(w, opts, kind, AESKey, rawXMLMsg)
+}
+
+func runMP(w io.Writer, opts *options, kind string, AESKey, rawXMLMsg []byte) (err error) {
+	switch opts.mode {
+	case simulator.MODE_RAW:
+	case simulator.MODE_COMPATIBLE, simulator.MODE_AES:
+		if opts.appId == "" || AESKey == nil {
+			return fmt.Errorf("-appid and -aeskey are required in %s mode", opts.mode)
+		}
+	default:
+		return fmt.Errorf("unknown mode %q", opts.mode)
+	}
+
+	s := simulator.NewSimulator(opts.url, opts.token, opts.appId, AESKey, opts.mode)
+	if opts.verify {
+		if err = s.Verify(); err != nil {
+			return
+		}
+		_, err = fmt.Fprintln(w, "verify ok")
+		return
+	}
+
+	if rawXMLMsg == nil {
+		params := &simulator.Params{
+			ToUserName:   opts.to,
+			FromUserName: opts.from,
+			Content:      opts.content,
+			EventKey:     opts.key,
+		}
+		if rawXMLMsg, err = simulator.BuildMsg(kind, params); err != nil {
+			return
+		}
+	}
+
+	fmt.Fprintf(w, "==> POST %s (%s)\n%s\n\n", opts.url, opts.mode, simulator.FormatXML(rawXMLMsg))
+	reply, err := s.Post(rawXMLMsg)
+	if reply != nil {
+		printReply(w, reply.StatusCode, reply.Body, reply.RawXMLMsg)
+	}
+	return
+}
+
+func runCorp(w io.Writer, opts *options, kind string, AESKey, rawXMLMsg []byte) (err error) {
+	if opts.corpId == "" || AESKey == nil {
+		return errors.New("-corpid and -aeskey are required")
+	}
+
+	s := corpsimulator.NewSimulator(opts.url, opts.token, opts.corpId, AESKey)
+	if opts.verify {
+		if err = s.Verify(); err != nil {
+			return
+		}
+		_, err = fmt.Fprintln(w, "verify ok")
+		return
+	}
+
+	if rawXMLMsg == nil {
+		params := &corpsimulator.Params{
+			ToUserName:   opts.to,
+			FromUserName: opts.from,
+			AgentId:      opts.agentId,
+			Content:      opts.content,
+			EventKey:     opts.key,
+		}
+		if params.ToUserName == "" {
+			params.ToUserName = opts.corpId
+		}
+		if rawXMLMsg, err = corpsimulator.BuildMsg(kind, params); err != nil {
+			return
+		}
+	}
+
+	fmt.Fprintf(w, "==> POST %s\n%s\n\n", opts.url, corpsimulator.FormatXML(rawXMLMsg))
+	reply, err := s.Post(rawXMLMsg)
+	if reply != nil {
+		printReply(w, reply.StatusCode, reply.Body, reply.RawXMLMsg)
+	}
+	return
+}
+
+func printReply(w io.Writer, statusCode int, body, rawXMLMsg []byte) {
+	fmt.Fprintf(w, "<== HTTP %d\n", statusCode)
+	switch {
+	case rawXMLMsg != nil:
+		fmt.Fprintln(w, simulator.FormatXML(rawXMLMsg))
+	case len(body) != 0:
+		fmt.Fprintf(w, "%s\n", body)
+	default:
+		fmt.Fprintln(w, "(no reply)")
+	}
+}
@@ -0,0 +1,45 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chanxuehong/wechat/mp/server"
+	"github.com/chanxuehong/wechat/mp/simulator"
+)
+
+func TestRun(t *testing.T) {
+	agent := new(server.DefaultAgent)
+	agent.Init("gh_0123456789ab", "token", "wx0123456789abcdef", []byte("0123456789abcdef0123456789abcdef"))
+	ts := httptest.NewServer(server.NewAgentFrontend(agent, nil))
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	opts := &options{url: ts.URL, token: "token", mode: simulator.MODE_RAW, to: "gh_0123456789ab"}
+	if err := run(&buf, opts, "event.subscribe"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "<Event>subscribe</Event>") || !strings.Contains(buf.String(), "(no reply)") {
+		t.Errorf("run: have %s", buf.String())
+	}
+
+	opts.mode = simulator.MODE_AES
+	if err := run(&buf, opts, "text"); err == nil {
+		t.Error("run in aes mode without -aeskey: expected error")
+	}
+
+	buf.Reset()
+	if err := run(&buf, &options{list: true, corp: true}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "event.SCAN") || !strings.Contains(buf.String(), "event.CLICK") {
+		t.Errorf("list: have %s", buf.String())
+	}
+}
@@ -0,0 +1,76 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package bulk
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/chanxuehong/wechat/corp/addresslist"
+	"github.com/chanxuehong/wechat/corp/client"
+	"github.com/chanxuehong/wechat/corp/tokencache"
+	"github.com/chanxuehong/wechat/wechattest"
+)
+
+func TestBulkTagUserAdd(t *testing.T) {
+	const path = "/cgi-bin/tag/addtagusers"
+
+	srv := wechattest.NewServer(nil)
+	defer srv.Close()
+
+	userids := make([]string, 2500)
+	for i := range userids {
+		userids[i] = fmt.Sprintf("userid-%04d", i)
+		if i != 5 { // userid-0005 不存在
+			srv.AddCorpUser(addresslist.UserInfo{Id: userids[i], Name: userids[i]})
+		}
+	}
+
+	clt := client.NewClient(srv.CorpId(), srv.CorpSecret(), new(tokencache.DefaultTokenCache), srv.Client())
+	tagId, err := clt.TagCreate("bulk")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 一批 2500 个, 每次调用最多 1000 个; 模拟服务器超过 1000 个会返回错误
+	b := NewBulk(clt, &Options{BatchSize: 2500, MaxRetries: 1})
+	srv.InjectError(path, errCodeFreqOutOfLimit, "api freq out of limit", 1) // 第一次调用模拟限流
+
+	checkpoint := new(MemoryCheckpoint)
+	checkpoint.Save(userids[1])
+
+	results, err := b.TagUserAdd(tagId, userids, checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 剩下 2498 个分为 1000, 1000, 498 三次调用, 加上限流后的一次重试
+	if n := srv.Calls(path); n != 4 {
+		t.Errorf("calls: have %d, want 4", n)
+	}
+	if len(results) != len(userids)-2 {
+		t.Fatalf("len(results): have %d, want %d", len(results), len(userids)-2)
+	}
+	for i, result := range results {
+		if want := userids[i+2]; result.UserId != want {
+			t.Fatalf("results[%d].UserId: have %s, want %s", i, result.UserId, want)
+		}
+		if (result.UserId == "userid-0005") != (result.Err == ErrInvalidUser) || (result.Err != nil && result.Err != ErrInvalidUser) {
+			t.Errorf("results[%d].Err: %v", i, result.Err)
+		}
+	}
+	if last, _ := checkpoint.Load(); last != userids[len(userids)-1] {
+		t.Errorf("checkpoint: have %s, want %s", last, userids[len(userids)-1])
+	}
+
+	userList, err := clt.TagUserList(tagId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(userList) != len(userids)-3 || userList[0].Id != "userid-0002" {
+		t.Errorf("tag users: have %d, first %+v", len(userList), userList[0])
+	}
+}
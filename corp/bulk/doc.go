@@ -0,0 +1,9 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+// 企业号成员的批量操作, 如批量获取成员信息, 批量增加/删除标签成员.
+//  所有操作都通过固定数量的 worker 并发执行, 并且可以限制每秒的请求数;
+//  操作按批次执行, 每完成一批就保存一次进度(Checkpoint), 中断后可以从进度处继续.
+package bulk
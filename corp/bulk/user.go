@@ -0,0 +1,119 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package bulk
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/chanxuehong/wechat/corp/addresslist"
+)
+
+const tagUserBatchSizeLimit = 1000 // 增加/删除标签成员每次最多的成员个数
+
+// 标签成员的 userid 非法时 Result.Err 为 ErrInvalidUser
+var ErrInvalidUser = errors.New("invalid userid")
+
+// 获取成员信息的结果
+type UserInfoResult struct {
+	Result
+	UserInfo *addresslist.UserInfo // Err == nil 时有效
+}
+
+// 批量获取成员信息, 结果的顺序和 userids 一致.
+//  如果 checkpoint != nil 则从保存的进度处继续, 已经处理过的 userid 不在结果中.
+func (b *Bulk) UserInfo(userids []string, checkpoint Checkpoint) (results []UserInfoResult, err error) {
+	var mutex sync.Mutex
+	infos := make(map[string]*addresslist.UserInfo)
+
+	results = make([]UserInfoResult, 0, len(userids))
+	err = b.run(userids, checkpoint,
+		func(batch []string) []Result {
+			return b.runBatch(batch, func(userid string) error {
+				info, err := b.clt.UserInfo(userid)
+				if err != nil {
+					return err
+				}
+				mutex.Lock()
+				infos[userid] = info
+				mutex.Unlock()
+				return nil
+			})
+		},
+		func(result *Result) {
+			mutex.Lock()
+			info := infos[result.UserId]
+			delete(infos, result.UserId)
+			mutex.Unlock()
+
+			results = append(results, UserInfoResult{
+				Result:   *result,
+				UserInfo: info,
+			})
+		},
+	)
+	return
+}
+
+// 批量增加标签成员, 每一批调用一次 TagUserAdd, 结果的顺序和 userids 一致.
+//  非法的 userid 对应的 Result.Err 为 ErrInvalidUser.
+//  如果 checkpoint != nil 则从保存的进度处继续, 已经处理过的 userid 不在结果中.
+func (b *Bulk) TagUserAdd(tagId int64, userids []string, checkpoint Checkpoint) (results []Result, err error) {
+	return b.tagUser(userids, checkpoint, func(batch []string) ([]string, error) {
+		return b.clt.TagUserAdd(tagId, batch)
+	})
+}
+
+// 批量删除标签成员, 每一批调用一次 TagUserDel, 结果的顺序和 userids 一致.
+//  非法的 userid 对应的 Result.Err 为 ErrInvalidUser.
+//  如果 checkpoint != nil 则从保存的进度处继续, 已经处理过的 userid 不在结果中.
+func (b *Bulk) TagUserDel(tagId int64, userids []string, checkpoint Checkpoint) (results []Result, err error) {
+	return b.tagUser(userids, checkpoint, func(batch []string) ([]string, error) {
+		return b.clt.TagUserDel(tagId, batch)
+	})
+}
+
+func (b *Bulk) tagUser(userids []string, checkpoint Checkpoint,
+	call func(batch []string) (invalidUsers []string, err error)) (results []Result, err error) {
+
+	results = make([]Result, 0, len(userids))
+	err = b.run(userids, checkpoint,
+		func(batch []string) []Result {
+			batchResults := make([]Result, 0, len(batch))
+			for len(batch) > 0 {
+				n := tagUserBatchSizeLimit
+				if n > len(batch) {
+					n = len(batch)
+				}
+				part := batch[:n]
+				batch = batch[n:]
+
+				var invalidUsers []string
+				callErr := b.call(func() (err error) {
+					invalidUsers, err = call(part)
+					return
+				})
+
+				invalidSet := make(map[string]bool, len(invalidUsers))
+				for _, userid := range invalidUsers {
+					invalidSet[userid] = true
+				}
+				for _, userid := range part {
+					result := Result{UserId: userid, Err: callErr}
+					if callErr == nil && invalidSet[userid] {
+						result.Err = ErrInvalidUser
+					}
+					batchResults = append(batchResults, result)
+				}
+			}
+			return batchResults
+		},
+		func(result *Result) {
+			results = append(results, *result)
+		},
+	)
+	return
+}
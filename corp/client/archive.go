@@ -0,0 +1,69 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package client
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	wechatjson "github.com/chanxuehong/wechat/json"
+	"github.com/chanxuehong/wechat/util"
+)
+
+// 主动发送的消息的种类, util.ArchiveRecord.Kind
+const archiveKindMsg = "msg"
+
+// 开启消息存档, 把 MsgSendXXX 发送的消息体, 调用时间和错误存档到 store,
+// 比如 util.NewFileArchiveStore 返回的 *util.FileArchiveStore. store 为 nil 则关闭存档.
+//  NOTE: 要在发送消息之前调用, 不是并发安全的.
+func (c *Client) EnableArchive(store util.ArchiveStore) {
+	c.archiveStore = store
+}
+
+// 把主动发送的消息 msg 存档, 出错的时候只记录日志.
+func (c *Client) archiveSend(msg interface{}, start time.Time, sendErr error) {
+	msgJSON, err := wechatjson.Marshal(msg)
+	if err != nil {
+		log.Printf("wechat: encode %s message failed: %v", archiveKindMsg, err)
+		return
+	}
+
+	record := &util.ArchiveRecord{
+		Direction:  util.ArchiveOutbound,
+		Source:     "corp",
+		Kind:       archiveKindMsg,
+		MsgType:    archiveKindMsg,
+		Msg:        json.RawMessage(msgJSON),
+		Latency:    time.Since(start),
+		ArchivedAt: time.Now(),
+	}
+	if sendErr != nil {
+		record.Error = sendErr.Error()
+	}
+
+	var header struct {
+		ToUser  string `json:"touser"` // 多个接收者用 '|' 分隔
+		MsgType string `json:"msgtype"`
+		AgentId int64  `json:"agentid"`
+	}
+	if json.Unmarshal(msgJSON, &header) == nil {
+		if header.MsgType != "" {
+			record.MsgType = header.MsgType
+		}
+		record.AgentId = header.AgentId
+		if strings.Contains(header.ToUser, "|") {
+			record.OpenIds = strings.Split(header.ToUser, "|")
+		} else {
+			record.OpenId = header.ToUser
+		}
+	}
+
+	if err = c.archiveStore.Append(record); err != nil {
+		log.Printf("wechat: archive %s message failed: %v", archiveKindMsg, err)
+	}
+}
@@ -0,0 +1,76 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package client
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/chanxuehong/wechat/corp/addresslist"
+	"github.com/chanxuehong/wechat/corp/message/active/common"
+	"github.com/chanxuehong/wechat/corp/tokencache"
+	"github.com/chanxuehong/wechat/util"
+	"github.com/chanxuehong/wechat/wechattest"
+)
+
+type testArchiveStore struct {
+	mutex   sync.Mutex
+	records []*util.ArchiveRecord
+}
+
+func (s *testArchiveStore) Append(record *util.ArchiveRecord) error {
+	s.mutex.Lock()
+	s.records = append(s.records, record)
+	s.mutex.Unlock()
+	return nil
+}
+
+func (s *testArchiveStore) Query(query *util.ArchiveQuery) (records []*util.ArchiveRecord, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, record := range s.records {
+		if query.Match(record) {
+			records = append(records, record)
+		}
+	}
+	return
+}
+
+func TestMsgSendArchive(t *testing.T) {
+	srv := wechattest.NewServer(nil)
+	defer srv.Close()
+	srv.AddCorpUser(addresslist.UserInfo{Id: "userid1", Name: "user1"})
+	srv.AddCorpUser(addresslist.UserInfo{Id: "userid2", Name: "user2"}) // userid3 不存在
+
+	clt := NewClient(srv.CorpId(), srv.CorpSecret(), new(tokencache.DefaultTokenCache), srv.Client())
+
+	store := new(testArchiveStore)
+	clt.EnableArchive(store)
+
+	var msg common.Text
+	msg.ToUser = "userid1|userid2|userid3"
+	msg.MsgType = common.MSG_TYPE_TEXT
+	msg.AgentId = 1
+	msg.Text.Content = "hello"
+
+	result, err := clt.MsgSendText(&msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.InvalidUser != "userid3" {
+		t.Errorf("InvalidUser mismatch, have %q", result.InvalidUser)
+	}
+
+	records, _ := store.Query(&util.ArchiveQuery{Direction: util.ArchiveOutbound, OpenId: "userid2"})
+	if len(records) != 1 {
+		t.Fatalf("want 1 record, have %d", len(records))
+	}
+	record := records[0]
+	if record.Source != "corp" || record.Kind != archiveKindMsg || record.MsgType != common.MSG_TYPE_TEXT ||
+		record.AgentId != 1 || len(record.OpenIds) != 3 || record.Error != "" {
+		t.Errorf("record mismatch, have %+v", record)
+	}
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/chanxuehong/wechat/corp/tokencache"
 	wechatjson "github.com/chanxuehong/wechat/json"
+	"github.com/chanxuehong/wechat/util"
 )
 
 // Client 封装了主动请求功能
@@ -22,6 +23,8 @@ type Client struct {
 
 	tokenCache tokencache.TokenCache
 	httpClient *http.Client
+
+	archiveStore util.ArchiveStore
 }
 
 // 创建一个新的 Client.
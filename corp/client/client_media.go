@@ -12,7 +12,9 @@ import (
 	"io"
 	"mime"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 
 	"github.com/chanxuehong/wechat/corp/media"
@@ -126,25 +128,48 @@ func (c *Client) MediaUploadFileFromReader(filename string, mediaReader io.Reade
 
 // 下载多媒体文件
 func (c *Client) MediaDownload(mediaId, filepath_ string) (err error) {
+	_, err = c.MediaDownloadWithInfo(mediaId, filepath_)
+	return
+}
+
+// 下载多媒体文件
+func (c *Client) MediaDownloadToWriter(mediaId string, writer io.Writer) (err error) {
+	_, err = c.MediaDownloadToWriterWithInfo(mediaId, writer)
+	return
+}
+
+// 下载多媒体文件, 同时返回文件的类型, 名称和大小.
+//  如果 mediaId 对应的是视频文件, 会继续下载微信服务器返回的 video_url.
+func (c *Client) MediaDownloadWithInfo(mediaId, filepath_ string) (info *media.DownloadInfo, err error) {
 	file, err := os.Create(filepath_)
 	if err != nil {
 		return
 	}
 	defer file.Close()
 
-	return c.mediaDownloadToWriter(mediaId, file)
+	return c.MediaDownloadToWriterWithInfo(mediaId, file)
 }
 
-// 下载多媒体文件
-func (c *Client) MediaDownloadToWriter(mediaId string, writer io.Writer) error {
+// 下载多媒体文件, 同时返回文件的类型, 名称和大小.
+//  如果 mediaId 对应的是视频文件, 会继续下载微信服务器返回的 video_url.
+func (c *Client) MediaDownloadToWriterWithInfo(mediaId string, writer io.Writer) (info *media.DownloadInfo, err error) {
 	if writer == nil {
-		return errors.New("writer == nil")
+		err = errors.New("writer == nil")
+		return
 	}
-	return c.mediaDownloadToWriter(mediaId, writer)
+
+	err = c.mediaDownload(mediaId, func(fileInfo *media.DownloadInfo, body io.Reader) (err error) {
+		info = fileInfo
+		info.Size, err = io.Copy(writer, body)
+		return
+	})
+	return
 }
 
-// 下载多媒体文件.
-func (c *Client) mediaDownloadToWriter(mediaId string, writer io.Writer) (err error) {
+// 下载多媒体文件, 成功获取到文件内容时调用 fn 处理.
+//  微信服务器返回的 json 有两种: 错误信息和视频文件的 video_url;
+//  前者转换为 *Error 返回, 后者会继续下载 video_url 的内容.
+func (c *Client) mediaDownload(mediaId string, fn func(info *media.DownloadInfo, body io.Reader) error) (err error) {
 	token, err := c.Token()
 	if err != nil {
 		return
@@ -162,21 +187,25 @@ RETRY:
 		return fmt.Errorf("http.Status: %s", httpResp.Status)
 	}
 
-	contentType, _, _ := mime.ParseMediaType(httpResp.Header.Get("Content-Type"))
-	if contentType != "text/plain" && contentType != "application/json" {
-		_, err = io.Copy(writer, httpResp.Body)
-		return
+	if !isJSONContentType(httpResp.Header.Get("Content-Type")) {
+		return fn(newMediaDownloadInfo(httpResp), httpResp.Body)
 	}
 
-	// 返回的是错误信息
-	var result Error
+	// 返回的是错误信息或者视频文件的下载地址
+	var result struct {
+		Error
+		VideoURL string `json:"video_url"`
+	}
 	if err = json.NewDecoder(httpResp.Body).Decode(&result); err != nil {
 		return
 	}
 
 	switch result.ErrCode {
 	case errCodeOK:
-		return
+		if result.VideoURL == "" {
+			return errors.New("unexpected media response: no video_url")
+		}
+		return c.mediaDownloadVideo(result.VideoURL, fn)
 	case errCodeTimeout, errCodeInvalidCredential:
 		if !hasRetry {
 			hasRetry = true
@@ -188,7 +217,49 @@ RETRY:
 		}
 		fallthrough
 	default:
-		err = &result
+		err = &result.Error
 		return
 	}
 }
+
+// 下载视频文件
+func (c *Client) mediaDownloadVideo(videoURL string, fn func(info *media.DownloadInfo, body io.Reader) error) (err error) {
+	httpResp, err := c.httpClient.Get(videoURL)
+	if err != nil {
+		return
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("http.Status: %s", httpResp.Status)
+	}
+
+	info := newMediaDownloadInfo(httpResp)
+	info.VideoURL = videoURL
+	if info.Filename == "" {
+		if u, err := url.Parse(videoURL); err == nil {
+			if name := path.Base(u.Path); name != "/" && name != "." {
+				info.Filename = name
+			}
+		}
+	}
+	return fn(info, httpResp.Body)
+}
+
+// 微信服务器返回 json 的时候 Content-Type 可能是 text/plain 也可能是 application/json
+func isJSONContentType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "text/plain" || mediaType == "application/json"
+}
+
+// 从 http 响应的头部获取文件信息
+func newMediaDownloadInfo(httpResp *http.Response) *media.DownloadInfo {
+	info := &media.DownloadInfo{
+		ContentType: httpResp.Header.Get("Content-Type"),
+		Size:        httpResp.ContentLength,
+	}
+	if _, params, err := mime.ParseMediaType(httpResp.Header.Get("Content-Disposition")); err == nil {
+		info.Filename = params["filename"]
+	}
+	return info
+}
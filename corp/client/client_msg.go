@@ -7,6 +7,7 @@ package client
 
 import (
 	"errors"
+	"time"
 
 	"github.com/chanxuehong/wechat/corp/message/active/common"
 )
@@ -74,6 +75,10 @@ func (c *Client) MsgSendMPNews(msg *common.MPNews) (result *common.Result, err e
 }
 
 func (c *Client) msgSend(msg interface{}) (result *common.Result, err error) {
+	if c.archiveStore != nil {
+		defer func(start time.Time) { c.archiveSend(msg, start, err) }(time.Now())
+	}
+
 	var resultx struct {
 		Error
 		common.Result
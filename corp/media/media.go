@@ -11,3 +11,11 @@ type MediaInfo struct {
 	MediaId   string `json:"media_id"`   // 媒体文件上传后获取的唯一标识
 	CreatedAt int64  `json:"created_at"` // 媒体文件上传时间戳
 }
+
+// 下载多媒体文件时的文件信息
+type DownloadInfo struct {
+	ContentType string // 文件的 MIME 类型, 如 image/jpeg
+	Filename    string // 文件名称, 从 Content-Disposition 中获取, 可能为空
+	Size        int64  // 文件大小(字节); 下载完成前如果微信服务器没有返回 Content-Length 则为 -1
+	VideoURL    string // 视频文件的下载地址, 只有视频文件才有
+}
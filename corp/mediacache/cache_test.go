@@ -0,0 +1,69 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package mediacache
+
+import (
+	"crypto/sha1"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/wechat/corp/client"
+	"github.com/chanxuehong/wechat/corp/media"
+	"github.com/chanxuehong/wechat/corp/tokencache"
+	"github.com/chanxuehong/wechat/wechattest"
+)
+
+const uploadPath = "/cgi-bin/media/upload"
+
+func TestCacheUpload(t *testing.T) {
+	srv := wechattest.NewServer(nil)
+	defer srv.Close()
+
+	clt := client.NewClient(srv.CorpId(), srv.CorpSecret(), new(tokencache.DefaultTokenCache), srv.Client())
+	storage := NewMemoryStorage()
+	cache := NewCache(clt, storage, 0)
+
+	info1, err := cache.MediaUploadImageFromReader("a.jpg", strings.NewReader("content-a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info2, err := cache.MediaUploadImageFromReader("b.jpg", strings.NewReader("content-a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info1.MediaId != info2.MediaId || srv.Calls(uploadPath) != 1 {
+		t.Errorf("same content uploaded twice: %s, %s", info1.MediaId, info2.MediaId)
+	}
+
+	// 相同内容不同类型
+	if _, err = cache.MediaUploadFileFromReader("a.jpg", strings.NewReader("content-a")); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Calls(uploadPath); n != 2 {
+		t.Errorf("upload calls: have %d, want 2", n)
+	}
+
+	// 快要过期的记录需要重新上传
+	key := cacheKey(media.MEDIA_TYPE_IMAGE, sha1Sum("content-a"))
+	storage.Put(key, &media.MediaInfo{
+		MediaType: media.MEDIA_TYPE_IMAGE,
+		MediaId:   "OLD_MEDIA_ID",
+		CreatedAt: time.Now().Unix() - MediaExpiresIn + 60,
+	})
+	info3, err := cache.MediaUploadImageFromReader("a.jpg", strings.NewReader("content-a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info3.MediaId == "OLD_MEDIA_ID" || srv.Calls(uploadPath) != 3 {
+		t.Errorf("expiring media_id was reused: %s", info3.MediaId)
+	}
+}
+
+func sha1Sum(s string) []byte {
+	sum := sha1.Sum([]byte(s))
+	return sum[:]
+}
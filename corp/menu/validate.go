@@ -0,0 +1,96 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package menu
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 检查菜单是否符合微信的规则，有效返回 nil，否则返回第一个错误:
+//  1. 一级菜单 1~3 个, 二级菜单 1~5 个, 二级菜单不能再有子菜单;
+//  2. 一级菜单标题不超过16个字节, 二级菜单标题不超过40个字节;
+//  3. view 类型的按钮必须有 url, 不超过256字节; 其他类型的按钮必须有 key, 不超过128字节.
+func (menu *Menu) Validate() (err error) {
+	n := len(menu.Buttons)
+	if n <= 0 {
+		return errors.New("菜单是空的")
+	}
+	if n > MenuButtonCountLimit {
+		return fmt.Errorf("一级菜单最多 %d 个, 现在为 %d", MenuButtonCountLimit, n)
+	}
+
+	for i := range menu.Buttons {
+		btn := &menu.Buttons[i]
+		path := fmt.Sprintf("button[%d]", i)
+
+		if err = btn.checkName(path, MenuButtonNameLenLimit); err != nil {
+			return
+		}
+		if len(btn.SubButtons) == 0 {
+			if err = btn.checkAction(path); err != nil {
+				return
+			}
+			continue
+		}
+
+		if n := len(btn.SubButtons); n > SubMenuButtonCountLimit {
+			return fmt.Errorf("%s: 二级菜单最多 %d 个, 现在为 %d", path, SubMenuButtonCountLimit, n)
+		}
+		for j := range btn.SubButtons {
+			subBtn := &btn.SubButtons[j]
+			subPath := fmt.Sprintf("%s.sub_button[%d]", path, j)
+
+			if err = subBtn.checkName(subPath, SubMenuButtonNameLenLimit); err != nil {
+				return
+			}
+			if len(subBtn.SubButtons) > 0 {
+				return fmt.Errorf("%s: 二级菜单不能再有子菜单", subPath)
+			}
+			if err = subBtn.checkAction(subPath); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+func (btn *Button) checkName(path string, lenLimit int) (err error) {
+	if btn.Name == "" {
+		return fmt.Errorf("%s: 菜单标题是空的", path)
+	}
+	if n := len(btn.Name); n > lenLimit {
+		return fmt.Errorf("%s: 菜单标题 %q 不能超过 %d 个字节, 现在为 %d", path, btn.Name, lenLimit, n)
+	}
+	return
+}
+
+// 检查没有子菜单的按钮的类型和对应的 key, url
+func (btn *Button) checkAction(path string) (err error) {
+	switch btn.Type {
+	case BUTTON_TYPE_VIEW:
+		if btn.URL == "" {
+			return fmt.Errorf("%s: view 类型的按钮 url 不能为空", path)
+		}
+		if n := len(btn.URL); n > ButtonURLLenLimit {
+			return fmt.Errorf("%s: url 不能超过 %d 个字节, 现在为 %d", path, ButtonURLLenLimit, n)
+		}
+	case BUTTON_TYPE_CLICK, BUTTON_TYPE_SCANCODE_PUSH, BUTTON_TYPE_SCANCODE_WAITMSG,
+		BUTTON_TYPE_PIC_SYSPHOTO, BUTTON_TYPE_PIC_PHOTO_OR_ALBUM, BUTTON_TYPE_PIC_WEIXIN,
+		BUTTON_TYPE_LOCATION_SELECT:
+		if btn.Key == "" {
+			return fmt.Errorf("%s: %s 类型的按钮 key 不能为空", path, btn.Type)
+		}
+		if n := len(btn.Key); n > ButtonKeyLenLimit {
+			return fmt.Errorf("%s: key 不能超过 %d 个字节, 现在为 %d", path, ButtonKeyLenLimit, n)
+		}
+	case "":
+		return fmt.Errorf("%s: 没有子菜单的按钮必须指定类型", path)
+	default:
+		return fmt.Errorf("%s: 未知的按钮类型 %q", path, btn.Type)
+	}
+	return
+}
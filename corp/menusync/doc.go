@@ -0,0 +1,8 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+// 自定义菜单的声明式同步.
+//  从 json 或者 yaml 文件加载菜单, 和线上的菜单比较, 只有在有差异的时候才调用 MenuCreate.
+package menusync
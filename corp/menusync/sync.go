@@ -0,0 +1,57 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package menusync
+
+import (
+	"errors"
+
+	"github.com/chanxuehong/wechat/corp/client"
+	"github.com/chanxuehong/wechat/corp/menu"
+)
+
+const errCodeMenuNotExist = 46003 // 不存在的菜单数据
+
+// 把应用 agentId 线上的菜单同步为 menu_.
+//  先调用 MenuGet 获取线上的菜单(没有菜单时当作空菜单), 计算差异;
+//  有差异并且 dryRun == false 时调用 MenuCreate, 没有差异时不调用.
+//  返回的 diff 是线上菜单到 menu_ 的差异, 格式见 menu.Diff.
+func Sync(clt *client.Client, agentId int64, menu_ *menu.Menu, dryRun bool) (diff []string, err error) {
+	if clt == nil {
+		err = errors.New("clt == nil")
+		return
+	}
+	if menu_ == nil {
+		err = errors.New("menu_ == nil")
+		return
+	}
+	if err = menu_.Validate(); err != nil {
+		return
+	}
+
+	current, err := clt.MenuGet(agentId)
+	if err != nil {
+		if clientErr, ok := err.(*client.Error); !ok || clientErr.ErrCode != errCodeMenuNotExist {
+			return
+		}
+		current, err = menu.Menu{}, nil
+	}
+
+	diff = menu.Diff(&current, menu_)
+	if len(diff) == 0 || dryRun {
+		return
+	}
+	err = clt.MenuCreate(*menu_, agentId)
+	return
+}
+
+// 从文件加载菜单并同步, 见 LoadFile 和 Sync.
+func SyncFile(clt *client.Client, agentId int64, filename string, dryRun bool) (diff []string, err error) {
+	menu_, err := LoadFile(filename)
+	if err != nil {
+		return
+	}
+	return Sync(clt, agentId, menu_, dryRun)
+}
@@ -0,0 +1,35 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"github.com/chanxuehong/wechat/util"
+)
+
+// 可选的接口, Agent 实现了这个接口并且 GetAESKeyRing 返回的不是 nil 的时候,
+// 用 AESKeyRing 里所有有效的 key 解密消息, 不再使用 GetAESKey, 这样更换 EncodingAESKey 的时候不会丢失消息.
+type AESKeyRingAgent interface {
+	GetAESKeyRing() *util.AESKeyRing
+}
+
+// 获取 agent 的 AESKeyRing, 没有则返回 nil
+func getAESKeyRing(agent Agent) *util.AESKeyRing {
+	if ringAgent, ok := agent.(AESKeyRingAgent); ok {
+		return ringAgent.GetAESKeyRing()
+	}
+	return nil
+}
+
+// 解密消息, index 是解密所用的 key 的序号, 同 Context.AESKeyIndex
+func decryptMsg(encryptedMsg []byte, agent Agent) (random, rawXMLMsg []byte, AESKey [32]byte, index int, err error) {
+	if ring := getAESKeyRing(agent); ring != nil {
+		return ring.Decrypt(encryptedMsg, agent.GetCorpId())
+	}
+
+	AESKey = agent.GetAESKey()
+	random, rawXMLMsg, err = util.AESDecryptMsg(encryptedMsg, agent.GetCorpId(), AESKey)
+	return
+}
@@ -0,0 +1,90 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/wechat/util"
+)
+
+func TestAESKeyRingRotation(t *testing.T) {
+	const corpId, token = "wx0123456789abcdef", "token"
+
+	ring, err := util.NewAESKeyRingFromEncoded("abcdefghijklmnopqrstuvwxyz0123456789ABCDEFG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKey := ring.Current()
+	if err = ring.RotateEncoded("ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789abcdefg", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	var agent DefaultAgent
+	agent.InitWithAESKeyRing(corpId, 1, token, ring)
+
+	var keyIndex int
+	mux := NewServeMux(&agent)
+	mux.OnText(func(ctx *Context) {
+		keyIndex = ctx.AESKeyIndex
+		ctx.ReplyText("pong")
+	})
+	// 通过 AgentHandler 注册的 ServeMux 收到的是同一个 Context
+	outer := NewServeMux(&agent)
+	outer.SetFallback(AgentHandler(mux))
+
+	for _, frontend := range []*AgentFrontend{NewAgentFrontend(mux, nil), NewAgentFrontend(outer, nil)} {
+		keyIndex = 0
+		testAESKeyRingRotation(t, frontend, oldKey)
+		if keyIndex != 1 {
+			t.Errorf("AESKeyIndex = %d, want 1", keyIndex)
+		}
+	}
+}
+
+func testAESKeyRingRotation(t *testing.T, frontend *AgentFrontend, oldKey [32]byte) {
+	const corpId, token = "wx0123456789abcdef", "token"
+
+	// 用旧的 key 加密的消息
+	random := bytes.Repeat([]byte("r"), 16)
+	rawXMLMsg := "<xml><ToUserName>" + corpId + "</ToUserName><FromUserName>zhangsan</FromUserName>" +
+		"<CreateTime>1</CreateTime><MsgType>text</MsgType><Content>ping</Content><MsgId>1</MsgId><AgentID>1</AgentID></xml>"
+	encryptedMsg := base64.StdEncoding.EncodeToString(util.AESEncryptMsg(random, []byte(rawXMLMsg), corpId, oldKey))
+
+	query := url.Values{
+		"msg_signature": {util.MsgSign(token, "1", "1", encryptedMsg)},
+		"timestamp":     {"1"},
+		"nonce":         {"1"},
+	}
+	body := "<xml><ToUserName>" + corpId + "</ToUserName><AgentID>1</AgentID><Encrypt>" + encryptedMsg + "</Encrypt></xml>"
+	w := httptest.NewRecorder()
+	frontend.ServeHTTP(w, httptest.NewRequest("POST", "/?"+query.Encode(), bytes.NewBufferString(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("code = %d, body = %s", w.Code, w.Body)
+	}
+
+	// 回复用解密消息的 key 加密
+	var resp struct {
+		Encrypt string `xml:"Encrypt"`
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	encryptedResp, err := base64.StdEncoding.DecodeString(resp.Encrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = util.AESDecryptMsg(encryptedResp, corpId, oldKey); err != nil {
+		t.Errorf("decrypt reply with old key: %v", err)
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"errors"
 	"net/http"
 	"net/url"
+
+	"github.com/chanxuehong/wechat/util"
 )
 
 // Agent 的前端, 负责处理 http 请求, net/http.Handler 的实现
@@ -16,6 +18,7 @@ import (
 type AgentFrontend struct {
 	agent                 Agent
 	invalidRequestHandler InvalidRequestHandler
+	options               serveOptions
 }
 
 // 创建一个新的 AgentFrontend.
@@ -34,9 +37,67 @@ func NewAgentFrontend(agent Agent, invalidRequestHandler InvalidRequestHandler)
 	}
 }
 
+// 开启重复消息过滤, 微信服务器重试推送的消息直接回复空串, 不再交给 Agent 处理.
+//  store 为 nil 则使用 util.NewLRUDedupStore(util.DefaultDedupStoreSize, util.DefaultDedupTTL);
+//  NOTE: 要在开始处理消息之前调用, 不是并发安全的.
+func (this *AgentFrontend) EnableDedup(store util.DedupStore) {
+	if store == nil {
+		store = util.NewLRUDedupStore(util.DefaultDedupStoreSize, util.DefaultDedupTTL)
+	}
+	this.options.dedupStore = store
+}
+
+// 开启重放攻击防护, 拒绝时间戳超出允许范围或者 nonce 已经使用过的请求,
+// 交给 InvalidRequestHandler 处理, 这时的 err 是 *util.ReplayError.
+//  guard 为 nil 则使用 util.NewReplayGuard(util.DefaultReplayWindow, nil);
+//  NOTE: 要在开始处理消息之前调用, 不是并发安全的.
+func (this *AgentFrontend) EnableReplayGuard(guard *util.ReplayGuard) {
+	if guard == nil {
+		guard = util.NewReplayGuard(util.DefaultReplayWindow, nil)
+	}
+	this.options.replayGuard = guard
+}
+
+// 开启统计, 把每一个消息(事件)的类型, 是否加密, 处理时间, 回复的字节数和非法请求的原因报告给 metrics,
+// 比如 util.NewPrometheusMetrics 返回的 *util.PrometheusMetrics. metrics 为 nil 则关闭统计.
+//  NOTE: 要在开始处理消息之前调用, 不是并发安全的.
+func (this *AgentFrontend) EnableMetrics(metrics util.ServerMetrics) {
+	this.options.metrics = metrics
+}
+
+// 把每一个通过校验并且解密的消息(事件)发布到 publisher, 然后再交给 Agent 处理, 用于在其他的服务里异步处理消息;
+// 微信服务器重试推送的消息(开启了 EnableDedup)不会重复发布. publisher 为 nil 则不发布.
+//  NOTE: 要在开始处理消息之前调用, 不是并发安全的.
+func (this *AgentFrontend) EnablePublisher(publisher util.Publisher) {
+	this.options.publisher = publisher
+}
+
+// 开启消息存档, 把每一个通过校验并且解密的消息(事件), 回复和处理时间存档到 store,
+// 比如 util.NewFileArchiveStore 返回的 *util.FileArchiveStore. store 为 nil 则关闭存档.
+//  NOTE: 要在开始处理消息之前调用, 不是并发安全的.
+func (this *AgentFrontend) EnableArchive(store util.ArchiveStore) {
+	this.options.archiveStore = store
+}
+
+// 添加中间件, 先添加的在外层; 每一个通过校验并且解密的消息(事件)先经过中间件再交给 Agent 处理,
+// 所以不用把 Agent 换成 ServeMux 也可以使用 Recover, Logger 等中间件.
+//  Agent 是 *ServeMux 的时候, 中间件的 Context 会直接交给 ServeMux, 然后再经过 ServeMux.Use 添加的中间件.
+//  NOTE: 要在开始处理消息之前调用, 不是并发安全的.
+func (this *AgentFrontend) Use(middlewares ...Middleware) {
+	for _, middleware := range middlewares {
+		if middleware == nil {
+			panic("middleware == nil")
+		}
+	}
+	this.options.middlewares = append(this.options.middlewares, middlewares...)
+}
+
 func (this *AgentFrontend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	agent := this.agent
 	invalidRequestHandler := this.invalidRequestHandler
+	if this.options.metrics != nil {
+		invalidRequestHandler = metricsInvalidRequestHandler{invalidRequestHandler, this.options.metrics}
+	}
 
 	if r.URL == nil {
 		err := errors.New("input net/http.Request.URL == nil")
@@ -50,5 +111,5 @@ func (this *AgentFrontend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ServeHTTP(w, r, urlValues, agent, invalidRequestHandler)
+	serveHTTP(w, r, urlValues, agent, invalidRequestHandler, this.options)
 }
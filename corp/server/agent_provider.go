@@ -0,0 +1,172 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// 按需加载 Agent, 比如运行中才接入的企业号应用从数据库里读取配置.
+// MultiAgentFrontend 在 SetAgent 设置的 Agent 里找不到的时候调用.
+type AgentProvider interface {
+	// 获取 agentkey 对应的 Agent, 不存在返回 nil, nil; 返回错误的时候交给 InvalidRequestHandler 处理.
+	GetAgent(agentkey string) (agent Agent, err error)
+}
+
+type AgentProviderFunc func(agentkey string) (agent Agent, err error)
+
+func (fn AgentProviderFunc) GetAgent(agentkey string) (agent Agent, err error) {
+	return fn(agentkey)
+}
+
+const DefaultAgentCacheSize = 1000 // 默认的 CachedAgentProvider 容量
+
+// 不存在的 agentkey 的最长缓存时间, 这样新接入的企业号应用最多一分钟以后就能加载到
+const agentMissTTL = time.Minute
+
+type cachedAgent struct {
+	agentkey string
+	agent    Agent // 可能为 nil, 表示不存在
+	expireAt time.Time
+}
+
+// 带缓存的 AgentProvider, 并发安全.
+//  provider 返回的 Agent 缓存 ttl 时间, 最多缓存 size 个, 超过的时候淘汰最近最少使用的.
+//  不存在的 agentkey(provider 返回 nil)单独缓存, 最多也是 size 个, 有效期不超过一分钟,
+//  这样大量不存在的 agentkey 不会把已经加载的 Agent 挤出缓存; provider 返回的错误不缓存.
+//  过期的缓存在下次获取或者被淘汰的时候删除, 不需要定期清理.
+type CachedAgentProvider struct {
+	provider AgentProvider
+	ttl      time.Duration
+	missTTL  time.Duration
+
+	mutex  sync.Mutex
+	agents *agentLRU // provider 加载到的 Agent
+	misses *agentLRU // 不存在的 agentkey
+}
+
+// 创建一个新的 CachedAgentProvider, provider 不能为 nil, ttl 要大于 0.
+//  size <= 0 则使用 DefaultAgentCacheSize.
+func NewCachedAgentProvider(provider AgentProvider, size int, ttl time.Duration) *CachedAgentProvider {
+	if provider == nil {
+		panic("provider == nil")
+	}
+	if ttl <= 0 {
+		panic("ttl must be positive")
+	}
+	if size <= 0 {
+		size = DefaultAgentCacheSize
+	}
+
+	missTTL := ttl
+	if missTTL > agentMissTTL {
+		missTTL = agentMissTTL
+	}
+	return &CachedAgentProvider{
+		provider: provider,
+		ttl:      ttl,
+		missTTL:  missTTL,
+		agents:   newAgentLRU(size),
+		misses:   newAgentLRU(size),
+	}
+}
+
+func (p *CachedAgentProvider) GetAgent(agentkey string) (agent Agent, err error) {
+	now := time.Now()
+
+	p.mutex.Lock()
+	entry := p.agents.get(agentkey, now)
+	if entry == nil {
+		entry = p.misses.get(agentkey, now)
+	}
+	p.mutex.Unlock()
+	if entry != nil {
+		return entry.agent, nil
+	}
+
+	// 不持有锁调用 provider, 并发的请求可能会重复加载
+	if agent, err = p.provider.GetAgent(agentkey); err != nil {
+		return
+	}
+
+	p.mutex.Lock()
+	if agent != nil {
+		p.misses.remove(agentkey)
+		p.agents.add(&cachedAgent{agentkey: agentkey, agent: agent, expireAt: now.Add(p.ttl)})
+	} else {
+		p.agents.remove(agentkey)
+		p.misses.add(&cachedAgent{agentkey: agentkey, expireAt: now.Add(p.missTTL)})
+	}
+	p.mutex.Unlock()
+	return
+}
+
+// 删除 agentkey 的缓存, 比如修改了企业号应用的配置之后调用.
+func (p *CachedAgentProvider) Invalidate(agentkey string) {
+	p.mutex.Lock()
+	p.agents.remove(agentkey)
+	p.misses.remove(agentkey)
+	p.mutex.Unlock()
+}
+
+// CachedAgentProvider 使用的 LRU 缓存, 不是并发安全的.
+type agentLRU struct {
+	size    int
+	list    *list.List               // 元素是 *cachedAgent, 最近使用的在前面
+	entries map[string]*list.Element // map[agentkey]element
+}
+
+func newAgentLRU(size int) *agentLRU {
+	return &agentLRU{
+		size:    size,
+		list:    list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// 获取没有过期的缓存, 没有则返回 nil; 过期的缓存顺便删除.
+func (c *agentLRU) get(agentkey string, now time.Time) *cachedAgent {
+	elem := c.entries[agentkey]
+	if elem == nil {
+		return nil
+	}
+	entry := elem.Value.(*cachedAgent)
+	if !now.Before(entry.expireAt) {
+		c.list.Remove(elem)
+		delete(c.entries, agentkey)
+		return nil
+	}
+	c.list.MoveToFront(elem)
+	return entry
+}
+
+func (c *agentLRU) add(entry *cachedAgent) {
+	if elem := c.entries[entry.agentkey]; elem != nil {
+		elem.Value = entry
+		c.list.MoveToFront(elem)
+		return
+	}
+
+	c.entries[entry.agentkey] = c.list.PushFront(entry)
+	for c.list.Len() > c.size {
+		elem := c.list.Back()
+		c.list.Remove(elem)
+		delete(c.entries, elem.Value.(*cachedAgent).agentkey)
+	}
+}
+
+func (c *agentLRU) remove(agentkey string) {
+	if elem := c.entries[agentkey]; elem != nil {
+		c.list.Remove(elem)
+		delete(c.entries, agentkey)
+	}
+}
+
+func (c *agentLRU) len() int {
+	return c.list.Len()
+}
@@ -0,0 +1,129 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/wechat/corp/message/passive/response"
+	"github.com/chanxuehong/wechat/corp/simulator"
+)
+
+func TestMultiAgentFrontendRouting(t *testing.T) {
+	const corpId, token = "wx0123456789abcdef", "token"
+	AESKey := bytes.Repeat([]byte("k"), 32)
+
+	loads := 0
+	provider := NewCachedAgentProvider(AgentProviderFunc(func(agentkey string) (Agent, error) {
+		loads++
+		agentId, err := strconv.ParseInt(agentkey[strings.LastIndex(agentkey, ":")+1:], 10, 64)
+		if err != nil {
+			return nil, nil
+		}
+		agent := new(DefaultAgent)
+		agent.Init(corpId, agentId, token, AESKey)
+		mux := NewServeMux(agent)
+		mux.SetFallback(HandlerFunc(func(ctx *Context) {
+			ctx.ReplyText(strconv.FormatInt(ctx.AgentId, 10))
+		}))
+		return mux, nil
+	}), 0, time.Minute)
+
+	var frontend MultiAgentFrontend
+	frontend.SetAgentProvider(provider)
+	srv := httptest.NewServer(&frontend)
+	defer srv.Close()
+
+	send := func(url string, agentId int64) (string, error) {
+		s := simulator.NewSimulator(url, token, corpId, AESKey)
+		reply, err := s.Send("text", &simulator.Params{AgentId: agentId})
+		if err != nil {
+			return "", err
+		}
+		var text response.Text
+		if err = xml.Unmarshal(reply.RawXMLMsg, &text); err != nil {
+			t.Fatal(err)
+		}
+		return text.Content, nil
+	}
+
+	frontend.SetRouteMode(RouteByPath)
+	if got, err := send(srv.URL+"/wx/2", 2); err != nil || got != "2" {
+		t.Errorf("RouteByPath: reply = %q, %v", got, err)
+	}
+	if _, err := send(srv.URL+"/wx/x", 2); err == nil {
+		t.Error("unknown agent: err = nil")
+	}
+
+	frontend.SetRouteMode(RouteByToUserName)
+	for i := 0; i < 2; i++ {
+		if got, err := send(srv.URL, 3); err != nil || got != "3" {
+			t.Errorf("RouteByToUserName: reply = %q, %v", got, err)
+		}
+	}
+	if loads != 3 {
+		t.Errorf("provider loads = %d, want 3", loads)
+	}
+}
+
+func TestCachedAgentProvider(t *testing.T) {
+	loads := make(map[string]int)
+	provider := NewCachedAgentProvider(AgentProviderFunc(func(agentkey string) (Agent, error) {
+		loads[agentkey]++
+		if strings.HasPrefix(agentkey, "unknown") {
+			return nil, nil
+		}
+		return new(DefaultAgent), nil
+	}), 2, time.Minute)
+
+	get := func(agentkey string, wantAgent bool) {
+		agent, err := provider.GetAgent(agentkey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (agent != nil) != wantAgent {
+			t.Fatalf("GetAgent(%q) = %v", agentkey, agent)
+		}
+	}
+
+	get("a", true)
+	get("b", true)
+	get("a", true) // a 是最近使用的
+	for i := 0; i < 10; i++ {
+		get("unknown"+strconv.Itoa(i), false) // 不存在的 agentkey 不会挤出 a, b
+	}
+	get("a", true)
+	get("b", true)
+	if loads["a"] != 1 || loads["b"] != 1 {
+		t.Errorf("loads = %v, want a, b loaded once", loads)
+	}
+	if n := provider.misses.len(); n != 2 {
+		t.Errorf("misses.len() = %d, want 2", n)
+	}
+
+	get("c", true) // 淘汰最近最少使用的 a
+	get("b", true)
+	get("a", true)
+	if loads["a"] != 2 || loads["b"] != 1 || loads["c"] != 1 {
+		t.Errorf("loads = %v, want a twice, b and c once", loads)
+	}
+	if n := provider.agents.len(); n != 2 {
+		t.Errorf("agents.len() = %d, want 2", n)
+	}
+
+	// 过期的缓存在下次获取的时候删除
+	provider.agents.get("a", time.Now()).expireAt = time.Now()
+	get("a", true)
+	if loads["a"] != 3 {
+		t.Errorf(`loads["a"] = %d, want 3`, loads["a"])
+	}
+}
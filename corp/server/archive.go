@@ -0,0 +1,77 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/chanxuehong/wechat/corp/message/passive/request"
+	"github.com/chanxuehong/wechat/corp/message/passive/response"
+	"github.com/chanxuehong/wechat/util"
+)
+
+// 调用 serve 处理消息 msgReq, 然后把消息, 回复和处理时间存档到 archiveStore, 出错的时候只记录日志.
+//  archiveStore 为 nil 则直接调用 serve(w). 回复用 AESKey 解密以后存档 "明文" 回复.
+func archiveServe(archiveStore util.ArchiveStore, msgReq *request.Request, rawXMLMsg []byte,
+	AESKey [32]byte, CorpId string, w http.ResponseWriter, serve func(w http.ResponseWriter)) {
+
+	if archiveStore == nil {
+		serve(w)
+		return
+	}
+
+	reply, latency := util.CaptureServe(w, serve)
+
+	msgJSON, err := json.Marshal(msgReq)
+	if err != nil {
+		log.Printf("wechat: encode %s message from %s failed: %v", msgReq.MsgType, msgReq.FromUserName, err)
+		return
+	}
+	record := &util.ArchiveRecord{
+		Direction:  util.ArchiveInbound,
+		Source:     metricsSource,
+		AccountId:  msgReq.ToUserName,
+		AgentId:    msgReq.AgentId,
+		OpenId:     msgReq.FromUserName,
+		MsgType:    msgReq.MsgType,
+		Event:      msgReq.Event,
+		MsgId:      msgReq.MsgId,
+		CreateTime: msgReq.CreateTime,
+		RawXMLMsg:  string(rawXMLMsg),
+		Msg:        msgJSON,
+		Reply:      string(reply),
+		Latency:    latency,
+		ArchivedAt: time.Now(),
+	}
+	if len(reply) > 0 {
+		record.ReplyXML = string(decryptReply(reply, CorpId, AESKey))
+	}
+	if err = archiveStore.Append(record); err != nil {
+		log.Printf("wechat: archive %s message from %s failed: %v", msgReq.MsgType, msgReq.FromUserName, err)
+	}
+}
+
+// 解密回复 reply, 失败返回 nil
+func decryptReply(reply []byte, CorpId string, AESKey [32]byte) []byte {
+	var responseHttpBody response.ResponseHttpBody
+	if err := xml.Unmarshal(reply, &responseHttpBody); err != nil {
+		return nil
+	}
+	EncryptedMsg, err := base64.StdEncoding.DecodeString(responseHttpBody.EncryptedMsg)
+	if err != nil {
+		return nil
+	}
+	_, rawXMLMsg, err := util.AESDecryptMsg(EncryptedMsg, CorpId, AESKey)
+	if err != nil {
+		return nil
+	}
+	return rawXMLMsg
+}
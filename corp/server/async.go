@@ -0,0 +1,250 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/chanxuehong/wechat/corp/message/active/common"
+	"github.com/chanxuehong/wechat/corp/message/passive/response"
+)
+
+const (
+	// 默认等待被动回复的时间, 微信服务器 5 秒内收不到回复会断开连接并重试
+	DefaultAsyncTimeout    = 4 * time.Second
+	DefaultAsyncMaxWorkers = 1000 // 默认同时在后台处理的消息的最大数量
+)
+
+// 发送消息, *client.Client 实现了这个接口.
+type MsgSender interface {
+	MsgSendText(msg *common.Text) (*common.Result, error)
+	MsgSendImage(msg *common.Image) (*common.Result, error)
+	MsgSendVoice(msg *common.Voice) (*common.Result, error)
+	MsgSendVideo(msg *common.Video) (*common.Result, error)
+	MsgSendNews(msg *common.News) (*common.Result, error)
+}
+
+type AsyncOptions struct {
+	Timeout    time.Duration // 等待被动回复的时间, 默认为 DefaultAsyncTimeout
+	MaxWorkers int           // 同时在后台处理的消息的最大数量, 默认为 DefaultAsyncMaxWorkers; 超过的消息直接在当前 goroutine 里同步处理
+
+	// 超时后通过发送消息接口发送回复失败, 或者 handler panic 的时候调用, 后者 msg == nil;
+	// 为 nil 则用 log.Printf 记录错误.
+	OnError func(ctx *Context, msg interface{}, err error)
+}
+
+// 异步回复模式, 解决处理时间超过微信服务器 5 秒限制的问题.
+// handler 在后台的 goroutine 里处理消息, 如果 Timeout 之内回复了消息则正常的被动回复;
+// 否则先回复空串结束 http 请求, handler 之后调用 Context.Reply 回复的消息通过 sender 以主动消息发送给 Context.AgentId 应用的用户.
+//  NOTE:
+//  1. 只有通过 Context.Reply 回复的消息超时后才能转为主动消息, 直接写 Context.ResponseWriter 的数据超时后被丢弃;
+//  2. Async 后面的中间件和 handler 在后台的 goroutine 里运行, 前面的中间件看到的是 Async 返回的时候的状态,
+//     所以 Recover 要放在 Async 的后面才能恢复 handler 的 panic, Async 自己也会恢复 panic 并报告给 OnError.
+func Async(sender MsgSender, opts *AsyncOptions) Middleware {
+	if sender == nil {
+		panic("sender == nil")
+	}
+
+	var options AsyncOptions
+	if opts != nil {
+		options = *opts
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultAsyncTimeout
+	}
+	if options.MaxWorkers <= 0 {
+		options.MaxWorkers = DefaultAsyncMaxWorkers
+	}
+	if options.OnError == nil {
+		options.OnError = func(ctx *Context, msg interface{}, err error) {
+			log.Printf("wechat: async reply to %s failed: %v", ctx.FromUserName, err)
+		}
+	}
+	workers := make(chan struct{}, options.MaxWorkers)
+
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx *Context) {
+			select {
+			case workers <- struct{}{}:
+			default: // 后台处理的消息太多, 同步处理
+				next.ServeMsg(ctx)
+				return
+			}
+
+			w := ctx.ResponseWriter
+			state := &asyncState{
+				sender:  sender,
+				onError: options.OnError,
+				writer:  &asyncResponseWriter{header: make(http.Header)},
+			}
+			state.writer.state = state
+			ctx.ResponseWriter = state.writer
+			ctx.async = state
+
+			done := make(chan struct{})
+			go func() {
+				defer func() {
+					if v := recover(); v != nil {
+						options.OnError(ctx, nil, fmt.Errorf("panic: %v", v))
+					}
+					<-workers
+					close(done)
+				}()
+				next.ServeMsg(ctx)
+			}()
+
+			timedOut := false
+			timer := time.NewTimer(options.Timeout)
+			select {
+			case <-done:
+				timer.Stop()
+			case <-timer.C:
+				timedOut = true
+			}
+
+			// 之后 handler 写的数据都被丢弃, Context.Reply 改为发送主动消息
+			state.mutex.Lock()
+			state.finished = true
+			code := state.writer.code
+			body := state.writer.buf.Bytes()
+			state.mutex.Unlock()
+
+			// 超时的时候 handler 可能还在修改之前通过 Header() 拿到的 map, 不能读取, 丢弃 header
+			if !timedOut {
+				for k, v := range state.writer.header {
+					w.Header()[k] = v
+				}
+			}
+			if code != 0 {
+				w.WriteHeader(code)
+			}
+			if len(body) > 0 {
+				w.Write(body)
+			}
+		})
+	}
+}
+
+type asyncState struct {
+	mutex    sync.Mutex
+	finished bool // http 请求是否已经结束
+	writer   *asyncResponseWriter
+
+	sender  MsgSender
+	onError func(ctx *Context, msg interface{}, err error)
+}
+
+// 被动回复或者 http 请求结束后通过发送消息接口发送
+func (state *asyncState) reply(ctx *Context, msg interface{}) (err error) {
+	state.mutex.Lock()
+	if !state.finished {
+		err = ctx.writeReply(&state.writer.buf, msg)
+		state.mutex.Unlock()
+		return
+	}
+	state.mutex.Unlock()
+
+	if err = sendMsg(state.sender, ctx.AgentId, msg); err != nil {
+		state.onError(ctx, msg, err)
+	}
+	return
+}
+
+// 缓存 handler 写的数据, http 请求结束后丢弃
+type asyncResponseWriter struct {
+	state  *asyncState
+	header http.Header
+	code   int
+	buf    bytes.Buffer
+}
+
+// http 请求结束后返回一个丢弃的 map
+func (w *asyncResponseWriter) Header() http.Header {
+	w.state.mutex.Lock()
+	defer w.state.mutex.Unlock()
+
+	if w.state.finished {
+		return make(http.Header)
+	}
+	return w.header
+}
+
+func (w *asyncResponseWriter) WriteHeader(code int) {
+	w.state.mutex.Lock()
+	if !w.state.finished && w.code == 0 {
+		w.code = code
+	}
+	w.state.mutex.Unlock()
+}
+
+func (w *asyncResponseWriter) Write(p []byte) (int, error) {
+	w.state.mutex.Lock()
+	defer w.state.mutex.Unlock()
+
+	if w.state.finished {
+		return 0, fmt.Errorf("wechat: the http request has finished, data discarded")
+	}
+	return w.buf.Write(p)
+}
+
+// 把被动回复的消息转换为主动消息, 通过 agentId 应用发送给 msg 的接收方
+func sendMsg(sender MsgSender, agentId int64, msg interface{}) (err error) {
+	switch msg := msg.(type) {
+	case *response.Text:
+		var text common.Text
+		text.ToUser = msg.ToUserName
+		text.MsgType = common.MSG_TYPE_TEXT
+		text.AgentId = agentId
+		text.Text.Content = msg.Content
+		_, err = sender.MsgSendText(&text)
+	case *response.Image:
+		var image common.Image
+		image.ToUser = msg.ToUserName
+		image.MsgType = common.MSG_TYPE_IMAGE
+		image.AgentId = agentId
+		image.Image.MediaId = msg.Image.MediaId
+		_, err = sender.MsgSendImage(&image)
+	case *response.Voice:
+		var voice common.Voice
+		voice.ToUser = msg.ToUserName
+		voice.MsgType = common.MSG_TYPE_VOICE
+		voice.AgentId = agentId
+		voice.Voice.MediaId = msg.Voice.MediaId
+		_, err = sender.MsgSendVoice(&voice)
+	case *response.Video:
+		var video common.Video
+		video.ToUser = msg.ToUserName
+		video.MsgType = common.MSG_TYPE_VIDEO
+		video.AgentId = agentId
+		video.Video.MediaId = msg.Video.MediaId
+		video.Video.Title = msg.Video.Title
+		video.Video.Description = msg.Video.Description
+		_, err = sender.MsgSendVideo(&video)
+	case *response.News:
+		var news common.News
+		news.ToUser = msg.ToUserName
+		news.MsgType = common.MSG_TYPE_NEWS
+		news.AgentId = agentId
+		news.News.Articles = make([]common.NewsArticle, len(msg.Articles))
+		for i := range msg.Articles {
+			news.News.Articles[i] = common.NewsArticle{
+				Title:       msg.Articles[i].Title,
+				Description: msg.Articles[i].Description,
+				URL:         msg.Articles[i].URL,
+				PicURL:      msg.Articles[i].PicURL,
+			}
+		}
+		_, err = sender.MsgSendNews(&news)
+	default:
+		err = fmt.Errorf("can not send %T as active message", msg)
+	}
+	return
+}
@@ -0,0 +1,74 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/wechat/corp/message/active/common"
+	"github.com/chanxuehong/wechat/corp/message/passive/request"
+)
+
+type asyncTestSender struct {
+	texts chan *common.Text
+}
+
+func (s *asyncTestSender) MsgSendText(msg *common.Text) (*common.Result, error) {
+	s.texts <- msg
+	return &common.Result{}, nil
+}
+func (s *asyncTestSender) MsgSendImage(msg *common.Image) (*common.Result, error) { return nil, nil }
+func (s *asyncTestSender) MsgSendVoice(msg *common.Voice) (*common.Result, error) { return nil, nil }
+func (s *asyncTestSender) MsgSendVideo(msg *common.Video) (*common.Result, error) { return nil, nil }
+func (s *asyncTestSender) MsgSendNews(msg *common.News) (*common.Result, error)   { return nil, nil }
+
+func TestAsync(t *testing.T) {
+	const corpId, token = "wx0123456789abcdef", "token"
+	AESKey := bytes.Repeat([]byte("k"), 32)
+
+	var agent DefaultAgent
+	agent.Init(corpId, 1, token, AESKey)
+
+	sender := &asyncTestSender{texts: make(chan *common.Text, 1)}
+	mux := NewServeMux(&agent)
+	mux.Use(Async(sender, &AsyncOptions{Timeout: 50 * time.Millisecond}))
+	mux.OnText(func(ctx *Context) {
+		content := ctx.Msg.(*request.Text).Content
+		if content == "slow" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		ctx.ReplyText(content + " done")
+	})
+
+	serve := func(content string) string {
+		w := httptest.NewRecorder()
+		msg := &request.Text{Content: content}
+		msg.FromUserName = "zhangsan"
+		msg.ToUserName = corpId
+		msg.MsgType = request.MSG_TYPE_TEXT
+		msg.AgentId = 2
+		mux.ServeTextMsg(w, nil, msg, nil, time.Now().Unix(), "nonce", make([]byte, 16))
+		return w.Body.String()
+	}
+
+	if body := serve("fast"); body == "" {
+		t.Error("fast reply is empty")
+	}
+	if body := serve("slow"); body != "" {
+		t.Errorf("slow reply = %q, want empty", body)
+	}
+	select {
+	case text := <-sender.texts:
+		if text.ToUser != "zhangsan" || text.AgentId != 2 || text.MsgType != common.MSG_TYPE_TEXT || text.Text.Content != "slow done" {
+			t.Errorf("active msg = %+v", text)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("active msg not sent")
+	}
+}
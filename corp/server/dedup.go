@@ -0,0 +1,29 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"strconv"
+
+	"github.com/chanxuehong/wechat/corp/message/passive/request"
+	"github.com/chanxuehong/wechat/util"
+)
+
+// 消息去重的 key, 普通消息用 MsgId, 事件用 FromUserName + CreateTime + Event.
+//  NOTE: 都加上了 CorpId 和 AgentId 前缀, 这样多个应用可以共用一个 DedupStore.
+func msgDedupKey(msg *request.Request) string {
+	prefix := msg.ToUserName + ":" + strconv.FormatInt(msg.AgentId, 10) + ":"
+	if msg.MsgType != request.MSG_TYPE_EVENT && msg.MsgId != 0 {
+		return prefix + strconv.FormatInt(msg.MsgId, 10)
+	}
+	return prefix + msg.FromUserName + ":" + strconv.FormatInt(msg.CreateTime, 10) + ":" + msg.Event
+}
+
+// 判断 msg 是否是微信服务器重试推送的消息, store 出错的时候当作不重复的消息.
+func isDuplicateMsg(store util.DedupStore, msg *request.Request) bool {
+	added, err := store.Add(msgDedupKey(msg))
+	return err == nil && !added
+}
@@ -0,0 +1,78 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chanxuehong/wechat/corp/simulator"
+)
+
+func TestDedup(t *testing.T) {
+	const corpId, token = "wx0123456789abcdef", "token"
+	AESKey := bytes.Repeat([]byte("k"), 32)
+
+	agent := new(DefaultAgent)
+	agent.Init(corpId, 1, token, AESKey)
+	var count int
+	mux := NewServeMux(agent)
+	mux.SetFallback(HandlerFunc(func(ctx *Context) {
+		count++
+		ctx.ReplyText("ok")
+	}))
+
+	var frontend MultiAgentFrontend
+	frontend.SetAgent("a", mux)
+	frontend.EnableDedup("a", nil)
+	srv := httptest.NewServer(&frontend)
+	defer srv.Close()
+
+	s := simulator.NewSimulator(srv.URL+"?agentkey=a", token, corpId, AESKey)
+	for _, kind := range []string{"text", "event.CLICK"} {
+		rawXMLMsg, err := simulator.BuildMsg(kind, &simulator.Params{ToUserName: corpId})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ { // 模拟微信服务器重试
+			reply, err := s.Post(rawXMLMsg)
+			if err != nil {
+				t.Fatalf("%s: %v", kind, err)
+			}
+			if i > 0 && len(reply.Body) != 0 {
+				t.Errorf("%s: duplicate reply = %q, want empty", kind, reply.Body)
+			}
+		}
+	}
+	if count != 2 {
+		t.Errorf("count = %d, want 2", count)
+	}
+
+	frontend.DeleteAgent("a")
+	frontend.SetAgent("a", mux) // 重新添加的 Agent 没有开启过滤
+	rawXMLMsg, _ := simulator.BuildMsg("text", &simulator.Params{ToUserName: corpId, MsgId: 1})
+	s.Post(rawXMLMsg)
+	s.Post(rawXMLMsg)
+	if count != 4 {
+		t.Errorf("count = %d, want 4", count)
+	}
+
+	// 默认的过滤对没有单独开启过滤的 Agent 和 AgentProvider 加载的 Agent 都有效
+	frontend.EnableDefaultDedup(nil)
+	frontend.SetAgentProvider(AgentProviderFunc(func(agentkey string) (Agent, error) {
+		return mux, nil
+	}))
+	for i, url := range []string{srv.URL + "?agentkey=a", srv.URL + "?agentkey=b"} {
+		s := simulator.NewSimulator(url, token, corpId, AESKey)
+		rawXMLMsg, _ := simulator.BuildMsg("text", &simulator.Params{ToUserName: corpId, MsgId: int64(i + 2)})
+		s.Post(rawXMLMsg)
+		s.Post(rawXMLMsg)
+	}
+	if count != 6 {
+		t.Errorf("count = %d, want 6", count)
+	}
+}
@@ -9,15 +9,20 @@ import (
 	"net/http"
 
 	"github.com/chanxuehong/wechat/corp/message/passive/request"
+	"github.com/chanxuehong/wechat/util"
 )
 
 var _ Agent = new(DefaultAgent)
+var _ AESKeyRingAgent = new(DefaultAgent)
 
 type DefaultAgent struct {
 	CorpId  string
 	AgentId int64
 	Token   string
 	AESKey  [32]byte
+
+	// 不为 nil 的时候用 AESKeyRing 里所有有效的 key 解密消息, 忽略 AESKey
+	AESKeyRing *util.AESKeyRing
 }
 
 func (this *DefaultAgent) Init(CorpId string, AgentId int64, Token string, AESKey []byte) {
@@ -30,6 +35,19 @@ func (this *DefaultAgent) Init(CorpId string, AgentId int64, Token string, AESKe
 	copy(this.AESKey[:], AESKey)
 }
 
+// 用 AESKeyRing 初始化 DefaultAgent, ring 不能为 nil, 比如:
+//  ring, err := util.NewAESKeyRingFromEncoded(EncodingAESKey) // 43 个字符的 EncodingAESKey
+//  agent.InitWithAESKeyRing(CorpId, AgentId, Token, ring)
+func (this *DefaultAgent) InitWithAESKeyRing(CorpId string, AgentId int64, Token string, ring *util.AESKeyRing) {
+	if ring == nil {
+		panic("ring == nil")
+	}
+	this.CorpId = CorpId
+	this.AgentId = AgentId
+	this.Token = Token
+	this.AESKeyRing = ring
+}
+
 func (this *DefaultAgent) GetCorpId() string {
 	return this.CorpId
 }
@@ -40,8 +58,14 @@ func (this *DefaultAgent) GetToken() string {
 	return this.Token
 }
 func (this *DefaultAgent) GetAESKey() [32]byte {
+	if this.AESKeyRing != nil {
+		return this.AESKeyRing.Current()
+	}
 	return this.AESKey
 }
+func (this *DefaultAgent) GetAESKeyRing() *util.AESKeyRing {
+	return this.AESKeyRing
+}
 
 func (this *DefaultAgent) ServeUnknownMsg(w http.ResponseWriter, r *http.Request, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
 }
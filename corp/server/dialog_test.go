@@ -0,0 +1,87 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/chanxuehong/wechat/corp/message/passive/request"
+	"github.com/chanxuehong/wechat/corp/message/passive/response"
+	"github.com/chanxuehong/wechat/corp/simulator"
+	"github.com/chanxuehong/wechat/util"
+)
+
+func TestDialog(t *testing.T) {
+	const corpId, token = "wx0123456789abcdef", "token"
+	AESKey := bytes.Repeat([]byte("k"), 32)
+
+	dir, err := ioutil.TempDir("", "wechat-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var agent DefaultAgent
+	agent.Init(corpId, 1, token, AESKey)
+
+	leave := &Dialog{
+		Name: "leave",
+		Steps: []DialogStep{
+			{Name: "days", Prompt: "days?"},
+			{Name: "photo", Prompt: "photo?", Input: request.MSG_TYPE_IMAGE},
+		},
+		CancelKeywords: []string{"cancel"},
+		OnComplete: func(ctx *Context, values map[string]string) {
+			ctx.ReplyText(values["days"] + " " + values["photo"])
+		},
+	}
+
+	mux := NewServeMux(&agent)
+	mux.Use(Sessions(util.NewFileSessionStore(dir), 0), Dialogs(leave))
+	mux.OnText(func(ctx *Context) {
+		if ctx.Msg.(*request.Text).Content == "leave" {
+			leave.Start(ctx)
+			return
+		}
+		ctx.ReplyText("menu")
+	})
+
+	srv := httptest.NewServer(NewAgentFrontend(mux, nil))
+	defer srv.Close()
+
+	s := simulator.NewSimulator(srv.URL, token, corpId, AESKey)
+	expect := func(kind string, params *simulator.Params, want string) {
+		reply, err := s.Send(kind, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var text response.Text
+		if len(reply.RawXMLMsg) > 0 {
+			if err = xml.Unmarshal(reply.RawXMLMsg, &text); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if text.Content != want {
+			t.Fatalf("reply = %q, want %q", text.Content, want)
+		}
+	}
+
+	expect("text", &simulator.Params{Content: "leave"}, "days?")
+	expect("text", &simulator.Params{Content: "hi", FromUserName: "lisi"}, "menu") // 不同用户的会话是独立的
+	expect("text", &simulator.Params{Content: "3"}, "photo?")
+	expect("text", &simulator.Params{Content: "3"}, "photo?")
+	expect("image", nil, "3 media_id")
+	expect("text", &simulator.Params{Content: "hi"}, "menu")
+
+	expect("text", &simulator.Params{Content: "leave"}, "days?")
+	expect("text", &simulator.Params{Content: "CANCEL"}, "")
+	expect("text", &simulator.Params{Content: "hi"}, "menu")
+}
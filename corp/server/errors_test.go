@@ -0,0 +1,70 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/chanxuehong/wechat/util"
+)
+
+func TestInvalidRequestErrors(t *testing.T) {
+	const corpId, token = "wx0123456789abcdef", "token"
+
+	var agent DefaultAgent
+	agent.Init(corpId, 1, token, bytes.Repeat([]byte("k"), 32))
+
+	var lastErr error
+	frontend := NewAgentFrontend(&agent, InvalidRequestHandlerFunc(func(w http.ResponseWriter, r *http.Request, err error) {
+		lastErr = err
+		DefaultInvalidRequestHandler.ServeInvalidRequest(w, r, err)
+	}))
+
+	post := func(msgSignature, body string) int {
+		query := url.Values{"msg_signature": {msgSignature}, "timestamp": {"1"}, "nonce": {"1"}}
+		lastErr = nil
+		w := httptest.NewRecorder()
+		frontend.ServeHTTP(w, httptest.NewRequest("POST", "/?"+query.Encode(), bytes.NewBufferString(body)))
+		return w.Code
+	}
+
+	body := "<xml><ToUserName>" + corpId + "</ToUserName><AgentID>1</AgentID><Encrypt>AAAA</Encrypt></xml>"
+	if code := post(util.MsgSign(token, "1", "1", "BBBB"), body); code != http.StatusForbidden {
+		t.Errorf("bad signature: code = %d", code)
+	}
+	if _, ok := lastErr.(*SignatureError); !ok {
+		t.Errorf("bad signature: err = %#v", lastErr)
+	}
+
+	if code := post(util.MsgSign(token, "1", "1", "AAAA"), body); code != http.StatusBadRequest {
+		t.Errorf("decrypt: code = %d", code)
+	}
+	if _, ok := lastErr.(*DecryptError); !ok {
+		t.Errorf("decrypt: err = %#v", lastErr)
+	}
+
+	body = "<xml><ToUserName>" + corpId + "</ToUserName><AgentID>2</AgentID><Encrypt>AAAA</Encrypt></xml>"
+	post(util.MsgSign(token, "1", "1", "AAAA"), body)
+	if err, ok := lastErr.(*MismatchError); !ok || err.Field != "AgentId" || err.Have != "2" || err.Want != "1" {
+		t.Errorf("AgentId mismatch: err = %#v", lastErr)
+	}
+
+	// AESKey 正确, 但是加密的 CorpId 不一致
+	encryptedMsg := base64.StdEncoding.EncodeToString(util.AESEncryptMsg(make([]byte, 16),
+		[]byte("<xml></xml>"), "wxfedcba9876543210", agent.GetAESKey()))
+	body = "<xml><ToUserName>" + corpId + "</ToUserName><AgentID>1</AgentID><Encrypt>" + encryptedMsg + "</Encrypt></xml>"
+	if code := post(util.MsgSign(token, "1", "1", encryptedMsg), body); code != http.StatusForbidden {
+		t.Errorf("CorpId mismatch: code = %d", code)
+	}
+	if err, ok := lastErr.(*MismatchError); !ok || err.Field != "CorpId" || err.Have != "wxfedcba9876543210" || err.Want != corpId {
+		t.Errorf("CorpId mismatch: err = %#v", lastErr)
+	}
+}
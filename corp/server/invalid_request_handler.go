@@ -7,6 +7,8 @@ package server
 
 import (
 	"net/http"
+
+	"github.com/chanxuehong/wechat/util"
 )
 
 type InvalidRequestHandler interface {
@@ -20,4 +22,42 @@ func (fn InvalidRequestHandlerFunc) ServeInvalidRequest(w http.ResponseWriter, r
 	fn(w, r, err)
 }
 
-var DefaultInvalidRequestHandler InvalidRequestHandler = InvalidRequestHandlerFunc(func(w http.ResponseWriter, r *http.Request, err error) {})
+// 默认的 InvalidRequestHandler, 根据 InvalidRequestStatusCode(err) 回复 http 状态码.
+var DefaultInvalidRequestHandler InvalidRequestHandler = InvalidRequestHandlerFunc(func(w http.ResponseWriter, r *http.Request, err error) {
+	code := InvalidRequestStatusCode(err)
+	http.Error(w, http.StatusText(code), code)
+})
+
+// 非法请求的错误 err 对应的 http 状态码:
+//  *SignatureError, *MismatchError, *util.ReplayError 为 403,
+//  *DecryptError, *TimestampError, *XMLError 和其他错误为 400.
+func InvalidRequestStatusCode(err error) int {
+	switch err.(type) {
+	case *SignatureError, *MismatchError, *util.ReplayError:
+		return http.StatusForbidden
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// 非法请求的错误 err 对应的原因, 用于统计:
+//  *SignatureError 为 "signature", *DecryptError 为 "decrypt", *MismatchError 为 "mismatch",
+//  *TimestampError 为 "timestamp", *XMLError 为 "xml", *util.ReplayError 为 "replay", 其他错误为 "other".
+func InvalidRequestReason(err error) string {
+	switch err.(type) {
+	case *SignatureError:
+		return "signature"
+	case *DecryptError:
+		return "decrypt"
+	case *MismatchError:
+		return "mismatch"
+	case *TimestampError:
+		return "timestamp"
+	case *XMLError:
+		return "xml"
+	case *util.ReplayError:
+		return "replay"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,298 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/chanxuehong/wechat/corp/menu"
+	"github.com/chanxuehong/wechat/corp/message/passive/request"
+)
+
+// 菜单事件, 传递给 MenuEventHandler 的参数.
+type MenuEvent struct {
+	Type string // 事件类型, request.EVENT_TYPE_CLICK, request.EVENT_TYPE_SCANCODE_PUSH 等
+	Key  string // 事件KEY值, 对于 VIEW 事件是跳转的 URL
+
+	// 成功解析的事件结构体, 根据 Type 的不同分别是
+	// *request.MenuClickEvent, *request.MenuViewEvent, *request.MenuScanCodePushEvent,
+	// *request.MenuScanCodeWaitMsgEvent, *request.MenuPicSysPhotoEvent,
+	// *request.MenuPicPhotoOrAlbumEvent, *request.MenuPicWeixinEvent, *request.MenuLocationSelectEvent
+	Event interface{}
+
+	RawXMLMsg []byte // 解密后的"明文" xml 消息体
+	Timestamp int64  // 请求 URL 中的时间戳
+	Nonce     string // 请求 URL 中的随机数
+	Random    []byte // 请求 http body 中的密文消息加密时所用的 random, 16 bytes
+}
+
+type MenuEventHandler interface {
+	// 菜单事件的处理方法
+	//  r *http.Request 的 Body 已经读取过了, 不要再读取了, 但是可以获取其他信息, 比如 r.URL.RawQuery
+	ServeMenuEvent(w http.ResponseWriter, r *http.Request, event *MenuEvent)
+}
+
+type MenuEventHandlerFunc func(w http.ResponseWriter, r *http.Request, event *MenuEvent)
+
+func (fn MenuEventHandlerFunc) ServeMenuEvent(w http.ResponseWriter, r *http.Request, event *MenuEvent) {
+	fn(w, r, event)
+}
+
+type menuRoute struct {
+	prefix  string
+	handler MenuEventHandler
+}
+
+// 菜单事件路由器, 包装一个 Agent, 根据 事件类型 和 按钮的 KEY 把菜单事件分发给注册的 MenuEventHandler,
+// 其他消息(事件)直接由被包装的 Agent 处理.
+//  NOTE:
+//  1. 所有的 Handle 都要在开始处理消息之前完成, MenuRouter 注册的方法不是并发安全的;
+//  2. 找不到对应的 handler 时调用 fallback, 没有设置 fallback 则调用被包装的 Agent 的对应方法.
+type MenuRouter struct {
+	Agent
+
+	exact    map[string]map[string]MenuEventHandler // map[eventType]map[key]handler
+	prefix   map[string][]menuRoute                 // map[eventType][]menuRoute, 按 prefix 长度从长到短排序
+	fallback MenuEventHandler
+}
+
+// 创建一个新的 MenuRouter, agent 不能为 nil.
+func NewMenuRouter(agent Agent) *MenuRouter {
+	if agent == nil {
+		panic("agent == nil")
+	}
+
+	return &MenuRouter{
+		Agent:  agent,
+		exact:  make(map[string]map[string]MenuEventHandler),
+		prefix: make(map[string][]menuRoute),
+	}
+}
+
+// 注册 eventType 类型, KEY 为 key 的菜单事件的处理函数.
+//  eventType 是 request.EVENT_TYPE_CLICK, request.EVENT_TYPE_VIEW 等菜单事件类型;
+//  key 以 * 结尾表示前缀匹配, 比如 "V1001_*" 匹配所有以 "V1001_" 开头的 KEY, "*" 匹配所有的 KEY;
+//  精确匹配优先于前缀匹配, 多个前缀都匹配时最长的前缀优先.
+func (router *MenuRouter) Handle(eventType, key string, handler MenuEventHandler) {
+	if !isMenuEventType(eventType) {
+		panic(fmt.Sprintf("不是菜单事件类型: %q", eventType))
+	}
+	if key == "" {
+		panic(`key == ""`)
+	}
+	if handler == nil {
+		panic("handler == nil")
+	}
+
+	if strings.HasSuffix(key, "*") {
+		prefix := key[:len(key)-1]
+		routes := router.prefix[eventType]
+		for _, route := range routes {
+			if route.prefix == prefix {
+				panic(fmt.Sprintf("重复注册: %s %q", eventType, key))
+			}
+		}
+
+		// 插入排序, 保持 prefix 从长到短
+		i := len(routes)
+		for i > 0 && len(routes[i-1].prefix) < len(prefix) {
+			i--
+		}
+		routes = append(routes, menuRoute{})
+		copy(routes[i+1:], routes[i:])
+		routes[i] = menuRoute{prefix: prefix, handler: handler}
+		router.prefix[eventType] = routes
+		return
+	}
+
+	m := router.exact[eventType]
+	if m == nil {
+		m = make(map[string]MenuEventHandler)
+		router.exact[eventType] = m
+	}
+	if _, ok := m[key]; ok {
+		panic(fmt.Sprintf("重复注册: %s %q", eventType, key))
+	}
+	m[key] = handler
+}
+
+// 同 MenuRouter.Handle.
+func (router *MenuRouter) HandleFunc(eventType, key string, handler func(http.ResponseWriter, *http.Request, *MenuEvent)) {
+	if handler == nil {
+		panic("handler == nil")
+	}
+	router.Handle(eventType, key, MenuEventHandlerFunc(handler))
+}
+
+// 设置找不到对应 handler 时的处理函数, handler == nil 表示调用被包装的 Agent 的对应方法.
+func (router *MenuRouter) SetFallback(handler MenuEventHandler) {
+	router.fallback = handler
+}
+
+// 查找 eventType, key 对应的 handler, 没有找到返回 nil, 不包括 fallback.
+func (router *MenuRouter) Lookup(eventType, key string) MenuEventHandler {
+	if handler := router.exact[eventType][key]; handler != nil {
+		return handler
+	}
+	for _, route := range router.prefix[eventType] {
+		if strings.HasPrefix(key, route.prefix) {
+			return route.handler
+		}
+	}
+	return nil
+}
+
+// 检查菜单 menu_ 里所有需要推送事件的按钮都注册了 handler, 一般在启动的时候调用, 确保菜单和 handler 一致.
+//  NOTE: view 类型的按钮只是跳转 URL, 不检查; fallback 不算注册了 handler.
+func (router *MenuRouter) CheckMenu(menu_ *menu.Menu) error {
+	if menu_ == nil {
+		return errors.New("menu == nil")
+	}
+
+	var missing []string
+	check := func(path string, btn *menu.Button) {
+		if btn.Type == "" || btn.Type == menu.BUTTON_TYPE_VIEW {
+			return
+		}
+		eventType := menuButtonEventType(btn.Type)
+		if eventType == "" {
+			missing = append(missing, fmt.Sprintf("%s: 未知的按钮类型 %q", path, btn.Type))
+			return
+		}
+		if router.Lookup(eventType, btn.Key) == nil {
+			missing = append(missing, fmt.Sprintf("%s: %s %q", path, eventType, btn.Key))
+		}
+	}
+	for i := 0; i < len(menu_.Buttons); i++ {
+		btn := &menu_.Buttons[i]
+		path := fmt.Sprintf("button[%d]", i)
+		check(path, btn)
+		for j := 0; j < len(btn.SubButtons); j++ {
+			check(fmt.Sprintf("%s.sub_button[%d]", path, j), &btn.SubButtons[j])
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("下列菜单按钮没有注册 handler: %s", strings.Join(missing, "; "))
+	}
+	return nil
+}
+
+// 分发菜单事件, 找不到 handler 并且没有设置 fallback 返回 false.
+func (router *MenuRouter) dispatch(w http.ResponseWriter, r *http.Request, event *MenuEvent) bool {
+	handler := router.Lookup(event.Type, event.Key)
+	if handler == nil {
+		if handler = router.fallback; handler == nil {
+			return false
+		}
+	}
+	handler.ServeMenuEvent(w, r, event)
+	return true
+}
+
+// 菜单按钮类型对应的事件类型, 不是推送事件的按钮类型返回 "".
+func menuButtonEventType(buttonType string) string {
+	switch buttonType {
+	case menu.BUTTON_TYPE_CLICK:
+		return request.EVENT_TYPE_CLICK
+	case menu.BUTTON_TYPE_VIEW:
+		return request.EVENT_TYPE_VIEW
+	case menu.BUTTON_TYPE_SCANCODE_PUSH:
+		return request.EVENT_TYPE_SCANCODE_PUSH
+	case menu.BUTTON_TYPE_SCANCODE_WAITMSG:
+		return request.EVENT_TYPE_SCANCODE_WAITMSG
+	case menu.BUTTON_TYPE_PIC_SYSPHOTO:
+		return request.EVENT_TYPE_PIC_SYSPHOTO
+	case menu.BUTTON_TYPE_PIC_PHOTO_OR_ALBUM:
+		return request.EVENT_TYPE_PIC_PHOTO_OR_ALBUM
+	case menu.BUTTON_TYPE_PIC_WEIXIN:
+		return request.EVENT_TYPE_PIC_WEIXIN
+	case menu.BUTTON_TYPE_LOCATION_SELECT:
+		return request.EVENT_TYPE_LOCATION_SELECT
+	default:
+		return ""
+	}
+}
+
+func isMenuEventType(eventType string) bool {
+	switch eventType {
+	case request.EVENT_TYPE_CLICK,
+		request.EVENT_TYPE_VIEW,
+		request.EVENT_TYPE_SCANCODE_PUSH,
+		request.EVENT_TYPE_SCANCODE_WAITMSG,
+		request.EVENT_TYPE_PIC_SYSPHOTO,
+		request.EVENT_TYPE_PIC_PHOTO_OR_ALBUM,
+		request.EVENT_TYPE_PIC_WEIXIN,
+		request.EVENT_TYPE_LOCATION_SELECT:
+		return true
+	default:
+		return false
+	}
+}
+
+func newMenuEvent(eventType, key string, event interface{}, rawXMLMsg []byte, timestamp int64,
+	nonce string, random []byte) *MenuEvent {
+
+	return &MenuEvent{
+		Type:      eventType,
+		Key:       key,
+		Event:     event,
+		RawXMLMsg: rawXMLMsg,
+		Timestamp: timestamp,
+		Nonce:     nonce,
+		Random:    random,
+	}
+}
+func (router *MenuRouter) ServeMenuClickEvent(w http.ResponseWriter, r *http.Request, event *request.MenuClickEvent, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	if !router.dispatch(w, r, newMenuEvent(event.Event, event.EventKey, event, rawXMLMsg, timestamp, nonce, random)) {
+		router.Agent.ServeMenuClickEvent(w, r, event, rawXMLMsg, timestamp, nonce, random)
+	}
+}
+
+func (router *MenuRouter) ServeMenuViewEvent(w http.ResponseWriter, r *http.Request, event *request.MenuViewEvent, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	if !router.dispatch(w, r, newMenuEvent(event.Event, event.EventKey, event, rawXMLMsg, timestamp, nonce, random)) {
+		router.Agent.ServeMenuViewEvent(w, r, event, rawXMLMsg, timestamp, nonce, random)
+	}
+}
+
+func (router *MenuRouter) ServeMenuScanCodePushEvent(w http.ResponseWriter, r *http.Request, event *request.MenuScanCodePushEvent, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	if !router.dispatch(w, r, newMenuEvent(event.Event, event.EventKey, event, rawXMLMsg, timestamp, nonce, random)) {
+		router.Agent.ServeMenuScanCodePushEvent(w, r, event, rawXMLMsg, timestamp, nonce, random)
+	}
+}
+
+func (router *MenuRouter) ServeMenuScanCodeWaitMsgEvent(w http.ResponseWriter, r *http.Request, event *request.MenuScanCodeWaitMsgEvent, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	if !router.dispatch(w, r, newMenuEvent(event.Event, event.EventKey, event, rawXMLMsg, timestamp, nonce, random)) {
+		router.Agent.ServeMenuScanCodeWaitMsgEvent(w, r, event, rawXMLMsg, timestamp, nonce, random)
+	}
+}
+
+func (router *MenuRouter) ServeMenuPicSysPhotoEvent(w http.ResponseWriter, r *http.Request, event *request.MenuPicSysPhotoEvent, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	if !router.dispatch(w, r, newMenuEvent(event.Event, event.EventKey, event, rawXMLMsg, timestamp, nonce, random)) {
+		router.Agent.ServeMenuPicSysPhotoEvent(w, r, event, rawXMLMsg, timestamp, nonce, random)
+	}
+}
+
+func (router *MenuRouter) ServeMenuPicPhotoOrAlbumEvent(w http.ResponseWriter, r *http.Request, event *request.MenuPicPhotoOrAlbumEvent, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	if !router.dispatch(w, r, newMenuEvent(event.Event, event.EventKey, event, rawXMLMsg, timestamp, nonce, random)) {
+		router.Agent.ServeMenuPicPhotoOrAlbumEvent(w, r, event, rawXMLMsg, timestamp, nonce, random)
+	}
+}
+
+func (router *MenuRouter) ServeMenuPicWeixinEvent(w http.ResponseWriter, r *http.Request, event *request.MenuPicWeixinEvent, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	if !router.dispatch(w, r, newMenuEvent(event.Event, event.EventKey, event, rawXMLMsg, timestamp, nonce, random)) {
+		router.Agent.ServeMenuPicWeixinEvent(w, r, event, rawXMLMsg, timestamp, nonce, random)
+	}
+}
+
+func (router *MenuRouter) ServeMenuLocationSelectEvent(w http.ResponseWriter, r *http.Request, event *request.MenuLocationSelectEvent, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	if !router.dispatch(w, r, newMenuEvent(event.Event, event.EventKey, event, rawXMLMsg, timestamp, nonce, random)) {
+		router.Agent.ServeMenuLocationSelectEvent(w, r, event, rawXMLMsg, timestamp, nonce, random)
+	}
+}
@@ -0,0 +1,92 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/chanxuehong/wechat/corp/menu"
+	"github.com/chanxuehong/wechat/corp/message/passive/request"
+)
+
+type menuRouterTestAgent struct {
+	DefaultAgent
+	clicked []string
+}
+
+func (this *menuRouterTestAgent) ServeMenuClickEvent(w http.ResponseWriter, r *http.Request, event *request.MenuClickEvent, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	this.clicked = append(this.clicked, event.EventKey)
+}
+
+func TestMenuRouterDispatch(t *testing.T) {
+	var agent menuRouterTestAgent
+	router := NewMenuRouter(&agent)
+
+	var got []string
+	handler := func(name string) func(http.ResponseWriter, *http.Request, *MenuEvent) {
+		return func(w http.ResponseWriter, r *http.Request, event *MenuEvent) {
+			got = append(got, name+":"+event.Key)
+		}
+	}
+	router.HandleFunc(request.EVENT_TYPE_CLICK, "V1001_GOOD", handler("exact"))
+	router.HandleFunc(request.EVENT_TYPE_CLICK, "V1001_*", handler("v1001"))
+	router.HandleFunc(request.EVENT_TYPE_CLICK, "V1001_MUSIC_*", handler("music"))
+	router.HandleFunc(request.EVENT_TYPE_SCANCODE_PUSH, "*", handler("scan"))
+
+	click := func(key string) {
+		event := &request.MenuClickEvent{Event: request.EVENT_TYPE_CLICK, EventKey: key}
+		router.ServeMenuClickEvent(nil, nil, event, nil, 0, "", nil)
+	}
+	click("V1001_GOOD")
+	click("V1001_MUSIC_TODAY")
+	click("V1001_OTHER")
+	click("V2001") // 没有匹配, 交给被包装的 Agent
+
+	scan := &request.MenuScanCodePushEvent{Event: request.EVENT_TYPE_SCANCODE_PUSH, EventKey: "rselfmenu_0_1"}
+	router.ServeMenuScanCodePushEvent(nil, nil, scan, nil, 0, "", nil)
+
+	want := []string{"exact:V1001_GOOD", "music:V1001_MUSIC_TODAY", "v1001:V1001_OTHER", "scan:rselfmenu_0_1"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+	if len(agent.clicked) != 1 || agent.clicked[0] != "V2001" {
+		t.Fatalf("agent.clicked = %v, want [V2001]", agent.clicked)
+	}
+
+	router.SetFallback(MenuEventHandlerFunc(handler("fallback")))
+	click("V3001")
+	if last := got[len(got)-1]; last != "fallback:V3001" {
+		t.Fatalf("got %q, want fallback:V3001", last)
+	}
+}
+
+func TestMenuRouterCheckMenu(t *testing.T) {
+	var mn menu.Menu
+	mn.Buttons = make([]menu.Button, 2)
+	mn.Buttons[0].InitToClickButton("今日歌曲", "V1001_TODAY_MUSIC")
+	mn.Buttons[1].InitToSubMenuButton("菜单", make([]menu.Button, 2))
+	mn.Buttons[1].SubButtons[0].InitToViewButton("搜索", "http://www.soso.com/")
+	mn.Buttons[1].SubButtons[1].InitToScanCodePushButton("扫码", "rselfmenu_0_1")
+
+	router := NewMenuRouter(new(DefaultAgent))
+	router.SetFallback(MenuEventHandlerFunc(func(http.ResponseWriter, *http.Request, *MenuEvent) {}))
+	router.HandleFunc(request.EVENT_TYPE_CLICK, "V1001_*", func(http.ResponseWriter, *http.Request, *MenuEvent) {})
+
+	if err := router.CheckMenu(&mn); err == nil {
+		t.Fatal("CheckMenu: expected error for button[1].sub_button[1]")
+	}
+
+	router.HandleFunc(request.EVENT_TYPE_SCANCODE_PUSH, "rselfmenu_0_1", func(http.ResponseWriter, *http.Request, *MenuEvent) {})
+	if err := router.CheckMenu(&mn); err != nil {
+		t.Fatalf("CheckMenu: %v", err)
+	}
+}
@@ -74,3 +74,66 @@ func msgDispatch(w http.ResponseWriter, r *http.Request, msg *request.Request,
 		agent.ServeUnknownMsg(w, r, rawXMLMsg, timestamp, nonce, random)
 	}
 }
+
+// 根据 MsgType 和 Event 从 msg 中取出对应的消息结构体, 和消息分路器调用 Agent 的方法时的参数一致;
+// 未知类型的消息返回 nil. 用于 Context.Msg.
+func requestMsg(msg *request.Request) interface{} {
+	switch msg.MsgType {
+	case request.MSG_TYPE_TEXT:
+		return msg.Text()
+
+	case request.MSG_TYPE_EVENT:
+		switch msg.Event {
+		case request.EVENT_TYPE_LOCATION:
+			return msg.LocationEvent()
+
+		case request.EVENT_TYPE_CLICK:
+			return msg.MenuClickEvent()
+
+		case request.EVENT_TYPE_SCANCODE_PUSH:
+			return msg.MenuScanCodePushEvent()
+
+		case request.EVENT_TYPE_SCANCODE_WAITMSG:
+			return msg.MenuScanCodeWaitMsgEvent()
+
+		case request.EVENT_TYPE_PIC_SYSPHOTO:
+			return msg.MenuPicSysPhotoEvent()
+
+		case request.EVENT_TYPE_PIC_PHOTO_OR_ALBUM:
+			return msg.MenuPicPhotoOrAlbumEvent()
+
+		case request.EVENT_TYPE_PIC_WEIXIN:
+			return msg.MenuPicWeixinEvent()
+
+		case request.EVENT_TYPE_LOCATION_SELECT:
+			return msg.MenuLocationSelectEvent()
+
+		case request.EVENT_TYPE_VIEW:
+			return msg.MenuViewEvent()
+
+		case request.EVENT_TYPE_SUBSCRIBE:
+			return msg.SubscribeEvent()
+
+		case request.EVENT_TYPE_UNSUBSCRIBE:
+			return msg.UnsubscribeEvent()
+
+		default: // unknown event type
+			return nil
+		}
+
+	case request.MSG_TYPE_VOICE:
+		return msg.Voice()
+
+	case request.MSG_TYPE_LOCATION:
+		return msg.Location()
+
+	case request.MSG_TYPE_IMAGE:
+		return msg.Image()
+
+	case request.MSG_TYPE_VIDEO:
+		return msg.Video()
+
+	default: // unknown message type
+		return nil
+	}
+}
@@ -0,0 +1,85 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/chanxuehong/wechat/corp/message/passive/request"
+)
+
+// ServeMux 的 Agent 方法都是把参数包装成 Context 然后调用 ServeMux.ServeMsg
+
+var _ Agent = new(ServeMux)
+
+func (mux *ServeMux) ServeUnknownMsg(w http.ResponseWriter, r *http.Request, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	head, event := parseUnknownMsgHead(rawXMLMsg)
+	mux.ServeMsg(mux.newContext(w, r, head, event, nil, rawXMLMsg, timestamp, nonce, random))
+}
+
+func (mux *ServeMux) ServeTextMsg(w http.ResponseWriter, r *http.Request, msg *request.Text, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	mux.ServeMsg(mux.newContext(w, r, msg.CommonHead, "", msg, rawXMLMsg, timestamp, nonce, random))
+}
+
+func (mux *ServeMux) ServeImageMsg(w http.ResponseWriter, r *http.Request, msg *request.Image, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	mux.ServeMsg(mux.newContext(w, r, msg.CommonHead, "", msg, rawXMLMsg, timestamp, nonce, random))
+}
+
+func (mux *ServeMux) ServeVoiceMsg(w http.ResponseWriter, r *http.Request, msg *request.Voice, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	mux.ServeMsg(mux.newContext(w, r, msg.CommonHead, "", msg, rawXMLMsg, timestamp, nonce, random))
+}
+
+func (mux *ServeMux) ServeVideoMsg(w http.ResponseWriter, r *http.Request, msg *request.Video, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	mux.ServeMsg(mux.newContext(w, r, msg.CommonHead, "", msg, rawXMLMsg, timestamp, nonce, random))
+}
+
+func (mux *ServeMux) ServeLocationMsg(w http.ResponseWriter, r *http.Request, msg *request.Location, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	mux.ServeMsg(mux.newContext(w, r, msg.CommonHead, "", msg, rawXMLMsg, timestamp, nonce, random))
+}
+
+func (mux *ServeMux) ServeSubscribeEvent(w http.ResponseWriter, r *http.Request, event *request.SubscribeEvent, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	mux.ServeMsg(mux.newContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp, nonce, random))
+}
+
+func (mux *ServeMux) ServeUnsubscribeEvent(w http.ResponseWriter, r *http.Request, event *request.UnsubscribeEvent, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	mux.ServeMsg(mux.newContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp, nonce, random))
+}
+
+func (mux *ServeMux) ServeLocationEvent(w http.ResponseWriter, r *http.Request, event *request.LocationEvent, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	mux.ServeMsg(mux.newContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp, nonce, random))
+}
+
+func (mux *ServeMux) ServeMenuClickEvent(w http.ResponseWriter, r *http.Request, event *request.MenuClickEvent, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	mux.ServeMsg(mux.newContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp, nonce, random))
+}
+
+func (mux *ServeMux) ServeMenuViewEvent(w http.ResponseWriter, r *http.Request, event *request.MenuViewEvent, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	mux.ServeMsg(mux.newContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp, nonce, random))
+}
+
+func (mux *ServeMux) ServeMenuScanCodePushEvent(w http.ResponseWriter, r *http.Request, event *request.MenuScanCodePushEvent, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	mux.ServeMsg(mux.newContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp, nonce, random))
+}
+
+func (mux *ServeMux) ServeMenuScanCodeWaitMsgEvent(w http.ResponseWriter, r *http.Request, event *request.MenuScanCodeWaitMsgEvent, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	mux.ServeMsg(mux.newContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp, nonce, random))
+}
+
+func (mux *ServeMux) ServeMenuPicSysPhotoEvent(w http.ResponseWriter, r *http.Request, event *request.MenuPicSysPhotoEvent, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	mux.ServeMsg(mux.newContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp, nonce, random))
+}
+
+func (mux *ServeMux) ServeMenuPicPhotoOrAlbumEvent(w http.ResponseWriter, r *http.Request, event *request.MenuPicPhotoOrAlbumEvent, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	mux.ServeMsg(mux.newContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp, nonce, random))
+}
+
+func (mux *ServeMux) ServeMenuPicWeixinEvent(w http.ResponseWriter, r *http.Request, event *request.MenuPicWeixinEvent, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	mux.ServeMsg(mux.newContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp, nonce, random))
+}
+
+func (mux *ServeMux) ServeMenuLocationSelectEvent(w http.ResponseWriter, r *http.Request, event *request.MenuLocationSelectEvent, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	mux.ServeMsg(mux.newContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp, nonce, random))
+}
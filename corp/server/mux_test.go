@@ -0,0 +1,172 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"bytes"
+	"encoding/xml"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chanxuehong/wechat/corp/message/passive/request"
+	"github.com/chanxuehong/wechat/corp/message/passive/response"
+	"github.com/chanxuehong/wechat/corp/simulator"
+)
+
+type muxTestAgent struct {
+	DefaultAgent
+	clicks int
+}
+
+func (this *muxTestAgent) ServeMenuClickEvent(w http.ResponseWriter, r *http.Request, event *request.MenuClickEvent, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	this.clicks++
+}
+
+func TestServeMux(t *testing.T) {
+	const corpId, token = "wx0123456789abcdef", "token"
+	AESKey := bytes.Repeat([]byte("k"), 32)
+
+	var agent muxTestAgent
+	agent.Init(corpId, 1, token, AESKey)
+
+	var logBuf bytes.Buffer
+	mux := NewServeMux(&agent)
+	mux.Use(RequestId(), Logger(log.New(&logBuf, "", 0)), Recover(func(*Context, interface{}, []byte) {}))
+	mux.OnText(func(ctx *Context) {
+		content := ctx.Msg.(*request.Text).Content
+		if content == "panic" {
+			panic(content)
+		}
+		ctx.ReplyText("echo: " + content)
+	})
+	mux.OnEvent(request.EVENT_TYPE_SUBSCRIBE, func(ctx *Context) {
+		ctx.Reply(response.NewText(ctx.FromUserName, ctx.ToUserName, "welcome", ctx.Timestamp))
+	})
+
+	srv := httptest.NewServer(NewAgentFrontend(mux, nil))
+	defer srv.Close()
+
+	s := simulator.NewSimulator(srv.URL, token, corpId, AESKey)
+	send := func(kind string, params *simulator.Params) *simulator.Reply {
+		reply, err := s.Send(kind, params)
+		if err != nil {
+			t.Fatalf("%s: %v", kind, err)
+		}
+		return reply
+	}
+	replyContent := func(reply *simulator.Reply) string {
+		var text response.Text
+		if err := xml.Unmarshal(reply.RawXMLMsg, &text); err != nil {
+			t.Fatalf("%v, reply: %s", err, reply.Body)
+		}
+		return text.Content
+	}
+
+	if got := replyContent(send("text", &simulator.Params{FromUserName: "zhangsan", Content: "hi"})); got != "echo: hi" {
+		t.Errorf("text reply = %q", got)
+	}
+	if got := replyContent(send("event.subscribe", nil)); got != "welcome" {
+		t.Errorf("subscribe reply = %q", got)
+	}
+	send("event.CLICK", nil) // 交给被包装的 Agent
+	if agent.clicks != 1 {
+		t.Errorf("agent.clicks = %d, want 1", agent.clicks)
+	}
+
+	reply := send("text", &simulator.Params{Content: "panic"})
+	if len(reply.Body) != 0 || reply.StatusCode != http.StatusOK {
+		t.Errorf("panic reply = %d %q, want 200 with empty body", reply.StatusCode, reply.Body)
+	}
+
+	if !strings.Contains(logBuf.String(), "msg_type=text event= userid=zhangsan agentid=1 latency=") {
+		t.Errorf("log = %q", logBuf.String())
+	}
+}
+
+type frontendTestAgent struct {
+	DefaultAgent
+}
+
+func (this *frontendTestAgent) ServeTextMsg(w http.ResponseWriter, r *http.Request, msg *request.Text, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	WriteText(w, response.NewText(msg.FromUserName, msg.ToUserName, "agent: "+msg.Content, timestamp),
+		timestamp, nonce, this.GetAESKey(), random, this.GetCorpId(), this.GetToken())
+}
+
+func TestFrontendMiddleware(t *testing.T) {
+	const corpId, token = "wx0123456789abcdef", "token"
+	AESKey := bytes.Repeat([]byte("k"), 32)
+
+	var order []string
+	frontendMiddleware := func(next Handler) Handler {
+		return HandlerFunc(func(ctx *Context) {
+			if _, ok := ctx.Msg.(*request.Text); !ok {
+				t.Errorf("ctx.Msg = %#v", ctx.Msg)
+			}
+			order = append(order, "frontend")
+			ctx.Set("key", "value")
+			if ctx.FromUserName == "blocked" {
+				ctx.ReplyText("blocked")
+				return
+			}
+			next.ServeMsg(ctx)
+		})
+	}
+
+	send := func(frontend http.Handler, from string) string {
+		srv := httptest.NewServer(frontend)
+		defer srv.Close()
+
+		reply, err := simulator.NewSimulator(srv.URL, token, corpId, AESKey).Send("text", &simulator.Params{FromUserName: from, Content: "ping"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var text response.Text
+		if err := xml.Unmarshal(reply.RawXMLMsg, &text); err != nil {
+			t.Fatalf("%v, reply: %s", err, reply.Body)
+		}
+		return text.Content
+	}
+
+	// 普通的 Agent 也经过中间件
+	agent := new(frontendTestAgent)
+	agent.Init(corpId, 1, token, AESKey)
+	frontend := NewAgentFrontend(agent, nil)
+	frontend.Use(frontendMiddleware)
+
+	if got := send(frontend, "zhangsan"); got != "agent: ping" {
+		t.Errorf("agent reply = %q", got)
+	}
+	if got := send(frontend, "blocked"); got != "blocked" {
+		t.Errorf("short-circuit reply = %q", got)
+	}
+
+	// ServeMux 收到的是中间件的 Context
+	mux := NewServeMux(agent)
+	mux.Use(func(next Handler) Handler {
+		return HandlerFunc(func(ctx *Context) {
+			order = append(order, "mux")
+			next.ServeMsg(ctx)
+		})
+	})
+	mux.OnText(func(ctx *Context) {
+		value, _ := ctx.Get("key")
+		ctx.ReplyText(ctx.RequestId + ":" + value.(string))
+	})
+	multiFrontend := new(MultiAgentFrontend)
+	multiFrontend.SetRouteMode(RouteByToUserName)
+	multiFrontend.SetAgent(corpId+":1", mux)
+	multiFrontend.Use(RequestId(), frontendMiddleware)
+
+	if got := send(multiFrontend, "zhangsan"); !strings.HasSuffix(got, ":value") || len(got) != 32+len(":value") {
+		t.Errorf("mux reply = %q", got)
+	}
+	if want := "frontend,frontend,frontend,mux"; strings.Join(order, ",") != want {
+		t.Errorf("order = %v, want %s", order, want)
+	}
+}
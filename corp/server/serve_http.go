@@ -9,7 +9,6 @@ import (
 	"crypto/subtle"
 	"encoding/base64"
 	"encoding/xml"
-	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -23,6 +22,23 @@ import (
 func ServeHTTP(w http.ResponseWriter, r *http.Request,
 	urlValues url.Values, agent Agent, invalidRequestHandler InvalidRequestHandler) {
 
+	serveHTTP(w, r, urlValues, agent, invalidRequestHandler, serveOptions{})
+}
+
+// serveHTTP 的可选功能, 字段为 nil 表示不开启
+type serveOptions struct {
+	dedupStore   util.DedupStore    // 过滤微信服务器重试推送的消息
+	replayGuard  *util.ReplayGuard  // 拒绝重放的请求
+	metrics      util.ServerMetrics // 报告消息的统计信息
+	publisher    util.Publisher     // 把消息发布到 publisher
+	archiveStore util.ArchiveStore  // 把消息和回复存档到 archiveStore
+	middlewares  []Middleware       // 交给 Agent 处理之前经过的中间件
+}
+
+// 同 ServeHTTP, 另外按照 options 开启重复消息过滤, 重放攻击防护, 统计, 发布, 存档和中间件
+func serveHTTP(w http.ResponseWriter, r *http.Request, urlValues url.Values, agent Agent,
+	invalidRequestHandler InvalidRequestHandler, options serveOptions) {
+
 	switch r.Method {
 	case "POST": // 消息处理
 		msgSignature1, timestampStr, nonce, err := parsePostURLQuery(urlValues)
@@ -32,33 +48,33 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request,
 		}
 
 		if len(msgSignature1) != 40 {
-			err = fmt.Errorf("the length of msg_signature mismatch, have: %d, want: 40", len(msgSignature1))
+			err = &SignatureError{Name: "msg_signature", Have: msgSignature1}
 			invalidRequestHandler.ServeInvalidRequest(w, r, err)
 			return
 		}
 
 		timestamp, err := strconv.ParseInt(timestampStr, 10, 64)
 		if err != nil {
-			err = fmt.Errorf("can not parse timestamp(==%q) to int64, error: %s", timestampStr, err.Error())
+			err = &TimestampError{Timestamp: timestampStr, Err: err}
 			invalidRequestHandler.ServeInvalidRequest(w, r, err)
 			return
 		}
 
 		var requestHttpBody request.RequestHttpBody
 		if err := xml.NewDecoder(r.Body).Decode(&requestHttpBody); err != nil {
-			invalidRequestHandler.ServeInvalidRequest(w, r, err)
+			invalidRequestHandler.ServeInvalidRequest(w, r, &XMLError{Err: err})
 			return
 		}
 
 		haveAgentCorpId := requestHttpBody.CorpId
 		wantAgentCorpId := agent.GetCorpId()
 		if len(haveAgentCorpId) != len(wantAgentCorpId) {
-			err = fmt.Errorf("the message RequestHttpBody's ToUserName mismatch, have: %s, want: %s", haveAgentCorpId, wantAgentCorpId)
+			err = &MismatchError{Field: "ToUserName", Have: haveAgentCorpId, Want: wantAgentCorpId}
 			invalidRequestHandler.ServeInvalidRequest(w, r, err)
 			return
 		}
 		if subtle.ConstantTimeCompare([]byte(haveAgentCorpId), []byte(wantAgentCorpId)) != 1 {
-			err = fmt.Errorf("the message RequestHttpBody's ToUserName mismatch, have: %s, want: %s", haveAgentCorpId, wantAgentCorpId)
+			err = &MismatchError{Field: "ToUserName", Have: haveAgentCorpId, Want: wantAgentCorpId}
 			invalidRequestHandler.ServeInvalidRequest(w, r, err)
 			return
 		}
@@ -66,7 +82,7 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request,
 		haveAgentAgentId := requestHttpBody.AgentId
 		wantAgentAgentId := agent.GetAgentId()
 		if haveAgentAgentId != wantAgentAgentId && haveAgentAgentId != 0 {
-			err = fmt.Errorf("the message RequestHttpBody's AgentId mismatch, have: %d, want: %d", haveAgentAgentId, wantAgentAgentId)
+			err = &MismatchError{Field: "AgentId", Have: strconv.FormatInt(haveAgentAgentId, 10), Want: strconv.FormatInt(wantAgentAgentId, 10)}
 			invalidRequestHandler.ServeInvalidRequest(w, r, err)
 			return
 		}
@@ -77,36 +93,43 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request,
 
 		msgSignature2 := util.MsgSign(agent.GetToken(), timestampStr, nonce, requestHttpBody.EncryptedMsg)
 		if subtle.ConstantTimeCompare([]byte(msgSignature1), []byte(msgSignature2)) != 1 {
-			err = fmt.Errorf("check signature failed, input: %s, local: %s", msgSignature1, msgSignature2)
+			err = &SignatureError{Name: "msg_signature", Have: msgSignature1, Want: msgSignature2}
 			invalidRequestHandler.ServeInvalidRequest(w, r, err)
 			return
 		}
 
+		if options.replayGuard != nil {
+			if err = options.replayGuard.Check(timestamp, nonce); err != nil {
+				invalidRequestHandler.ServeInvalidRequest(w, r, err)
+				return
+			}
+		}
+
 		EncryptedMsgBytes, err := base64.StdEncoding.DecodeString(requestHttpBody.EncryptedMsg)
 		if err != nil {
-			invalidRequestHandler.ServeInvalidRequest(w, r, err)
+			invalidRequestHandler.ServeInvalidRequest(w, r, &DecryptError{Err: err})
 			return
 		}
 
-		random, rawXMLMsg, err := util.AESDecryptMsg(EncryptedMsgBytes, wantAgentCorpId, agent.GetAESKey())
+		random, rawXMLMsg, AESKey, keyIndex, err := decryptMsg(EncryptedMsgBytes, agent)
 		if err != nil {
-			invalidRequestHandler.ServeInvalidRequest(w, r, err)
+			invalidRequestHandler.ServeInvalidRequest(w, r, newDecryptError(err))
 			return
 		}
 
 		var msgReq request.Request
 		if err := xml.Unmarshal(rawXMLMsg, &msgReq); err != nil {
-			invalidRequestHandler.ServeInvalidRequest(w, r, err)
+			invalidRequestHandler.ServeInvalidRequest(w, r, &XMLError{Err: err})
 			return
 		}
 
 		if haveAgentCorpId != msgReq.ToUserName {
-			err = fmt.Errorf("the RequestHttpBody's ToUserName(==%s) mismatch the Request's ToUserName(==%s)", haveAgentCorpId, msgReq.ToUserName)
+			err = &MismatchError{Field: "ToUserName", Have: msgReq.ToUserName, Want: haveAgentCorpId}
 			invalidRequestHandler.ServeInvalidRequest(w, r, err)
 			return
 		}
 		if haveAgentAgentId != msgReq.AgentId {
-			err = fmt.Errorf("the RequestHttpBody's AgentId(==%d) mismatch the Request's AgengId(==%d)", haveAgentAgentId, msgReq.AgentId)
+			err = &MismatchError{Field: "AgentId", Have: strconv.FormatInt(msgReq.AgentId, 10), Want: strconv.FormatInt(haveAgentAgentId, 10)}
 			invalidRequestHandler.ServeInvalidRequest(w, r, err)
 			return
 		}
@@ -116,13 +139,39 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request,
 				(msgReq.Event == request.EVENT_TYPE_SUBSCRIBE || msgReq.Event == request.EVENT_TYPE_UNSUBSCRIBE) {
 				// do nothing
 			} else {
-				err = fmt.Errorf("the message Request's AgentId mismatch, have: %d, want: %d", haveAgentAgentId, wantAgentAgentId)
+				err = &MismatchError{Field: "AgentId", Have: strconv.FormatInt(haveAgentAgentId, 10), Want: strconv.FormatInt(wantAgentAgentId, 10)}
 				invalidRequestHandler.ServeInvalidRequest(w, r, err)
 				return
 			}
 		}
 
-		msgDispatch(w, r, &msgReq, rawXMLMsg, timestamp, nonce, random, agent)
+		if options.dedupStore != nil && isDuplicateMsg(options.dedupStore, &msgReq) {
+			return
+		}
+		if options.publisher != nil {
+			publishMsg(options.publisher, &msgReq, rawXMLMsg)
+		}
+		stat := &util.MsgStat{Source: metricsSource, MsgType: msgReq.MsgType, Event: msgReq.Event, Encrypted: true}
+		util.ObserveServe(options.metrics, stat, w, func(w http.ResponseWriter) {
+			archiveServe(options.archiveStore, &msgReq, rawXMLMsg, AESKey, agent.GetCorpId(), w, func(w http.ResponseWriter) {
+				ctx := &Context{
+					ResponseWriter: w,
+					Request:        r,
+					CommonHead:     msgReq.CommonHead,
+					Event:          msgReq.Event,
+					Msg:            requestMsg(&msgReq),
+					RawXMLMsg:      rawXMLMsg,
+					Timestamp:      timestamp,
+					Nonce:          nonce,
+					Random:         random,
+					AESKeyIndex:    keyIndex,
+					corpId:         agent.GetCorpId(),
+					token:          agent.GetToken(),
+					aesKey:         AESKey,
+				}
+				serveMsg(ctx, &msgReq, agent, options.middlewares)
+			})
+		})
 
 	case "GET": // 首次验证
 		msgSignature1, timestamp, nonce, encryptedMsg, err := parseGetURLQuery(urlValues)
@@ -132,30 +181,45 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request,
 		}
 
 		if len(msgSignature1) != 40 {
-			err = fmt.Errorf("the length of msg_signature mismatch, have: %d, want: 40", len(msgSignature1))
+			err = &SignatureError{Name: "msg_signature", Have: msgSignature1}
 			invalidRequestHandler.ServeInvalidRequest(w, r, err)
 			return
 		}
 
 		msgSignature2 := util.MsgSign(agent.GetToken(), timestamp, nonce, encryptedMsg)
 		if subtle.ConstantTimeCompare([]byte(msgSignature1), []byte(msgSignature2)) != 1 {
-			err = fmt.Errorf("check signature failed, input: %s, local: %s", msgSignature1, msgSignature2)
+			err = &SignatureError{Name: "msg_signature", Have: msgSignature1, Want: msgSignature2}
 			invalidRequestHandler.ServeInvalidRequest(w, r, err)
 			return
 		}
 
 		EncryptedMsgBytes, err := base64.StdEncoding.DecodeString(encryptedMsg)
 		if err != nil {
-			invalidRequestHandler.ServeInvalidRequest(w, r, err)
+			invalidRequestHandler.ServeInvalidRequest(w, r, &DecryptError{Err: err})
 			return
 		}
 
-		_, echostr, err := util.AESDecryptMsg(EncryptedMsgBytes, agent.GetCorpId(), agent.GetAESKey())
+		_, echostr, _, _, err := decryptMsg(EncryptedMsgBytes, agent)
 		if err != nil {
-			invalidRequestHandler.ServeInvalidRequest(w, r, err)
+			invalidRequestHandler.ServeInvalidRequest(w, r, newDecryptError(err))
 			return
 		}
 
 		w.Write(echostr)
 	}
 }
+
+// 经过 middlewares 以后把消息交给 agent 处理.
+//  agent 是 *ServeMux 的时候直接把 ctx 交给它, 这样中间件设置的 RequestId, Context.Set 保存的值等在 ServeMux 里也能获取;
+//  否则用消息分路器调用 agent 对应的方法.
+func serveMsg(ctx *Context, msgReq *request.Request, agent Agent, middlewares []Middleware) {
+	var handler Handler
+	if mux, ok := agent.(*ServeMux); ok {
+		handler = mux
+	} else {
+		handler = HandlerFunc(func(ctx *Context) {
+			msgDispatch(ctx.ResponseWriter, ctx.Request, msgReq, ctx.RawXMLMsg, ctx.Timestamp, ctx.Nonce, ctx.Random, agent)
+		})
+	}
+	Chain(handler, middlewares...).ServeMsg(ctx)
+}
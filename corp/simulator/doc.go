@@ -0,0 +1,19 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+// 模拟微信服务器向企业号应用的回调 URL 推送消息, 用于本地开发和调试 corp/server.
+//
+// 支持 corp/message/passive/request 里所有的消息和事件类型, 会自动加密消息,
+// 计算 msg_signature, timestamp 和 nonce, 并且解密开发者服务器的回复:
+//
+//  s := simulator.NewSimulator("http://localhost:8080/wechat", token, corpId, AESKey)
+//  reply, err := s.Send("event.CLICK", &simulator.Params{AgentId: 1, EventKey: "V1001_TODAY_MUSIC"})
+//  if err != nil {
+//      ...
+//  }
+//  fmt.Println(simulator.FormatXML(reply.RawXMLMsg))
+//
+// 命令行工具参考 github.com/chanxuehong/wechat/cmd/wechatsim
+package simulator
@@ -0,0 +1,43 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package simulator
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// 格式化 xml, 每个元素一行并且缩进; 如果 data 不是合法的 xml 则原样返回.
+func FormatXML(data []byte) string {
+	var buf bytes.Buffer
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "    ")
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return string(data)
+		}
+		if charData, ok := token.(xml.CharData); ok {
+			if len(bytes.TrimSpace(charData)) == 0 {
+				continue // 忽略元素之间的空白
+			}
+		}
+		if err = encoder.EncodeToken(token); err != nil {
+			return string(data)
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		return string(data)
+	}
+	return strings.TrimSpace(buf.String())
+}
@@ -0,0 +1,235 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package simulator
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// 构造消息的参数, 零值的字段使用默认值
+type Params struct {
+	ToUserName   string // 企业号CorpID, 默认为 wx0123456789abcdef
+	FromUserName string // 员工UserID, 默认为 zhangsan
+	AgentId      int64  // 企业应用的id, 默认为 1
+	CreateTime   int64  // 默认为当前时间
+	MsgId        int64  // 默认为 CreateTime 的纳秒数
+
+	Content  string // 文本消息的内容, 默认为 "hello"
+	EventKey string // 菜单事件 和 二维码事件 的 EventKey, 默认为各个事件的示例值
+}
+
+func (params *Params) setDefaults(kind string) {
+	if params.ToUserName == "" {
+		params.ToUserName = "wx0123456789abcdef"
+	}
+	if params.FromUserName == "" {
+		params.FromUserName = "zhangsan"
+	}
+	if params.AgentId == 0 {
+		params.AgentId = 1
+	}
+	if params.CreateTime == 0 {
+		now := time.Now()
+		params.CreateTime = now.Unix()
+		if params.MsgId == 0 {
+			params.MsgId = now.UnixNano()
+		}
+	}
+	if params.MsgId == 0 {
+		params.MsgId = params.CreateTime
+	}
+	if params.Content == "" {
+		params.Content = "hello"
+	}
+	if params.EventKey == "" {
+		params.EventKey = defaultEventKeys[kind]
+	}
+}
+
+var defaultEventKeys = map[string]string{
+	"event.CLICK":              "V1001_TODAY_MUSIC",
+	"event.VIEW":               "http://www.qq.com/",
+	"event.scancode_push":      "6",
+	"event.scancode_waitmsg":   "6",
+	"event.pic_sysphoto":       "6",
+	"event.pic_photo_or_album": "6",
+	"event.pic_weixin":         "6",
+	"event.location_select":    "6",
+}
+
+const msgHead = `<xml>
+<ToUserName>{{cdata .ToUserName}}</ToUserName>
+<FromUserName>{{cdata .FromUserName}}</FromUserName>
+<CreateTime>{{.CreateTime}}</CreateTime>
+<AgentID>{{.AgentId}}</AgentID>
+`
+
+// 所有支持的消息类型; 普通消息为 MsgType, 事件为 "event." + Event.
+var msgTemplates = map[string]string{
+	"text": msgHead + `<MsgType><![CDATA[text]]></MsgType>
+<Content>{{cdata .Content}}</Content>
+<MsgId>{{.MsgId}}</MsgId>
+</xml>`,
+
+	"image": msgHead + `<MsgType><![CDATA[image]]></MsgType>
+<PicUrl><![CDATA[http://mmbiz.qpic.cn/mmbiz/sample.jpg]]></PicUrl>
+<MediaId><![CDATA[media_id]]></MediaId>
+<MsgId>{{.MsgId}}</MsgId>
+</xml>`,
+
+	"voice": msgHead + `<MsgType><![CDATA[voice]]></MsgType>
+<MediaId><![CDATA[media_id]]></MediaId>
+<Format><![CDATA[amr]]></Format>
+<MsgId>{{.MsgId}}</MsgId>
+</xml>`,
+
+	"video": msgHead + `<MsgType><![CDATA[video]]></MsgType>
+<MediaId><![CDATA[media_id]]></MediaId>
+<ThumbMediaId><![CDATA[thumb_media_id]]></ThumbMediaId>
+<MsgId>{{.MsgId}}</MsgId>
+</xml>`,
+
+	"location": msgHead + `<MsgType><![CDATA[location]]></MsgType>
+<Location_X>23.134521</Location_X>
+<Location_Y>113.358803</Location_Y>
+<Scale>20</Scale>
+<Label><![CDATA[广州市天河区]]></Label>
+<MsgId>{{.MsgId}}</MsgId>
+</xml>`,
+
+	"event.subscribe": msgHead + `<MsgType><![CDATA[event]]></MsgType>
+<Event><![CDATA[subscribe]]></Event>
+</xml>`,
+
+	"event.unsubscribe": msgHead + `<MsgType><![CDATA[event]]></MsgType>
+<Event><![CDATA[unsubscribe]]></Event>
+</xml>`,
+
+	"event.LOCATION": msgHead + `<MsgType><![CDATA[event]]></MsgType>
+<Event><![CDATA[LOCATION]]></Event>
+<Latitude>23.137466</Latitude>
+<Longitude>113.352425</Longitude>
+<Precision>119.385040</Precision>
+</xml>`,
+
+	"event.CLICK": msgHead + `<MsgType><![CDATA[event]]></MsgType>
+<Event><![CDATA[CLICK]]></Event>
+<EventKey>{{cdata .EventKey}}</EventKey>
+</xml>`,
+
+	"event.VIEW": msgHead + `<MsgType><![CDATA[event]]></MsgType>
+<Event><![CDATA[VIEW]]></Event>
+<EventKey>{{cdata .EventKey}}</EventKey>
+</xml>`,
+
+	"event.scancode_push": msgHead + `<MsgType><![CDATA[event]]></MsgType>
+<Event><![CDATA[scancode_push]]></Event>
+<EventKey>{{cdata .EventKey}}</EventKey>
+<ScanCodeInfo><ScanType><![CDATA[qrcode]]></ScanType>
+<ScanResult><![CDATA[1]]></ScanResult>
+</ScanCodeInfo>
+</xml>`,
+
+	"event.scancode_waitmsg": msgHead + `<MsgType><![CDATA[event]]></MsgType>
+<Event><![CDATA[scancode_waitmsg]]></Event>
+<EventKey>{{cdata .EventKey}}</EventKey>
+<ScanCodeInfo><ScanType><![CDATA[qrcode]]></ScanType>
+<ScanResult><![CDATA[2]]></ScanResult>
+</ScanCodeInfo>
+</xml>`,
+
+	"event.pic_sysphoto": msgHead + `<MsgType><![CDATA[event]]></MsgType>
+<Event><![CDATA[pic_sysphoto]]></Event>
+<EventKey>{{cdata .EventKey}}</EventKey>
+<SendPicsInfo><Count>1</Count>
+<PicList><item><PicMd5Sum><![CDATA[1b5f7c23b5bf75682a53e7b6d163e185]]></PicMd5Sum>
+</item>
+</PicList>
+</SendPicsInfo>
+</xml>`,
+
+	"event.pic_photo_or_album": msgHead + `<MsgType><![CDATA[event]]></MsgType>
+<Event><![CDATA[pic_photo_or_album]]></Event>
+<EventKey>{{cdata .EventKey}}</EventKey>
+<SendPicsInfo><Count>1</Count>
+<PicList><item><PicMd5Sum><![CDATA[5a75aaca956d97be686719218f275c6b]]></PicMd5Sum>
+</item>
+</PicList>
+</SendPicsInfo>
+</xml>`,
+
+	"event.pic_weixin": msgHead + `<MsgType><![CDATA[event]]></MsgType>
+<Event><![CDATA[pic_weixin]]></Event>
+<EventKey>{{cdata .EventKey}}</EventKey>
+<SendPicsInfo><Count>1</Count>
+<PicList><item><PicMd5Sum><![CDATA[5a75aaca956d97be686719218f275c6b]]></PicMd5Sum>
+</item>
+</PicList>
+</SendPicsInfo>
+</xml>`,
+
+	"event.location_select": msgHead + `<MsgType><![CDATA[event]]></MsgType>
+<Event><![CDATA[location_select]]></Event>
+<EventKey>{{cdata .EventKey}}</EventKey>
+<SendLocationInfo><Location_X><![CDATA[23]]></Location_X>
+<Location_Y><![CDATA[113]]></Location_Y>
+<Scale><![CDATA[15]]></Scale>
+<Label><![CDATA[ 广州市海珠区客村艺苑路 106号]]></Label>
+<Poiname><![CDATA[]]></Poiname>
+</SendLocationInfo>
+</xml>`,
+}
+
+var templates = template.New("msg").Funcs(template.FuncMap{"cdata": cdata})
+
+func init() {
+	for kind, text := range msgTemplates {
+		template.Must(templates.New(kind).Parse(text))
+	}
+}
+
+func cdata(s string) string {
+	return "<![CDATA[" + strings.Replace(s, "]]>", "]]]]><![CDATA[>", -1) + "]]>"
+}
+
+// 返回所有支持的消息类型, 按字典序排列.
+func Kinds() []string {
+	kinds := make([]string, 0, len(msgTemplates))
+	for kind := range msgTemplates {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// 构造 kind 类型的消息, 返回和微信服务器推送的格式一样的明文 xml; params 可以为 nil.
+//
+//	kind 为 Kinds() 返回的类型之一, 比如 "text", "event.subscribe", "event.CLICK".
+func BuildMsg(kind string, params *Params) (rawXMLMsg []byte, err error) {
+	tpl := templates.Lookup(kind)
+	if tpl == nil || kind == "msg" {
+		err = fmt.Errorf("unknown message kind: %q", kind)
+		return
+	}
+
+	var p Params
+	if params != nil {
+		p = *params
+	}
+	p.setDefaults(kind)
+
+	var buf bytes.Buffer
+	if err = tpl.Execute(&buf, &p); err != nil {
+		return
+	}
+	rawXMLMsg = buf.Bytes()
+	return
+}
@@ -0,0 +1,262 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package simulator
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/chanxuehong/wechat/corp/message/passive/response"
+	"github.com/chanxuehong/wechat/util"
+)
+
+// 模拟微信服务器, 向企业号应用的回调 URL 推送消息.
+//  NOTE: 企业号的消息都是加密的.
+type Simulator struct {
+	URL    string // 开发者服务器的 URL, 比如 http://localhost:8080/wechat
+	Token  string
+	CorpId string
+	AESKey [32]byte
+
+	HTTPClient *http.Client // 默认为 http.DefaultClient
+}
+
+// 创建一个新的 Simulator, AESKey 的长度必须为 32.
+func NewSimulator(URL, Token, CorpId string, AESKey []byte) *Simulator {
+	if URL == "" {
+		panic("empty URL")
+	}
+	if Token == "" {
+		panic("empty Token")
+	}
+	if CorpId == "" {
+		panic("empty CorpId")
+	}
+	if len(AESKey) != 32 {
+		panic("the length of AESKey must be equal to 32")
+	}
+
+	s := &Simulator{
+		URL:    URL,
+		Token:  Token,
+		CorpId: CorpId,
+	}
+	copy(s.AESKey[:], AESKey)
+	return s
+}
+
+// 推送消息的结果
+type Reply struct {
+	StatusCode int
+	Body       []byte // 原始的 http body
+	RawXMLMsg  []byte // 解密后的回复消息; 没有回复消息则为 nil
+}
+
+// 回复的消息的类型, 没有回复消息则返回空字符串.
+func (reply *Reply) MsgType() string {
+	if len(reply.RawXMLMsg) == 0 {
+		return ""
+	}
+	var head response.CommonHead
+	xml.Unmarshal(reply.RawXMLMsg, &head)
+	return head.MsgType
+}
+
+// 模拟首次验证 URL 的 GET 请求, 检查开发者服务器是否返回了解密后的 echostr.
+func (s *Simulator) Verify() (err error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := randString(10)
+	echostr := randString(19)
+
+	encryptedEchostr, err := s.encrypt([]byte(echostr))
+	if err != nil {
+		return
+	}
+
+	query := make(url.Values)
+	query.Set("msg_signature", util.MsgSign(s.Token, timestamp, nonce, encryptedEchostr))
+	query.Set("timestamp", timestamp)
+	query.Set("nonce", nonce)
+	query.Set("echostr", encryptedEchostr)
+
+	resp, err := s.httpClient().Get(s.url(query))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("http.Status: %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	if string(body) != echostr {
+		return fmt.Errorf("echostr mismatch, have: %q, want: %q", body, echostr)
+	}
+	return
+}
+
+// 构造 kind 类型的消息并推送到开发者服务器, 参考 BuildMsg.
+func (s *Simulator) Send(kind string, params *Params) (reply *Reply, err error) {
+	var p Params
+	if params != nil {
+		p = *params
+	}
+	if p.ToUserName == "" {
+		p.ToUserName = s.CorpId
+	}
+
+	rawXMLMsg, err := BuildMsg(kind, &p)
+	if err != nil {
+		return
+	}
+	return s.Post(rawXMLMsg)
+}
+
+// 推送明文消息 rawXMLMsg 到开发者服务器, 签名并加密, 并且解密回复的消息.
+func (s *Simulator) Post(rawXMLMsg []byte) (reply *Reply, err error) {
+	req, err := s.NewRequest(rawXMLMsg)
+	if err != nil {
+		return
+	}
+
+	resp, err := s.httpClient().Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	reply = &Reply{
+		StatusCode: resp.StatusCode,
+		Body:       body,
+	}
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("http.Status: %s", resp.Status)
+		return
+	}
+	reply.RawXMLMsg, err = s.DecryptReply(body)
+	return
+}
+
+// 构造推送 rawXMLMsg 的 http 请求, 包括 URL 里的 msg_signature, timestamp, nonce.
+func (s *Simulator) NewRequest(rawXMLMsg []byte) (req *http.Request, err error) {
+	var head struct {
+		ToUserName string `xml:"ToUserName"`
+		AgentId    int64  `xml:"AgentID"`
+	}
+	if err = xml.Unmarshal(rawXMLMsg, &head); err != nil {
+		return
+	}
+
+	encryptedMsg, err := s.encrypt(rawXMLMsg)
+	if err != nil {
+		return
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := randString(10)
+
+	query := make(url.Values)
+	query.Set("msg_signature", util.MsgSign(s.Token, timestamp, nonce, encryptedMsg))
+	query.Set("timestamp", timestamp)
+	query.Set("nonce", nonce)
+
+	body := "<xml><ToUserName>" + cdata(head.ToUserName) + "</ToUserName><AgentID>" +
+		strconv.FormatInt(head.AgentId, 10) + "</AgentID><Encrypt>" + cdata(encryptedMsg) + "</Encrypt></xml>"
+
+	if req, err = http.NewRequest("POST", s.url(query), bytes.NewReader([]byte(body))); err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	return
+}
+
+// 解密开发者服务器回复的 http body, 返回明文消息; 没有回复消息(空字符串或者 "success")则返回 nil.
+func (s *Simulator) DecryptReply(body []byte) (rawXMLMsg []byte, err error) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || string(body) == "success" {
+		return
+	}
+
+	var responseHttpBody response.ResponseHttpBody
+	if err = xml.Unmarshal(body, &responseHttpBody); err != nil {
+		return
+	}
+	if responseHttpBody.EncryptedMsg == "" {
+		err = errors.New("the reply is not encrypted")
+		return
+	}
+
+	timestamp := strconv.FormatInt(responseHttpBody.TimeStamp, 10)
+	msgSignature := util.MsgSign(s.Token, timestamp, responseHttpBody.Nonce, responseHttpBody.EncryptedMsg)
+	if subtle.ConstantTimeCompare([]byte(msgSignature), []byte(responseHttpBody.MsgSignature)) != 1 {
+		err = fmt.Errorf("check reply signature failed, input: %s, local: %s", responseHttpBody.MsgSignature, msgSignature)
+		return
+	}
+
+	encryptedMsg, err := base64.StdEncoding.DecodeString(responseHttpBody.EncryptedMsg)
+	if err != nil {
+		return
+	}
+	_, rawXMLMsg, err = util.AESDecryptMsg(encryptedMsg, s.CorpId, s.AESKey)
+	return
+}
+
+// 加密 msg, 返回 base64 编码的密文
+func (s *Simulator) encrypt(msg []byte) (encryptedMsg string, err error) {
+	random := make([]byte, 16)
+	if _, err = io.ReadFull(rand.Reader, random); err != nil {
+		return
+	}
+	encryptedMsg = base64.StdEncoding.EncodeToString(util.AESEncryptMsg(random, msg, s.CorpId, s.AESKey))
+	return
+}
+
+func (s *Simulator) httpClient() *http.Client {
+	if s.HTTPClient != nil {
+		return s.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (s *Simulator) url(query url.Values) string {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return s.URL + "?" + query.Encode()
+	}
+	q := u.Query()
+	for k, v := range query {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func randString(n int) string {
+	b := make([]byte, (n+1)/2)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)[:n]
+}
@@ -0,0 +1,84 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package simulator
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chanxuehong/wechat/corp/message/passive/request"
+	"github.com/chanxuehong/wechat/corp/message/passive/response"
+	"github.com/chanxuehong/wechat/corp/server"
+)
+
+const (
+	testCorpId  = "wx0123456789abcdef"
+	testAgentId = 2
+	testToken   = "token"
+)
+
+var testAESKey = []byte("0123456789abcdef0123456789abcdef")
+
+type echoAgent struct {
+	server.DefaultAgent
+}
+
+func (agent *echoAgent) ServeTextMsg(w http.ResponseWriter, r *http.Request, msg *request.Text, rawXMLMsg []byte, timestamp int64, nonce string, random []byte) {
+	server.WriteText(w, response.NewText(msg.FromUserName, msg.ToUserName, msg.Content, timestamp),
+		timestamp, nonce, agent.GetAESKey(), random, agent.GetCorpId(), agent.GetToken())
+}
+
+func TestBuildMsg(t *testing.T) {
+	for _, kind := range Kinds() {
+		rawXMLMsg, err := BuildMsg(kind, &Params{ToUserName: testCorpId, AgentId: testAgentId})
+		if err != nil {
+			t.Errorf("BuildMsg(%q): %v", kind, err)
+			continue
+		}
+		var req request.Request
+		if err = xml.Unmarshal(rawXMLMsg, &req); err != nil {
+			t.Errorf("BuildMsg(%q): invalid xml: %v\n%s", kind, err, rawXMLMsg)
+			continue
+		}
+		if req.ToUserName != testCorpId || req.AgentId != testAgentId {
+			t.Errorf("BuildMsg(%q): have ToUserName %q, AgentId %d", kind, req.ToUserName, req.AgentId)
+		}
+	}
+}
+
+func TestSimulator(t *testing.T) {
+	agent := new(echoAgent)
+	agent.Init(testCorpId, testAgentId, testToken, testAESKey)
+	invalidRequestHandler := server.InvalidRequestHandlerFunc(func(w http.ResponseWriter, r *http.Request, err error) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	})
+	ts := httptest.NewServer(server.NewAgentFrontend(agent, invalidRequestHandler))
+	defer ts.Close()
+
+	s := NewSimulator(ts.URL, testToken, testCorpId, testAESKey)
+	if err := s.Verify(); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+
+	reply, err := s.Send("text", &Params{AgentId: testAgentId, Content: "你好"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.MsgType() != response.MSG_TYPE_TEXT || !bytes.Contains(reply.RawXMLMsg, []byte("你好")) {
+		t.Errorf("reply: have %s", reply.RawXMLMsg)
+	}
+
+	if reply, err = s.Send("event.CLICK", &Params{AgentId: testAgentId}); err != nil || reply.RawXMLMsg != nil {
+		t.Errorf("Send(event.CLICK): have %s, %v", reply.Body, err)
+	}
+
+	if _, err = s.Send("text", &Params{AgentId: testAgentId + 1}); err == nil {
+		t.Error("Send to another agent: expected error")
+	}
+}
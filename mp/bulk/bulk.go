@@ -0,0 +1,185 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package bulk
+
+import (
+	"sync"
+	"time"
+
+	"github.com/chanxuehong/wechat/mp/client"
+)
+
+const (
+	DefaultWorkers   = 8
+	DefaultBatchSize = 500
+
+	errCodeFreqOutOfLimit = 45009 // 接口调用超过限制
+)
+
+// 批量操作的参数, 零值的字段使用默认值
+type Options struct {
+	Workers    int // 并发的 worker 数量, 默认为 DefaultWorkers
+	BatchSize  int // 每一批处理的 openid 个数, 每完成一批保存一次进度, 默认为 DefaultBatchSize
+	RateLimit  int // 每秒最多的请求数, <= 0 表示不限制
+	MaxRetries int // 微信服务器返回 45009(接口调用超过限制) 时最多重试的次数, 默认不重试
+}
+
+// 单个 openid 的处理结果
+type Result struct {
+	OpenId string
+	Err    error
+}
+
+// 关注用户的批量操作
+type Bulk struct {
+	clt     *client.Client
+	options Options
+	limiter *rateLimiter
+}
+
+// 创建一个新的 Bulk.
+//  如果 options == nil 则全部使用默认值.
+func NewBulk(clt *client.Client, options *Options) *Bulk {
+	if clt == nil {
+		panic("clt == nil")
+	}
+
+	bulk := &Bulk{
+		clt: clt,
+	}
+	if options != nil {
+		bulk.options = *options
+	}
+	if bulk.options.Workers <= 0 {
+		bulk.options.Workers = DefaultWorkers
+	}
+	if bulk.options.BatchSize <= 0 {
+		bulk.options.BatchSize = DefaultBatchSize
+	}
+	if bulk.options.RateLimit > 0 {
+		bulk.limiter = &rateLimiter{
+			interval: time.Second / time.Duration(bulk.options.RateLimit),
+		}
+	}
+	return bulk
+}
+
+// 按批次并发处理 openids, 每一批处理完成后按 openids 的顺序调用 resultFunc, 然后保存进度.
+//  如果 checkpoint != nil 且保存的进度在 openids 中, 则从该 openid 的下一个开始处理.
+func (b *Bulk) run(openids []string, checkpoint Checkpoint,
+	handle func(openid string) error, resultFunc func(*Result)) (err error) {
+
+	if checkpoint != nil {
+		var lastOpenId string
+		if lastOpenId, err = checkpoint.Load(); err != nil {
+			return
+		}
+		if lastOpenId != "" {
+			for i, openid := range openids {
+				if openid == lastOpenId {
+					openids = openids[i+1:]
+					break
+				}
+			}
+		}
+	}
+
+	for len(openids) > 0 {
+		n := b.options.BatchSize
+		if n > len(openids) {
+			n = len(openids)
+		}
+		batch := openids[:n]
+		openids = openids[n:]
+
+		results := b.runBatch(batch, handle)
+		if resultFunc != nil {
+			for i := range results {
+				resultFunc(&results[i])
+			}
+		}
+		if checkpoint != nil {
+			if err = checkpoint.Save(batch[len(batch)-1]); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+func (b *Bulk) runBatch(batch []string, handle func(openid string) error) []Result {
+	results := make([]Result, len(batch))
+
+	indexChan := make(chan int)
+	var wg sync.WaitGroup
+
+	workers := b.options.Workers
+	if workers > len(batch) {
+		workers = len(batch)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexChan {
+				openid := batch[index]
+				results[index] = Result{
+					OpenId: openid,
+					Err:    b.call(func() error { return handle(openid) }),
+				}
+			}
+		}()
+	}
+
+	for i := range batch {
+		indexChan <- i
+	}
+	close(indexChan)
+	wg.Wait()
+
+	return results
+}
+
+// 限制请求速率, 如果微信服务器返回接口调用超过限制则等待后重试.
+func (b *Bulk) call(fn func() error) (err error) {
+	for retry := 0; ; retry++ {
+		b.limiter.wait()
+
+		err = fn()
+		if clientErr, ok := err.(*client.Error); !ok || clientErr.ErrCode != errCodeFreqOutOfLimit ||
+			retry >= b.options.MaxRetries {
+			return
+		}
+		time.Sleep(time.Duration(retry+1) * time.Second)
+	}
+}
+
+// 简单的限速器, 保证相邻两次请求的间隔不小于 interval.
+type rateLimiter struct {
+	mutex    sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// limiter == nil 时不限速
+func (limiter *rateLimiter) wait() {
+	if limiter == nil {
+		return
+	}
+
+	limiter.mutex.Lock()
+	now := time.Now()
+	if limiter.next.Before(now) {
+		limiter.next = now
+	}
+	d := limiter.next.Sub(now)
+	limiter.next = limiter.next.Add(limiter.interval)
+	limiter.mutex.Unlock()
+
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
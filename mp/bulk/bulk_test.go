@@ -0,0 +1,65 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package bulk
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/chanxuehong/wechat/mp/client"
+)
+
+func TestBulkRun(t *testing.T) {
+	b := &Bulk{
+		options: Options{
+			Workers:    3,
+			BatchSize:  4,
+			MaxRetries: 1,
+		},
+	}
+
+	openids := make([]string, 10)
+	for i := range openids {
+		openids[i] = fmt.Sprintf("openid-%d", i)
+	}
+
+	var calls int32
+	errBad := errors.New("bad openid")
+	handle := func(openid string) error {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return &client.Error{ErrCode: errCodeFreqOutOfLimit} // 第一次调用模拟限流
+		}
+		if openid == "openid-5" {
+			return errBad
+		}
+		return nil
+	}
+
+	checkpoint := new(MemoryCheckpoint)
+	checkpoint.Save("openid-1")
+
+	var results []Result
+	if err := b.run(openids, checkpoint, handle, func(r *Result) { results = append(results, *r) }); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 8 {
+		t.Fatalf("len(results): have %d, want 8", len(results))
+	}
+	for i, result := range results {
+		if want := openids[i+2]; result.OpenId != want {
+			t.Errorf("results[%d].OpenId: have %s, want %s", i, result.OpenId, want)
+		}
+		if (result.OpenId == "openid-5") != (result.Err == errBad) || (result.Err != nil && result.Err != errBad) {
+			t.Errorf("results[%d].Err: %v", i, result.Err)
+		}
+	}
+	if last, _ := checkpoint.Load(); last != "openid-9" {
+		t.Errorf("checkpoint: have %s, want openid-9", last)
+	}
+}
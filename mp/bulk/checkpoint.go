@@ -0,0 +1,72 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package bulk
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+// 批量操作的进度, 保存的是最后一个已经处理完成的 openid(该 openid 之前的也都已经处理完成).
+type Checkpoint interface {
+	// 获取保存的进度, 没有进度时返回 "" 和 nil
+	Load() (lastOpenId string, err error)
+
+	// 保存进度
+	Save(lastOpenId string) (err error)
+}
+
+var _ Checkpoint = new(MemoryCheckpoint)
+
+// 基于内存的 Checkpoint 实现
+type MemoryCheckpoint struct {
+	rwmutex    sync.RWMutex
+	lastOpenId string
+}
+
+func (this *MemoryCheckpoint) Load() (lastOpenId string, err error) {
+	this.rwmutex.RLock()
+	lastOpenId = this.lastOpenId
+	this.rwmutex.RUnlock()
+	return
+}
+
+func (this *MemoryCheckpoint) Save(lastOpenId string) (err error) {
+	this.rwmutex.Lock()
+	this.lastOpenId = lastOpenId
+	this.rwmutex.Unlock()
+	return
+}
+
+var _ Checkpoint = new(FileCheckpoint)
+
+// 基于文件的 Checkpoint 实现, 进度保存在文件 Path 里.
+type FileCheckpoint struct {
+	Path string
+}
+
+func (this *FileCheckpoint) Load() (lastOpenId string, err error) {
+	data, err := ioutil.ReadFile(this.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	lastOpenId = strings.TrimSpace(string(data))
+	return
+}
+
+// 先写临时文件再重命名, 避免中断时文件内容不完整
+func (this *FileCheckpoint) Save(lastOpenId string) (err error) {
+	tmpPath := this.Path + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, []byte(lastOpenId), 0644); err != nil {
+		return
+	}
+	return os.Rename(tmpPath, this.Path)
+}
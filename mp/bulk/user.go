@@ -0,0 +1,133 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package bulk
+
+import (
+	"sync"
+
+	"github.com/chanxuehong/wechat/mp/user"
+)
+
+// 获取用户信息的结果
+type UserInfoResult struct {
+	Result
+	UserInfo *user.UserInfo // Err == nil 时有效
+}
+
+// 批量获取用户基本信息, 结果的顺序和 openids 一致.
+//  lang 可能的取值是 zh_CN, zh_TW, en; 如果留空 "" 则默认为 zh_CN.
+//  如果 checkpoint != nil 则从保存的进度处继续, 已经处理过的 openid 不在结果中.
+func (b *Bulk) UserInfo(openids []string, lang string, checkpoint Checkpoint) (results []UserInfoResult, err error) {
+	results = make([]UserInfoResult, 0, len(openids))
+	err = b.userInfo(openids, lang, checkpoint, func(result *UserInfoResult) {
+		results = append(results, *result)
+	})
+	return
+}
+
+// 遍历所有关注用户并获取他们的基本信息, 每个用户的结果都会调用一次 resultFunc.
+//  resultFunc 是顺序调用的, 不需要考虑并发.
+//  如果 checkpoint != nil 则从保存的进度处继续, 并且每完成一批就保存一次进度;
+//  返回的 err 只表示遍历关注者列表或者保存进度失败, 单个用户的错误在 UserInfoResult.Err 里.
+func (b *Bulk) UserInfoAll(lang string, checkpoint Checkpoint, resultFunc func(*UserInfoResult)) (err error) {
+	var beginOpenId string
+	if checkpoint != nil {
+		if beginOpenId, err = checkpoint.Load(); err != nil {
+			return
+		}
+	}
+
+	iter, err := b.clt.UserIterator(beginOpenId)
+	if err != nil {
+		return
+	}
+
+	for iter.HasNext() {
+		var openids []string
+		if openids, err = iter.NextPage(); err != nil {
+			return
+		}
+		if err = b.userInfo(openids, lang, checkpoint, resultFunc); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (b *Bulk) userInfo(openids []string, lang string, checkpoint Checkpoint, resultFunc func(*UserInfoResult)) (err error) {
+	var mutex sync.Mutex
+	infos := make(map[string]*user.UserInfo)
+
+	return b.run(openids, checkpoint,
+		func(openid string) error {
+			info, err := b.clt.UserInfo(openid, lang)
+			if err != nil {
+				return err
+			}
+			mutex.Lock()
+			infos[openid] = info
+			mutex.Unlock()
+			return nil
+		},
+		func(result *Result) {
+			mutex.Lock()
+			info := infos[result.OpenId]
+			delete(infos, result.OpenId)
+			mutex.Unlock()
+
+			if resultFunc != nil {
+				resultFunc(&UserInfoResult{
+					Result:   *result,
+					UserInfo: info,
+				})
+			}
+		},
+	)
+}
+
+// 批量移动用户分组, 结果的顺序和 openids 一致.
+//  如果 checkpoint != nil 则从保存的进度处继续, 已经处理过的 openid 不在结果中.
+func (b *Bulk) UserMoveToGroup(openids []string, toGroupId int64, checkpoint Checkpoint) (results []Result, err error) {
+	results = make([]Result, 0, len(openids))
+	err = b.run(openids, checkpoint,
+		func(openid string) error {
+			return b.clt.UserMoveToGroup(openid, toGroupId)
+		},
+		func(result *Result) {
+			results = append(results, *result)
+		},
+	)
+	return
+}
+
+// 用户的备注名
+type Remark struct {
+	OpenId string
+	Remark string
+}
+
+// 批量设置用户备注名, 结果的顺序和 remarks 一致.
+//  如果 checkpoint != nil 则从保存的进度处继续, 已经处理过的 openid 不在结果中.
+//  NOTE: 该接口暂时开放给微信认证的服务号
+func (b *Bulk) UserUpdateRemark(remarks []Remark, checkpoint Checkpoint) (results []Result, err error) {
+	openids := make([]string, len(remarks))
+	remarkMap := make(map[string]string, len(remarks))
+	for i := range remarks {
+		openids[i] = remarks[i].OpenId
+		remarkMap[remarks[i].OpenId] = remarks[i].Remark
+	}
+
+	results = make([]Result, 0, len(remarks))
+	err = b.run(openids, checkpoint,
+		func(openid string) error {
+			return b.clt.UserUpdateRemark(openid, remarkMap[openid])
+		},
+		func(result *Result) {
+			results = append(results, *result)
+		},
+	)
+	return
+}
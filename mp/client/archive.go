@@ -0,0 +1,73 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package client
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	wechatjson "github.com/chanxuehong/wechat/json"
+	"github.com/chanxuehong/wechat/util"
+)
+
+// 主动发送的消息的种类, util.ArchiveRecord.Kind
+const (
+	archiveKindCustom       = "custom"
+	archiveKindTemplate     = "template"
+	archiveKindMassByGroup  = "mass_by_group"
+	archiveKindMassByOpenId = "mass_by_openid"
+)
+
+// 开启消息存档, 把客服消息, 模板消息和群发消息的消息体, 返回的 msgid, 调用时间和错误存档到 store,
+// 比如 util.NewFileArchiveStore 返回的 *util.FileArchiveStore. store 为 nil 则关闭存档.
+//  NOTE: 要在发送消息之前调用, 不是并发安全的.
+func (c *Client) EnableArchive(store util.ArchiveStore) {
+	c.archiveStore = store
+}
+
+// 把主动发送的消息 msg 存档, msg 是消息结构体或者 json 格式的消息体([]byte), 出错的时候只记录日志.
+func (c *Client) archiveSend(kind string, msg interface{}, msgid int64, start time.Time, sendErr error) {
+	msgJSON, ok := msg.([]byte)
+	if !ok {
+		var err error
+		if msgJSON, err = wechatjson.Marshal(msg); err != nil {
+			log.Printf("wechat: encode %s message failed: %v", kind, err)
+			return
+		}
+	}
+
+	record := &util.ArchiveRecord{
+		Direction:  util.ArchiveOutbound,
+		Source:     "mp",
+		Kind:       kind,
+		MsgType:    kind,
+		MsgId:      msgid,
+		Msg:        json.RawMessage(msgJSON),
+		Latency:    time.Since(start),
+		ArchivedAt: time.Now(),
+	}
+	if sendErr != nil {
+		record.Error = sendErr.Error()
+	}
+
+	var header struct {
+		ToUser  json.RawMessage `json:"touser"`
+		MsgType string          `json:"msgtype"`
+	}
+	if json.Unmarshal(msgJSON, &header) == nil {
+		if header.MsgType != "" {
+			record.MsgType = header.MsgType
+		}
+		if len(header.ToUser) > 0 && json.Unmarshal(header.ToUser, &record.OpenId) != nil {
+			json.Unmarshal(header.ToUser, &record.OpenIds)
+		}
+	}
+
+	if err := c.archiveStore.Append(record); err != nil {
+		log.Printf("wechat: archive %s message failed: %v", kind, err)
+	}
+}
@@ -13,11 +13,13 @@ import (
 
 	wechatjson "github.com/chanxuehong/wechat/json"
 	"github.com/chanxuehong/wechat/mp/tokenservice"
+	"github.com/chanxuehong/wechat/util"
 )
 
 type Client struct {
 	tokenService tokenservice.TokenService
 	httpClient   *http.Client
+	archiveStore util.ArchiveStore
 }
 
 // 创建一个新的 Client.
@@ -0,0 +1,95 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package client
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/chanxuehong/wechat/mp/media"
+)
+
+const errCodeInvalidMediaId = 40007 // 不合法的媒体文件 id
+
+// 把 media_id 对应的多媒体文件转发给浏览器的 http.Handler,
+// 会根据微信服务器的返回设置 Content-Type, Content-Disposition 和 Content-Length.
+type MediaProxyHandler struct {
+	clt         *Client
+	mediaIdFunc func(r *http.Request) string
+}
+
+// 创建一个新的 MediaProxyHandler.
+//  mediaIdFunc 从请求中获取 media_id, 如果 mediaIdFunc == nil 则默认获取 url 的查询参数 media_id.
+func NewMediaProxyHandler(clt *Client, mediaIdFunc func(r *http.Request) string) *MediaProxyHandler {
+	if clt == nil {
+		panic("clt == nil")
+	}
+	if mediaIdFunc == nil {
+		mediaIdFunc = defaultMediaIdFunc
+	}
+
+	return &MediaProxyHandler{
+		clt:         clt,
+		mediaIdFunc: mediaIdFunc,
+	}
+}
+
+func defaultMediaIdFunc(r *http.Request) string {
+	return r.URL.Query().Get("media_id")
+}
+
+func (handler *MediaProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	mediaId := handler.mediaIdFunc(r)
+	if mediaId == "" {
+		http.Error(w, "media_id is empty", http.StatusBadRequest)
+		return
+	}
+
+	hasWritten := false
+	err := handler.clt.mediaDownload(mediaId, func(info *media.DownloadInfo, body io.Reader) (err error) {
+		header := w.Header()
+		if info.ContentType != "" {
+			header.Set("Content-Type", info.ContentType)
+		} else {
+			header.Set("Content-Type", "application/octet-stream")
+		}
+		if info.Filename != "" {
+			header.Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": info.Filename}))
+		}
+		if info.Size >= 0 {
+			header.Set("Content-Length", strconv.FormatInt(info.Size, 10))
+		}
+		w.WriteHeader(http.StatusOK)
+		hasWritten = true
+
+		if r.Method == "HEAD" {
+			return
+		}
+		_, err = io.Copy(w, body)
+		return
+	})
+	if err == nil || hasWritten {
+		return
+	}
+
+	switch v := err.(type) {
+	case *Error:
+		if v.ErrCode == errCodeInvalidMediaId {
+			http.Error(w, v.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, v.Error(), http.StatusBadGateway)
+	default:
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	}
+}
@@ -0,0 +1,152 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package client
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chanxuehong/wechat/mp/media"
+	"github.com/chanxuehong/wechat/mp/tokenservice"
+	"github.com/chanxuehong/wechat/wechattest"
+)
+
+// 在模拟服务器上准备一个图片和一个视频文件
+func newTestMediaServer() (srv *wechattest.Server, clt *Client, imageId, videoId string) {
+	srv = wechattest.NewServer(nil)
+	tokenService := tokenservice.NewDefaultTokenService(srv.AppId(), srv.AppSecret(), srv.Client())
+	clt = NewClient(tokenService, srv.Client())
+
+	imageId = srv.AddMedia(media.MEDIA_TYPE_IMAGE, "image.jpg", []byte("IMAGE DATA"))
+	videoId = srv.AddMedia(media.MEDIA_TYPE_VIDEO, "video.mp4", []byte("VIDEO DATA"))
+	return
+}
+
+func TestMediaDownloadToWriterWithInfo(t *testing.T) {
+	srv, clt, imageId, videoId := newTestMediaServer()
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	info, err := clt.MediaDownloadToWriterWithInfo(imageId, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "IMAGE DATA" {
+		t.Errorf("image body mismatch, have %q", buf.String())
+	}
+	if info.ContentType != "image/jpeg" || info.Filename != "image.jpg" || info.Size != int64(buf.Len()) || info.VideoURL != "" {
+		t.Errorf("image info mismatch, have %+v", info)
+	}
+
+	// 视频文件要继续下载 video_url
+	buf.Reset()
+	info, err = clt.MediaDownloadToWriterWithInfo(videoId, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "VIDEO DATA" {
+		t.Errorf("video body mismatch, have %q", buf.String())
+	}
+	if info.Filename != videoId+".mp4" || info.Size != int64(buf.Len()) ||
+		info.VideoURL != "http://vweixinf.tc.qq.com/"+videoId+".mp4" {
+		t.Errorf("video info mismatch, have %+v", info)
+	}
+
+	// json 格式的错误信息要转换为 *Error
+	buf.Reset()
+	_, err = clt.MediaDownloadToWriterWithInfo("BAD", &buf)
+	if e, ok := err.(*Error); !ok || e.ErrCode != errCodeInvalidMediaId {
+		t.Errorf("want *Error with errcode %d, have %#v", errCodeInvalidMediaId, err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("error body should not be written, have %q", buf.String())
+	}
+}
+
+func TestMediaDownloadWithInfo(t *testing.T) {
+	srv, clt, _, videoId := newTestMediaServer()
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "wechat-media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filepath_ := filepath.Join(dir, "video.mp4")
+	info, err := clt.MediaDownloadWithInfo(videoId, filepath_)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath_)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "VIDEO DATA" || info.Size != int64(len(data)) {
+		t.Errorf("file mismatch, have %q, info %+v", data, info)
+	}
+}
+
+func TestMediaProxyHandler(t *testing.T) {
+	srv, clt, imageId, videoId := newTestMediaServer()
+	defer srv.Close()
+
+	handler := NewMediaProxyHandler(clt, nil)
+
+	tests := []struct {
+		method      string
+		url         string
+		status      int
+		contentType string // 为空不检查
+		disposition string
+		length      string
+		body        string
+	}{
+		{"GET", "/media?media_id=" + imageId, http.StatusOK, "image/jpeg", `inline; filename=image.jpg`, "10", "IMAGE DATA"},
+		{"HEAD", "/media?media_id=" + imageId, http.StatusOK, "image/jpeg", `inline; filename=image.jpg`, "10", ""},
+		{"GET", "/media?media_id=" + videoId, http.StatusOK, "", `inline; filename=` + videoId + ".mp4", "10", "VIDEO DATA"},
+		{"GET", "/media?media_id=BAD", http.StatusNotFound, "", "", "", ""},
+		{"GET", "/media?media_id=BUSY", http.StatusBadGateway, "", "", "", ""},
+		{"GET", "/media", http.StatusBadRequest, "", "", "", ""},
+		{"POST", "/media?media_id=" + imageId, http.StatusMethodNotAllowed, "", "", "", ""},
+	}
+	for _, tt := range tests {
+		if tt.url == "/media?media_id=BUSY" { // 模拟服务器返回系统繁忙
+			srv.InjectError("/cgi-bin/media/get", -1, "system error", 1)
+		}
+		r, err := http.NewRequest(tt.method, tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Errorf("%s %s: status mismatch, have %d, want %d", tt.method, tt.url, w.Code, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		if have := w.Header().Get("Content-Type"); tt.contentType != "" && have != tt.contentType {
+			t.Errorf("%s %s: Content-Type mismatch, have %q, want %q", tt.method, tt.url, have, tt.contentType)
+		}
+		if have := w.Header().Get("Content-Disposition"); have != tt.disposition {
+			t.Errorf("%s %s: Content-Disposition mismatch, have %q, want %q", tt.method, tt.url, have, tt.disposition)
+		}
+		if have := w.Header().Get("Content-Length"); have != tt.length {
+			t.Errorf("%s %s: Content-Length mismatch, have %q, want %q", tt.method, tt.url, have, tt.length)
+		}
+		if w.Body.String() != tt.body {
+			t.Errorf("%s %s: body mismatch, have %q, want %q", tt.method, tt.url, w.Body.String(), tt.body)
+		}
+	}
+}
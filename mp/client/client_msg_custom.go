@@ -7,6 +7,7 @@ package client
 
 import (
 	"errors"
+	"time"
 
 	"github.com/chanxuehong/wechat/mp/message/active/custom"
 )
@@ -63,6 +64,10 @@ func (c *Client) MsgCustomSendNews(msg *custom.News) (err error) {
 }
 
 func (c *Client) msgCustomSend(msg interface{}) (err error) {
+	if c.archiveStore != nil {
+		defer func(start time.Time) { c.archiveSend(archiveKindCustom, msg, 0, start, err) }(time.Now())
+	}
+
 	var result Error
 
 	token, err := c.Token()
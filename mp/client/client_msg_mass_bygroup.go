@@ -7,6 +7,7 @@ package client
 
 import (
 	"errors"
+	"time"
 
 	"github.com/chanxuehong/wechat/mp/message/active/massbygroup"
 )
@@ -57,6 +58,10 @@ func (c *Client) MsgMassSendNewsByGroup(msg *massbygroup.News) (msgid int64, err
 }
 
 func (c *Client) msgMassSendByGroup(msg interface{}) (msgid int64, err error) {
+	if c.archiveStore != nil {
+		defer func(start time.Time) { c.archiveSend(archiveKindMassByGroup, msg, msgid, start, err) }(time.Now())
+	}
+
 	var result struct {
 		Error
 		MsgId int64 `json:"msg_id"`
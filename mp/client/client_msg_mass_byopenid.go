@@ -7,6 +7,7 @@ package client
 
 import (
 	"errors"
+	"time"
 
 	"github.com/chanxuehong/wechat/mp/message/active/massbyopenid"
 )
@@ -72,6 +73,10 @@ func (c *Client) MsgMassSendNewsByOpenId(msg *massbyopenid.News) (msgid int64, e
 }
 
 func (c *Client) msgMassSendByOpenId(msg interface{}) (msgid int64, err error) {
+	if c.archiveStore != nil {
+		defer func(start time.Time) { c.archiveSend(archiveKindMassByOpenId, msg, msgid, start, err) }(time.Now())
+	}
+
 	var result struct {
 		Error
 		MsgId int64 `json:"msg_id"`
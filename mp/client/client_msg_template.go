@@ -11,6 +11,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/chanxuehong/wechat/mp/message/active/template"
 )
@@ -21,6 +22,14 @@ func (c *Client) MsgTemplateSend(msg *template.Msg) (msgid int64, err error) {
 		err = errors.New("msg == nil")
 		return
 	}
+	if data, ok := msg.Data.(template.Data); ok {
+		if err = data.CheckValid(); err != nil {
+			return
+		}
+	}
+	if c.archiveStore != nil {
+		defer func(start time.Time) { c.archiveSend(archiveKindTemplate, msg, msgid, start, err) }(time.Now())
+	}
 
 	var result struct {
 		Error
@@ -67,6 +76,9 @@ func (c *Client) MsgTemplateSendRaw(msg []byte) (msgid int64, err error) {
 		err = errors.New("msg is empty")
 		return
 	}
+	if c.archiveStore != nil {
+		defer func(start time.Time) { c.archiveSend(archiveKindTemplate, msg, msgid, start, err) }(time.Now())
+	}
 
 	var result struct {
 		Error
@@ -0,0 +1,59 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package masscampaign
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/chanxuehong/wechat/mp/message/passive/request"
+	"github.com/chanxuehong/wechat/mp/server"
+)
+
+var _ server.Agent = new(Agent)
+
+// 包装一个 server.Agent, 收到群发结束的事件时先交给 Manager 更新 Campaign 的状态,
+// 然后再调用被包装的 Agent 的对应方法, 其他消息直接由被包装的 Agent 处理.
+type Agent struct {
+	server.Agent
+	manager *Manager
+}
+
+// 创建一个新的 Agent, agent 和 manager 都不能为 nil.
+func NewAgent(agent server.Agent, manager *Manager) *Agent {
+	if agent == nil {
+		panic("agent == nil")
+	}
+	if manager == nil {
+		panic("manager == nil")
+	}
+
+	return &Agent{
+		Agent:   agent,
+		manager: manager,
+	}
+}
+
+func (this *Agent) ServeMassSendJobFinishEvent(w http.ResponseWriter, r *http.Request,
+	event *request.MassSendJobFinishEvent, rawXMLMsg []byte, timestamp int64) {
+
+	this.handleMassSendJobFinishEvent(event)
+	this.Agent.ServeMassSendJobFinishEvent(w, r, event, rawXMLMsg, timestamp)
+}
+
+func (this *Agent) ServeAESMassSendJobFinishEvent(w http.ResponseWriter, r *http.Request,
+	event *request.MassSendJobFinishEvent, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+
+	this.handleMassSendJobFinishEvent(event)
+	this.Agent.ServeAESMassSendJobFinishEvent(w, r, event, rawXMLMsg, timestamp, nonce, AESKey, random)
+}
+
+// 不属于任何 Campaign 的事件忽略, 其他错误记录日志
+func (this *Agent) handleMassSendJobFinishEvent(event *request.MassSendJobFinishEvent) {
+	if err := this.manager.HandleMassSendJobFinishEvent(event); err != nil && err != ErrNotFound {
+		log.Printf("wechat: handle MASSSENDJOBFINISH event %d failed: %v", event.MsgId, err)
+	}
+}
@@ -0,0 +1,134 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package masscampaign
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/chanxuehong/wechat/mp/message/active/massbyopenid"
+)
+
+const (
+	JOB_STATUS_PENDING  = "pending"  // 还没有调用群发接口
+	JOB_STATUS_SENDING  = "sending"  // 正在调用群发接口; 进程在这时中断的话不知道是否已经发送, 不会自动重发
+	JOB_STATUS_SENT     = "sent"     // 调用群发接口成功, 等待群发结束的事件
+	JOB_STATUS_FAILED   = "failed"   // 调用群发接口失败
+	JOB_STATUS_FINISHED = "finished" // 已经收到群发结束的事件
+)
+
+// 群发的消息内容, 根据 MsgType 设置对应的字段.
+type Message struct {
+	MsgType     string `json:"msgtype"`               // massbyopenid.MSG_TYPE_TEXT, MSG_TYPE_IMAGE 等
+	Content     string `json:"content,omitempty"`     // 文本消息的内容
+	MediaId     string `json:"media_id,omitempty"`    // 图片, 语音, 视频, 图文消息的 media_id
+	Title       string `json:"title,omitempty"`       // 视频消息的标题
+	Description string `json:"description,omitempty"` // 视频消息的描述
+}
+
+// 检查 Message 是否有效，有效返回 nil，否则返回错误信息
+func (msg *Message) CheckValid() (err error) {
+	switch msg.MsgType {
+	case massbyopenid.MSG_TYPE_TEXT:
+		if msg.Content == "" {
+			err = errors.New("文本消息的内容是空的")
+		}
+	case massbyopenid.MSG_TYPE_IMAGE, massbyopenid.MSG_TYPE_VOICE,
+		massbyopenid.MSG_TYPE_VIDEO, massbyopenid.MSG_TYPE_NEWS:
+		if msg.MediaId == "" {
+			err = errors.New("media_id 是空的")
+		}
+	default:
+		err = fmt.Errorf("不支持的消息类型: %s", msg.MsgType)
+	}
+	return
+}
+
+// 一次群发接口调用
+type Job struct {
+	ToUser  []string `json:"touser"`           // 该 Job 的用户列表
+	Status  string   `json:"status"`           // JOB_STATUS_PENDING, JOB_STATUS_SENT 等
+	MsgId   int64    `json:"msg_id,omitempty"` // 群发接口返回的 msg_id
+	SendErr string   `json:"send_err,omitempty"`
+
+	// 下面的字段来自群发结束的事件 request.MassSendJobFinishEvent
+	FinishStatus string `json:"finish_status,omitempty"` // "send success", "send fail", "err(num)"
+	TotalCount   int    `json:"total_count,omitempty"`
+	FilterCount  int    `json:"filter_count,omitempty"`
+	SentCount    int    `json:"sent_count,omitempty"`
+	ErrorCount   int    `json:"error_count,omitempty"`
+}
+
+// 一次群发, 包含多个 Job
+type Campaign struct {
+	Id        string  `json:"id"`
+	Message   Message `json:"message"`
+	CreatedAt int64   `json:"created_at"` // unixtime
+	Jobs      []Job   `json:"jobs"`
+}
+
+// 深拷贝, 避免 Store 里的数据被外部修改
+func (c *Campaign) clone() *Campaign {
+	cc := *c
+	cc.Jobs = make([]Job, len(c.Jobs))
+	copy(cc.Jobs, c.Jobs)
+	return &cc
+}
+
+// Campaign 的汇总报告
+type Report struct {
+	CampaignId string `json:"campaign_id"`
+
+	UserCount    int  `json:"user_count"`    // 计划发送的用户数
+	JobCount     int  `json:"job_count"`     // Job 总数
+	PendingJobs  int  `json:"pending_jobs"`  // 还没有发送的 Job 数
+	SendingJobs  int  `json:"sending_jobs"`  // 正在调用群发接口的 Job 数
+	SentJobs     int  `json:"sent_jobs"`     // 已经发送, 等待群发结束事件的 Job 数
+	FailedJobs   int  `json:"failed_jobs"`   // 调用群发接口失败的 Job 数
+	FinishedJobs int  `json:"finished_jobs"` // 已经收到群发结束事件的 Job 数
+	RejectedJobs int  `json:"rejected_jobs"` // 群发结束事件的 Status 不是 "send success" 的 Job 数
+	TotalCount   int  `json:"total_count"`   // 群发结束事件的 TotalCount 之和
+	FilterCount  int  `json:"filter_count"`  // 群发结束事件的 FilterCount 之和
+	SentCount    int  `json:"sent_count"`    // 群发结束事件的 SentCount 之和
+	ErrorCount   int  `json:"error_count"`   // 群发结束事件的 ErrorCount 之和
+	Done         bool `json:"done"`          // 所有 Job 都已经失败或者结束
+}
+
+// 汇总 Campaign 的所有 Job
+func (c *Campaign) Report() (report *Report) {
+	report = &Report{
+		CampaignId: c.Id,
+		JobCount:   len(c.Jobs),
+	}
+
+	for i := range c.Jobs {
+		job := &c.Jobs[i]
+		report.UserCount += len(job.ToUser)
+
+		switch job.Status {
+		case JOB_STATUS_PENDING:
+			report.PendingJobs++
+		case JOB_STATUS_SENDING:
+			report.SendingJobs++
+		case JOB_STATUS_SENT:
+			report.SentJobs++
+		case JOB_STATUS_FAILED:
+			report.FailedJobs++
+		case JOB_STATUS_FINISHED:
+			report.FinishedJobs++
+			if job.FinishStatus != "send success" {
+				report.RejectedJobs++
+			}
+			report.TotalCount += job.TotalCount
+			report.FilterCount += job.FilterCount
+			report.SentCount += job.SentCount
+			report.ErrorCount += job.ErrorCount
+		}
+	}
+
+	report.Done = report.FailedJobs+report.FinishedJobs == report.JobCount
+	return
+}
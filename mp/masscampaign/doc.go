@@ -0,0 +1,10 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+// 根据 openid 列表群发消息的任务管理.
+//  一次群发(Campaign)按 massbyopenid.ToUserCountLimit 拆分成多个 Job, 每个 Job 调用一次群发接口;
+//  Job 的状态保存在 Store 里, 群发结束的事件(MASSSENDJOBFINISH)到达后更新对应 Job 的统计数据,
+//  最后汇总成整个 Campaign 的 Report.
+package masscampaign
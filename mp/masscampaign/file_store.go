@@ -0,0 +1,127 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package masscampaign
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var _ Store = new(FileStore)
+
+// 基于文件的 Store 实现, 每个 Campaign 保存为目录 dir 下的一个 json 文件.
+//  msg_id 的索引在创建的时候从文件中加载, 之后保存在内存中.
+type FileStore struct {
+	dir string
+
+	rwmutex sync.RWMutex
+	msgIds  map[int64]string // msg_id --> campaign id
+}
+
+// 创建一个新的 FileStore, 如果目录 dir 不存在则创建.
+func NewFileStore(dir string) (store *FileStore, err error) {
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+
+	store = &FileStore{
+		dir:    dir,
+		msgIds: make(map[int64]string),
+	}
+
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return
+	}
+	for _, name := range names {
+		id := strings.TrimSuffix(filepath.Base(name), ".json")
+
+		var campaign *Campaign
+		if campaign, err = store.Get(id); err != nil {
+			return
+		}
+		store.indexMsgIds(campaign)
+	}
+	return
+}
+
+func (this *FileStore) filename(id string) string {
+	return filepath.Join(this.dir, id+".json")
+}
+
+func (this *FileStore) indexMsgIds(campaign *Campaign) {
+	this.rwmutex.Lock()
+	for i := range campaign.Jobs {
+		if msgId := campaign.Jobs[i].MsgId; msgId != 0 {
+			this.msgIds[msgId] = campaign.Id
+		}
+	}
+	this.rwmutex.Unlock()
+}
+
+// 先写临时文件再重命名, 避免中断时文件内容不完整
+func (this *FileStore) Put(campaign *Campaign) (err error) {
+	if campaign == nil {
+		return errors.New("campaign == nil")
+	}
+	if campaign.Id == "" || strings.ContainsAny(campaign.Id, `/\`) {
+		return errors.New("invalid campaign id: " + campaign.Id)
+	}
+
+	data, err := json.Marshal(campaign)
+	if err != nil {
+		return
+	}
+
+	filename := this.filename(campaign.Id)
+	if err = ioutil.WriteFile(filename+".tmp", data, 0644); err != nil {
+		return
+	}
+	if err = os.Rename(filename+".tmp", filename); err != nil {
+		return
+	}
+
+	this.indexMsgIds(campaign)
+	return
+}
+
+func (this *FileStore) Get(id string) (campaign *Campaign, err error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		err = errors.New("invalid campaign id: " + id)
+		return
+	}
+
+	data, err := ioutil.ReadFile(this.filename(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = ErrNotFound
+		}
+		return
+	}
+
+	campaign = new(Campaign)
+	if err = json.Unmarshal(data, campaign); err != nil {
+		campaign = nil
+		return
+	}
+	return
+}
+
+func (this *FileStore) GetIdByMsgId(msgId int64) (id string, err error) {
+	this.rwmutex.RLock()
+	id, ok := this.msgIds[msgId]
+	this.rwmutex.RUnlock()
+
+	if !ok {
+		err = ErrNotFound
+	}
+	return
+}
@@ -0,0 +1,301 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package masscampaign
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chanxuehong/wechat/mp/client"
+	"github.com/chanxuehong/wechat/mp/message/active/massbyopenid"
+	"github.com/chanxuehong/wechat/mp/message/passive/request"
+)
+
+// 管理群发任务: 拆分用户列表, 调用群发接口, 保存任务状态, 处理群发结束的事件.
+type Manager struct {
+	clt       *client.Client
+	store     Store
+	chunkSize int
+
+	// 保证同一时刻只有一个 goroutine 在"读取-修改-保存" Campaign, 同时保护 sending 和 earlyEvents
+	mutex sync.Mutex
+
+	// 正在调用群发接口的 Job 数; 这期间找不到 msg_id 的群发结束事件可能比接口先返回,
+	// 先保存在 earlyEvents, 拿到 msg_id 以后再处理
+	sending     int
+	earlyEvents map[int64]*request.MassSendJobFinishEvent
+}
+
+// 创建一个新的 Manager.
+//  如果 store == nil 则默认用 NewMemoryStore();
+//  chunkSize 是每次调用群发接口的用户数, 如果 chunkSize <= 0 或者 chunkSize > massbyopenid.ToUserCountLimit
+//  则用 massbyopenid.ToUserCountLimit.
+func NewManager(clt *client.Client, store Store, chunkSize int) *Manager {
+	if clt == nil {
+		panic("clt == nil")
+	}
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	if chunkSize <= 0 || chunkSize > massbyopenid.ToUserCountLimit {
+		chunkSize = massbyopenid.ToUserCountLimit
+	}
+
+	return &Manager{
+		clt:       clt,
+		store:     store,
+		chunkSize: chunkSize,
+	}
+}
+
+// 创建并保存一个新的 Campaign, openids 按 chunkSize 拆分成多个 Job, 此时还没有发送.
+func (m *Manager) Create(msg *Message, openids []string) (campaign *Campaign, err error) {
+	if msg == nil {
+		err = errors.New("msg == nil")
+		return
+	}
+	if err = msg.CheckValid(); err != nil {
+		return
+	}
+	if len(openids) == 0 {
+		err = errors.New("用户列表是空的")
+		return
+	}
+
+	id, err := newCampaignId()
+	if err != nil {
+		return
+	}
+
+	campaign = &Campaign{
+		Id:        id,
+		Message:   *msg,
+		CreatedAt: time.Now().Unix(),
+		Jobs:      make([]Job, 0, (len(openids)+m.chunkSize-1)/m.chunkSize),
+	}
+	for len(openids) > 0 {
+		n := m.chunkSize
+		if n > len(openids) {
+			n = len(openids)
+		}
+		campaign.Jobs = append(campaign.Jobs, Job{
+			ToUser: openids[:n:n],
+			Status: JOB_STATUS_PENDING,
+		})
+		openids = openids[n:]
+	}
+
+	if err = m.store.Put(campaign); err != nil {
+		campaign = nil
+		return
+	}
+	return
+}
+
+// 发送 Campaign 中所有状态为 JOB_STATUS_PENDING 的 Job, 每发送一个 Job 保存一次状态.
+//  中断之后再次调用 Send 会从没有发送的 Job 继续; 调用失败的 Job 不会自动重发, 见 Retry.
+//  单个 Job 调用群发接口失败不会中断发送, 错误记录在 Job.SendErr 里; 返回的 err 只表示存储出错.
+//  调用群发接口之前先把 Job 改为 JOB_STATUS_SENDING, 并发调用 Send 或者 Retry 的时候每个 Job 只会发送一次.
+func (m *Manager) Send(campaignId string) (report *Report, err error) {
+	campaign, err := m.store.Get(campaignId)
+	if err != nil {
+		return
+	}
+
+	for i := range campaign.Jobs {
+		claimed := false
+		if err = m.updateJob(campaignId, i, func(job *Job) bool {
+			if job.Status != JOB_STATUS_PENDING {
+				return false
+			}
+			job.Status = JOB_STATUS_SENDING
+			claimed = true
+			return true
+		}); err != nil {
+			return
+		}
+		if !claimed {
+			continue
+		}
+
+		m.mutex.Lock()
+		m.sending++
+		m.mutex.Unlock()
+
+		msgId, sendErr := m.send(&campaign.Message, campaign.Jobs[i].ToUser)
+
+		if err = m.sent(campaignId, i, msgId, sendErr); err != nil {
+			return
+		}
+	}
+
+	return m.Report(campaignId)
+}
+
+// 把 Campaign 中调用群发接口失败的 Job 重置为 JOB_STATUS_PENDING 并重新发送.
+func (m *Manager) Retry(campaignId string) (report *Report, err error) {
+	m.mutex.Lock()
+	campaign, err := m.store.Get(campaignId)
+	if err != nil {
+		m.mutex.Unlock()
+		return
+	}
+	for i := range campaign.Jobs {
+		if campaign.Jobs[i].Status == JOB_STATUS_FAILED {
+			campaign.Jobs[i].Status = JOB_STATUS_PENDING
+		}
+	}
+	err = m.store.Put(campaign)
+	m.mutex.Unlock()
+
+	if err != nil {
+		return
+	}
+	return m.Send(campaignId)
+}
+
+// 获取 Campaign 的汇总报告
+func (m *Manager) Report(campaignId string) (report *Report, err error) {
+	campaign, err := m.store.Get(campaignId)
+	if err != nil {
+		return
+	}
+	report = campaign.Report()
+	return
+}
+
+// 处理群发结束的事件, 更新对应 Job 的统计数据.
+//  如果 event.MsgId 不属于任何 Campaign 返回 ErrNotFound;
+//  事件比群发接口先返回的时候先保存起来, 拿到 msg_id 以后再更新, 这时返回 nil.
+func (m *Manager) HandleMassSendJobFinishEvent(event *request.MassSendJobFinishEvent) (err error) {
+	if event == nil {
+		return errors.New("event == nil")
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	campaignId, err := m.store.GetIdByMsgId(event.MsgId)
+	if err == ErrNotFound && m.sending > 0 {
+		if m.earlyEvents == nil {
+			m.earlyEvents = make(map[int64]*request.MassSendJobFinishEvent)
+		}
+		m.earlyEvents[event.MsgId] = event
+		return nil
+	}
+	if err != nil {
+		return
+	}
+
+	campaign, err := m.store.Get(campaignId)
+	if err != nil {
+		return
+	}
+	for i := range campaign.Jobs {
+		job := &campaign.Jobs[i]
+		if job.MsgId != event.MsgId {
+			continue
+		}
+		finishJob(job, event)
+		return m.store.Put(campaign)
+	}
+	return ErrNotFound
+}
+
+// 根据群发结束的事件更新 job 的统计数据
+func finishJob(job *Job, event *request.MassSendJobFinishEvent) {
+	job.Status = JOB_STATUS_FINISHED
+	job.FinishStatus = event.Status
+	job.TotalCount = event.TotalCount
+	job.FilterCount = event.FilterCount
+	job.SentCount = event.SentCount
+	job.ErrorCount = event.ErrorCount
+}
+
+// 保存第 index 个 Job 调用群发接口的结果, 如果群发结束的事件已经先到了则一起更新
+func (m *Manager) sent(campaignId string, index int, msgId int64, sendErr error) (err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.sending--
+	defer func() {
+		// 没有正在发送的 Job 了, 剩下的事件不属于任何 Campaign
+		if m.sending == 0 {
+			m.earlyEvents = nil
+		}
+	}()
+
+	return m.updateJobLocked(campaignId, index, func(job *Job) bool {
+		if sendErr != nil {
+			job.Status = JOB_STATUS_FAILED
+			job.SendErr = sendErr.Error()
+			return true
+		}
+		job.Status = JOB_STATUS_SENT
+		job.MsgId = msgId
+		job.SendErr = ""
+		if event := m.earlyEvents[msgId]; event != nil {
+			delete(m.earlyEvents, msgId)
+			finishJob(job, event)
+		}
+		return true
+	})
+}
+
+// 在锁里"读取-修改-保存"第 index 个 Job, update 返回 false 表示没有修改, 不用保存
+func (m *Manager) updateJob(campaignId string, index int, update func(job *Job) bool) (err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.updateJobLocked(campaignId, index, update)
+}
+
+// 同 updateJob, 调用者持有锁
+func (m *Manager) updateJobLocked(campaignId string, index int, update func(job *Job) bool) (err error) {
+	campaign, err := m.store.Get(campaignId)
+	if err != nil {
+		return
+	}
+	if index >= len(campaign.Jobs) {
+		return fmt.Errorf("job index out of range: %d", index)
+	}
+	if !update(&campaign.Jobs[index]) {
+		return
+	}
+	return m.store.Put(campaign)
+}
+
+func (m *Manager) send(msg *Message, toUser []string) (msgId int64, err error) {
+	switch msg.MsgType {
+	case massbyopenid.MSG_TYPE_TEXT:
+		return m.clt.MsgMassSendTextByOpenId(massbyopenid.NewText(toUser, msg.Content))
+	case massbyopenid.MSG_TYPE_IMAGE:
+		return m.clt.MsgMassSendImageByOpenId(massbyopenid.NewImage(toUser, msg.MediaId))
+	case massbyopenid.MSG_TYPE_VOICE:
+		return m.clt.MsgMassSendVoiceByOpenId(massbyopenid.NewVoice(toUser, msg.MediaId))
+	case massbyopenid.MSG_TYPE_VIDEO:
+		return m.clt.MsgMassSendVideoByOpenId(massbyopenid.NewVideo(toUser, msg.MediaId, msg.Title, msg.Description))
+	case massbyopenid.MSG_TYPE_NEWS:
+		return m.clt.MsgMassSendNewsByOpenId(massbyopenid.NewNews(toUser, msg.MediaId))
+	default:
+		err = fmt.Errorf("不支持的消息类型: %s", msg.MsgType)
+		return
+	}
+}
+
+// 生成 Campaign 的 id, 格式为 unixtime-16位随机十六进制字符串
+func newCampaignId() (id string, err error) {
+	var random [8]byte
+	if _, err = rand.Read(random[:]); err != nil {
+		return
+	}
+	id = strconv.FormatInt(time.Now().Unix(), 10) + "-" + hex.EncodeToString(random[:])
+	return
+}
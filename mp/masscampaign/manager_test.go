@@ -0,0 +1,209 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package masscampaign
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/wechat/mp/client"
+	"github.com/chanxuehong/wechat/mp/message/active/massbyopenid"
+	"github.com/chanxuehong/wechat/mp/message/passive/request"
+	"github.com/chanxuehong/wechat/mp/tokenservice"
+	"github.com/chanxuehong/wechat/mp/user"
+	"github.com/chanxuehong/wechat/wechattest"
+)
+
+func TestManagerFinishEvent(t *testing.T) {
+	m := &Manager{
+		store:     NewMemoryStore(),
+		chunkSize: 2,
+	}
+
+	openids := []string{"o1", "o2", "o3", "o4", "o5"}
+	campaign, err := m.Create(&Message{MsgType: massbyopenid.MSG_TYPE_TEXT, Content: "hello"}, openids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(campaign.Jobs) != 3 {
+		t.Fatalf("len(Jobs): have %d, want 3", len(campaign.Jobs))
+	}
+
+	// 模拟调用群发接口的结果
+	for i := range campaign.Jobs {
+		i := i
+		m.updateJob(campaign.Id, i, func(job *Job) bool {
+			if i == 2 {
+				job.Status = JOB_STATUS_FAILED
+				job.SendErr = "errcode: 45028, errmsg: has no masssend quota"
+				return true
+			}
+			job.Status = JOB_STATUS_SENT
+			job.MsgId = int64(1000 + i)
+			return true
+		})
+	}
+
+	for i := 0; i < 2; i++ {
+		event := &request.MassSendJobFinishEvent{
+			MsgId:       int64(1000 + i),
+			Status:      "send success",
+			TotalCount:  2,
+			FilterCount: 2,
+			SentCount:   2 - i,
+			ErrorCount:  i,
+		}
+		if err = m.HandleMassSendJobFinishEvent(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = m.HandleMassSendJobFinishEvent(&request.MassSendJobFinishEvent{MsgId: 9999}); err != ErrNotFound {
+		t.Errorf("unknown msg_id: have %v, want ErrNotFound", err)
+	}
+
+	report, err := m.Report(campaign.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("%+v", Report{
+		CampaignId:   campaign.Id,
+		UserCount:    5,
+		JobCount:     3,
+		FailedJobs:   1,
+		FinishedJobs: 2,
+		TotalCount:   4,
+		FilterCount:  4,
+		SentCount:    3,
+		ErrorCount:   1,
+		Done:         true,
+	})
+	if have := fmt.Sprintf("%+v", *report); have != want {
+		t.Errorf("Report:\nhave %s\nwant %s", have, want)
+	}
+}
+
+// 在模拟服务器上准备关注用户 openids
+func newTestManager(openids []string, chunkSize int, base http.RoundTripper) (srv *wechattest.Server, m *Manager) {
+	srv = wechattest.NewServer(nil)
+	for _, openid := range openids {
+		srv.AddUser(user.UserInfo{OpenId: openid})
+	}
+	httpClient := &http.Client{Transport: wechattest.NewTransport(srv.URL(), base)}
+	clt := client.NewClient(tokenservice.NewDefaultTokenService(srv.AppId(), srv.AppSecret(), httpClient), httpClient)
+	m = NewManager(clt, nil, chunkSize)
+	return
+}
+
+func TestManagerSendAndRetry(t *testing.T) {
+	const path = "/cgi-bin/message/mass/send"
+
+	openids := []string{"o1", "o2", "o3", "o4", "o5"}
+	srv, m := newTestManager(openids, 2, nil)
+	defer srv.Close()
+	srv.SetLatency(10 * time.Millisecond) // 让并发的 Send 有机会重叠
+
+	campaign, err := m.Create(&Message{MsgType: massbyopenid.MSG_TYPE_TEXT, Content: "hello"}, openids)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟第一次调用群发接口没有群发配额
+	srv.InjectError(path, 45028, "has no masssend quota", 1)
+
+	// 并发调用 Send, 每个 Job 只能发送一次
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.Send(campaign.Id); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	report, err := m.Report(campaign.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.SentJobs != 2 || report.FailedJobs != 1 || report.PendingJobs != 0 || report.SendingJobs != 0 {
+		t.Errorf("after Send: %+v", report)
+	}
+	if n := srv.Calls(path); n != 3 {
+		t.Errorf("after Send: calls = %d, want 3", n)
+	}
+
+	// Retry 只重发失败的 Job
+	if report, err = m.Retry(campaign.Id); err != nil {
+		t.Fatal(err)
+	}
+	if report.SentJobs != 3 || report.FailedJobs != 0 {
+		t.Errorf("after Retry: %+v", report)
+	}
+	if n := srv.Calls(path); n != 4 {
+		t.Errorf("after Retry: calls = %d, want 4", n)
+	}
+	if n := len(srv.Messages()); n != 3 {
+		t.Errorf("after Retry: messages = %d, want 3", n)
+	}
+}
+
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return fn(r) }
+
+func TestManagerEarlyFinishEvent(t *testing.T) {
+	var (
+		srv *wechattest.Server
+		m   *Manager
+	)
+	// 群发接口返回之前先收到群发结束的事件
+	base := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil || r.URL.Path != "/cgi-bin/message/mass/send" {
+			return resp, err
+		}
+		messages := srv.Messages()
+		event := &request.MassSendJobFinishEvent{
+			MsgId:      messages[len(messages)-1].MsgId,
+			Status:     "send success",
+			TotalCount: 2,
+			SentCount:  2,
+		}
+		if err := m.HandleMassSendJobFinishEvent(event); err != nil {
+			t.Errorf("early event: %v", err)
+		}
+		return resp, nil
+	})
+
+	openids := []string{"o1", "o2"}
+	srv, m = newTestManager(openids, 2, base)
+	defer srv.Close()
+
+	campaign, err := m.Create(&Message{MsgType: massbyopenid.MSG_TYPE_TEXT, Content: "hello"}, openids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := m.Send(campaign.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.FinishedJobs != 1 || report.SentCount != 2 || !report.Done {
+		t.Errorf("report: %+v", report)
+	}
+
+	// 没有正在发送的 Job, 不认识的事件不再保存
+	if err = m.HandleMassSendJobFinishEvent(&request.MassSendJobFinishEvent{MsgId: 9999}); err != ErrNotFound {
+		t.Errorf("unknown msg_id: have %v, want ErrNotFound", err)
+	}
+	if m.earlyEvents != nil {
+		t.Errorf("earlyEvents should be nil, have %v", m.earlyEvents)
+	}
+}
@@ -0,0 +1,84 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package masscampaign
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrNotFound = errors.New("campaign not found")
+
+// Campaign 的存储接口
+type Store interface {
+	// 添加或者覆盖 Campaign
+	Put(campaign *Campaign) (err error)
+
+	// 获取 Campaign
+	//  NOTE: 如果没有找到返回 ErrNotFound
+	Get(id string) (campaign *Campaign, err error)
+
+	// 根据群发接口返回的 msg_id 查找所属 Campaign 的 id
+	//  NOTE: 如果没有找到返回 ErrNotFound
+	GetIdByMsgId(msgId int64) (id string, err error)
+}
+
+var _ Store = new(MemoryStore)
+
+// 基于内存的 Store 实现
+type MemoryStore struct {
+	rwmutex   sync.RWMutex
+	campaigns map[string]*Campaign
+	msgIds    map[int64]string // msg_id --> campaign id
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		campaigns: make(map[string]*Campaign),
+		msgIds:    make(map[int64]string),
+	}
+}
+
+func (this *MemoryStore) Put(campaign *Campaign) (err error) {
+	if campaign == nil {
+		return errors.New("campaign == nil")
+	}
+	campaign = campaign.clone()
+
+	this.rwmutex.Lock()
+	this.campaigns[campaign.Id] = campaign
+	for i := range campaign.Jobs {
+		if msgId := campaign.Jobs[i].MsgId; msgId != 0 {
+			this.msgIds[msgId] = campaign.Id
+		}
+	}
+	this.rwmutex.Unlock()
+	return
+}
+
+func (this *MemoryStore) Get(id string) (campaign *Campaign, err error) {
+	this.rwmutex.RLock()
+	campaign, ok := this.campaigns[id]
+	this.rwmutex.RUnlock()
+
+	if !ok {
+		err = ErrNotFound
+		return
+	}
+	campaign = campaign.clone()
+	return
+}
+
+func (this *MemoryStore) GetIdByMsgId(msgId int64) (id string, err error) {
+	this.rwmutex.RLock()
+	id, ok := this.msgIds[msgId]
+	this.rwmutex.RUnlock()
+
+	if !ok {
+		err = ErrNotFound
+	}
+	return
+}
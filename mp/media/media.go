@@ -22,3 +22,11 @@ type NewsArticle struct {
 	Digest           string `json:"digest,omitempty"`             // 图文消息的描述
 	ShowCoverPic     int    `json:"show_cover_pic"`               // 是否显示封面，1为显示，0为不显示
 }
+
+// 下载多媒体文件时的文件信息
+type DownloadInfo struct {
+	ContentType string // 文件的 MIME 类型, 如 image/jpeg
+	Filename    string // 文件名称, 从 Content-Disposition 中获取, 可能为空
+	Size        int64  // 文件大小(字节); 下载完成前如果微信服务器没有返回 Content-Length 则为 -1
+	VideoURL    string // 视频文件的下载地址, 只有视频文件才有
+}
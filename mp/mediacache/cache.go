@@ -0,0 +1,228 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package mediacache
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/chanxuehong/wechat/mp/client"
+	"github.com/chanxuehong/wechat/mp/media"
+)
+
+const (
+	MediaExpiresIn = 3 * 24 * 60 * 60 // 临时多媒体文件的有效期, 单位秒
+
+	DefaultRefreshAhead = time.Hour // 默认提前多久重新上传
+)
+
+// 在 client.Client 前面加一层缓存, 相同内容的文件在有效期内只上传一次.
+type Cache struct {
+	clt          *client.Client
+	storage      Storage
+	refreshAhead int64 // 单位秒
+
+	mutex    sync.Mutex
+	inflight map[string]*uploadCall // 正在上传的文件, 避免并发时重复上传
+}
+
+type uploadCall struct {
+	wg   sync.WaitGroup
+	info *media.MediaInfo
+	err  error
+}
+
+// 创建一个新的 Cache.
+//  如果 storage == nil 则默认用 NewMemoryStorage();
+//  refreshAhead 表示在 created_at + 3天 之前多久就重新上传, 如果 refreshAhead <= 0 则默认用 DefaultRefreshAhead.
+func NewCache(clt *client.Client, storage Storage, refreshAhead time.Duration) *Cache {
+	if clt == nil {
+		panic("clt == nil")
+	}
+	if storage == nil {
+		storage = NewMemoryStorage()
+	}
+	if refreshAhead <= 0 {
+		refreshAhead = DefaultRefreshAhead
+	}
+
+	return &Cache{
+		clt:          clt,
+		storage:      storage,
+		refreshAhead: int64(refreshAhead / time.Second),
+		inflight:     make(map[string]*uploadCall),
+	}
+}
+
+// 上传多媒体图片, 如果缓存里有相同内容且仍然有效的 media_id 则直接返回.
+func (c *Cache) MediaUploadImage(filepath_ string) (info *media.MediaInfo, err error) {
+	return c.mediaUpload(media.MEDIA_TYPE_IMAGE, filepath_)
+}
+
+// 上传多媒体语音, 如果缓存里有相同内容且仍然有效的 media_id 则直接返回.
+func (c *Cache) MediaUploadVoice(filepath_ string) (info *media.MediaInfo, err error) {
+	return c.mediaUpload(media.MEDIA_TYPE_VOICE, filepath_)
+}
+
+// 上传多媒体视频, 如果缓存里有相同内容且仍然有效的 media_id 则直接返回.
+func (c *Cache) MediaUploadVideo(filepath_ string) (info *media.MediaInfo, err error) {
+	return c.mediaUpload(media.MEDIA_TYPE_VIDEO, filepath_)
+}
+
+// 上传多媒体缩略图, 如果缓存里有相同内容且仍然有效的 media_id 则直接返回.
+func (c *Cache) MediaUploadThumb(filepath_ string) (info *media.MediaInfo, err error) {
+	return c.mediaUpload(media.MEDIA_TYPE_THUMB, filepath_)
+}
+
+// 上传多媒体图片, 如果缓存里有相同内容且仍然有效的 media_id 则直接返回.
+//  NOTE: 参数 filename 不是文件路径, 是指定 multipart form 里面文件名称;
+//  mediaReader 的内容会全部读到内存中计算 hash.
+func (c *Cache) MediaUploadImageFromReader(filename string, mediaReader io.Reader) (info *media.MediaInfo, err error) {
+	return c.mediaUploadFromReader(media.MEDIA_TYPE_IMAGE, filename, mediaReader)
+}
+
+// 上传多媒体语音, 如果缓存里有相同内容且仍然有效的 media_id 则直接返回.
+//  NOTE: 参数 filename 不是文件路径, 是指定 multipart form 里面文件名称;
+//  mediaReader 的内容会全部读到内存中计算 hash.
+func (c *Cache) MediaUploadVoiceFromReader(filename string, mediaReader io.Reader) (info *media.MediaInfo, err error) {
+	return c.mediaUploadFromReader(media.MEDIA_TYPE_VOICE, filename, mediaReader)
+}
+
+// 上传多媒体视频, 如果缓存里有相同内容且仍然有效的 media_id 则直接返回.
+//  NOTE: 参数 filename 不是文件路径, 是指定 multipart form 里面文件名称;
+//  mediaReader 的内容会全部读到内存中计算 hash.
+func (c *Cache) MediaUploadVideoFromReader(filename string, mediaReader io.Reader) (info *media.MediaInfo, err error) {
+	return c.mediaUploadFromReader(media.MEDIA_TYPE_VIDEO, filename, mediaReader)
+}
+
+// 上传多媒体缩略图, 如果缓存里有相同内容且仍然有效的 media_id 则直接返回.
+//  NOTE: 参数 filename 不是文件路径, 是指定 multipart form 里面文件名称;
+//  mediaReader 的内容会全部读到内存中计算 hash.
+func (c *Cache) MediaUploadThumbFromReader(filename string, mediaReader io.Reader) (info *media.MediaInfo, err error) {
+	return c.mediaUploadFromReader(media.MEDIA_TYPE_THUMB, filename, mediaReader)
+}
+
+// 删除缓存中 mediaType 类型, 内容为 content 的文件对应的 media_id, 下次上传时会重新上传.
+func (c *Cache) Forget(mediaType string, content []byte) (err error) {
+	sum := sha1.Sum(content)
+	return c.storage.Delete(cacheKey(mediaType, sum[:]))
+}
+
+func (c *Cache) mediaUpload(mediaType, filepath_ string) (info *media.MediaInfo, err error) {
+	file, err := os.Open(filepath_)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	hash := sha1.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return
+	}
+	key := cacheKey(mediaType, hash.Sum(nil))
+
+	return c.upload(key, func() (*media.MediaInfo, error) {
+		if _, err := file.Seek(0, 0); err != nil {
+			return nil, err
+		}
+		return c.clientUpload(mediaType, filepath.Base(filepath_), file)
+	})
+}
+
+func (c *Cache) mediaUploadFromReader(mediaType, filename string, mediaReader io.Reader) (info *media.MediaInfo, err error) {
+	if filename == "" {
+		err = errors.New(`filename == ""`)
+		return
+	}
+	if mediaReader == nil {
+		err = errors.New("mediaReader == nil")
+		return
+	}
+
+	var buf bytes.Buffer
+	if _, err = buf.ReadFrom(mediaReader); err != nil {
+		return
+	}
+	content := buf.Bytes()
+	sum := sha1.Sum(content)
+	key := cacheKey(mediaType, sum[:])
+
+	return c.upload(key, func() (*media.MediaInfo, error) {
+		return c.clientUpload(mediaType, filename, bytes.NewReader(content))
+	})
+}
+
+// 查找缓存, 没有找到或者快要过期的时候调用 uploadFunc 重新上传并更新缓存.
+func (c *Cache) upload(key string, uploadFunc func() (*media.MediaInfo, error)) (info *media.MediaInfo, err error) {
+	if info, err = c.storage.Get(key); err == nil {
+		if c.isValid(info) {
+			return
+		}
+	} else if err != ErrCacheMiss {
+		return
+	}
+
+	c.mutex.Lock()
+	if call, ok := c.inflight[key]; ok {
+		c.mutex.Unlock()
+		call.wg.Wait()
+		return call.info, call.err
+	}
+	call := new(uploadCall)
+	call.wg.Add(1)
+	c.inflight[key] = call
+	c.mutex.Unlock()
+
+	defer func() {
+		c.mutex.Lock()
+		delete(c.inflight, key)
+		c.mutex.Unlock()
+
+		call.info, call.err = info, err
+		call.wg.Done()
+	}()
+
+	if info, err = uploadFunc(); err != nil {
+		return
+	}
+	if info.CreatedAt <= 0 {
+		info.CreatedAt = time.Now().Unix()
+	}
+	err = c.storage.Put(key, info)
+	return
+}
+
+func (c *Cache) isValid(info *media.MediaInfo) bool {
+	return info.MediaId != "" && time.Now().Unix() < info.CreatedAt+MediaExpiresIn-c.refreshAhead
+}
+
+func (c *Cache) clientUpload(mediaType, filename string, reader io.Reader) (info *media.MediaInfo, err error) {
+	switch mediaType {
+	case media.MEDIA_TYPE_IMAGE:
+		return c.clt.MediaUploadImageFromReader(filename, reader)
+	case media.MEDIA_TYPE_VOICE:
+		return c.clt.MediaUploadVoiceFromReader(filename, reader)
+	case media.MEDIA_TYPE_VIDEO:
+		return c.clt.MediaUploadVideoFromReader(filename, reader)
+	case media.MEDIA_TYPE_THUMB:
+		return c.clt.MediaUploadThumbFromReader(filename, reader)
+	default:
+		err = errors.New("unknown media type: " + mediaType)
+		return
+	}
+}
+
+// 缓存的 key, 格式为 mediaType:hex(sha1(content))
+func cacheKey(mediaType string, sum []byte) string {
+	return mediaType + ":" + hex.EncodeToString(sum)
+}
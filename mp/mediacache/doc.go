@@ -0,0 +1,9 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+// 临时多媒体文件上传缓存.
+//  相同内容(同一种媒体类型)的文件只上传一次, 在 media_id 有效期内复用,
+//  快要过期的时候再重新上传.
+package mediacache
@@ -0,0 +1,76 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package mediacache
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/chanxuehong/wechat/mp/media"
+)
+
+var _ Storage = new(MemoryStorage)
+
+// 基于内存的 Storage 实现, 已经过期的记录会在 Put 的时候定期清理.
+type MemoryStorage struct {
+	rwmutex   sync.RWMutex
+	items     map[string]media.MediaInfo
+	lastPurge int64 // 上次清理过期记录的时间, unixtime
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		items: make(map[string]media.MediaInfo),
+	}
+}
+
+func (this *MemoryStorage) Get(key string) (info *media.MediaInfo, err error) {
+	this.rwmutex.RLock()
+	item, ok := this.items[key]
+	this.rwmutex.RUnlock()
+
+	if !ok {
+		err = ErrCacheMiss
+		return
+	}
+	info = &item
+	return
+}
+
+func (this *MemoryStorage) Put(key string, info *media.MediaInfo) (err error) {
+	if info == nil {
+		return errors.New("info == nil")
+	}
+
+	now := time.Now().Unix()
+
+	this.rwmutex.Lock()
+	defer this.rwmutex.Unlock()
+
+	if this.items == nil {
+		this.items = make(map[string]media.MediaInfo)
+	}
+	this.items[key] = *info
+
+	// 每小时最多清理一次已经过期的记录
+	if now-this.lastPurge >= 3600 {
+		this.lastPurge = now
+		for k, v := range this.items {
+			if v.CreatedAt+MediaExpiresIn <= now {
+				delete(this.items, k)
+			}
+		}
+	}
+	return
+}
+
+func (this *MemoryStorage) Delete(key string) (err error) {
+	this.rwmutex.Lock()
+	delete(this.items, key)
+	this.rwmutex.Unlock()
+	return
+}
@@ -0,0 +1,27 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package mediacache
+
+import (
+	"errors"
+
+	"github.com/chanxuehong/wechat/mp/media"
+)
+
+var ErrCacheMiss = errors.New("media cache miss")
+
+// 缓存上传结果的存储接口, key 由媒体类型和文件内容的 hash 组成.
+type Storage interface {
+	// 获取 key 对应的 MediaInfo
+	//  NOTE: 如果没有找到返回 ErrCacheMiss
+	Get(key string) (info *media.MediaInfo, err error)
+
+	// 添加或者重置 key 对应的 MediaInfo
+	Put(key string, info *media.MediaInfo) (err error)
+
+	// 删除 key 对应的 MediaInfo, key 不存在时返回 nil
+	Delete(key string) (err error)
+}
@@ -0,0 +1,69 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package menu
+
+import (
+	"fmt"
+)
+
+// 比较两个菜单, 返回可读的差异列表, 没有差异返回空列表.
+//  按钮按位置一一比较, 每一行的格式为:
+//  + button[1].sub_button[0] {type: click, name: "赞一下", key: "V1001_GOOD"}
+//  - button[2] {name: "菜单"}
+//  ~ button[0].name: "今日歌曲" -> "今日推荐"
+func Diff(from, to *Menu) (diff []string) {
+	return diffButtons("button", from.Buttons, to.Buttons, diff)
+}
+
+func diffButtons(path string, from, to []Button, diff []string) []string {
+	n := len(from)
+	if len(to) > n {
+		n = len(to)
+	}
+
+	for i := 0; i < n; i++ {
+		btnPath := fmt.Sprintf("%s[%d]", path, i)
+		switch {
+		case i >= len(from):
+			diff = append(diff, "+ "+btnPath+" "+to[i].summary())
+			diff = diffButtons(btnPath+".sub_button", nil, to[i].SubButtons, diff)
+		case i >= len(to):
+			diff = append(diff, "- "+btnPath+" "+from[i].summary())
+		default:
+			diff = diffField(btnPath+".type", from[i].Type, to[i].Type, diff)
+			diff = diffField(btnPath+".name", from[i].Name, to[i].Name, diff)
+			diff = diffField(btnPath+".key", from[i].Key, to[i].Key, diff)
+			diff = diffField(btnPath+".url", from[i].URL, to[i].URL, diff)
+			diff = diffButtons(btnPath+".sub_button", from[i].SubButtons, to[i].SubButtons, diff)
+		}
+	}
+	return diff
+}
+
+func diffField(path, from, to string, diff []string) []string {
+	if from == to {
+		return diff
+	}
+	return append(diff, fmt.Sprintf("~ %s: %q -> %q", path, from, to))
+}
+
+func (btn *Button) summary() string {
+	s := "{"
+	if btn.Type != "" {
+		s += "type: " + btn.Type + ", "
+	}
+	s += fmt.Sprintf("name: %q", btn.Name)
+	if btn.Key != "" {
+		s += fmt.Sprintf(", key: %q", btn.Key)
+	}
+	if btn.URL != "" {
+		s += fmt.Sprintf(", url: %q", btn.URL)
+	}
+	if len(btn.SubButtons) > 0 {
+		s += fmt.Sprintf(", sub_button: %d", len(btn.SubButtons))
+	}
+	return s + "}"
+}
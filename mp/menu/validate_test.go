@@ -0,0 +1,81 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package menu
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestMenu() *Menu {
+	var subButtons = make([]Button, 2)
+	subButtons[0].InitToViewButton("搜索", "http://www.soso.com/")
+	subButtons[1].InitToClickButton("赞一下我们", "V1001_GOOD")
+
+	var mn Menu
+	mn.Buttons = make([]Button, 2)
+	mn.Buttons[0].InitToClickButton("今日歌曲", "V1001_TODAY_MUSIC")
+	mn.Buttons[1].InitToSubMenuButton("菜单", subButtons)
+	return &mn
+}
+
+func TestMenuValidate(t *testing.T) {
+	if err := newTestMenu().Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		modify func(mn *Menu)
+		errStr string
+	}{
+		{func(mn *Menu) { mn.Buttons = nil }, "菜单是空的"},
+		{func(mn *Menu) { mn.Buttons = append(mn.Buttons, mn.Buttons...) }, "一级菜单最多"},
+		{func(mn *Menu) { mn.Buttons[0].Name = strings.Repeat("a", 17) }, "button[0]: 菜单标题"},
+		{func(mn *Menu) { mn.Buttons[0].Key = "" }, "button[0]: click 类型的按钮 key 不能为空"},
+		{func(mn *Menu) { mn.Buttons[0].Key = strings.Repeat("k", 129) }, "button[0]: key 不能超过 128 个字节"},
+		{func(mn *Menu) { mn.Buttons[0].Type = "unknown" }, "未知的按钮类型"},
+		{func(mn *Menu) { mn.Buttons[1].SubButtons[0].URL = "http://" + strings.Repeat("u", 250) }, "button[1].sub_button[0]: url 不能超过 256 个字节"},
+		{func(mn *Menu) { mn.Buttons[1].SubButtons[1].Name = strings.Repeat("a", 41) }, "button[1].sub_button[1]: 菜单标题"},
+		{func(mn *Menu) {
+			btn := mn.Buttons[1].SubButtons[0]
+			mn.Buttons[1].SubButtons = []Button{btn, btn, btn, btn, btn, btn}
+		}, "button[1]: 二级菜单最多 5 个"},
+		{func(mn *Menu) { mn.Buttons[1].SubButtons[0].SubButtons = []Button{mn.Buttons[0]} }, "二级菜单不能再有子菜单"},
+	}
+
+	for i, test := range tests {
+		mn := newTestMenu()
+		test.modify(mn)
+		err := mn.Validate()
+		if err == nil || !strings.Contains(err.Error(), test.errStr) {
+			t.Errorf("tests[%d]: have %v, want error contains %q", i, err, test.errStr)
+		}
+	}
+}
+
+func TestMenuDiff(t *testing.T) {
+	from := newTestMenu()
+	if diff := Diff(from, newTestMenu()); len(diff) != 0 {
+		t.Errorf("same menu: have diff %q", diff)
+	}
+
+	to := newTestMenu()
+	to.Buttons[0].Name = "今日推荐"
+	to.Buttons[1].SubButtons = to.Buttons[1].SubButtons[:1]
+	var btn Button
+	btn.InitToLocationSelectButton("发送位置", "rselfmenu_2_0")
+	to.Buttons = append(to.Buttons, btn)
+
+	want := []string{
+		`~ button[0].name: "今日歌曲" -> "今日推荐"`,
+		`- button[1].sub_button[1] {type: click, name: "赞一下我们", key: "V1001_GOOD"}`,
+		`+ button[2] {type: location_select, name: "发送位置", key: "rselfmenu_2_0"}`,
+	}
+	if diff := Diff(from, to); !reflect.DeepEqual(diff, want) {
+		t.Errorf("Diff:\nhave %q\nwant %q", diff, want)
+	}
+}
@@ -0,0 +1,78 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package menusync
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/chanxuehong/wechat/mp/menu"
+	"github.com/chanxuehong/wechat/util"
+)
+
+// 从文件加载菜单并检查是否有效, 根据扩展名判断格式: .json, .yaml, .yml
+func LoadFile(filename string) (menu_ *menu.Menu, err error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(filename)); ext {
+	case ".json":
+		return LoadJSON(data)
+	case ".yaml", ".yml":
+		return LoadYAML(data)
+	default:
+		err = fmt.Errorf("unsupported menu file extension: %q", ext)
+		return
+	}
+}
+
+// 从 json 加载菜单并检查是否有效, 格式和 MenuCreate 的请求一致.
+//
+//  {
+//      "button": [
+//          {
+//              "type": "click",
+//              "name": "今日歌曲",
+//              "key": "V1001_TODAY_MUSIC"
+//          }
+//      ]
+//  }
+func LoadJSON(data []byte) (menu_ *menu.Menu, err error) {
+	menu_ = new(menu.Menu)
+	if err = json.Unmarshal(data, menu_); err != nil {
+		menu_ = nil
+		return
+	}
+	if err = menu_.Validate(); err != nil {
+		menu_ = nil
+		return
+	}
+	return
+}
+
+// 从 yaml 加载菜单并检查是否有效, 字段名和 json 格式一致, 支持的 yaml 语法见 util.YAMLToJSON.
+//
+//  button:
+//    - type: click
+//      name: 今日歌曲
+//      key: V1001_TODAY_MUSIC
+//    - name: 菜单
+//      sub_button:
+//        - type: view
+//          name: 搜索
+//          url: http://www.soso.com/
+func LoadYAML(data []byte) (menu_ *menu.Menu, err error) {
+	jsonData, err := util.YAMLToJSON(data)
+	if err != nil {
+		return
+	}
+	return LoadJSON(jsonData)
+}
@@ -0,0 +1,87 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package menusync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chanxuehong/wechat/mp/menu"
+)
+
+func TestLoadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "menusync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, data string) string {
+		filename := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(filename, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+
+	menu_, err := LoadFile(write("menu.json", `{
+	    "button": [
+	        {
+	            "type": "click",
+	            "name": "今日歌曲",
+	            "key": "1001"
+	        },
+	        {
+	            "name": "菜单",
+	            "sub_button": [
+	                {
+	                    "type": "view",
+	                    "name": "搜索",
+	                    "url": "http://www.soso.com/"
+	                }
+	            ]
+	        }
+	    ]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(menu_.Buttons) != 2 || menu_.Buttons[0].Key != "1001" || len(menu_.Buttons[1].SubButtons) != 1 {
+		t.Errorf("LoadFile: %+v", menu_)
+	}
+
+	if _, err = LoadFile(write("invalid.json", `{"button": [{"name": "没有类型"}]}`)); err == nil {
+		t.Error("invalid menu: want error")
+	}
+
+	yamlMenu, err := LoadFile(write("menu.yml", `
+# 和 menu.json 一样的菜单
+button:
+  - type: click
+    name: 今日歌曲
+    key: "1001"
+  - name: 菜单
+    sub_button:
+      - type: view
+        name: 搜索
+        url: http://www.soso.com/
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := menu.Diff(menu_, yamlMenu); len(diff) != 0 {
+		t.Errorf("yaml and json mismatch: %q", diff)
+	}
+
+	if _, err = LoadFile(write("invalid.yaml", "button:\n  - name: 没有类型\n")); err == nil {
+		t.Error("invalid yaml menu: want error")
+	}
+	if _, err = LoadFile(write("menu.toml", "")); err == nil {
+		t.Error("unsupported extension: want error")
+	}
+}
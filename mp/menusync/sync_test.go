@@ -0,0 +1,79 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package menusync
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chanxuehong/wechat/mp/client"
+	"github.com/chanxuehong/wechat/mp/menu"
+	"github.com/chanxuehong/wechat/mp/tokenservice"
+	"github.com/chanxuehong/wechat/wechattest"
+)
+
+func TestSync(t *testing.T) {
+	const createPath = "/cgi-bin/menu/create"
+
+	srv := wechattest.NewServer(nil)
+	defer srv.Close()
+	clt := client.NewClient(tokenservice.NewDefaultTokenService(srv.AppId(), srv.AppSecret(), srv.Client()), srv.Client())
+
+	menu_, err := LoadYAML([]byte(`
+button:
+  - type: click
+    name: 今日歌曲
+    key: V1001_TODAY_MUSIC
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 线上没有菜单, dryRun 只返回差异
+	want := []string{`+ button[0] {type: click, name: "今日歌曲", key: "V1001_TODAY_MUSIC"}`}
+	diff, err := Sync(clt, menu_, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("dry run diff:\nhave %q\nwant %q", diff, want)
+	}
+	if n := srv.Calls(createPath); n != 0 {
+		t.Errorf("dry run: MenuCreate called %d times", n)
+	}
+
+	if diff, err = Sync(clt, menu_, false); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("diff:\nhave %q\nwant %q", diff, want)
+	}
+	if current, ok := srv.Menu(); !ok || len(menu.Diff(&current, menu_)) != 0 {
+		t.Errorf("server menu: %+v", current)
+	}
+
+	// 没有差异的时候不调用 MenuCreate
+	if diff, err = Sync(clt, menu_, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(diff) != 0 {
+		t.Errorf("unchanged menu diff: %q", diff)
+	}
+	if n := srv.Calls(createPath); n != 1 {
+		t.Errorf("MenuCreate called %d times, want 1", n)
+	}
+
+	menu_.Buttons[0].Name = "今日推荐"
+	if diff, err = Sync(clt, menu_, false); err != nil {
+		t.Fatal(err)
+	}
+	if want = []string{`~ button[0].name: "今日歌曲" -> "今日推荐"`}; !reflect.DeepEqual(diff, want) {
+		t.Errorf("changed menu diff:\nhave %q\nwant %q", diff, want)
+	}
+	if current, _ := srv.Menu(); current.Buttons[0].Name != "今日推荐" {
+		t.Errorf("server menu: %+v", current)
+	}
+}
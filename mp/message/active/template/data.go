@@ -0,0 +1,84 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package template
+
+import (
+	"fmt"
+	"sort"
+)
+
+// 模板消息 data 里的一个字段
+type Field struct {
+	Value string `json:"value"`
+	Color string `json:"color,omitempty"` // 格式为 #RRGGBB, 可以为空
+}
+
+// 模板消息的 data, 可以直接作为 Msg.Data.
+//
+//  data := template.NewData().
+//      Set("first", "您好，您已购买成功。").
+//      SetColor("keyword1", "苹果", "#173177")
+//  if err := data.CheckValid(); err != nil {
+//      // TODO: 增加你的代码
+//  }
+//  msg := template.NewMsg(openid, templateId, data)
+type Data map[string]Field
+
+func NewData() Data {
+	return make(Data)
+}
+
+// 设置字段 key 的值, 不设置颜色
+func (data Data) Set(key, value string) Data {
+	data[key] = Field{Value: value}
+	return data
+}
+
+// 设置字段 key 的值和颜色, color 的格式为 #RRGGBB
+func (data Data) SetColor(key, value, color string) Data {
+	data[key] = Field{Value: value, Color: color}
+	return data
+}
+
+// 按字典序返回所有的 key
+func (data Data) Keys() []string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// 检查 Data 是否有效，有效返回 nil，否则返回错误信息
+func (data Data) CheckValid() (err error) {
+	for _, key := range data.Keys() {
+		if key == "" {
+			return fmt.Errorf("字段名不能为空")
+		}
+		if color := data[key].Color; color != "" {
+			if err = CheckColor(color); err != nil {
+				return fmt.Errorf("字段 %s 的颜色无效: %s", key, err)
+			}
+		}
+	}
+	return
+}
+
+// 检查颜色的格式是否为 #RRGGBB
+func CheckColor(color string) (err error) {
+	if len(color) != 7 || color[0] != '#' {
+		return fmt.Errorf("颜色的格式必须是 #RRGGBB, 现在为 %q", color)
+	}
+	for i := 1; i < 7; i++ {
+		switch c := color[i]; {
+		case '0' <= c && c <= '9', 'a' <= c && c <= 'f', 'A' <= c && c <= 'F':
+		default:
+			return fmt.Errorf("颜色的格式必须是 #RRGGBB, 现在为 %q", color)
+		}
+	}
+	return
+}
@@ -0,0 +1,252 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package template
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// 模板内容里的占位符, 如 {{first.DATA}}
+var placeholderRegexp = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_]+)\.DATA\s*\}\}`)
+
+// 模板的字段定义
+type Schema struct {
+	TemplateId string
+	Keys       []string // 模板需要的所有字段, 顺序即本地渲染时的顺序
+
+	// 模板的内容(公众平台后台"模板消息"里看到的详细内容), 如
+	//  {{first.DATA}}
+	//  商品名称：{{keyword1.DATA}}
+	//  {{remark.DATA}}
+	// 可以为空, 为空时 Render 按 Keys 的顺序逐行输出.
+	Content string
+}
+
+// 根据模板内容创建 Schema, 字段从内容里的 {{xxx.DATA}} 占位符中解析.
+func ParseSchema(templateId, content string) (schema *Schema, err error) {
+	if templateId == "" {
+		err = errors.New("templateId is empty")
+		return
+	}
+
+	schema = &Schema{
+		TemplateId: templateId,
+		Content:    content,
+	}
+	seen := make(map[string]bool)
+	for _, match := range placeholderRegexp.FindAllStringSubmatch(content, -1) {
+		if key := match[1]; !seen[key] {
+			seen[key] = true
+			schema.Keys = append(schema.Keys, key)
+		}
+	}
+	if len(schema.Keys) == 0 {
+		schema = nil
+		err = errors.New("模板内容里没有 {{xxx.DATA}} 格式的字段")
+		return
+	}
+	return
+}
+
+// 字段不符合 Schema 时返回的错误
+type SchemaError struct {
+	TemplateId string
+	Missing    []string // Schema 需要但是 Data 里没有的字段
+	Unknown    []string // Data 里有但是 Schema 没有定义的字段
+}
+
+func (e *SchemaError) Error() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "template %s:", e.TemplateId)
+	if len(e.Missing) > 0 {
+		fmt.Fprintf(&buf, " missing keys: %s;", strings.Join(e.Missing, ", "))
+	}
+	if len(e.Unknown) > 0 {
+		fmt.Fprintf(&buf, " unknown keys: %s;", strings.Join(e.Unknown, ", "))
+	}
+	return strings.TrimSuffix(buf.String(), ";")
+}
+
+// 检查 data 是否符合 Schema, 包括字段是否齐全, 是否有未定义的字段, 颜色是否有效.
+func (schema *Schema) CheckData(data Data) (err error) {
+	if data == nil {
+		return errors.New("data == nil")
+	}
+	if err = data.CheckValid(); err != nil {
+		return
+	}
+
+	var schemaErr *SchemaError
+	defined := make(map[string]bool, len(schema.Keys))
+	for _, key := range schema.Keys {
+		defined[key] = true
+		if _, ok := data[key]; !ok {
+			if schemaErr == nil {
+				schemaErr = &SchemaError{TemplateId: schema.TemplateId}
+			}
+			schemaErr.Missing = append(schemaErr.Missing, key)
+		}
+	}
+	for _, key := range data.Keys() {
+		if !defined[key] {
+			if schemaErr == nil {
+				schemaErr = &SchemaError{TemplateId: schema.TemplateId}
+			}
+			schemaErr.Unknown = append(schemaErr.Unknown, key)
+		}
+	}
+	if schemaErr != nil {
+		return schemaErr
+	}
+	return
+}
+
+// 把 data 渲染成纯文本, 用于预览和日志.
+//  NOTE: 不检查 data 是否符合 Schema, 缺少的字段渲染为空字符串.
+func (schema *Schema) Render(data Data) string {
+	if schema.Content != "" {
+		return placeholderRegexp.ReplaceAllStringFunc(schema.Content, func(placeholder string) string {
+			key := placeholderRegexp.FindStringSubmatch(placeholder)[1]
+			return data[key].Value
+		})
+	}
+
+	var buf bytes.Buffer
+	for i, key := range schema.Keys {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(key)
+		buf.WriteString(": ")
+		buf.WriteString(data[key].Value)
+	}
+	return buf.String()
+}
+
+// 模板 id 到 Schema 的注册表
+type Registry struct {
+	rwmutex sync.RWMutex
+	schemas map[string]*Schema
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		schemas: make(map[string]*Schema),
+	}
+}
+
+// 注册 Schema, 相同模板 id 的 Schema 会被覆盖.
+func (registry *Registry) Register(schema *Schema) (err error) {
+	if schema == nil {
+		return errors.New("schema == nil")
+	}
+	if schema.TemplateId == "" {
+		return errors.New("schema.TemplateId is empty")
+	}
+	if len(schema.Keys) == 0 {
+		return errors.New("schema.Keys is empty")
+	}
+
+	registry.rwmutex.Lock()
+	registry.schemas[schema.TemplateId] = schema
+	registry.rwmutex.Unlock()
+	return
+}
+
+// 获取模板 id 对应的 Schema, 没有注册返回 nil.
+func (registry *Registry) Schema(templateId string) *Schema {
+	registry.rwmutex.RLock()
+	schema := registry.schemas[templateId]
+	registry.rwmutex.RUnlock()
+	return schema
+}
+
+// 检查 msg 是否符合注册的 Schema.
+//  msg.Data 必须是 Data 或者 *Data 类型; 模板 id 没有注册也返回错误.
+func (registry *Registry) CheckMsg(msg *Msg) (err error) {
+	if msg == nil {
+		return errors.New("msg == nil")
+	}
+	if msg.ToUser == "" {
+		return errors.New("msg.ToUser is empty")
+	}
+	if msg.TopColor != "" {
+		if err = CheckColor(msg.TopColor); err != nil {
+			return
+		}
+	}
+
+	schema := registry.Schema(msg.TemplateId)
+	if schema == nil {
+		return fmt.Errorf("template %s is not registered", msg.TemplateId)
+	}
+	data, err := msgData(msg)
+	if err != nil {
+		return
+	}
+	return schema.CheckData(data)
+}
+
+// 新建模板消息并检查是否符合注册的 Schema, 不符合时返回错误.
+func (registry *Registry) NewMsg(toUser, templateId string, data Data) (msg *Msg, err error) {
+	msg = NewMsg(toUser, templateId, data)
+	if err = registry.CheckMsg(msg); err != nil {
+		msg = nil
+		return
+	}
+	return
+}
+
+// 新建带链接的模板消息并检查是否符合注册的 Schema, 不符合时返回错误.
+func (registry *Registry) NewMsgWithLink(toUser, templateId string, data Data, url, topColor string) (msg *Msg, err error) {
+	msg = NewMsgWithLink(toUser, templateId, data, url, topColor)
+	if err = registry.CheckMsg(msg); err != nil {
+		msg = nil
+		return
+	}
+	return
+}
+
+// 把 msg 渲染成纯文本, 用于预览和日志.
+func (registry *Registry) Render(msg *Msg) (text string, err error) {
+	if msg == nil {
+		err = errors.New("msg == nil")
+		return
+	}
+	schema := registry.Schema(msg.TemplateId)
+	if schema == nil {
+		err = fmt.Errorf("template %s is not registered", msg.TemplateId)
+		return
+	}
+	data, err := msgData(msg)
+	if err != nil {
+		return
+	}
+	text = schema.Render(data)
+	return
+}
+
+func msgData(msg *Msg) (data Data, err error) {
+	switch v := msg.Data.(type) {
+	case Data:
+		data = v
+	case *Data:
+		if v != nil {
+			data = *v
+		}
+	case map[string]Field:
+		data = Data(v)
+	}
+	if data == nil {
+		err = fmt.Errorf("msg.Data must be template.Data, now is %T", msg.Data)
+	}
+	return
+}
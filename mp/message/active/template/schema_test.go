@@ -0,0 +1,88 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCheckColor(t *testing.T) {
+	for _, color := range []string{"#173177", "#FFffFF", "#000000"} {
+		if err := CheckColor(color); err != nil {
+			t.Errorf("CheckColor(%q): %s", color, err)
+		}
+	}
+	for _, color := range []string{"", "173177", "#17317", "#1731777", "#17317G", "red"} {
+		if err := CheckColor(color); err == nil {
+			t.Errorf("CheckColor(%q): want error", color)
+		}
+	}
+}
+
+func TestDataMarshal(t *testing.T) {
+	data := NewData().
+		Set("first", "您好").
+		SetColor("keyword1", "苹果", "#173177")
+
+	want := []byte(`{"first":{"value":"您好"},"keyword1":{"value":"苹果","color":"#173177"}}`)
+	have, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(have, want) {
+		t.Errorf("json.Marshal:\nhave %s\nwant %s", have, want)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	schema, err := ParseSchema("TEMPLATE_ID", "{{first.DATA}}\n商品名称：{{keyword1.DATA}}\n{{ remark.DATA }}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"first", "keyword1", "remark"}; !reflect.DeepEqual(schema.Keys, want) {
+		t.Errorf("Keys: have %v, want %v", schema.Keys, want)
+	}
+
+	registry := NewRegistry()
+	if err = registry.Register(schema); err != nil {
+		t.Fatal(err)
+	}
+
+	data := NewData().Set("first", "您好").Set("keyword1", "苹果").Set("remark", "谢谢")
+	msg, err := registry.NewMsg("OPENID", "TEMPLATE_ID", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := registry.Render(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "您好\n商品名称：苹果\n谢谢"; text != want {
+		t.Errorf("Render:\nhave %q\nwant %q", text, want)
+	}
+
+	data = NewData().Set("first", "您好").Set("keyword2", "苹果").SetColor("remark", "谢谢", "#1731")
+	if _, err = registry.NewMsg("OPENID", "TEMPLATE_ID", data); err == nil {
+		t.Error("invalid color: want error")
+	}
+
+	data.SetColor("remark", "谢谢", "#173177")
+	_, err = registry.NewMsg("OPENID", "TEMPLATE_ID", data)
+	schemaErr, ok := err.(*SchemaError)
+	if !ok {
+		t.Fatalf("want *SchemaError, have %v", err)
+	}
+	if !reflect.DeepEqual(schemaErr.Missing, []string{"keyword1"}) || !reflect.DeepEqual(schemaErr.Unknown, []string{"keyword2"}) {
+		t.Errorf("SchemaError: %+v", schemaErr)
+	}
+
+	if _, err = registry.NewMsg("OPENID", "UNKNOWN_TEMPLATE_ID", data); err == nil {
+		t.Error("unregistered template: want error")
+	}
+}
@@ -0,0 +1,66 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"bytes"
+
+	"github.com/chanxuehong/wechat/util"
+)
+
+// 可选的接口, Agent 实现了这个接口并且 GetAESKeyRing 返回的不是 nil 的时候,
+// 兼容模式, 安全模式下用 AESKeyRing 里所有有效的 key 解密消息, 不再使用 GetCurrentAESKey 和 GetLastAESKey.
+type AESKeyRingAgent interface {
+	GetAESKeyRing() *util.AESKeyRing
+}
+
+// 获取 agent 的 AESKeyRing, 没有则返回 nil
+func getAESKeyRing(agent Agent) *util.AESKeyRing {
+	if ringAgent, ok := agent.(AESKeyRingAgent); ok {
+		return ringAgent.GetAESKeyRing()
+	}
+	return nil
+}
+
+// 解密消息, index 是解密所用的 key 的序号, 同 Context.AESKeyIndex
+func decryptMsg(encryptedMsg []byte, agent Agent) (random, rawXMLMsg []byte, AESKey [32]byte, index int, err error) {
+	if ring := getAESKeyRing(agent); ring != nil {
+		return ring.Decrypt(encryptedMsg, agent.GetAppId())
+	}
+
+	AESKey = agent.GetCurrentAESKey()
+
+	random, rawXMLMsg, err = util.AESDecryptMsg(encryptedMsg, agent.GetAppId(), AESKey)
+	if err != nil {
+		// 尝试上一个 AESKey
+		LastAESKey := agent.GetLastAESKey()
+		if bytes.Equal(zeroAESKey[:], LastAESKey[:]) || bytes.Equal(AESKey[:], LastAESKey[:]) {
+			return
+		}
+
+		AESKey = LastAESKey // !!!
+		index = 1
+
+		random, rawXMLMsg, err = util.AESDecryptMsg(encryptedMsg, agent.GetAppId(), AESKey)
+	}
+	return
+}
+
+// AESKey 在 agent 的 key 里的序号, 同 Context.AESKeyIndex, 找不到则返回 0
+func aesKeyIndex(agent Agent, AESKey [32]byte) int {
+	if ring := getAESKeyRing(agent); ring != nil {
+		for i, key := range ring.Keys() {
+			if key == AESKey {
+				return i
+			}
+		}
+		return 0
+	}
+	if AESKey != agent.GetCurrentAESKey() && AESKey == agent.GetLastAESKey() {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,87 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/wechat/util"
+)
+
+// 包装 ServeMux 的 Agent, 消息通过 ServeMux 的回调方法处理
+type wrappedMux struct {
+	*ServeMux
+}
+
+func TestAESKeyRingRotation(t *testing.T) {
+	const id, token, appId = "gh_0123456789ab", "token", "wx0123456789abcdef"
+
+	ring, err := util.NewAESKeyRingFromEncoded("abcdefghijklmnopqrstuvwxyz0123456789ABCDEFG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKey := ring.Current()
+	if err = ring.RotateEncoded("ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789abcdefg", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	var agent DefaultAgent
+	agent.InitWithAESKeyRing(id, token, appId, ring)
+
+	var keyIndex int
+	mux := NewServeMux(&agent)
+	mux.OnText(func(ctx *Context) {
+		keyIndex = ctx.AESKeyIndex
+		ctx.ReplyText("pong")
+	})
+
+	// 用旧的 key 加密的消息
+	rawXMLMsg := "<xml><ToUserName>" + id + "</ToUserName><FromUserName>openid</FromUserName>" +
+		"<CreateTime>1</CreateTime><MsgType>text</MsgType><Content>ping</Content><MsgId>1</MsgId></xml>"
+	encryptedMsg := base64.StdEncoding.EncodeToString(util.AESEncryptMsg(bytes.Repeat([]byte("r"), 16), []byte(rawXMLMsg), appId, oldKey))
+	query := url.Values{
+		"signature":     {util.Sign(token, "1", "1")},
+		"msg_signature": {util.MsgSign(token, "1", "1", encryptedMsg)},
+		"timestamp":     {"1"},
+		"nonce":         {"1"},
+		"encrypt_type":  {"aes"},
+	}
+	body := "<xml><ToUserName>" + id + "</ToUserName><Encrypt>" + encryptedMsg + "</Encrypt></xml>"
+
+	for _, agent := range []Agent{mux, wrappedMux{mux}} {
+		keyIndex = 0
+		w := httptest.NewRecorder()
+		NewAgentFrontend(agent, nil).ServeHTTP(w, httptest.NewRequest("POST", "/?"+query.Encode(), bytes.NewBufferString(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%T: code = %d, body = %s", agent, w.Code, w.Body)
+		}
+		if keyIndex != 1 {
+			t.Errorf("%T: AESKeyIndex = %d, want 1", agent, keyIndex)
+		}
+
+		// 回复用解密消息的 key 加密
+		var resp struct {
+			Encrypt string `xml:"Encrypt"`
+		}
+		if err = xml.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		encryptedResp, err := base64.StdEncoding.DecodeString(resp.Encrypt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err = util.AESDecryptMsg(encryptedResp, appId, oldKey); err != nil {
+			t.Errorf("%T: decrypt reply with old key: %v", agent, err)
+		}
+	}
+}
@@ -6,16 +6,31 @@
 package server
 
 import (
+	"bytes"
+	"encoding/xml"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"path"
 	"sync"
+
+	"github.com/chanxuehong/wechat/util"
 )
 
 // 定义回调 URL 上指定 Agent 的查询参数名
 const URLQueryAgentKeyName = "agentkey"
 
+// MultiAgentFrontend 从请求中获取 agentkey 的方式
+type RouteMode int
+
+const (
+	RouteByQuery      RouteMode = iota // 默认; 回调 URL 的查询参数 agentkey, 比如 /wx?agentkey=1234567890
+	RouteByPath                        // 回调 URL 路径的最后一段, 比如 /wx/1234567890
+	RouteByToUserName                  // 消息体的 ToUserName(公众号原始ID), GET 请求(首次验证)没有消息体, 用查询参数 agentkey
+)
+
 // 多个 Agent 的前端, 负责处理 http 请求, net/http.Handler 的实现
 //
 //  NOTE:
@@ -28,10 +43,17 @@ const URLQueryAgentKeyName = "agentkey"
 //
 //  来增加一个 Agent 来处理 agentkey=1234567890 的消息（事件）。
 //
+//  也可以调用 SetRouteMode 改为从 URL 路径或者消息体的 ToUserName 获取 agentkey，
+//  调用 SetAgentProvider 在运行中按需加载 Agent。
+//
 //  MultiAgentFrontend 并发安全，可以在运行中动态增加和删除 Agent。
 type MultiAgentFrontend struct {
 	rwmutex               sync.RWMutex
 	agentMap              map[string]Agent
+	dedupStoreMap         map[string]util.DedupStore // map[agentkey]DedupStore
+	options               serveOptions               // dedupStore 是 EnableDefaultDedup 设置的默认值
+	routeMode             RouteMode
+	agentProvider         AgentProvider
 	invalidRequestHandler InvalidRequestHandler
 }
 
@@ -46,6 +68,21 @@ func (this *MultiAgentFrontend) SetInvalidRequestHandler(handler InvalidRequestH
 	this.rwmutex.Unlock()
 }
 
+// 设置获取 agentkey 的方式, 默认为 RouteByQuery
+func (this *MultiAgentFrontend) SetRouteMode(mode RouteMode) {
+	this.rwmutex.Lock()
+	this.routeMode = mode
+	this.rwmutex.Unlock()
+}
+
+// 设置 AgentProvider, SetAgent 设置的 Agent 里找不到 agentkey 的时候从 provider 加载,
+// 一般用 NewCachedAgentProvider 包装一下. provider 为 nil 则不加载.
+func (this *MultiAgentFrontend) SetAgentProvider(provider AgentProvider) {
+	this.rwmutex.Lock()
+	this.agentProvider = provider
+	this.rwmutex.Unlock()
+}
+
 // 添加（设置） agentkey-agent pair, 如果 agent == nil 则不做任何操作
 func (this *MultiAgentFrontend) SetAgent(agentkey string, agent Agent) {
 	if agentkey == "" {
@@ -63,10 +100,96 @@ func (this *MultiAgentFrontend) SetAgent(agentkey string, agent Agent) {
 	this.rwmutex.Unlock()
 }
 
+// 对 agentkey 对应的 Agent 开启重复消息过滤, 微信服务器重试推送的消息直接回复空串, 不再交给 Agent 处理.
+//  store 为 nil 则使用 util.NewLRUDedupStore(util.DefaultDedupStoreSize, util.DefaultDedupTTL);
+//  多个 Agent 可以共用一个 store. 删除 Agent 的时候同时关闭过滤.
+func (this *MultiAgentFrontend) EnableDedup(agentkey string, store util.DedupStore) {
+	if agentkey == "" {
+		return
+	}
+	if store == nil {
+		store = util.NewLRUDedupStore(util.DefaultDedupStoreSize, util.DefaultDedupTTL)
+	}
+
+	this.rwmutex.Lock()
+	if this.dedupStoreMap == nil {
+		this.dedupStoreMap = make(map[string]util.DedupStore)
+	}
+	this.dedupStoreMap[agentkey] = store
+	this.rwmutex.Unlock()
+}
+
+// 对没有调用 EnableDedup 单独开启过滤的 Agent(包括 AgentProvider 加载的 Agent)开启重复消息过滤.
+//  store 为 nil 则使用 util.NewLRUDedupStore(util.DefaultDedupStoreSize, util.DefaultDedupTTL),
+//  所有这些 Agent 共用一个 store, 所以容量要足够大.
+func (this *MultiAgentFrontend) EnableDefaultDedup(store util.DedupStore) {
+	if store == nil {
+		store = util.NewLRUDedupStore(util.DefaultDedupStoreSize, util.DefaultDedupTTL)
+	}
+
+	this.rwmutex.Lock()
+	this.options.dedupStore = store
+	this.rwmutex.Unlock()
+}
+
+// 对所有的 Agent 开启重放攻击防护, 拒绝时间戳超出允许范围或者 nonce 已经使用过的请求,
+// 交给 InvalidRequestHandler 处理, 这时的 err 是 *util.ReplayError.
+//  guard 为 nil 则使用 util.NewReplayGuard(util.DefaultReplayWindow, nil).
+func (this *MultiAgentFrontend) EnableReplayGuard(guard *util.ReplayGuard) {
+	if guard == nil {
+		guard = util.NewReplayGuard(util.DefaultReplayWindow, nil)
+	}
+
+	this.rwmutex.Lock()
+	this.options.replayGuard = guard
+	this.rwmutex.Unlock()
+}
+
+// 对所有的 Agent 开启统计, 把每一个消息(事件)的类型, 是否加密, 处理时间, 回复的字节数和非法请求的原因报告给 metrics,
+// 比如 util.NewPrometheusMetrics 返回的 *util.PrometheusMetrics. metrics 为 nil 则关闭统计.
+func (this *MultiAgentFrontend) EnableMetrics(metrics util.ServerMetrics) {
+	this.rwmutex.Lock()
+	this.options.metrics = metrics
+	this.rwmutex.Unlock()
+}
+
+// 对所有的 Agent 开启消息发布, 把每一个通过校验并且解密的消息(事件)发布到 publisher, 然后再交给 Agent 处理;
+// 微信服务器重试推送的消息(开启了 EnableDedup)不会重复发布. publisher 为 nil 则不发布.
+func (this *MultiAgentFrontend) EnablePublisher(publisher util.Publisher) {
+	this.rwmutex.Lock()
+	this.options.publisher = publisher
+	this.rwmutex.Unlock()
+}
+
+// 对所有的 Agent 开启消息存档, 把每一个通过校验并且解密的消息(事件), 回复和处理时间存档到 store,
+// 比如 util.NewFileArchiveStore 返回的 *util.FileArchiveStore. store 为 nil 则关闭存档.
+func (this *MultiAgentFrontend) EnableArchive(store util.ArchiveStore) {
+	this.rwmutex.Lock()
+	this.options.archiveStore = store
+	this.rwmutex.Unlock()
+}
+
+// 对所有的 Agent 添加中间件, 先添加的在外层; 每一个通过校验并且解密的消息(事件)先经过中间件再交给 Agent 处理.
+//  Agent 是 *ServeMux 的时候, 中间件的 Context 会直接交给 ServeMux, 然后再经过 ServeMux.Use 添加的中间件.
+func (this *MultiAgentFrontend) Use(middlewares ...Middleware) {
+	for _, middleware := range middlewares {
+		if middleware == nil {
+			panic("middleware == nil")
+		}
+	}
+
+	this.rwmutex.Lock()
+	// 正在处理的请求可能还在使用原来的 slice, 不能在原来的底层数组上追加
+	n := len(this.options.middlewares)
+	this.options.middlewares = append(this.options.middlewares[:n:n], middlewares...)
+	this.rwmutex.Unlock()
+}
+
 // 删除 agentkey 对应的 Agent
 func (this *MultiAgentFrontend) DeleteAgent(agentkey string) {
 	this.rwmutex.Lock()
 	delete(this.agentMap, agentkey)
+	delete(this.dedupStoreMap, agentkey)
 	this.rwmutex.Unlock()
 }
 
@@ -74,18 +197,26 @@ func (this *MultiAgentFrontend) DeleteAgent(agentkey string) {
 func (this *MultiAgentFrontend) DeleteAllAgent() {
 	this.rwmutex.Lock()
 	this.agentMap = nil
+	this.dedupStoreMap = nil
 	this.rwmutex.Unlock()
 }
 
 func (this *MultiAgentFrontend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if r.URL == nil {
-		this.rwmutex.RLock()
-		invalidRequestHandler := this.invalidRequestHandler
-		this.rwmutex.RUnlock()
-		if invalidRequestHandler == nil {
-			invalidRequestHandler = DefaultInvalidRequestHandler
-		}
+	this.rwmutex.RLock()
+	invalidRequestHandler := this.invalidRequestHandler
+	routeMode := this.routeMode
+	agentProvider := this.agentProvider
+	options := this.options
+	this.rwmutex.RUnlock()
 
+	if invalidRequestHandler == nil {
+		invalidRequestHandler = DefaultInvalidRequestHandler
+	}
+	if options.metrics != nil {
+		invalidRequestHandler = metricsInvalidRequestHandler{invalidRequestHandler, options.metrics}
+	}
+
+	if r.URL == nil {
 		err := errors.New("input net/http.Request.URL == nil")
 		invalidRequestHandler.ServeInvalidRequest(w, r, err)
 		return
@@ -93,43 +224,71 @@ func (this *MultiAgentFrontend) ServeHTTP(w http.ResponseWriter, r *http.Request
 
 	urlValues, err := url.ParseQuery(r.URL.RawQuery)
 	if err != nil {
-		this.rwmutex.RLock()
-		invalidRequestHandler := this.invalidRequestHandler
-		this.rwmutex.RUnlock()
-		if invalidRequestHandler == nil {
-			invalidRequestHandler = DefaultInvalidRequestHandler
-		}
-
 		invalidRequestHandler.ServeInvalidRequest(w, r, err)
 		return
 	}
 
-	agentKey := urlValues.Get(URLQueryAgentKeyName)
-	if agentKey == "" {
-		this.rwmutex.RLock()
-		invalidRequestHandler := this.invalidRequestHandler
-		this.rwmutex.RUnlock()
-		if invalidRequestHandler == nil {
-			invalidRequestHandler = DefaultInvalidRequestHandler
-		}
-
-		err = fmt.Errorf("the url query value with name %s is empty", URLQueryAgentKeyName)
+	agentKey, err := getAgentKey(r, urlValues, routeMode)
+	if err != nil {
 		invalidRequestHandler.ServeInvalidRequest(w, r, err)
 		return
 	}
 
 	this.rwmutex.RLock()
-	invalidRequestHandler := this.invalidRequestHandler
 	agent := this.agentMap[agentKey]
+	if store := this.dedupStoreMap[agentKey]; store != nil {
+		options.dedupStore = store
+	}
 	this.rwmutex.RUnlock()
 
-	if invalidRequestHandler == nil {
-		invalidRequestHandler = DefaultInvalidRequestHandler
+	if agent == nil && agentProvider != nil {
+		if agent, err = agentProvider.GetAgent(agentKey); err != nil {
+			invalidRequestHandler.ServeInvalidRequest(w, r, err)
+			return
+		}
 	}
 	if agent == nil {
 		invalidRequestHandler.ServeInvalidRequest(w, r, fmt.Errorf("Not found Agent for %s == %s", URLQueryAgentKeyName, agentKey))
 		return
 	}
 
-	ServeHTTP(w, r, urlValues, agent, invalidRequestHandler)
+	serveHTTP(w, r, urlValues, agent, invalidRequestHandler, options)
+}
+
+// 按照 mode 从请求中获取 agentkey.
+//  RouteByToUserName 的时候读取了 r.Body, 会替换为读取的数据, 不影响后续的处理.
+func getAgentKey(r *http.Request, urlValues url.Values, mode RouteMode) (agentKey string, err error) {
+	switch {
+	case mode == RouteByPath:
+		agentKey = path.Base(r.URL.Path)
+		if agentKey == "/" || agentKey == "." {
+			err = fmt.Errorf("can not get agentkey from the url path %q", r.URL.Path)
+		}
+		return
+
+	case mode == RouteByToUserName && r.Method == "POST":
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return "", err
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		var head struct {
+			ToUserName string `xml:"ToUserName"`
+		}
+		if err = xml.Unmarshal(body, &head); err != nil {
+			return "", &XMLError{Err: err}
+		}
+		if head.ToUserName == "" {
+			return "", errors.New("the message ToUserName is empty")
+		}
+		return head.ToUserName, nil
+
+	default:
+		agentKey = urlValues.Get(URLQueryAgentKeyName)
+		if agentKey == "" {
+			err = fmt.Errorf("the url query value with name %s is empty", URLQueryAgentKeyName)
+		}
+		return
+	}
 }
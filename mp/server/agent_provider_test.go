@@ -0,0 +1,136 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/wechat/mp/message/passive/response"
+	"github.com/chanxuehong/wechat/mp/simulator"
+)
+
+func TestMultiAgentFrontendRouting(t *testing.T) {
+	const token, appId = "token", "wx0123456789abcdef"
+	AESKey := bytes.Repeat([]byte("k"), 32)
+
+	loads := 0
+	provider := NewCachedAgentProvider(AgentProviderFunc(func(agentkey string) (Agent, error) {
+		loads++
+		if agentkey == "gh_unknown00000" {
+			return nil, nil
+		}
+		agent := new(DefaultAgent)
+		agent.Init(agentkey, token, appId, AESKey)
+		mux := NewServeMux(agent)
+		mux.SetFallback(HandlerFunc(func(ctx *Context) {
+			ctx.ReplyText(ctx.ToUserName)
+		}))
+		return mux, nil
+	}), 0, time.Minute)
+
+	var frontend MultiAgentFrontend
+	frontend.SetAgentProvider(provider)
+	srv := httptest.NewServer(&frontend)
+	defer srv.Close()
+
+	send := func(url, id string, mode string) (string, error) {
+		s := simulator.NewSimulator(url, token, appId, AESKey, mode)
+		reply, err := s.Send("text", &simulator.Params{ToUserName: id})
+		if err != nil {
+			return "", err
+		}
+		var text response.Text
+		if err = xml.Unmarshal(reply.RawXMLMsg, &text); err != nil {
+			t.Fatal(err)
+		}
+		return text.Content, nil
+	}
+
+	frontend.SetRouteMode(RouteByPath)
+	for i := 0; i < 2; i++ {
+		if got, _ := send(srv.URL+"/wx/gh_0123456789ab", "gh_0123456789ab", simulator.MODE_AES); got != "gh_0123456789ab" {
+			t.Errorf("RouteByPath: reply = %q", got)
+		}
+	}
+	if _, err := send(srv.URL+"/wx/gh_unknown00000", "gh_unknown00000", simulator.MODE_AES); err == nil {
+		t.Error("unknown agent: err = nil")
+	}
+
+	frontend.SetRouteMode(RouteByToUserName)
+	for _, mode := range []string{simulator.MODE_RAW, simulator.MODE_AES} {
+		if got, _ := send(srv.URL, "gh_ba9876543210", mode); got != "gh_ba9876543210" {
+			t.Errorf("RouteByToUserName: reply = %q", got)
+		}
+	}
+
+	if loads != 3 {
+		t.Errorf("provider loads = %d, want 3", loads)
+	}
+	provider.Invalidate("gh_0123456789ab")
+	send(srv.URL, "gh_0123456789ab", simulator.MODE_RAW)
+	if loads != 4 {
+		t.Errorf("provider loads after Invalidate = %d, want 4", loads)
+	}
+}
+
+func TestCachedAgentProvider(t *testing.T) {
+	loads := make(map[string]int)
+	provider := NewCachedAgentProvider(AgentProviderFunc(func(agentkey string) (Agent, error) {
+		loads[agentkey]++
+		if strings.HasPrefix(agentkey, "unknown") {
+			return nil, nil
+		}
+		return new(DefaultAgent), nil
+	}), 2, time.Minute)
+
+	get := func(agentkey string, wantAgent bool) {
+		agent, err := provider.GetAgent(agentkey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (agent != nil) != wantAgent {
+			t.Fatalf("GetAgent(%q) = %v", agentkey, agent)
+		}
+	}
+
+	get("a", true)
+	get("b", true)
+	get("a", true) // a 是最近使用的
+	for i := 0; i < 10; i++ {
+		get("unknown"+strconv.Itoa(i), false) // 不存在的 agentkey 不会挤出 a, b
+	}
+	get("a", true)
+	get("b", true)
+	if loads["a"] != 1 || loads["b"] != 1 {
+		t.Errorf("loads = %v, want a, b loaded once", loads)
+	}
+	if n := provider.misses.len(); n != 2 {
+		t.Errorf("misses.len() = %d, want 2", n)
+	}
+
+	get("c", true) // 淘汰最近最少使用的 a
+	get("b", true)
+	get("a", true)
+	if loads["a"] != 2 || loads["b"] != 1 || loads["c"] != 1 {
+		t.Errorf("loads = %v, want a twice, b and c once", loads)
+	}
+	if n := provider.agents.len(); n != 2 {
+		t.Errorf("agents.len() = %d, want 2", n)
+	}
+
+	// 过期的缓存在下次获取的时候删除
+	provider.agents.get("a", time.Now()).expireAt = time.Now()
+	get("a", true)
+	if loads["a"] != 3 {
+		t.Errorf(`loads["a"] = %d, want 3`, loads["a"])
+	}
+}
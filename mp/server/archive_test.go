@@ -0,0 +1,93 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/chanxuehong/wechat/mp/message/passive/request"
+	"github.com/chanxuehong/wechat/mp/simulator"
+	"github.com/chanxuehong/wechat/util"
+)
+
+type testArchiveStore struct {
+	mutex   sync.Mutex
+	records []*util.ArchiveRecord
+}
+
+func (s *testArchiveStore) Append(record *util.ArchiveRecord) error {
+	s.mutex.Lock()
+	s.records = append(s.records, record)
+	s.mutex.Unlock()
+	return nil
+}
+
+func (s *testArchiveStore) Query(query *util.ArchiveQuery) (records []*util.ArchiveRecord, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, record := range s.records {
+		if query.Match(record) {
+			records = append(records, record)
+		}
+	}
+	return
+}
+
+func TestFrontendArchive(t *testing.T) {
+	const id, token, appId = "gh_0123456789ab", "token", "wx0123456789abcdef"
+	AESKey := bytes.Repeat([]byte("k"), 32)
+
+	var agent DefaultAgent
+	agent.Init(id, token, appId, AESKey)
+
+	mux := NewServeMux(&agent)
+	mux.OnText(func(ctx *Context) {
+		ctx.ReplyText("echo: " + ctx.Msg.(*request.Text).Content)
+	})
+
+	store := new(testArchiveStore)
+	frontend := NewAgentFrontend(mux, nil)
+	frontend.EnableArchive(store)
+
+	for _, mode := range []string{simulator.MODE_RAW, simulator.MODE_AES} {
+		rawXMLMsg, err := simulator.BuildMsg("text", &simulator.Params{ToUserName: id, FromUserName: "openid", Content: mode})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := simulator.NewSimulator("http://localhost/", token, appId, AESKey, mode).NewRequest(rawXMLMsg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		frontend.ServeHTTP(w, r)
+
+		records, _ := store.Query(&util.ArchiveQuery{OpenId: "openid", Limit: 1})
+		if len(records) != 1 {
+			t.Fatalf("%s: records = %+v", mode, records)
+		}
+		record := records[0]
+		store.records = nil
+
+		if record.Direction != util.ArchiveInbound || record.Source != "mp" || record.AccountId != id ||
+			record.MsgType != "text" || record.RawXMLMsg != string(rawXMLMsg) || record.Reply != w.Body.String() {
+			t.Errorf("%s: record = %+v", mode, record)
+		}
+		switch mode {
+		case simulator.MODE_RAW:
+			if !strings.Contains(record.Reply, "echo: raw") || record.ReplyXML != "" {
+				t.Errorf("raw: Reply = %q, ReplyXML = %q", record.Reply, record.ReplyXML)
+			}
+		case simulator.MODE_AES:
+			if strings.Contains(record.Reply, "echo: aes") || !strings.Contains(record.ReplyXML, "echo: aes") {
+				t.Errorf("aes: Reply = %q, ReplyXML = %q", record.Reply, record.ReplyXML)
+			}
+		}
+	}
+}
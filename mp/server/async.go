@@ -0,0 +1,231 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/chanxuehong/wechat/mp/message/active/custom"
+	"github.com/chanxuehong/wechat/mp/message/passive/response"
+)
+
+const (
+	// 默认等待被动回复的时间, 微信服务器 5 秒内收不到回复会断开连接并重试
+	DefaultAsyncTimeout    = 4 * time.Second
+	DefaultAsyncMaxWorkers = 1000 // 默认同时在后台处理的消息的最大数量
+)
+
+// 发送客服消息, *client.Client 实现了这个接口.
+type CustomMsgSender interface {
+	MsgCustomSendText(msg *custom.Text) error
+	MsgCustomSendImage(msg *custom.Image) error
+	MsgCustomSendVoice(msg *custom.Voice) error
+	MsgCustomSendVideo(msg *custom.Video) error
+	MsgCustomSendMusic(msg *custom.Music) error
+	MsgCustomSendNews(msg *custom.News) error
+}
+
+type AsyncOptions struct {
+	Timeout    time.Duration // 等待被动回复的时间, 默认为 DefaultAsyncTimeout
+	MaxWorkers int           // 同时在后台处理的消息的最大数量, 默认为 DefaultAsyncMaxWorkers; 超过的消息直接在当前 goroutine 里同步处理
+
+	// 超时后通过客服消息发送回复失败, 或者 handler panic 的时候调用, 后者 msg == nil;
+	// 为 nil 则用 log.Printf 记录错误.
+	OnError func(ctx *Context, msg interface{}, err error)
+}
+
+// 异步回复模式, 解决处理时间超过微信服务器 5 秒限制的问题.
+// handler 在后台的 goroutine 里处理消息, 如果 Timeout 之内回复了消息则正常的被动回复;
+// 否则先回复 "success" 结束 http 请求, handler 之后调用 Context.Reply 回复的消息通过 sender 以客服消息发送.
+//  NOTE:
+//  1. 只有通过 Context.Reply 回复的消息超时后才能转为客服消息, 直接写 Context.ResponseWriter 的数据超时后被丢弃;
+//  2. 客服消息不支持 *response.TransferToCustomerService 等消息, 超时后回复这类消息会报告给 OnError;
+//  3. Async 后面的中间件和 handler 在后台的 goroutine 里运行, 前面的中间件看到的是 Async 返回的时候的状态,
+//     所以 Recover 要放在 Async 的后面才能恢复 handler 的 panic, Async 自己也会恢复 panic 并报告给 OnError.
+func Async(sender CustomMsgSender, opts *AsyncOptions) Middleware {
+	if sender == nil {
+		panic("sender == nil")
+	}
+
+	var options AsyncOptions
+	if opts != nil {
+		options = *opts
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultAsyncTimeout
+	}
+	if options.MaxWorkers <= 0 {
+		options.MaxWorkers = DefaultAsyncMaxWorkers
+	}
+	if options.OnError == nil {
+		options.OnError = func(ctx *Context, msg interface{}, err error) {
+			log.Printf("wechat: async reply to %s failed: %v", ctx.FromUserName, err)
+		}
+	}
+	workers := make(chan struct{}, options.MaxWorkers)
+
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx *Context) {
+			select {
+			case workers <- struct{}{}:
+			default: // 后台处理的消息太多, 同步处理
+				next.ServeMsg(ctx)
+				return
+			}
+
+			w := ctx.ResponseWriter
+			state := &asyncState{
+				sender:  sender,
+				onError: options.OnError,
+				writer:  &asyncResponseWriter{header: make(http.Header)},
+			}
+			state.writer.state = state
+			ctx.ResponseWriter = state.writer
+			ctx.async = state
+
+			done := make(chan struct{})
+			go func() {
+				defer func() {
+					if v := recover(); v != nil {
+						options.OnError(ctx, nil, fmt.Errorf("panic: %v", v))
+					}
+					<-workers
+					close(done)
+				}()
+				next.ServeMsg(ctx)
+			}()
+
+			timedOut := false
+			timer := time.NewTimer(options.Timeout)
+			select {
+			case <-done:
+				timer.Stop()
+			case <-timer.C:
+				timedOut = true
+			}
+
+			// 之后 handler 写的数据都被丢弃, Context.Reply 改为发送客服消息
+			state.mutex.Lock()
+			state.finished = true
+			code := state.writer.code
+			body := state.writer.buf.Bytes()
+			state.mutex.Unlock()
+
+			// 超时的时候 handler 可能还在修改之前通过 Header() 拿到的 map, 不能读取, 丢弃 header
+			if !timedOut {
+				for k, v := range state.writer.header {
+					w.Header()[k] = v
+				}
+			}
+			if code != 0 {
+				w.WriteHeader(code)
+			}
+			if len(body) > 0 {
+				w.Write(body)
+				return
+			}
+			select {
+			case <-done:
+			default: // 超时了还没有回复
+				io.WriteString(w, "success")
+			}
+		})
+	}
+}
+
+type asyncState struct {
+	mutex    sync.Mutex
+	finished bool // http 请求是否已经结束
+	writer   *asyncResponseWriter
+
+	sender  CustomMsgSender
+	onError func(ctx *Context, msg interface{}, err error)
+}
+
+// 被动回复或者 http 请求结束后通过客服消息发送
+func (state *asyncState) reply(ctx *Context, msg interface{}) (err error) {
+	state.mutex.Lock()
+	if !state.finished {
+		err = ctx.writeReply(&state.writer.buf, msg)
+		state.mutex.Unlock()
+		return
+	}
+	state.mutex.Unlock()
+
+	if err = sendCustomMsg(state.sender, msg); err != nil {
+		state.onError(ctx, msg, err)
+	}
+	return
+}
+
+// 缓存 handler 写的数据, http 请求结束后丢弃
+type asyncResponseWriter struct {
+	state  *asyncState
+	header http.Header
+	code   int
+	buf    bytes.Buffer
+}
+
+// http 请求结束后返回一个丢弃的 map
+func (w *asyncResponseWriter) Header() http.Header {
+	w.state.mutex.Lock()
+	defer w.state.mutex.Unlock()
+
+	if w.state.finished {
+		return make(http.Header)
+	}
+	return w.header
+}
+
+func (w *asyncResponseWriter) WriteHeader(code int) {
+	w.state.mutex.Lock()
+	if !w.state.finished && w.code == 0 {
+		w.code = code
+	}
+	w.state.mutex.Unlock()
+}
+
+func (w *asyncResponseWriter) Write(p []byte) (int, error) {
+	w.state.mutex.Lock()
+	defer w.state.mutex.Unlock()
+
+	if w.state.finished {
+		return 0, fmt.Errorf("wechat: the http request has finished, data discarded")
+	}
+	return w.buf.Write(p)
+}
+
+// 把被动回复的消息转换为客服消息发送给 msg 的接收方
+func sendCustomMsg(sender CustomMsgSender, msg interface{}) error {
+	switch msg := msg.(type) {
+	case *response.Text:
+		return sender.MsgCustomSendText(custom.NewText(msg.ToUserName, msg.Content))
+	case *response.Image:
+		return sender.MsgCustomSendImage(custom.NewImage(msg.ToUserName, msg.Image.MediaId))
+	case *response.Voice:
+		return sender.MsgCustomSendVoice(custom.NewVoice(msg.ToUserName, msg.Voice.MediaId))
+	case *response.Video:
+		return sender.MsgCustomSendVideo(custom.NewVideo(msg.ToUserName, msg.Video.MediaId, "", msg.Video.Title, msg.Video.Description))
+	case *response.Music:
+		return sender.MsgCustomSendMusic(custom.NewMusic(msg.ToUserName, msg.Music.ThumbMediaId,
+			msg.Music.MusicURL, msg.Music.HQMusicURL, msg.Music.Title, msg.Music.Description))
+	case *response.News:
+		articles := make([]custom.NewsArticle, len(msg.Articles))
+		for i := range msg.Articles {
+			article := &msg.Articles[i]
+			articles[i].Init(article.Title, article.Description, article.URL, article.PicURL)
+		}
+		return sender.MsgCustomSendNews(custom.NewNews(msg.ToUserName, articles))
+	default:
+		return fmt.Errorf("can not send %T as custom message", msg)
+	}
+}
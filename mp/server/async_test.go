@@ -0,0 +1,148 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/wechat/mp/message/active/custom"
+	"github.com/chanxuehong/wechat/mp/message/passive/request"
+)
+
+type asyncTestSender struct {
+	texts chan *custom.Text
+}
+
+func (s *asyncTestSender) MsgCustomSendText(msg *custom.Text) error {
+	s.texts <- msg
+	return nil
+}
+func (s *asyncTestSender) MsgCustomSendImage(msg *custom.Image) error { return nil }
+func (s *asyncTestSender) MsgCustomSendVoice(msg *custom.Voice) error { return nil }
+func (s *asyncTestSender) MsgCustomSendVideo(msg *custom.Video) error { return nil }
+func (s *asyncTestSender) MsgCustomSendMusic(msg *custom.Music) error { return nil }
+func (s *asyncTestSender) MsgCustomSendNews(msg *custom.News) error   { return nil }
+
+func TestAsync(t *testing.T) {
+	const id, token, appId = "gh_0123456789ab", "token", "wx0123456789abcdef"
+	AESKey := bytes.Repeat([]byte("k"), 32)
+
+	var agent DefaultAgent
+	agent.Init(id, token, appId, AESKey)
+
+	sender := &asyncTestSender{texts: make(chan *custom.Text, 1)}
+	errs := make(chan error, 1)
+	release := make(chan struct{})
+
+	mux := NewServeMux(&agent)
+	mux.Use(Async(sender, &AsyncOptions{
+		Timeout:    50 * time.Millisecond,
+		MaxWorkers: 1,
+		OnError:    func(ctx *Context, msg interface{}, err error) { errs <- err },
+	}))
+	mux.OnText(func(ctx *Context) {
+		switch content := ctx.Msg.(*request.Text).Content; content {
+		case "slow":
+			time.Sleep(100 * time.Millisecond)
+			ctx.ReplyText("slow done")
+		case "block":
+			<-release
+		case "panic":
+			panic(content)
+		default:
+			ctx.ReplyText("echo: " + content)
+		}
+	})
+
+	serve := func(content string) string {
+		w := httptest.NewRecorder()
+		msg := &request.Text{Content: content}
+		msg.FromUserName = "openid"
+		msg.ToUserName = id
+		msg.MsgType = request.MSG_TYPE_TEXT
+		mux.ServeTextMsg(w, nil, msg, nil, time.Now().Unix())
+		return w.Body.String()
+	}
+
+	if body := serve("fast"); !strings.Contains(body, "<Content>echo: fast</Content>") {
+		t.Errorf("fast reply = %q", body)
+	}
+
+	start := time.Now()
+	if body := serve("slow"); body != "success" {
+		t.Errorf("slow reply = %q, want success", body)
+	}
+	if d := time.Since(start); d >= 100*time.Millisecond {
+		t.Errorf("slow reply took %s", d)
+	}
+	select {
+	case text := <-sender.texts:
+		if text.ToUser != "openid" || text.Text.Content != "slow done" {
+			t.Errorf("custom msg = %+v", text)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("custom msg not sent")
+	}
+
+	if body := serve("panic"); body != "" {
+		t.Errorf("panic reply = %q, want empty", body)
+	}
+	if err := <-errs; err == nil || !strings.Contains(err.Error(), "panic") {
+		t.Errorf("OnError err = %v", err)
+	}
+
+	// 占满工作池之后同步处理
+	go serve("block")
+	time.Sleep(10 * time.Millisecond)
+	if body := serve("sync"); !strings.Contains(body, "<Content>echo: sync</Content>") {
+		t.Errorf("sync reply = %q", body)
+	}
+	close(release)
+
+	if err := sendCustomMsg(sender, struct{}{}); err == nil {
+		t.Error("sendCustomMsg(struct{}{}) = nil, want error")
+	}
+}
+
+func TestAsyncHeaderAfterTimeout(t *testing.T) {
+	var agent DefaultAgent
+	agent.Init("gh_0123456789ab", "token", "wx0123456789abcdef", bytes.Repeat([]byte("k"), 32))
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	mux := NewServeMux(&agent)
+	mux.Use(Async(&asyncTestSender{texts: make(chan *custom.Text, 1)}, &AsyncOptions{Timeout: 20 * time.Millisecond}))
+	mux.OnText(func(ctx *Context) {
+		defer close(done)
+		// 超时前后一直修改 header, 不能和回复 http 请求并发读写
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				ctx.ResponseWriter.Header().Set("X-Test", "1")
+			}
+		}
+	})
+
+	w := httptest.NewRecorder()
+	msg := &request.Text{Content: "header"}
+	msg.FromUserName = "openid"
+	msg.MsgType = request.MSG_TYPE_TEXT
+	mux.ServeTextMsg(w, nil, msg, nil, time.Now().Unix())
+	close(stop)
+	<-done
+
+	if body := w.Body.String(); body != "success" {
+		t.Errorf("reply = %q, want success", body)
+	}
+	if have := w.Header().Get("X-Test"); have != "" {
+		t.Errorf("X-Test = %q, want empty after timeout", have)
+	}
+}
@@ -0,0 +1,481 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/chanxuehong/wechat/mp/message/passive/request"
+	"github.com/chanxuehong/wechat/mp/message/passive/response"
+)
+
+// 关键字的匹配方式
+const (
+	MatchExact    = "exact"    // 默认; 完全相等
+	MatchPrefix   = "prefix"   // 以关键字开头
+	MatchContains = "contains" // 包含关键字
+	MatchRegexp   = "regex"    // 关键字是正则表达式, 语法同 regexp 包
+)
+
+// 触发自动回复的消息(事件)
+const (
+	TriggerText      = "text"      // 默认; 文本消息, 用 Content 匹配关键字
+	TriggerSubscribe = "subscribe" // 关注事件, 没有关键字则匹配所有的关注; 否则用 EventKey(qrscene_ 为前缀) 匹配, 只匹配扫描带参数二维码的关注
+	TriggerClick     = "click"     // 点击菜单拉取消息的事件, 用 EventKey 匹配关键字
+)
+
+// 自动回复的规则, 可以从 JSON 加载, 比如:
+//  {
+//      "name": "hello",
+//      "keywords": ["你好", "hello"],
+//      "ignore_case": true,
+//      "time_windows": ["09:00-18:00"],
+//      "reply": {"type": "text", "content": "你好 {{.FromUserName}}"}
+//  }
+type AutoReplyRule struct {
+	Name       string   `json:"name"`                  // 规则的名称, 用于日志
+	Trigger    string   `json:"trigger,omitempty"`     // TriggerText(默认), TriggerSubscribe 或者 TriggerClick
+	Match      string   `json:"match,omitempty"`       // MatchExact(默认), MatchPrefix, MatchContains 或者 MatchRegexp
+	Keywords   []string `json:"keywords,omitempty"`    // 匹配任意一个关键字即可
+	IgnoreCase bool     `json:"ignore_case,omitempty"` // 忽略大小写
+	Priority   int      `json:"priority,omitempty"`    // 优先级, 越大越先匹配, 相同的按规则的顺序
+
+	// 生效的时间段, 格式为 "HH:MM-HH:MM", 包括开始不包括结束, 结束早于开始表示跨过零点; 为空表示全天生效.
+	TimeWindows []string `json:"time_windows,omitempty"`
+
+	Reply AutoReplyTemplate `json:"reply"`
+}
+
+// 自动回复的消息模板, 对应 response 包的回复消息.
+type AutoReplyTemplate struct {
+	// response.MSG_TYPE_TEXT, response.MSG_TYPE_IMAGE, response.MSG_TYPE_NEWS 或者 response.MSG_TYPE_MUSIC
+	Type string `json:"type"`
+
+	// 文本消息的内容, 是 text/template 模板, 可以使用 .FromUserName, .ToUserName, .Content 和 .EventKey
+	Content string `json:"content,omitempty"`
+
+	MediaId string `json:"media_id,omitempty"` // 图片消息的媒体id
+
+	Articles []response.NewsArticle `json:"articles,omitempty"` // 图文消息的文章
+
+	// 音乐消息
+	Title        string `json:"title,omitempty"`
+	Description  string `json:"description,omitempty"`
+	MusicURL     string `json:"music_url,omitempty"`
+	HQMusicURL   string `json:"hq_music_url,omitempty"`
+	ThumbMediaId string `json:"thumb_media_id,omitempty"`
+}
+
+// 传给文本消息模板的数据
+type autoReplyData struct {
+	FromUserName string
+	ToUserName   string
+	Content      string // 文本消息的内容
+	EventKey     string // 事件KEY值
+}
+
+type timeWindow struct {
+	start, end int // 一天中的分钟数
+}
+
+func (w timeWindow) contains(minute int) bool {
+	if w.start <= w.end {
+		return minute >= w.start && minute < w.end
+	}
+	return minute >= w.start || minute < w.end // 跨过零点
+}
+
+// 编译好的规则
+type autoReplyRule struct {
+	*AutoReplyRule
+	keywords []string         // IgnoreCase 的时候是小写的
+	regexps  []*regexp.Regexp // MatchRegexp
+	windows  []timeWindow
+	content  *template.Template
+}
+
+// 按照 Priority 从大到小排序
+type autoReplyRulesByPriority []*autoReplyRule
+
+func (s autoReplyRulesByPriority) Len() int           { return len(s) }
+func (s autoReplyRulesByPriority) Less(i, j int) bool { return s[i].Priority > s[j].Priority }
+func (s autoReplyRulesByPriority) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// 关键字自动回复, 按优先级依次匹配规则, 回复第一个匹配的规则的消息.
+// 规则可以在运行中调用 SetRules, LoadJSON, LoadFile 或者 WatchFile 重新加载. 并发安全.
+//
+//  replier, err := server.NewAutoReplier(nil)
+//  err = replier.LoadFile("auto_reply.json") // JSON 数组, 元素是 AutoReplyRule
+//  mux.Use(server.AutoReply(replier))
+type AutoReplier struct {
+	rwmutex  sync.RWMutex
+	rules    []*autoReplyRule // 按优先级排好序
+	location *time.Location
+}
+
+// 创建一个新的 AutoReplier, rules 可以为 nil, 以后再加载; 规则不合法的时候返回错误.
+func NewAutoReplier(rules []AutoReplyRule) (*AutoReplier, error) {
+	replier := &AutoReplier{location: time.Local}
+	if err := replier.SetRules(rules); err != nil {
+		return nil, err
+	}
+	return replier, nil
+}
+
+// 设置 AutoReplyRule.TimeWindows 使用的时区, 默认为 time.Local; 服务器不在中国的时候一般要设置.
+func (replier *AutoReplier) SetLocation(loc *time.Location) {
+	if loc == nil {
+		panic("loc == nil")
+	}
+	replier.rwmutex.Lock()
+	replier.location = loc
+	replier.rwmutex.Unlock()
+}
+
+// 替换所有的规则, 有规则不合法的时候返回错误, 不替换.
+func (replier *AutoReplier) SetRules(rules []AutoReplyRule) error {
+	compiled := make([]*autoReplyRule, 0, len(rules))
+	for i := range rules {
+		rule := rules[i] // 复制一份, 调用者修改 rules 不影响已经加载的规则
+		r, err := compileAutoReplyRule(&rule)
+		if err != nil {
+			return fmt.Errorf("auto reply rule %d(%s): %s", i, rule.Name, err.Error())
+		}
+		compiled = append(compiled, r)
+	}
+	sort.Stable(autoReplyRulesByPriority(compiled))
+
+	replier.rwmutex.Lock()
+	replier.rules = compiled
+	replier.rwmutex.Unlock()
+	return nil
+}
+
+// 从 JSON 数组加载规则, 替换所有的规则.
+func (replier *AutoReplier) LoadJSON(data []byte) error {
+	var rules []AutoReplyRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return err
+	}
+	return replier.SetRules(rules)
+}
+
+// 从 JSON 文件加载规则, 替换所有的规则.
+func (replier *AutoReplier) LoadFile(filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return replier.LoadJSON(data)
+}
+
+// 每隔 interval 检查一次 filename, 修改了则重新加载, 加载失败的时候保留原来的规则并调用 onError,
+// 下次检查的时候重试; onError 为 nil 则用 log.Printf 记录错误. 返回的 stop 用于停止检查,
+// stop 返回以后不会再调用 onError.
+//  NOTE: 不会马上加载 filename, 要先调用 LoadFile.
+func (replier *AutoReplier) WatchFile(filename string, interval time.Duration, onError func(err error)) (stop func()) {
+	if interval <= 0 {
+		panic("interval must be positive")
+	}
+	if onError == nil {
+		onError = func(err error) {
+			log.Printf("wechat: reload auto reply rules %s failed: %v", filename, err)
+		}
+	}
+
+	var lastModTime time.Time
+	if info, err := os.Stat(filename); err == nil {
+		lastModTime = info.ModTime()
+	}
+
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			info, err := os.Stat(filename)
+			if err != nil {
+				onError(err)
+				continue
+			}
+			if info.ModTime().Equal(lastModTime) {
+				continue
+			}
+			if err = replier.LoadFile(filename); err != nil {
+				onError(err)
+				continue
+			}
+			lastModTime = info.ModTime()
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-exited
+	}
+}
+
+func compileAutoReplyRule(rule *AutoReplyRule) (r *autoReplyRule, err error) {
+	r = &autoReplyRule{AutoReplyRule: rule}
+
+	switch rule.Trigger {
+	case "", TriggerText, TriggerClick:
+		if len(rule.Keywords) == 0 {
+			return nil, errors.New("no keywords")
+		}
+	case TriggerSubscribe:
+	default:
+		return nil, fmt.Errorf("unknown trigger %q", rule.Trigger)
+	}
+
+	switch rule.Match {
+	case "", MatchExact, MatchPrefix, MatchContains:
+		for _, keyword := range rule.Keywords {
+			if rule.IgnoreCase {
+				keyword = strings.ToLower(keyword)
+			}
+			r.keywords = append(r.keywords, keyword)
+		}
+	case MatchRegexp:
+		for _, keyword := range rule.Keywords {
+			if rule.IgnoreCase {
+				keyword = "(?i)" + keyword
+			}
+			re, err := regexp.Compile(keyword)
+			if err != nil {
+				return nil, err
+			}
+			r.regexps = append(r.regexps, re)
+		}
+	default:
+		return nil, fmt.Errorf("unknown match %q", rule.Match)
+	}
+
+	for _, window := range rule.TimeWindows {
+		w, err := parseTimeWindow(window)
+		if err != nil {
+			return nil, err
+		}
+		r.windows = append(r.windows, w)
+	}
+
+	reply := &rule.Reply
+	switch reply.Type {
+	case response.MSG_TYPE_TEXT:
+		if r.content, err = template.New(rule.Name).Parse(reply.Content); err != nil {
+			return nil, err
+		}
+	case response.MSG_TYPE_IMAGE:
+		if reply.MediaId == "" {
+			return nil, errors.New("image reply without media_id")
+		}
+	case response.MSG_TYPE_NEWS:
+		news := response.NewNews("", "", reply.Articles, 0)
+		if err = news.CheckValid(); err != nil {
+			return nil, err
+		}
+	case response.MSG_TYPE_MUSIC:
+		if reply.ThumbMediaId == "" {
+			return nil, errors.New("music reply without thumb_media_id")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported reply type %q", reply.Type)
+	}
+	return r, nil
+}
+
+// 解析 "HH:MM-HH:MM"
+func parseTimeWindow(s string) (w timeWindow, err error) {
+	var startHour, startMinute, endHour, endMinute int
+	if _, err = fmt.Sscanf(s, "%d:%d-%d:%d", &startHour, &startMinute, &endHour, &endMinute); err != nil {
+		return w, fmt.Errorf("invalid time window %q", s)
+	}
+	if startHour < 0 || startHour > 24 || startMinute < 0 || startMinute > 59 ||
+		endHour < 0 || endHour > 24 || endMinute < 0 || endMinute > 59 {
+		return w, fmt.Errorf("invalid time window %q", s)
+	}
+	w.start = startHour*60 + startMinute
+	w.end = endHour*60 + endMinute
+	return
+}
+
+func (r *autoReplyRule) matchKeyword(s string) bool {
+	if r.regexps != nil {
+		for _, re := range r.regexps {
+			if re.MatchString(s) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if r.IgnoreCase {
+		s = strings.ToLower(s)
+	}
+	for _, keyword := range r.keywords {
+		switch r.Match {
+		case MatchPrefix:
+			if strings.HasPrefix(s, keyword) {
+				return true
+			}
+		case MatchContains:
+			if strings.Contains(s, keyword) {
+				return true
+			}
+		default:
+			if s == keyword {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *autoReplyRule) inTimeWindows(minute int) bool {
+	if len(r.windows) == 0 {
+		return true
+	}
+	for _, w := range r.windows {
+		if w.contains(minute) {
+			return true
+		}
+	}
+	return false
+}
+
+// 查找匹配 ctx 的规则, 没有则返回 nil.
+func (replier *AutoReplier) Match(ctx *Context) *AutoReplyRule {
+	if rule, _ := replier.match(ctx, time.Now()); rule != nil {
+		return rule.AutoReplyRule
+	}
+	return nil
+}
+
+func (replier *AutoReplier) match(ctx *Context, now time.Time) (rule *autoReplyRule, data *autoReplyData) {
+	var trigger, value string
+	switch msg := ctx.Msg.(type) {
+	case *request.Text:
+		trigger, value = TriggerText, strings.TrimSpace(msg.Content)
+	case *request.MenuClickEvent:
+		trigger, value = TriggerClick, msg.EventKey
+	case *request.SubscribeEvent:
+		trigger = TriggerSubscribe
+	case *request.SubscribeByScanEvent:
+		trigger, value = TriggerSubscribe, msg.EventKey
+	default:
+		return
+	}
+
+	replier.rwmutex.RLock()
+	rules, location := replier.rules, replier.location
+	replier.rwmutex.RUnlock()
+
+	now = now.In(location)
+	minute := now.Hour()*60 + now.Minute()
+	for _, r := range rules {
+		ruleTrigger := r.Trigger
+		if ruleTrigger == "" {
+			ruleTrigger = TriggerText
+		}
+		if ruleTrigger != trigger || !r.inTimeWindows(minute) {
+			continue
+		}
+		if (trigger == TriggerSubscribe && len(r.Keywords) == 0) || r.matchKeyword(value) {
+			data = &autoReplyData{FromUserName: ctx.FromUserName, ToUserName: ctx.ToUserName}
+			if trigger == TriggerText {
+				data.Content = value
+			} else {
+				data.EventKey = value
+			}
+			return r, data
+		}
+	}
+	return nil, nil
+}
+
+// 根据规则 r 生成回复的消息
+func (r *autoReplyRule) buildReply(data *autoReplyData, timestamp int64) (msg interface{}, err error) {
+	reply := &r.Reply
+	to, from := data.FromUserName, data.ToUserName
+	switch reply.Type {
+	case response.MSG_TYPE_TEXT:
+		var buf bytes.Buffer
+		if err = r.content.Execute(&buf, data); err != nil {
+			return
+		}
+		return response.NewText(to, from, buf.String(), timestamp), nil
+	case response.MSG_TYPE_IMAGE:
+		return response.NewImage(to, from, reply.MediaId, timestamp), nil
+	case response.MSG_TYPE_NEWS:
+		articles := make([]response.NewsArticle, len(reply.Articles))
+		copy(articles, reply.Articles)
+		return response.NewNews(to, from, articles, timestamp), nil
+	default: // response.MSG_TYPE_MUSIC
+		return response.NewMusic(to, from, reply.ThumbMediaId, reply.MusicURL, reply.HQMusicURL,
+			reply.Title, reply.Description, timestamp), nil
+	}
+}
+
+// 实现 Handler, 有匹配的规则则回复对应的消息, 否则不做任何事情.
+func (replier *AutoReplier) ServeMsg(ctx *Context) {
+	replier.reply(ctx)
+}
+
+// 有匹配的规则则回复对应的消息并返回 true
+func (replier *AutoReplier) reply(ctx *Context) bool {
+	now := time.Now()
+	rule, data := replier.match(ctx, now)
+	if rule == nil {
+		return false
+	}
+
+	msg, err := rule.buildReply(data, now.Unix())
+	if err == nil {
+		err = ctx.Reply(msg)
+	}
+	if err != nil {
+		log.Printf("wechat: auto reply rule %s to %s failed: %v", rule.Name, ctx.FromUserName, err)
+	}
+	return true
+}
+
+// 关键字自动回复中间件, 有匹配的规则则回复对应的消息, 不再调用后面的 handler; 否则交给后面的 handler 处理.
+//  NOTE: 和 Dialogs 一起使用的时候要放在 Dialogs 的后面, 否则对话中用户的输入可能被自动回复.
+func AutoReply(replier *AutoReplier) Middleware {
+	if replier == nil {
+		panic("replier == nil")
+	}
+
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx *Context) {
+			if !replier.reply(ctx) {
+				next.ServeMsg(ctx)
+			}
+		})
+	}
+}
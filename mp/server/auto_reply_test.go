@@ -0,0 +1,152 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/wechat/mp/message/passive/request"
+	"github.com/chanxuehong/wechat/mp/message/passive/response"
+)
+
+const autoReplyRulesJSON = `[
+	{"name": "hello", "keywords": ["hello"], "ignore_case": true,
+	 "reply": {"type": "text", "content": "hi {{.FromUserName}}"}},
+	{"name": "help", "match": "prefix", "keywords": ["help"],
+	 "reply": {"type": "image", "media_id": "help_image"}},
+	{"name": "order", "match": "regex", "keywords": ["^order \\d+$"], "priority": 10,
+	 "reply": {"type": "news", "articles": [{"Title": "your order", "Url": "http://example.com"}]}},
+	{"name": "night", "match": "contains", "keywords": ["music"], "time_windows": ["22:00-06:00"],
+	 "reply": {"type": "music", "thumb_media_id": "thumb", "music_url": "http://example.com/a.mp3"}},
+	{"name": "welcome", "trigger": "subscribe",
+	 "reply": {"type": "text", "content": "welcome"}},
+	{"name": "menu", "trigger": "click", "keywords": ["V1001_TODAY_MUSIC"],
+	 "reply": {"type": "text", "content": "{{.EventKey}}"}}
+]`
+
+func TestAutoReplier(t *testing.T) {
+	replier, err := NewAutoReplier(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = replier.LoadJSON([]byte(autoReplyRulesJSON)); err != nil {
+		t.Fatal(err)
+	}
+
+	head := request.CommonHead{ToUserName: "gh_0123456789ab", FromUserName: "openid"}
+	text := func(content string) *Context {
+		return &Context{CommonHead: head, Msg: &request.Text{CommonHead: head, Content: content}}
+	}
+	noon := time.Date(2015, 1, 1, 12, 0, 0, 0, time.Local)
+	midnight := time.Date(2015, 1, 1, 23, 30, 0, 0, time.Local)
+
+	for _, tt := range []struct {
+		ctx  *Context
+		now  time.Time
+		want string
+	}{
+		{text(" HeLLo "), noon, "hello"},
+		{text("hello world"), noon, ""},
+		{text("help me"), noon, "help"},
+		{text("order 123"), noon, "order"},
+		{text("play music"), noon, ""},
+		{text("play music"), midnight, "night"},
+		{&Context{CommonHead: head, Msg: &request.SubscribeEvent{CommonHead: head}}, noon, "welcome"},
+		{&Context{CommonHead: head, Msg: &request.MenuClickEvent{CommonHead: head, EventKey: "V1001_TODAY_MUSIC"}}, noon, "menu"},
+		{&Context{CommonHead: head, Msg: &request.MenuClickEvent{CommonHead: head, EventKey: "OTHER"}}, noon, ""},
+	} {
+		rule, data := replier.match(tt.ctx, tt.now)
+		var name string
+		if rule != nil {
+			name = rule.Name
+		}
+		if name != tt.want {
+			t.Errorf("match(%+v) = %q, want %q", tt.ctx.Msg, name, tt.want)
+			continue
+		}
+		if rule == nil {
+			continue
+		}
+		if _, err = rule.buildReply(data, tt.now.Unix()); err != nil {
+			t.Errorf("rule %s: %v", name, err)
+		}
+	}
+
+	rule, data := replier.match(text("hello"), noon)
+	msg, err := rule.buildReply(data, noon.Unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply := msg.(*response.Text); reply.Content != "hi openid" || reply.ToUserName != "openid" {
+		t.Errorf("reply = %+v", reply)
+	}
+
+	// 不合法的规则不替换原来的规则
+	if err = replier.LoadJSON([]byte(`[{"name": "bad", "match": "regex", "keywords": ["("], "reply": {"type": "text"}}]`)); err == nil {
+		t.Fatal("want error for invalid regexp")
+	}
+	if rule, _ := replier.match(text("hello"), noon); rule == nil {
+		t.Error("rules replaced by invalid rules")
+	}
+}
+
+func TestAutoReplierWatchFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wechat-auto-reply")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "rules.json")
+
+	write := func(keyword string, modTime time.Time) { // 先写临时文件再改名, 不会读到写了一半的文件
+		rules := `[{"name": "r", "keywords": ["` + keyword + `"], "reply": {"type": "text", "content": "ok"}}]`
+		tmp := filename + ".tmp"
+		if err := ioutil.WriteFile(tmp, []byte(rules), 0600); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(tmp, modTime, modTime)
+		if err := os.Rename(tmp, filename); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a", time.Now().Add(-time.Hour))
+
+	replier, err := NewAutoReplier(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = replier.LoadFile(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	var errsMutex sync.Mutex
+	var errs []error
+	stop := replier.WatchFile(filename, 10*time.Millisecond, func(err error) {
+		errsMutex.Lock()
+		errs = append(errs, err)
+		errsMutex.Unlock()
+	})
+
+	head := request.CommonHead{FromUserName: "openid"}
+	ctx := &Context{CommonHead: head, Msg: &request.Text{CommonHead: head, Content: "b"}}
+	write("b", time.Now())
+	for i := 0; i < 100 && replier.Match(ctx) == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	stop()
+
+	if replier.Match(ctx) == nil {
+		t.Error("rules not reloaded")
+	}
+	if len(errs) != 0 {
+		t.Errorf("errs = %v", errs)
+	}
+}
@@ -0,0 +1,93 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chanxuehong/wechat/mp/simulator"
+)
+
+func TestDedup(t *testing.T) {
+	const id, token, appId = "gh_0123456789ab", "token", "wx0123456789abcdef"
+	AESKey := bytes.Repeat([]byte("k"), 32)
+
+	newMux := func(count *int) *ServeMux {
+		agent := new(DefaultAgent)
+		agent.Init(id, token, appId, AESKey)
+		mux := NewServeMux(agent)
+		mux.SetFallback(HandlerFunc(func(ctx *Context) {
+			*count++
+			ctx.ReplyText("ok")
+		}))
+		return mux
+	}
+
+	var single, multi, plain int
+	frontend := NewAgentFrontend(newMux(&single), nil)
+	frontend.EnableDedup(nil)
+
+	var multiFrontend MultiAgentFrontend
+	multiFrontend.SetAgent("a", newMux(&multi))
+	multiFrontend.EnableDedup("a", nil)
+	multiFrontend.SetAgent("b", newMux(&plain)) // 没有开启过滤
+
+	mux := http.NewServeMux()
+	mux.Handle("/single", frontend)
+	mux.Handle("/multi", &multiFrontend)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	text, err := simulator.BuildMsg("text", &simulator.Params{ToUserName: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := simulator.BuildMsg("event.CLICK", &simulator.Params{ToUserName: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, url := range []string{srv.URL + "/single", srv.URL + "/multi?agentkey=a", srv.URL + "/multi?agentkey=b"} {
+		s := simulator.NewSimulator(url, token, appId, AESKey, simulator.MODE_AES)
+		for _, rawXMLMsg := range [][]byte{text, event} {
+			for i := 0; i < 3; i++ { // 模拟微信服务器重试
+				reply, err := s.Post(rawXMLMsg)
+				if err != nil {
+					t.Fatalf("%s: %v", url, err)
+				}
+				if i > 0 && url != srv.URL+"/multi?agentkey=b" && len(reply.Body) != 0 {
+					t.Errorf("%s: duplicate reply = %q, want empty", url, reply.Body)
+				}
+			}
+		}
+	}
+
+	if single != 2 || multi != 2 || plain != 6 {
+		t.Errorf("single = %d, multi = %d, plain = %d, want 2, 2, 6", single, multi, plain)
+	}
+
+	// 默认的过滤对没有单独开启过滤的 Agent 和 AgentProvider 加载的 Agent 都有效
+	var loaded int
+	multiFrontend.EnableDefaultDedup(nil)
+	multiFrontend.SetAgentProvider(AgentProviderFunc(func(agentkey string) (Agent, error) {
+		return newMux(&loaded), nil
+	}))
+	for i, url := range []string{srv.URL + "/multi?agentkey=b", srv.URL + "/multi?agentkey=c"} {
+		s := simulator.NewSimulator(url, token, appId, AESKey, simulator.MODE_AES)
+		rawXMLMsg, _ := simulator.BuildMsg("text", &simulator.Params{ToUserName: id, MsgId: int64(i + 1)})
+		for j := 0; j < 3; j++ {
+			if _, err := s.Post(rawXMLMsg); err != nil {
+				t.Fatalf("%s: %v", url, err)
+			}
+		}
+	}
+	if plain != 7 || loaded != 1 {
+		t.Errorf("plain = %d, loaded = %d, want 7, 1", plain, loaded)
+	}
+}
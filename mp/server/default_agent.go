@@ -10,9 +10,11 @@ import (
 	"sync"
 
 	"github.com/chanxuehong/wechat/mp/message/passive/request"
+	"github.com/chanxuehong/wechat/util"
 )
 
 var _ Agent = new(DefaultAgent)
+var _ AESKeyRingAgent = new(DefaultAgent)
 
 type DefaultAgent struct {
 	RWMutex       sync.RWMutex
@@ -21,6 +23,9 @@ type DefaultAgent struct {
 	AppId         string   // 貌似需要认证才会有的???
 	LastAESKey    [32]byte // 最后一个 AES Key
 	CurrentAESKey [32]byte // 当前的 AES Key
+
+	// 不为 nil 的时候用 AESKeyRing 里所有有效的 key 解密消息, 忽略 LastAESKey 和 CurrentAESKey
+	AESKeyRing *util.AESKeyRing
 }
 
 // 初始化 DefaultAgent
@@ -36,6 +41,19 @@ func (this *DefaultAgent) Init(Id, Token, AppId string, AESKey []byte) {
 	copy(this.CurrentAESKey[:], AESKey)
 }
 
+// 用 AESKeyRing 初始化 DefaultAgent, ring 不能为 nil, 比如:
+//  ring, err := util.NewAESKeyRingFromEncoded(EncodingAESKey) // 43 个字符的 EncodingAESKey
+//  agent.InitWithAESKeyRing(Id, Token, AppId, ring)
+func (this *DefaultAgent) InitWithAESKeyRing(Id, Token, AppId string, ring *util.AESKeyRing) {
+	if ring == nil {
+		panic("ring == nil")
+	}
+	this.Id = Id
+	this.Token = Token
+	this.AppId = AppId
+	this.AESKeyRing = ring
+}
+
 func (this *DefaultAgent) GetId() string {
 	return this.Id
 }
@@ -52,11 +70,19 @@ func (this *DefaultAgent) GetLastAESKey() (key [32]byte) {
 	return
 }
 func (this *DefaultAgent) GetCurrentAESKey() (key [32]byte) {
+	if this.AESKeyRing != nil {
+		return this.AESKeyRing.Current()
+	}
 	this.RWMutex.RLock()
 	key = this.CurrentAESKey
 	this.RWMutex.RUnlock()
 	return
 }
+func (this *DefaultAgent) GetAESKeyRing() *util.AESKeyRing {
+	return this.AESKeyRing
+}
+
+// 更换 AES Key, 使用 AESKeyRing 的时候调用 AESKeyRing.Rotate 代替.
 func (this *DefaultAgent) UpdateAESKey(AESKey [32]byte) {
 	this.RWMutex.Lock()
 	this.LastAESKey = this.CurrentAESKey
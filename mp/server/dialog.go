@@ -0,0 +1,206 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chanxuehong/wechat/mp/message/passive/request"
+)
+
+// 对话的一个步骤, 提示用户输入并保存用户的输入.
+type DialogStep struct {
+	Name   string // 必须; 用户输入的保存名称, 对话完成后作为 Dialog.OnComplete 的 values 的 key
+	Prompt string // 进入这个步骤的时候回复给用户的提示, 为空则不回复
+	Input  string // 期望的消息类型, request.MSG_TYPE_TEXT(默认), request.MSG_TYPE_IMAGE 或 request.MSG_TYPE_LOCATION
+
+	// 校验用户的输入 value, 返回的错误信息回复给用户并等待重新输入; 可以为 nil.
+	// 文本消息的 value 是 Content, 图片消息是 MediaId, 地理位置消息是 "Location_X,Location_Y".
+	Validate func(value string) error
+
+	InvalidPrompt string // 消息类型不对的时候回复给用户的提示, 为空则用 Prompt
+}
+
+// 多步骤的对话, 比如依次收集用户的姓名, 手机号码和照片.
+// 调用 Dialog.Start 开始对话, 之后用户的消息由 Dialogs 中间件交给对话处理, 直到对话完成, 超时或者被取消.
+type Dialog struct {
+	Name  string       // 必须; 对话的名称, 唯一
+	Steps []DialogStep // 必须; 对话的步骤
+
+	Timeout        time.Duration // 每个步骤等待用户输入的时间, 0 表示不超时
+	CancelKeywords []string      // 用户发送这些文本(忽略大小写和首尾空白)的时候取消对话
+	CancelPrompt   string        // 取消对话后回复给用户的文本, 为空则不回复
+
+	// 对话超时后收到用户的消息时调用, 为 nil 则把消息交给 Dialogs 后面的 handler 处理.
+	OnTimeout func(ctx *Context)
+	// 必须; 所有的步骤都完成后调用, values 是每个步骤的 Name 和用户的输入.
+	OnComplete func(ctx *Context, values map[string]string)
+}
+
+// 正在进行的对话的状态, 保存在会话里
+type dialogState struct {
+	Name   string            `json:"name"`
+	Step   int               `json:"step"`
+	StepAt int64             `json:"step_at"` // 进入当前步骤的时间, unix 纳秒
+	Values map[string]string `json:"values,omitempty"`
+}
+
+// 开始对话 d, 取代 ctx 的会话里正在进行的对话, 并回复第一个步骤的提示.
+//  NOTE: 需要使用 Sessions 中间件, 并且 d 要注册到 Dialogs 中间件.
+func (d *Dialog) Start(ctx *Context) error {
+	session := ctx.Session()
+	if session == nil {
+		return errors.New("wechat: Sessions middleware is required to start a dialog")
+	}
+	session.data.Dialog = &dialogState{
+		Name:   d.Name,
+		StepAt: time.Now().UnixNano(),
+	}
+	session.destroyed = false
+	return d.prompt(ctx, d.Steps[0].Prompt)
+}
+
+func (d *Dialog) prompt(ctx *Context, prompt string) error {
+	if prompt == "" {
+		return nil
+	}
+	return ctx.ReplyText(prompt)
+}
+
+func (d *Dialog) isCancelKeyword(content string) bool {
+	content = strings.TrimSpace(content)
+	for _, keyword := range d.CancelKeywords {
+		if strings.EqualFold(content, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// 对话中间件, 会话里有正在进行的对话的时候, 把用户的消息交给对话处理; 事件和其他消息交给后面的 handler.
+//  NOTE: 要放在 Sessions 中间件的后面.
+func Dialogs(dialogs ...*Dialog) Middleware {
+	dialogMap := make(map[string]*Dialog, len(dialogs))
+	for _, d := range dialogs {
+		if d == nil {
+			panic("nil Dialog")
+		}
+		if d.Name == "" {
+			panic("empty Dialog.Name")
+		}
+		if _, ok := dialogMap[d.Name]; ok {
+			panic("duplicate Dialog: " + d.Name)
+		}
+		if len(d.Steps) == 0 {
+			panic("Dialog " + d.Name + " has no steps")
+		}
+		if d.OnComplete == nil {
+			panic("nil Dialog.OnComplete: " + d.Name)
+		}
+		for i := range d.Steps {
+			step := &d.Steps[i]
+			if step.Name == "" {
+				panic(fmt.Sprintf("Dialog %s: empty DialogStep.Name at index %d", d.Name, i))
+			}
+			switch step.Input {
+			case "", request.MSG_TYPE_TEXT, request.MSG_TYPE_IMAGE, request.MSG_TYPE_LOCATION:
+			default:
+				panic(fmt.Sprintf("Dialog %s: unsupported DialogStep.Input %q", d.Name, step.Input))
+			}
+		}
+		dialogMap[d.Name] = d
+	}
+
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx *Context) {
+			session := ctx.Session()
+			if session == nil || session.data.Dialog == nil || ctx.MsgType == request.MSG_TYPE_EVENT {
+				next.ServeMsg(ctx)
+				return
+			}
+
+			state := session.data.Dialog
+			d := dialogMap[state.Name]
+			if d == nil || state.Step < 0 || state.Step >= len(d.Steps) { // 对话已经被删除或者修改了
+				session.data.Dialog = nil
+				next.ServeMsg(ctx)
+				return
+			}
+
+			now := time.Now()
+			if d.Timeout > 0 && now.After(time.Unix(0, state.StepAt).Add(d.Timeout)) {
+				session.data.Dialog = nil
+				if d.OnTimeout != nil {
+					d.OnTimeout(ctx)
+				} else {
+					next.ServeMsg(ctx)
+				}
+				return
+			}
+
+			if text, ok := ctx.Msg.(*request.Text); ok && d.isCancelKeyword(text.Content) {
+				session.data.Dialog = nil
+				d.prompt(ctx, d.CancelPrompt)
+				return
+			}
+
+			step := &d.Steps[state.Step]
+			value, ok := dialogInputValue(ctx.Msg, step.Input)
+			if !ok {
+				if step.InvalidPrompt != "" {
+					d.prompt(ctx, step.InvalidPrompt)
+				} else {
+					d.prompt(ctx, step.Prompt)
+				}
+				return
+			}
+			if step.Validate != nil {
+				if err := step.Validate(value); err != nil {
+					d.prompt(ctx, err.Error())
+					return
+				}
+			}
+
+			if state.Values == nil {
+				state.Values = make(map[string]string)
+			}
+			state.Values[step.Name] = value
+			state.Step++
+			state.StepAt = now.UnixNano()
+
+			if state.Step < len(d.Steps) {
+				d.prompt(ctx, d.Steps[state.Step].Prompt)
+				return
+			}
+			session.data.Dialog = nil // OnComplete 里可以开始新的对话
+			d.OnComplete(ctx, state.Values)
+		})
+	}
+}
+
+// 从消息 msg 中获取 input 类型的输入
+func dialogInputValue(msg interface{}, input string) (value string, ok bool) {
+	switch msg := msg.(type) {
+	case *request.Text:
+		if input == "" || input == request.MSG_TYPE_TEXT {
+			return msg.Content, true
+		}
+	case *request.Image:
+		if input == request.MSG_TYPE_IMAGE {
+			return msg.MediaId, true
+		}
+	case *request.Location:
+		if input == request.MSG_TYPE_LOCATION {
+			return strconv.FormatFloat(msg.LocationX, 'f', -1, 64) + "," +
+				strconv.FormatFloat(msg.LocationY, 'f', -1, 64), true
+		}
+	}
+	return
+}
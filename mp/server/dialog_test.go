@@ -0,0 +1,109 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/wechat/mp/message/passive/request"
+	"github.com/chanxuehong/wechat/mp/message/passive/response"
+	"github.com/chanxuehong/wechat/util"
+)
+
+func TestDialog(t *testing.T) {
+	var agent DefaultAgent
+	agent.Init("gh_0123456789ab", "token", "wx0123456789abcdef", bytes.Repeat([]byte("k"), 32))
+
+	var result map[string]string
+	signup := &Dialog{
+		Name: "signup",
+		Steps: []DialogStep{
+			{Name: "name", Prompt: "name?"},
+			{Name: "phone", Prompt: "phone?", Validate: func(value string) error {
+				if strings.Trim(value, "0123456789") != "" {
+					return errors.New("bad phone")
+				}
+				return nil
+			}},
+			{Name: "photo", Prompt: "photo?", Input: request.MSG_TYPE_IMAGE, InvalidPrompt: "send a photo"},
+		},
+		Timeout:        50 * time.Millisecond,
+		CancelKeywords: []string{"cancel"},
+		CancelPrompt:   "cancelled",
+		OnComplete: func(ctx *Context, values map[string]string) {
+			result = values
+			ctx.Session().Set("name", values["name"])
+			ctx.ReplyText("done")
+		},
+	}
+
+	mux := NewServeMux(&agent)
+	mux.Use(Sessions(util.NewMemorySessionStore(), 0), Dialogs(signup))
+	mux.OnText(func(ctx *Context) {
+		switch content := ctx.Msg.(*request.Text).Content; content {
+		case "signup":
+			signup.Start(ctx)
+		case "logout":
+			ctx.Session().Destroy()
+		default:
+			ctx.ReplyText("hello " + ctx.Session().Get("name"))
+		}
+	})
+
+	serve := func(msg interface{}) string {
+		w := httptest.NewRecorder()
+		switch msg := msg.(type) {
+		case string:
+			text := &request.Text{Content: msg}
+			text.FromUserName, text.MsgType = "openid", request.MSG_TYPE_TEXT
+			mux.ServeTextMsg(w, nil, text, nil, time.Now().Unix())
+		case *request.Image:
+			msg.FromUserName, msg.MsgType = "openid", request.MSG_TYPE_IMAGE
+			mux.ServeImageMsg(w, nil, msg, nil, time.Now().Unix())
+		}
+		if w.Body.Len() == 0 {
+			return ""
+		}
+		var reply response.Text
+		if err := xml.Unmarshal(w.Body.Bytes(), &reply); err != nil {
+			t.Fatal(err)
+		}
+		return reply.Content
+	}
+	expect := func(msg interface{}, want string) {
+		if got := serve(msg); got != want {
+			t.Fatalf("reply to %v = %q, want %q", msg, got, want)
+		}
+	}
+
+	expect("signup", "name?")
+	expect("bob", "phone?")
+	expect("abc", "bad phone")
+	expect("123", "photo?")
+	expect("photo", "send a photo")
+	expect(&request.Image{MediaId: "media"}, "done")
+	if result["name"] != "bob" || result["phone"] != "123" || result["photo"] != "media" {
+		t.Errorf("result = %v", result)
+	}
+	expect("hi", "hello bob")
+
+	expect("signup", "name?")
+	expect(" Cancel ", "cancelled")
+	expect("hi", "hello bob")
+
+	expect("signup", "name?")
+	time.Sleep(60 * time.Millisecond)
+	expect("hi", "hello bob") // 超时后交给后面的 handler
+
+	expect("logout", "")
+	expect("hi", "hello ")
+}
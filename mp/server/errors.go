@@ -0,0 +1,86 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"fmt"
+
+	"github.com/chanxuehong/wechat/util"
+)
+
+// 以下是传给 InvalidRequestHandler 的错误类型, 可以用类型断言区分非法请求的原因;
+// 其他的错误(缺少查询参数, 读取 http body 失败等)没有专门的类型.
+
+// 签名校验失败, 一般是 Token 配置错误或者伪造的请求.
+type SignatureError struct {
+	Name string // 签名的查询参数名, "signature" 或者 "msg_signature"
+	Have string // 请求中的签名
+	Want string // 本地计算的签名, 请求中的签名格式不对的时候为空
+}
+
+func (e *SignatureError) Error() string {
+	if e.Want == "" {
+		return fmt.Sprintf("the length of %s mismatch, have: %d, want: 40", e.Name, len(e.Have))
+	}
+	return fmt.Sprintf("check %s failed, input: %s, local: %s", e.Name, e.Have, e.Want)
+}
+
+// 消息解密失败, 一般是 AESKey 配置错误.
+type DecryptError struct {
+	Err error // base64 解码或者 AES 解密的错误
+}
+
+func (e *DecryptError) Error() string {
+	return "decrypt message failed: " + e.Err.Error()
+}
+
+// 解密消息的错误 err 对应的非法请求错误:
+//  解密后的 AppId 不一致(*util.AppIdMismatchError)为 Field 是 "AppId" 的 *MismatchError, 其他的为 *DecryptError.
+func newDecryptError(err error) error {
+	if e, ok := err.(*util.AppIdMismatchError); ok {
+		return &MismatchError{Field: "AppId", Have: e.Have, Want: e.Want}
+	}
+	return &DecryptError{Err: err}
+}
+
+// 请求中的 ToUserName(公众号原始ID) 或者解密后的 AppId 和 Agent 的配置不一致.
+type MismatchError struct {
+	Field string // 不一致的字段, "ToUserName" 或者 "AppId"
+	Have  string // 请求中的值
+	Want  string // 期望的值
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("the message %s mismatch, have: %s, want: %s", e.Field, e.Have, e.Want)
+}
+
+// 请求 URL 中的时间戳不合法.
+type TimestampError struct {
+	Timestamp string // 请求中的时间戳
+	Err       error  // 解析的错误
+}
+
+func (e *TimestampError) Error() string {
+	return fmt.Sprintf("can not parse timestamp(==%q) to int64, error: %s", e.Timestamp, e.Err.Error())
+}
+
+// 未知的 encrypt_type.
+type EncryptTypeError struct {
+	EncryptType string
+}
+
+func (e *EncryptTypeError) Error() string {
+	return fmt.Sprintf("unknown encrypt_type: %q", e.EncryptType)
+}
+
+// 解析请求的 xml 失败.
+type XMLError struct {
+	Err error
+}
+
+func (e *XMLError) Error() string {
+	return "parse xml failed: " + e.Err.Error()
+}
@@ -0,0 +1,100 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/chanxuehong/wechat/util"
+)
+
+func TestInvalidRequestErrors(t *testing.T) {
+	const id, token, appId = "gh_0123456789ab", "token", "wx0123456789abcdef"
+
+	var agent DefaultAgent
+	agent.Init(id, token, appId, bytes.Repeat([]byte("k"), 32))
+
+	var lastErr error
+	frontend := NewAgentFrontend(&agent, InvalidRequestHandlerFunc(func(w http.ResponseWriter, r *http.Request, err error) {
+		lastErr = err
+		DefaultInvalidRequestHandler.ServeInvalidRequest(w, r, err)
+	}))
+
+	post := func(query url.Values, body string) int {
+		lastErr = nil
+		w := httptest.NewRecorder()
+		frontend.ServeHTTP(w, httptest.NewRequest("POST", "/?"+query.Encode(), bytes.NewBufferString(body)))
+		return w.Code
+	}
+	signed := func(timestamp, nonce string) url.Values {
+		return url.Values{
+			"signature": {util.Sign(token, timestamp, nonce)},
+			"timestamp": {timestamp},
+			"nonce":     {nonce},
+		}
+	}
+
+	if code := post(url.Values{"signature": {"x"}, "timestamp": {"1"}, "nonce": {"1"}}, ""); code != http.StatusForbidden {
+		t.Errorf("bad signature: code = %d", code)
+	}
+	if _, ok := lastErr.(*SignatureError); !ok {
+		t.Errorf("bad signature: err = %#v", lastErr)
+	}
+
+	if code := post(url.Values{"signature": {"x"}, "timestamp": {"abc"}, "nonce": {"1"}}, ""); code != http.StatusBadRequest {
+		t.Errorf("bad timestamp: code = %d", code)
+	}
+	if err, ok := lastErr.(*TimestampError); !ok || err.Timestamp != "abc" {
+		t.Errorf("bad timestamp: err = %#v", lastErr)
+	}
+
+	query := signed("1", "1")
+	query.Set("encrypt_type", "des")
+	post(query, "")
+	if err, ok := lastErr.(*EncryptTypeError); !ok || err.EncryptType != "des" {
+		t.Errorf("unknown encrypt_type: err = %#v", lastErr)
+	}
+
+	if code := post(signed("1", "1"), "<xml>"); code != http.StatusBadRequest {
+		t.Errorf("bad xml: code = %d", code)
+	}
+	if _, ok := lastErr.(*XMLError); !ok {
+		t.Errorf("bad xml: err = %#v", lastErr)
+	}
+
+	if code := post(signed("1", "1"), "<xml><ToUserName>gh_ba9876543210</ToUserName></xml>"); code != http.StatusForbidden {
+		t.Errorf("ToUserName mismatch: code = %d", code)
+	}
+	if err, ok := lastErr.(*MismatchError); !ok || err.Field != "ToUserName" || err.Have != "gh_ba9876543210" || err.Want != id {
+		t.Errorf("ToUserName mismatch: err = %#v", lastErr)
+	}
+
+	query = signed("1", "1")
+	query.Set("encrypt_type", "aes")
+	query.Set("msg_signature", util.MsgSign(token, "1", "1", "AAAA"))
+	if code := post(query, "<xml><ToUserName>"+id+"</ToUserName><Encrypt>AAAA</Encrypt></xml>"); code != http.StatusBadRequest {
+		t.Errorf("decrypt: code = %d", code)
+	}
+	if _, ok := lastErr.(*DecryptError); !ok {
+		t.Errorf("decrypt: err = %#v", lastErr)
+	}
+
+	// AESKey 正确, 但是加密的 AppId 不一致
+	encryptedMsg := base64.StdEncoding.EncodeToString(util.AESEncryptMsg(make([]byte, 16),
+		[]byte("<xml></xml>"), "wxfedcba9876543210", agent.GetCurrentAESKey()))
+	query.Set("msg_signature", util.MsgSign(token, "1", "1", encryptedMsg))
+	if code := post(query, "<xml><ToUserName>"+id+"</ToUserName><Encrypt>"+encryptedMsg+"</Encrypt></xml>"); code != http.StatusForbidden {
+		t.Errorf("AppId mismatch: code = %d", code)
+	}
+	if err, ok := lastErr.(*MismatchError); !ok || err.Field != "AppId" || err.Have != "wxfedcba9876543210" || err.Want != appId {
+		t.Errorf("AppId mismatch: err = %#v", lastErr)
+	}
+}
@@ -0,0 +1,25 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/chanxuehong/wechat/util"
+)
+
+const metricsSource = "mp" // util.MsgStat.Source 和 util.PublishedMsg.Source
+
+// 报告非法请求的统计信息以后交给 InvalidRequestHandler 处理
+type metricsInvalidRequestHandler struct {
+	InvalidRequestHandler
+	metrics util.ServerMetrics
+}
+
+func (h metricsInvalidRequestHandler) ServeInvalidRequest(w http.ResponseWriter, r *http.Request, err error) {
+	h.metrics.ObserveInvalidRequest(metricsSource, InvalidRequestReason(err))
+	h.InvalidRequestHandler.ServeInvalidRequest(w, r, err)
+}
@@ -0,0 +1,72 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/chanxuehong/wechat/mp/simulator"
+	"github.com/chanxuehong/wechat/util"
+)
+
+type testServerMetrics struct {
+	mutex   sync.Mutex
+	msgs    []util.MsgStat
+	invalid []string
+}
+
+func (m *testServerMetrics) ObserveMsg(stat *util.MsgStat) {
+	m.mutex.Lock()
+	m.msgs = append(m.msgs, *stat)
+	m.mutex.Unlock()
+}
+
+func (m *testServerMetrics) ObserveInvalidRequest(source, reason string) {
+	m.mutex.Lock()
+	m.invalid = append(m.invalid, source+":"+reason)
+	m.mutex.Unlock()
+}
+
+func TestFrontendMetrics(t *testing.T) {
+	const id, token, appId = "gh_0123456789ab", "token", "wx0123456789abcdef"
+
+	var agent DefaultAgent
+	agent.Init(id, token, appId, bytes.Repeat([]byte("k"), 32))
+	mux := NewServeMux(&agent)
+	mux.OnText(func(ctx *Context) {
+		ctx.ReplyText("pong")
+	})
+
+	metrics := new(testServerMetrics)
+	frontend := NewAgentFrontend(mux, nil)
+	frontend.EnableMetrics(metrics)
+
+	rawXMLMsg, err := simulator.BuildMsg("text", &simulator.Params{ToUserName: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := func(signature string) {
+		query := url.Values{"signature": {signature}, "timestamp": {"1"}, "nonce": {"1"}}
+		r := httptest.NewRequest("POST", "/?"+query.Encode(), bytes.NewReader(rawXMLMsg))
+		frontend.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	post(util.Sign(token, "1", "1"))
+	post(util.Sign("bad token", "1", "1"))
+
+	if len(metrics.msgs) != 1 {
+		t.Fatalf("msgs = %+v", metrics.msgs)
+	}
+	if stat := metrics.msgs[0]; stat.Source != "mp" || stat.MsgType != "text" || stat.Encrypted || stat.ReplySize == 0 {
+		t.Errorf("stat = %+v", stat)
+	}
+	if len(metrics.invalid) != 1 || metrics.invalid[0] != "mp:signature" {
+		t.Errorf("invalid = %v", metrics.invalid)
+	}
+}
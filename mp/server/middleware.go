@@ -0,0 +1,152 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/chanxuehong/wechat/util"
+)
+
+// 中间件, 包装 next 返回一个新的 Handler, 可以在调用 next 前后做一些通用的处理;
+// 不调用 next 则中断处理, 这时可以用 Context.Reply 直接回复消息.
+type Middleware func(next Handler) Handler
+
+// 用 middlewares 包装 handler, middlewares[0] 在最外层.
+func Chain(handler Handler, middlewares ...Middleware) Handler {
+	if handler == nil {
+		panic("handler == nil")
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// 记录是否已经写入过数据的 http.ResponseWriter
+type trackingResponseWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *trackingResponseWriter) WriteHeader(code int) {
+	w.written = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *trackingResponseWriter) Write(p []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(p)
+}
+
+// 恢复 handler 的 panic, 如果还没有回复消息则回复 "success", 这样微信服务器不会重试, 也不会提示用户
+// "该公众号暂时无法提供服务"; 否则 http 连接被断开, 微信服务器会重试推送.
+//  onPanic 可以为 nil, 这时用 log.Printf 记录 panic 的值和调用栈.
+func Recover(onPanic func(ctx *Context, v interface{}, stack []byte)) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx *Context) {
+			w := &trackingResponseWriter{ResponseWriter: ctx.ResponseWriter}
+			ctx.ResponseWriter = w
+
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+
+				stack := make([]byte, 4<<10)
+				stack = stack[:runtime.Stack(stack, false)]
+				if onPanic != nil {
+					onPanic(ctx, v, stack)
+				} else {
+					log.Printf("wechat: panic serving %s message from %s: %v\n%s", ctx.MsgType, ctx.FromUserName, v, stack)
+				}
+
+				if !w.written {
+					io.WriteString(w.ResponseWriter, "success")
+				}
+			}()
+
+			next.ServeMsg(ctx)
+		})
+	}
+}
+
+// 记录每一个消息(事件)的日志, 格式为 key=value, 包括 request_id, msg_type, event, openid, aes, latency.
+//  logger 可以为 nil, 这时使用 log 包默认的 Logger.
+func Logger(logger *log.Logger) Middleware {
+	logf := log.Printf
+	if logger != nil {
+		logf = logger.Printf
+	}
+
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx *Context) {
+			start := time.Now()
+			next.ServeMsg(ctx)
+			logf("wechat: request_id=%s msg_type=%s event=%s openid=%s aes=%t latency=%s",
+				ctx.RequestId, ctx.MsgType, ctx.Event, ctx.FromUserName, ctx.AESMode, time.Since(start))
+		})
+	}
+}
+
+// 把每一个消息(事件)的类型, 是否加密, 处理时间和回复的字节数报告给 metrics, 报告的内容和 EnableMetrics 一致,
+// 用于只统计 ServeMux 里部分消息的场景; 不要和 AgentFrontend, MultiAgentFrontend 的 EnableMetrics 同时使用, 否则会重复统计.
+//  NOTE: handler panic 的时候不会报告, 如果需要统计请把 Metrics 放在 Recover 的里层.
+func Metrics(metrics util.ServerMetrics) Middleware {
+	if metrics == nil {
+		panic("metrics == nil")
+	}
+
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx *Context) {
+			stat := &util.MsgStat{Source: metricsSource, MsgType: ctx.MsgType, Event: ctx.Event, Encrypted: ctx.AESMode}
+			util.ObserveServe(metrics, stat, ctx.ResponseWriter, func(w http.ResponseWriter) {
+				ctx.ResponseWriter = w
+				next.ServeMsg(ctx)
+			})
+		})
+	}
+}
+
+// 请求 id 的 http header, 请求里有则沿用, 否则随机生成一个; 回复的时候也会带上.
+const RequestIdHeader = "X-Request-Id"
+
+// 设置 Context.RequestId, 请求里有 RequestIdHeader 则使用它, 否则随机生成一个, 并且写入回复的 header.
+//  NOTE: 应该放在 Logger 等需要 RequestId 的中间件的外层.
+func RequestId() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx *Context) {
+			var id string
+			if ctx.Request != nil {
+				id = ctx.Request.Header.Get(RequestIdHeader)
+			}
+			if id == "" {
+				id = newRequestId()
+			}
+			ctx.RequestId = id
+			if ctx.ResponseWriter != nil {
+				ctx.ResponseWriter.Header().Set(RequestIdHeader, id)
+			}
+			next.ServeMsg(ctx)
+		})
+	}
+}
+
+func newRequestId() string {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,195 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"bytes"
+	"encoding/xml"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chanxuehong/wechat/mp/message/passive/request"
+	"github.com/chanxuehong/wechat/mp/message/passive/response"
+	"github.com/chanxuehong/wechat/mp/simulator"
+)
+
+func TestMiddleware(t *testing.T) {
+	var agent DefaultAgent
+	agent.Init("gh_0123456789ab", "token", "appid", make([]byte, 32))
+
+	var logBuf bytes.Buffer
+	metrics := new(testServerMetrics)
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return HandlerFunc(func(ctx *Context) {
+				order = append(order, name)
+				next.ServeMsg(ctx)
+			})
+		}
+	}
+
+	mux := NewServeMux(&agent)
+	mux.Use(
+		RequestId(),
+		Logger(log.New(&logBuf, "", 0)),
+		Recover(func(ctx *Context, v interface{}, stack []byte) {}),
+		Metrics(metrics),
+		trace("a"),
+		trace("b"),
+	)
+	// 拦截黑名单用户, 直接回复
+	mux.Use(func(next Handler) Handler {
+		return HandlerFunc(func(ctx *Context) {
+			if ctx.FromUserName == "blocked" {
+				ctx.ReplyText("blocked")
+				return
+			}
+			next.ServeMsg(ctx)
+		})
+	})
+	mux.OnText(func(ctx *Context) {
+		panic("boom")
+	})
+
+	text := func(from string) *request.Text {
+		return &request.Text{CommonHead: request.CommonHead{FromUserName: from, MsgType: request.MSG_TYPE_TEXT}}
+	}
+
+	// panic 之后回复 success
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set(RequestIdHeader, "req-1")
+	mux.ServeTextMsg(w, r, text("user"), nil, 0)
+	if w.Body.String() != "success" {
+		t.Errorf("panic reply = %q, want success", w.Body.String())
+	}
+	if got := w.Header().Get(RequestIdHeader); got != "req-1" {
+		t.Errorf("request id header = %q", got)
+	}
+	if line := logBuf.String(); !strings.Contains(line, "request_id=req-1 msg_type=text event= openid=user") {
+		t.Errorf("log = %q", line)
+	}
+	if strings.Join(order, ",") != "a,b" {
+		t.Errorf("order = %v", order)
+	}
+
+	// 中间件直接回复, 不调用 handler
+	w = httptest.NewRecorder()
+	mux.ServeTextMsg(w, httptest.NewRequest("POST", "/", nil), text("blocked"), nil, 0)
+	if !strings.Contains(w.Body.String(), "<Content>blocked</Content>") {
+		t.Errorf("short-circuit reply = %q", w.Body.String())
+	}
+	if len(w.Header().Get(RequestIdHeader)) != 32 {
+		t.Errorf("generated request id = %q", w.Header().Get(RequestIdHeader))
+	}
+
+	// 交给被包装的 Agent 的消息也经过中间件
+	event := &request.SubscribeEvent{CommonHead: request.CommonHead{MsgType: request.MSG_TYPE_EVENT}, Event: request.EVENT_TYPE_SUBSCRIBE}
+	mux.ServeSubscribeEvent(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil), event, nil, 0)
+
+	var observed []string
+	for _, stat := range metrics.msgs {
+		observed = append(observed, stat.MsgType+"/"+stat.Event)
+	}
+	want := []string{"text/", "event/subscribe"} // panic 的消息不会报告
+	if strings.Join(observed, ",") != strings.Join(want, ",") {
+		t.Errorf("observed = %v, want %v", observed, want)
+	}
+}
+
+type middlewareTestAgent struct {
+	DefaultAgent
+}
+
+func (this *middlewareTestAgent) ServeAESTextMsg(w http.ResponseWriter, r *http.Request, msg *request.Text, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+	resp := response.NewText(msg.FromUserName, msg.ToUserName, "agent:"+msg.Content, timestamp)
+	WriteAESText(w, resp, timestamp, nonce, AESKey, random, this.GetAppId(), this.GetToken())
+}
+
+func TestFrontendMiddleware(t *testing.T) {
+	const id, token, appId = "gh_0123456789ab", "token", "wx0123456789abcdef"
+	AESKey := bytes.Repeat([]byte("k"), 32)
+
+	var order []string
+	frontendMiddleware := func(next Handler) Handler {
+		return HandlerFunc(func(ctx *Context) {
+			if _, ok := ctx.Msg.(*request.Text); !ok || !ctx.AESMode {
+				t.Errorf("ctx.Msg = %#v, ctx.AESMode = %t", ctx.Msg, ctx.AESMode)
+			}
+			order = append(order, "frontend")
+			ctx.Set("key", "value")
+			if ctx.FromUserName == "blocked" {
+				ctx.ReplyText("blocked")
+				return
+			}
+			next.ServeMsg(ctx)
+		})
+	}
+
+	sim := simulator.NewSimulator("http://localhost/wechat", token, appId, AESKey, simulator.MODE_AES)
+	send := func(frontend http.Handler, from string) string {
+		rawXMLMsg, err := simulator.BuildMsg("text", &simulator.Params{ToUserName: id, FromUserName: from, Content: "ping"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := sim.NewRequest(rawXMLMsg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		frontend.ServeHTTP(w, r)
+		reply, err := sim.DecryptReply(w.Body.Bytes())
+		if err != nil {
+			t.Fatalf("decrypt reply %q: %v", w.Body.String(), err)
+		}
+		var text struct {
+			Content string `xml:"Content"`
+		}
+		xml.Unmarshal(reply, &text)
+		return text.Content
+	}
+
+	// 普通的 Agent 也经过中间件
+	agent := new(middlewareTestAgent)
+	agent.Init(id, token, appId, AESKey)
+	frontend := NewAgentFrontend(agent, nil)
+	frontend.Use(frontendMiddleware)
+
+	if reply := send(frontend, "user"); reply != "agent:ping" {
+		t.Errorf("agent reply = %q", reply)
+	}
+	if reply := send(frontend, "blocked"); reply != "blocked" {
+		t.Errorf("short-circuit reply = %q", reply)
+	}
+
+	// ServeMux 收到的是中间件的 Context
+	mux := NewServeMux(agent)
+	mux.Use(func(next Handler) Handler {
+		return HandlerFunc(func(ctx *Context) {
+			order = append(order, "mux")
+			next.ServeMsg(ctx)
+		})
+	})
+	mux.OnText(func(ctx *Context) {
+		value, _ := ctx.Get("key")
+		ctx.ReplyText(ctx.RequestId + ":" + value.(string))
+	})
+	multiFrontend := new(MultiAgentFrontend)
+	multiFrontend.SetRouteMode(RouteByToUserName)
+	multiFrontend.SetAgent(id, mux)
+	multiFrontend.Use(RequestId(), frontendMiddleware)
+
+	if reply := send(multiFrontend, "user"); !strings.HasSuffix(reply, ":value") || len(reply) != 32+len(":value") {
+		t.Errorf("mux reply = %q", reply)
+	}
+	if want := "frontend,frontend,frontend,mux"; strings.Join(order, ",") != want {
+		t.Errorf("order = %v, want %s", order, want)
+	}
+}
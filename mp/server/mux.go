@@ -0,0 +1,460 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/chanxuehong/wechat/mp/message/passive/request"
+	"github.com/chanxuehong/wechat/mp/message/passive/response"
+	"github.com/chanxuehong/wechat/util"
+)
+
+// 一次消息(事件)推送的上下文, 传递给 Handler.
+type Context struct {
+	ResponseWriter http.ResponseWriter
+	Request        *http.Request // Body 已经读取过了, 不要再读取了, 但是可以获取其他信息, 比如 Request.URL.RawQuery
+
+	request.CommonHead        // 消息的公共部分, ToUserName, FromUserName, CreateTime, MsgType
+	Event              string // 事件类型, 只有 MsgType == request.MSG_TYPE_EVENT 时才有
+
+	// 成功解析的消息结构体, 根据 MsgType 和 Event 的不同分别是 *request.Text, *request.SubscribeEvent 等,
+	// 和 Agent 对应方法的参数一致; 未知类型的消息为 nil.
+	//  NOTE: Event == request.EVENT_TYPE_SUBSCRIBE 的时候可能是 *request.SubscribeEvent,
+	//  也可能是扫描带参数二维码关注的 *request.SubscribeByScanEvent.
+	Msg interface{}
+
+	RawXMLMsg []byte // "明文" xml 消息体
+	Timestamp int64  // 请求 URL 中的时间戳
+
+	// 下面的字段只有兼容模式, 安全模式才有, 明文模式下 AESMode == false, 其他字段都是零值
+	AESMode bool
+	Nonce   string
+	AESKey  [32]byte
+	Random  []byte
+
+	// 解密消息所用的 key 的序号, 0 表示当前的 key; 使用 AESKeyRing 的时候是 AESKeyRing.Keys 中的序号,
+	// 否则 1 表示 GetLastAESKey 返回的 key.
+	AESKeyIndex int
+
+	RequestId string // 请求的唯一标识, 由 RequestId 中间件设置
+
+	appId  string
+	token  string
+	values map[string]interface{}
+
+	async   *asyncState // 由 Async 中间件设置
+	session *Session    // 由 Sessions 中间件设置
+}
+
+// 获取 FromUserName 的会话, 没有使用 Sessions 中间件则返回 nil.
+func (ctx *Context) Session() *Session {
+	return ctx.session
+}
+
+// 保存 key 对应的值 value, 用于在中间件和 handler 之间传递数据.
+//  NOTE: 不是并发安全的.
+func (ctx *Context) Set(key string, value interface{}) {
+	if ctx.values == nil {
+		ctx.values = make(map[string]interface{})
+	}
+	ctx.values[key] = value
+}
+
+// 获取 Context.Set 保存的值, 没有找到返回 nil, false.
+func (ctx *Context) Get(key string) (value interface{}, ok bool) {
+	value, ok = ctx.values[key]
+	return
+}
+
+// 回复消息 msg, 明文模式下直接写入 xml, 兼容模式, 安全模式下自动加密.
+//  msg 是 *response.Text, *response.News 等回复消息的结构体.
+//  NOTE: 每次推送只能回复一次; 使用了 Async 中间件并且已经超时的话, 通过客服消息接口发送.
+func (ctx *Context) Reply(msg interface{}) (err error) {
+	if msg == nil {
+		return errors.New("msg == nil")
+	}
+	if news, ok := msg.(*response.News); ok {
+		if err = news.CheckValid(); err != nil {
+			return
+		}
+	}
+
+	if ctx.async != nil {
+		return ctx.async.reply(ctx, msg)
+	}
+	return ctx.writeReply(ctx.ResponseWriter, msg)
+}
+
+func (ctx *Context) writeReply(w io.Writer, msg interface{}) error {
+	if ctx.AESMode {
+		return writeAESResponse(w, msg, ctx.Timestamp, ctx.Nonce, ctx.AESKey, ctx.Random, ctx.appId, ctx.token)
+	}
+	return writeResponse(w, msg)
+}
+
+// 回复文本消息 content 给发送方, 同 Context.Reply.
+func (ctx *Context) ReplyText(content string) error {
+	return ctx.Reply(response.NewText(ctx.FromUserName, ctx.ToUserName, content, time.Now().Unix()))
+}
+
+type Handler interface {
+	// 消息(事件)的处理方法
+	ServeMsg(ctx *Context)
+}
+
+type HandlerFunc func(ctx *Context)
+
+func (fn HandlerFunc) ServeMsg(ctx *Context) {
+	fn(ctx)
+}
+
+// 消息(事件)分路器, 按照 MsgType 和 Event 把消息分发给注册的 Handler, 可以替代实现整个 Agent 接口.
+// ServeMux 实现了 Agent 接口, 可以直接传给 NewAgentFrontend 等.
+//
+//  mux := server.NewServeMux(&agent) // agent 提供 Id, Token, AppId, AESKey
+//  mux.OnText(func(ctx *server.Context) {
+//      ctx.ReplyText(ctx.Msg.(*request.Text).Content)
+//  })
+//  mux.OnEvent(request.EVENT_TYPE_SUBSCRIBE, func(ctx *server.Context) {
+//      ctx.ReplyText("欢迎关注")
+//  })
+//  http.Handle("/wechat", server.NewAgentFrontend(mux, nil))
+//
+//  NOTE:
+//  1. 所有的注册都要在开始处理消息之前完成, ServeMux 注册的方法不是并发安全的;
+//  2. 事件先查找 Event 对应的 handler, 再查找 MsgType 为 request.MSG_TYPE_EVENT 的 handler;
+//  3. 找不到对应的 handler 时调用 fallback, 没有设置 fallback 则调用被包装的 Agent 的对应方法,
+//     所以已有的 Agent 可以逐步迁移到 ServeMux.
+type ServeMux struct {
+	Agent
+
+	msgHandlers   map[string]Handler // map[MsgType]Handler
+	eventHandlers map[string]Handler // map[Event]Handler
+	fallback      Handler
+
+	middlewares []Middleware
+	handler     Handler // 用 middlewares 包装后的 dispatch
+}
+
+// 创建一个新的 ServeMux, agent 不能为 nil.
+//  agent 提供公众号的 Id, Token, AppId 和 AESKey, 也是找不到 handler 时默认的处理者;
+//  如果只需要 ServeMux 处理消息, 可以传入初始化好的 *DefaultAgent.
+func NewServeMux(agent Agent) *ServeMux {
+	if agent == nil {
+		panic("agent == nil")
+	}
+
+	mux := &ServeMux{
+		Agent:         agent,
+		msgHandlers:   make(map[string]Handler),
+		eventHandlers: make(map[string]Handler),
+	}
+	mux.handler = HandlerFunc(mux.dispatch)
+	return mux
+}
+
+// 实现 AESKeyRingAgent, 返回 agent 的 AESKeyRing, agent 没有实现 AESKeyRingAgent 则返回 nil.
+func (mux *ServeMux) GetAESKeyRing() *util.AESKeyRing {
+	return getAESKeyRing(mux.Agent)
+}
+
+// 注册消息类型为 msgType 的处理方法, msgType 是 request.MSG_TYPE_TEXT 等;
+// msgType == request.MSG_TYPE_EVENT 则处理所有没有单独注册的事件.
+//  NOTE: 可以注册 request 包里没有定义的消息类型, 这时 Context.Msg == nil, 需要自己解析 Context.RawXMLMsg.
+func (mux *ServeMux) Handle(msgType string, handler Handler) {
+	if msgType == "" {
+		panic(`msgType == ""`)
+	}
+	if handler == nil {
+		panic("handler == nil")
+	}
+	if _, ok := mux.msgHandlers[msgType]; ok {
+		panic(fmt.Sprintf("重复注册: %q", msgType))
+	}
+	mux.msgHandlers[msgType] = handler
+}
+
+// 同 ServeMux.Handle.
+func (mux *ServeMux) HandleFunc(msgType string, handler func(*Context)) {
+	if handler == nil {
+		panic("handler == nil")
+	}
+	mux.Handle(msgType, HandlerFunc(handler))
+}
+
+// 注册事件类型为 event 的处理方法, event 是 request.EVENT_TYPE_SUBSCRIBE 等.
+//  NOTE: 可以注册 request 包里没有定义的事件类型, 这时 Context.Msg == nil, 需要自己解析 Context.RawXMLMsg.
+func (mux *ServeMux) HandleEvent(event string, handler Handler) {
+	if event == "" {
+		panic(`event == ""`)
+	}
+	if handler == nil {
+		panic("handler == nil")
+	}
+	if _, ok := mux.eventHandlers[event]; ok {
+		panic(fmt.Sprintf("重复注册: event %q", event))
+	}
+	mux.eventHandlers[event] = handler
+}
+
+// 同 ServeMux.HandleEvent.
+func (mux *ServeMux) OnEvent(event string, handler func(*Context)) {
+	if handler == nil {
+		panic("handler == nil")
+	}
+	mux.HandleEvent(event, HandlerFunc(handler))
+}
+
+// 同 ServeMux.HandleFunc(request.MSG_TYPE_TEXT, handler).
+func (mux *ServeMux) OnText(handler func(*Context)) {
+	mux.HandleFunc(request.MSG_TYPE_TEXT, handler)
+}
+
+// 同 ServeMux.HandleFunc(request.MSG_TYPE_IMAGE, handler).
+func (mux *ServeMux) OnImage(handler func(*Context)) {
+	mux.HandleFunc(request.MSG_TYPE_IMAGE, handler)
+}
+
+// 同 ServeMux.HandleFunc(request.MSG_TYPE_VOICE, handler).
+func (mux *ServeMux) OnVoice(handler func(*Context)) {
+	mux.HandleFunc(request.MSG_TYPE_VOICE, handler)
+}
+
+// 同 ServeMux.HandleFunc(request.MSG_TYPE_VIDEO, handler).
+func (mux *ServeMux) OnVideo(handler func(*Context)) {
+	mux.HandleFunc(request.MSG_TYPE_VIDEO, handler)
+}
+
+// 同 ServeMux.HandleFunc(request.MSG_TYPE_LOCATION, handler).
+func (mux *ServeMux) OnLocation(handler func(*Context)) {
+	mux.HandleFunc(request.MSG_TYPE_LOCATION, handler)
+}
+
+// 同 ServeMux.HandleFunc(request.MSG_TYPE_LINK, handler).
+func (mux *ServeMux) OnLink(handler func(*Context)) {
+	mux.HandleFunc(request.MSG_TYPE_LINK, handler)
+}
+
+// 设置找不到对应 handler 时的处理方法, handler == nil 表示调用被包装的 Agent 的对应方法.
+func (mux *ServeMux) SetFallback(handler Handler) {
+	mux.fallback = handler
+}
+
+// 查找 msgType, event 对应的 handler, 没有找到返回 nil, 不包括 fallback.
+func (mux *ServeMux) Lookup(msgType, event string) Handler {
+	if msgType == request.MSG_TYPE_EVENT {
+		if handler := mux.eventHandlers[event]; handler != nil {
+			return handler
+		}
+	}
+	return mux.msgHandlers[msgType]
+}
+
+// 添加中间件, 先添加的在外层, 所有的消息(包括交给 fallback 和被包装的 Agent 的消息)都会经过中间件.
+//  NOTE: 和注册 handler 一样, 要在开始处理消息之前完成.
+func (mux *ServeMux) Use(middlewares ...Middleware) {
+	for _, middleware := range middlewares {
+		if middleware == nil {
+			panic("middleware == nil")
+		}
+	}
+	mux.middlewares = append(mux.middlewares, middlewares...)
+	mux.handler = Chain(HandlerFunc(mux.dispatch), mux.middlewares...)
+}
+
+// 经过中间件后分发消息, 找不到 handler 使用 fallback, 都没有则交给被包装的 Agent.
+func (mux *ServeMux) ServeMsg(ctx *Context) {
+	mux.handler.ServeMsg(ctx)
+}
+
+func (mux *ServeMux) dispatch(ctx *Context) {
+	handler := mux.Lookup(ctx.MsgType, ctx.Event)
+	if handler == nil {
+		if handler = mux.fallback; handler == nil {
+			handler = AgentHandler(mux.Agent)
+		}
+	}
+	handler.ServeMsg(ctx)
+}
+
+func (mux *ServeMux) newRawContext(w http.ResponseWriter, r *http.Request, head request.CommonHead, event string,
+	msg interface{}, rawXMLMsg []byte, timestamp int64) *Context {
+
+	return &Context{
+		ResponseWriter: w,
+		Request:        r,
+		CommonHead:     head,
+		Event:          event,
+		Msg:            msg,
+		RawXMLMsg:      rawXMLMsg,
+		Timestamp:      timestamp,
+		appId:          mux.GetAppId(),
+		token:          mux.GetToken(),
+	}
+}
+
+func (mux *ServeMux) newAESContext(w http.ResponseWriter, r *http.Request, head request.CommonHead, event string,
+	msg interface{}, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) *Context {
+
+	ctx := mux.newRawContext(w, r, head, event, msg, rawXMLMsg, timestamp)
+	ctx.AESMode = true
+	ctx.Nonce = nonce
+	ctx.AESKey = AESKey
+	ctx.Random = random
+	ctx.AESKeyIndex = aesKeyIndex(mux.Agent, AESKey)
+	return ctx
+}
+
+// 未知类型的消息只解析公共部分和 Event, 用于查找 handler.
+func parseUnknownMsgHead(rawXMLMsg []byte) (head request.CommonHead, event string) {
+	var msg struct {
+		request.CommonHead
+		Event string `xml:"Event"`
+	}
+	xml.Unmarshal(rawXMLMsg, &msg)
+	return msg.CommonHead, msg.Event
+}
+
+// 把 Agent 适配成 Handler, 根据 Context.Msg 的类型调用 agent 对应的方法, 未知类型的消息调用 ServeUnknownMsg;
+// agent 是 *ServeMux 的时候直接把 Context 交给它.
+//  已有的 Agent 实现可以通过 AgentHandler 注册到 ServeMux, 比如:
+//  mux.Handle(request.MSG_TYPE_VOICE, server.AgentHandler(&oldAgent))
+func AgentHandler(agent Agent) Handler {
+	if agent == nil {
+		panic("agent == nil")
+	}
+	return agentHandler{agent}
+}
+
+type agentHandler struct {
+	agent Agent
+}
+
+func (h agentHandler) ServeMsg(ctx *Context) {
+	if mux, ok := h.agent.(*ServeMux); ok { // 直接交给 ServeMux, 保留 Context 里中间件设置的值等信息
+		mux.ServeMsg(ctx)
+		return
+	}
+
+	if ctx.AESMode {
+		h.serveAESMsg(ctx)
+	} else {
+		h.serveRawMsg(ctx)
+	}
+}
+
+func (h agentHandler) serveRawMsg(ctx *Context) {
+	agent, w, r, rawXMLMsg, timestamp := h.agent, ctx.ResponseWriter, ctx.Request, ctx.RawXMLMsg, ctx.Timestamp
+
+	switch msg := ctx.Msg.(type) {
+	case *request.Text:
+		agent.ServeTextMsg(w, r, msg, rawXMLMsg, timestamp)
+	case *request.Image:
+		agent.ServeImageMsg(w, r, msg, rawXMLMsg, timestamp)
+	case *request.Voice:
+		agent.ServeVoiceMsg(w, r, msg, rawXMLMsg, timestamp)
+	case *request.Video:
+		agent.ServeVideoMsg(w, r, msg, rawXMLMsg, timestamp)
+	case *request.Location:
+		agent.ServeLocationMsg(w, r, msg, rawXMLMsg, timestamp)
+	case *request.Link:
+		agent.ServeLinkMsg(w, r, msg, rawXMLMsg, timestamp)
+	case *request.SubscribeEvent:
+		agent.ServeSubscribeEvent(w, r, msg, rawXMLMsg, timestamp)
+	case *request.UnsubscribeEvent:
+		agent.ServeUnsubscribeEvent(w, r, msg, rawXMLMsg, timestamp)
+	case *request.SubscribeByScanEvent:
+		agent.ServeSubscribeByScanEvent(w, r, msg, rawXMLMsg, timestamp)
+	case *request.ScanEvent:
+		agent.ServeScanEvent(w, r, msg, rawXMLMsg, timestamp)
+	case *request.LocationEvent:
+		agent.ServeLocationEvent(w, r, msg, rawXMLMsg, timestamp)
+	case *request.MenuClickEvent:
+		agent.ServeMenuClickEvent(w, r, msg, rawXMLMsg, timestamp)
+	case *request.MenuViewEvent:
+		agent.ServeMenuViewEvent(w, r, msg, rawXMLMsg, timestamp)
+	case *request.MenuScanCodePushEvent:
+		agent.ServeMenuScanCodePushEvent(w, r, msg, rawXMLMsg, timestamp)
+	case *request.MenuScanCodeWaitMsgEvent:
+		agent.ServeMenuScanCodeWaitMsgEvent(w, r, msg, rawXMLMsg, timestamp)
+	case *request.MenuPicSysPhotoEvent:
+		agent.ServeMenuPicSysPhotoEvent(w, r, msg, rawXMLMsg, timestamp)
+	case *request.MenuPicPhotoOrAlbumEvent:
+		agent.ServeMenuPicPhotoOrAlbumEvent(w, r, msg, rawXMLMsg, timestamp)
+	case *request.MenuPicWeixinEvent:
+		agent.ServeMenuPicWeixinEvent(w, r, msg, rawXMLMsg, timestamp)
+	case *request.MenuLocationSelectEvent:
+		agent.ServeMenuLocationSelectEvent(w, r, msg, rawXMLMsg, timestamp)
+	case *request.MassSendJobFinishEvent:
+		agent.ServeMassSendJobFinishEvent(w, r, msg, rawXMLMsg, timestamp)
+	case *request.TemplateSendJobFinishEvent:
+		agent.ServeTemplateSendJobFinishEvent(w, r, msg, rawXMLMsg, timestamp)
+	case *request.MerchantOrderEvent:
+		agent.ServeMerchantOrderEvent(w, r, msg, rawXMLMsg, timestamp)
+	default:
+		agent.ServeUnknownMsg(w, r, rawXMLMsg, timestamp)
+	}
+}
+
+func (h agentHandler) serveAESMsg(ctx *Context) {
+	agent, w, r, rawXMLMsg, timestamp := h.agent, ctx.ResponseWriter, ctx.Request, ctx.RawXMLMsg, ctx.Timestamp
+	nonce, AESKey, random := ctx.Nonce, ctx.AESKey, ctx.Random
+
+	switch msg := ctx.Msg.(type) {
+	case *request.Text:
+		agent.ServeAESTextMsg(w, r, msg, rawXMLMsg, timestamp, nonce, AESKey, random)
+	case *request.Image:
+		agent.ServeAESImageMsg(w, r, msg, rawXMLMsg, timestamp, nonce, AESKey, random)
+	case *request.Voice:
+		agent.ServeAESVoiceMsg(w, r, msg, rawXMLMsg, timestamp, nonce, AESKey, random)
+	case *request.Video:
+		agent.ServeAESVideoMsg(w, r, msg, rawXMLMsg, timestamp, nonce, AESKey, random)
+	case *request.Location:
+		agent.ServeAESLocationMsg(w, r, msg, rawXMLMsg, timestamp, nonce, AESKey, random)
+	case *request.Link:
+		agent.ServeAESLinkMsg(w, r, msg, rawXMLMsg, timestamp, nonce, AESKey, random)
+	case *request.SubscribeEvent:
+		agent.ServeAESSubscribeEvent(w, r, msg, rawXMLMsg, timestamp, nonce, AESKey, random)
+	case *request.UnsubscribeEvent:
+		agent.ServeAESUnsubscribeEvent(w, r, msg, rawXMLMsg, timestamp, nonce, AESKey, random)
+	case *request.SubscribeByScanEvent:
+		agent.ServeAESSubscribeByScanEvent(w, r, msg, rawXMLMsg, timestamp, nonce, AESKey, random)
+	case *request.ScanEvent:
+		agent.ServeAESScanEvent(w, r, msg, rawXMLMsg, timestamp, nonce, AESKey, random)
+	case *request.LocationEvent:
+		agent.ServeAESLocationEvent(w, r, msg, rawXMLMsg, timestamp, nonce, AESKey, random)
+	case *request.MenuClickEvent:
+		agent.ServeAESMenuClickEvent(w, r, msg, rawXMLMsg, timestamp, nonce, AESKey, random)
+	case *request.MenuViewEvent:
+		agent.ServeAESMenuViewEvent(w, r, msg, rawXMLMsg, timestamp, nonce, AESKey, random)
+	case *request.MenuScanCodePushEvent:
+		agent.ServeAESMenuScanCodePushEvent(w, r, msg, rawXMLMsg, timestamp, nonce, AESKey, random)
+	case *request.MenuScanCodeWaitMsgEvent:
+		agent.ServeAESMenuScanCodeWaitMsgEvent(w, r, msg, rawXMLMsg, timestamp, nonce, AESKey, random)
+	case *request.MenuPicSysPhotoEvent:
+		agent.ServeAESMenuPicSysPhotoEvent(w, r, msg, rawXMLMsg, timestamp, nonce, AESKey, random)
+	case *request.MenuPicPhotoOrAlbumEvent:
+		agent.ServeAESMenuPicPhotoOrAlbumEvent(w, r, msg, rawXMLMsg, timestamp, nonce, AESKey, random)
+	case *request.MenuPicWeixinEvent:
+		agent.ServeAESMenuPicWeixinEvent(w, r, msg, rawXMLMsg, timestamp, nonce, AESKey, random)
+	case *request.MenuLocationSelectEvent:
+		agent.ServeAESMenuLocationSelectEvent(w, r, msg, rawXMLMsg, timestamp, nonce, AESKey, random)
+	case *request.MassSendJobFinishEvent:
+		agent.ServeAESMassSendJobFinishEvent(w, r, msg, rawXMLMsg, timestamp, nonce, AESKey, random)
+	case *request.TemplateSendJobFinishEvent:
+		agent.ServeAESTemplateSendJobFinishEvent(w, r, msg, rawXMLMsg, timestamp, nonce, AESKey, random)
+	case *request.MerchantOrderEvent:
+		agent.ServeAESMerchantOrderEvent(w, r, msg, rawXMLMsg, timestamp, nonce, AESKey, random)
+	default:
+		agent.ServeAESUnknownMsg(w, r, rawXMLMsg, timestamp, nonce, AESKey, random)
+	}
+}
@@ -0,0 +1,206 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/chanxuehong/wechat/mp/message/passive/request"
+)
+
+// ServeMux 的 Agent 方法都是把参数包装成 Context 然后调用 ServeMux.ServeMsg
+
+var _ Agent = new(ServeMux)
+
+// 明文模式 ======================================================================================================================================================================
+
+func (mux *ServeMux) ServeUnknownMsg(w http.ResponseWriter, r *http.Request, rawXMLMsg []byte, timestamp int64) {
+	head, event := parseUnknownMsgHead(rawXMLMsg)
+	mux.ServeMsg(mux.newRawContext(w, r, head, event, nil, rawXMLMsg, timestamp))
+}
+
+func (mux *ServeMux) ServeTextMsg(w http.ResponseWriter, r *http.Request, msg *request.Text, rawXMLMsg []byte, timestamp int64) {
+	mux.ServeMsg(mux.newRawContext(w, r, msg.CommonHead, "", msg, rawXMLMsg, timestamp))
+}
+
+func (mux *ServeMux) ServeImageMsg(w http.ResponseWriter, r *http.Request, msg *request.Image, rawXMLMsg []byte, timestamp int64) {
+	mux.ServeMsg(mux.newRawContext(w, r, msg.CommonHead, "", msg, rawXMLMsg, timestamp))
+}
+
+func (mux *ServeMux) ServeVoiceMsg(w http.ResponseWriter, r *http.Request, msg *request.Voice, rawXMLMsg []byte, timestamp int64) {
+	mux.ServeMsg(mux.newRawContext(w, r, msg.CommonHead, "", msg, rawXMLMsg, timestamp))
+}
+
+func (mux *ServeMux) ServeVideoMsg(w http.ResponseWriter, r *http.Request, msg *request.Video, rawXMLMsg []byte, timestamp int64) {
+	mux.ServeMsg(mux.newRawContext(w, r, msg.CommonHead, "", msg, rawXMLMsg, timestamp))
+}
+
+func (mux *ServeMux) ServeLocationMsg(w http.ResponseWriter, r *http.Request, msg *request.Location, rawXMLMsg []byte, timestamp int64) {
+	mux.ServeMsg(mux.newRawContext(w, r, msg.CommonHead, "", msg, rawXMLMsg, timestamp))
+}
+
+func (mux *ServeMux) ServeLinkMsg(w http.ResponseWriter, r *http.Request, msg *request.Link, rawXMLMsg []byte, timestamp int64) {
+	mux.ServeMsg(mux.newRawContext(w, r, msg.CommonHead, "", msg, rawXMLMsg, timestamp))
+}
+
+func (mux *ServeMux) ServeSubscribeEvent(w http.ResponseWriter, r *http.Request, event *request.SubscribeEvent, rawXMLMsg []byte, timestamp int64) {
+	mux.ServeMsg(mux.newRawContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp))
+}
+
+func (mux *ServeMux) ServeUnsubscribeEvent(w http.ResponseWriter, r *http.Request, event *request.UnsubscribeEvent, rawXMLMsg []byte, timestamp int64) {
+	mux.ServeMsg(mux.newRawContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp))
+}
+
+func (mux *ServeMux) ServeSubscribeByScanEvent(w http.ResponseWriter, r *http.Request, event *request.SubscribeByScanEvent, rawXMLMsg []byte, timestamp int64) {
+	mux.ServeMsg(mux.newRawContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp))
+}
+
+func (mux *ServeMux) ServeScanEvent(w http.ResponseWriter, r *http.Request, event *request.ScanEvent, rawXMLMsg []byte, timestamp int64) {
+	mux.ServeMsg(mux.newRawContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp))
+}
+
+func (mux *ServeMux) ServeLocationEvent(w http.ResponseWriter, r *http.Request, event *request.LocationEvent, rawXMLMsg []byte, timestamp int64) {
+	mux.ServeMsg(mux.newRawContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp))
+}
+
+func (mux *ServeMux) ServeMenuClickEvent(w http.ResponseWriter, r *http.Request, event *request.MenuClickEvent, rawXMLMsg []byte, timestamp int64) {
+	mux.ServeMsg(mux.newRawContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp))
+}
+
+func (mux *ServeMux) ServeMenuViewEvent(w http.ResponseWriter, r *http.Request, event *request.MenuViewEvent, rawXMLMsg []byte, timestamp int64) {
+	mux.ServeMsg(mux.newRawContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp))
+}
+
+func (mux *ServeMux) ServeMenuScanCodePushEvent(w http.ResponseWriter, r *http.Request, event *request.MenuScanCodePushEvent, rawXMLMsg []byte, timestamp int64) {
+	mux.ServeMsg(mux.newRawContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp))
+}
+
+func (mux *ServeMux) ServeMenuScanCodeWaitMsgEvent(w http.ResponseWriter, r *http.Request, event *request.MenuScanCodeWaitMsgEvent, rawXMLMsg []byte, timestamp int64) {
+	mux.ServeMsg(mux.newRawContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp))
+}
+
+func (mux *ServeMux) ServeMenuPicSysPhotoEvent(w http.ResponseWriter, r *http.Request, event *request.MenuPicSysPhotoEvent, rawXMLMsg []byte, timestamp int64) {
+	mux.ServeMsg(mux.newRawContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp))
+}
+
+func (mux *ServeMux) ServeMenuPicPhotoOrAlbumEvent(w http.ResponseWriter, r *http.Request, event *request.MenuPicPhotoOrAlbumEvent, rawXMLMsg []byte, timestamp int64) {
+	mux.ServeMsg(mux.newRawContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp))
+}
+
+func (mux *ServeMux) ServeMenuPicWeixinEvent(w http.ResponseWriter, r *http.Request, event *request.MenuPicWeixinEvent, rawXMLMsg []byte, timestamp int64) {
+	mux.ServeMsg(mux.newRawContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp))
+}
+
+func (mux *ServeMux) ServeMenuLocationSelectEvent(w http.ResponseWriter, r *http.Request, event *request.MenuLocationSelectEvent, rawXMLMsg []byte, timestamp int64) {
+	mux.ServeMsg(mux.newRawContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp))
+}
+
+func (mux *ServeMux) ServeMassSendJobFinishEvent(w http.ResponseWriter, r *http.Request, event *request.MassSendJobFinishEvent, rawXMLMsg []byte, timestamp int64) {
+	mux.ServeMsg(mux.newRawContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp))
+}
+
+func (mux *ServeMux) ServeTemplateSendJobFinishEvent(w http.ResponseWriter, r *http.Request, event *request.TemplateSendJobFinishEvent, rawXMLMsg []byte, timestamp int64) {
+	mux.ServeMsg(mux.newRawContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp))
+}
+
+func (mux *ServeMux) ServeMerchantOrderEvent(w http.ResponseWriter, r *http.Request, event *request.MerchantOrderEvent, rawXMLMsg []byte, timestamp int64) {
+	mux.ServeMsg(mux.newRawContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp))
+}
+
+// 兼容模式, 安全模式 ======================================================================================================================================================================
+
+func (mux *ServeMux) ServeAESUnknownMsg(w http.ResponseWriter, r *http.Request, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+	head, event := parseUnknownMsgHead(rawXMLMsg)
+	mux.ServeMsg(mux.newAESContext(w, r, head, event, nil, rawXMLMsg, timestamp, nonce, AESKey, random))
+}
+
+func (mux *ServeMux) ServeAESTextMsg(w http.ResponseWriter, r *http.Request, msg *request.Text, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+	mux.ServeMsg(mux.newAESContext(w, r, msg.CommonHead, "", msg, rawXMLMsg, timestamp, nonce, AESKey, random))
+}
+
+func (mux *ServeMux) ServeAESImageMsg(w http.ResponseWriter, r *http.Request, msg *request.Image, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+	mux.ServeMsg(mux.newAESContext(w, r, msg.CommonHead, "", msg, rawXMLMsg, timestamp, nonce, AESKey, random))
+}
+
+func (mux *ServeMux) ServeAESVoiceMsg(w http.ResponseWriter, r *http.Request, msg *request.Voice, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+	mux.ServeMsg(mux.newAESContext(w, r, msg.CommonHead, "", msg, rawXMLMsg, timestamp, nonce, AESKey, random))
+}
+
+func (mux *ServeMux) ServeAESVideoMsg(w http.ResponseWriter, r *http.Request, msg *request.Video, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+	mux.ServeMsg(mux.newAESContext(w, r, msg.CommonHead, "", msg, rawXMLMsg, timestamp, nonce, AESKey, random))
+}
+
+func (mux *ServeMux) ServeAESLocationMsg(w http.ResponseWriter, r *http.Request, msg *request.Location, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+	mux.ServeMsg(mux.newAESContext(w, r, msg.CommonHead, "", msg, rawXMLMsg, timestamp, nonce, AESKey, random))
+}
+
+func (mux *ServeMux) ServeAESLinkMsg(w http.ResponseWriter, r *http.Request, msg *request.Link, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+	mux.ServeMsg(mux.newAESContext(w, r, msg.CommonHead, "", msg, rawXMLMsg, timestamp, nonce, AESKey, random))
+}
+
+func (mux *ServeMux) ServeAESSubscribeEvent(w http.ResponseWriter, r *http.Request, event *request.SubscribeEvent, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+	mux.ServeMsg(mux.newAESContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp, nonce, AESKey, random))
+}
+
+func (mux *ServeMux) ServeAESUnsubscribeEvent(w http.ResponseWriter, r *http.Request, event *request.UnsubscribeEvent, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+	mux.ServeMsg(mux.newAESContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp, nonce, AESKey, random))
+}
+
+func (mux *ServeMux) ServeAESSubscribeByScanEvent(w http.ResponseWriter, r *http.Request, event *request.SubscribeByScanEvent, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+	mux.ServeMsg(mux.newAESContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp, nonce, AESKey, random))
+}
+
+func (mux *ServeMux) ServeAESScanEvent(w http.ResponseWriter, r *http.Request, event *request.ScanEvent, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+	mux.ServeMsg(mux.newAESContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp, nonce, AESKey, random))
+}
+
+func (mux *ServeMux) ServeAESLocationEvent(w http.ResponseWriter, r *http.Request, event *request.LocationEvent, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+	mux.ServeMsg(mux.newAESContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp, nonce, AESKey, random))
+}
+
+func (mux *ServeMux) ServeAESMenuClickEvent(w http.ResponseWriter, r *http.Request, event *request.MenuClickEvent, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+	mux.ServeMsg(mux.newAESContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp, nonce, AESKey, random))
+}
+
+func (mux *ServeMux) ServeAESMenuViewEvent(w http.ResponseWriter, r *http.Request, event *request.MenuViewEvent, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+	mux.ServeMsg(mux.newAESContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp, nonce, AESKey, random))
+}
+
+func (mux *ServeMux) ServeAESMenuScanCodePushEvent(w http.ResponseWriter, r *http.Request, event *request.MenuScanCodePushEvent, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+	mux.ServeMsg(mux.newAESContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp, nonce, AESKey, random))
+}
+
+func (mux *ServeMux) ServeAESMenuScanCodeWaitMsgEvent(w http.ResponseWriter, r *http.Request, event *request.MenuScanCodeWaitMsgEvent, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+	mux.ServeMsg(mux.newAESContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp, nonce, AESKey, random))
+}
+
+func (mux *ServeMux) ServeAESMenuPicSysPhotoEvent(w http.ResponseWriter, r *http.Request, event *request.MenuPicSysPhotoEvent, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+	mux.ServeMsg(mux.newAESContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp, nonce, AESKey, random))
+}
+
+func (mux *ServeMux) ServeAESMenuPicPhotoOrAlbumEvent(w http.ResponseWriter, r *http.Request, event *request.MenuPicPhotoOrAlbumEvent, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+	mux.ServeMsg(mux.newAESContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp, nonce, AESKey, random))
+}
+
+func (mux *ServeMux) ServeAESMenuPicWeixinEvent(w http.ResponseWriter, r *http.Request, event *request.MenuPicWeixinEvent, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+	mux.ServeMsg(mux.newAESContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp, nonce, AESKey, random))
+}
+
+func (mux *ServeMux) ServeAESMenuLocationSelectEvent(w http.ResponseWriter, r *http.Request, event *request.MenuLocationSelectEvent, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+	mux.ServeMsg(mux.newAESContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp, nonce, AESKey, random))
+}
+
+func (mux *ServeMux) ServeAESMassSendJobFinishEvent(w http.ResponseWriter, r *http.Request, event *request.MassSendJobFinishEvent, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+	mux.ServeMsg(mux.newAESContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp, nonce, AESKey, random))
+}
+
+func (mux *ServeMux) ServeAESTemplateSendJobFinishEvent(w http.ResponseWriter, r *http.Request, event *request.TemplateSendJobFinishEvent, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+	mux.ServeMsg(mux.newAESContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp, nonce, AESKey, random))
+}
+
+func (mux *ServeMux) ServeAESMerchantOrderEvent(w http.ResponseWriter, r *http.Request, event *request.MerchantOrderEvent, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+	mux.ServeMsg(mux.newAESContext(w, r, event.CommonHead, event.Event, event, rawXMLMsg, timestamp, nonce, AESKey, random))
+}
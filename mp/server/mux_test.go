@@ -0,0 +1,134 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chanxuehong/wechat/mp/message/passive/request"
+	"github.com/chanxuehong/wechat/mp/message/passive/response"
+	"github.com/chanxuehong/wechat/mp/simulator"
+)
+
+type muxTestAgent struct {
+	DefaultAgent
+	voices int
+}
+
+func (this *muxTestAgent) ServeVoiceMsg(w http.ResponseWriter, r *http.Request, msg *request.Voice, rawXMLMsg []byte, timestamp int64) {
+	this.voices++
+}
+
+func (this *muxTestAgent) ServeAESVoiceMsg(w http.ResponseWriter, r *http.Request, msg *request.Voice, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+	this.voices++
+}
+
+func TestServeMux(t *testing.T) {
+	const id, token, appId = "gh_0123456789ab", "token", "wx0123456789abcdef"
+	AESKey := bytes.Repeat([]byte("k"), 32)
+
+	var agent muxTestAgent
+	agent.Init(id, token, appId, AESKey)
+
+	mux := NewServeMux(&agent)
+	mux.OnText(func(ctx *Context) {
+		ctx.ReplyText("echo: " + ctx.Msg.(*request.Text).Content)
+	})
+	mux.OnEvent(request.EVENT_TYPE_SUBSCRIBE, func(ctx *Context) {
+		ctx.Reply(response.NewText(ctx.FromUserName, ctx.ToUserName, "welcome", ctx.Timestamp))
+	})
+	var events []string
+	mux.HandleFunc(request.MSG_TYPE_EVENT, func(ctx *Context) {
+		events = append(events, ctx.Event)
+	})
+	// 未知的事件类型也可以注册
+	mux.OnEvent("kf_create_session", func(ctx *Context) {
+		if ctx.Msg != nil || ctx.FromUserName != "oUser" {
+			t.Errorf("unknown event: Msg %v, FromUserName %q", ctx.Msg, ctx.FromUserName)
+		}
+		ctx.ReplyText("kf")
+	})
+
+	srv := httptest.NewServer(NewAgentFrontend(mux, nil))
+	defer srv.Close()
+
+	for _, mode := range []string{simulator.MODE_RAW, simulator.MODE_AES} {
+		s := simulator.NewSimulator(srv.URL, token, appId, AESKey, mode)
+		send := func(kind string, params *simulator.Params) *simulator.Reply {
+			if params == nil {
+				params = new(simulator.Params)
+			}
+			params.ToUserName = id
+			reply, err := s.Send(kind, params)
+			if err != nil {
+				t.Fatalf("%s %s: %v", mode, kind, err)
+			}
+			return reply
+		}
+		replyContent := func(reply *simulator.Reply) string {
+			var text response.Text
+			if err := xml.Unmarshal(reply.RawXMLMsg, &text); err != nil {
+				t.Fatalf("%s: %v, reply: %s", mode, err, reply.Body)
+			}
+			return text.Content
+		}
+
+		if got := replyContent(send("text", &simulator.Params{Content: "hi"})); got != "echo: hi" {
+			t.Errorf("%s text reply = %q", mode, got)
+		}
+		if got := replyContent(send("event.subscribe", nil)); got != "welcome" {
+			t.Errorf("%s subscribe reply = %q", mode, got)
+		}
+		if got := replyContent(send("event.subscribe_scan", nil)); got != "welcome" {
+			t.Errorf("%s subscribe_scan reply = %q", mode, got)
+		}
+		if reply := send("event.CLICK", nil); reply.RawXMLMsg != nil {
+			t.Errorf("%s CLICK reply = %s", mode, reply.Body)
+		}
+		send("voice", nil) // 交给被包装的 Agent
+
+		rawXMLMsg := []byte("<xml><ToUserName><![CDATA[" + id + "]]></ToUserName><FromUserName><![CDATA[oUser]]></FromUserName>" +
+			"<CreateTime>1399197672</CreateTime><MsgType><![CDATA[event]]></MsgType><Event><![CDATA[kf_create_session]]></Event></xml>")
+		reply, err := s.Post(rawXMLMsg)
+		if err != nil {
+			t.Fatalf("%s kf_create_session: %v", mode, err)
+		}
+		if got := replyContent(reply); got != "kf" {
+			t.Errorf("%s kf_create_session reply = %q", mode, got)
+		}
+	}
+
+	if len(events) != 2 || events[0] != request.EVENT_TYPE_CLICK || events[1] != request.EVENT_TYPE_CLICK {
+		t.Errorf("events = %v", events)
+	}
+	if agent.voices != 2 {
+		t.Errorf("agent.voices = %d, want 2", agent.voices)
+	}
+}
+
+func TestServeMuxFallback(t *testing.T) {
+	mux := NewServeMux(new(DefaultAgent))
+	var got string
+	mux.SetFallback(HandlerFunc(func(ctx *Context) {
+		got = ctx.MsgType
+	}))
+	mux.ServeImageMsg(nil, nil, &request.Image{CommonHead: request.CommonHead{MsgType: request.MSG_TYPE_IMAGE}}, nil, 0)
+	if got != request.MSG_TYPE_IMAGE {
+		t.Errorf("fallback got %q", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("duplicate registration did not panic")
+		}
+	}()
+	mux.OnText(func(*Context) {})
+	mux.OnText(func(*Context) {})
+}
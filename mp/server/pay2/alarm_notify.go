@@ -9,19 +9,20 @@ import (
 	"bytes"
 	"crypto/subtle"
 	"errors"
-	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 
 	"github.com/chanxuehong/wechat/mp/pay"
 	"github.com/chanxuehong/wechat/mp/pay/pay2"
+	"github.com/chanxuehong/wechat/util"
 )
 
 // 微信后台向商户推送告警通知的 Handler
 type AlarmNotifyHandler struct {
 	agent                 Agent
 	invalidRequestHandler InvalidRequestHandler
+	metrics               util.ServerMetrics
 }
 
 // 创建一个新的 AlarmNotifyHandler.
@@ -44,8 +45,17 @@ func NewAlarmNotifyHandler(agent Agent, invalidRequestHandler InvalidRequestHand
 func (handler *AlarmNotifyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	agent := handler.agent
 	invalidRequestHandler := handler.invalidRequestHandler
+	if handler.metrics != nil {
+		invalidRequestHandler = metricsInvalidRequestHandler{invalidRequestHandler, handler.metrics}
+	}
+
+	serveAlarmNotifyHTTP(w, r, nil, agent, invalidRequestHandler, handler.metrics)
+}
 
-	ServeAlarmNotifyHTTP(w, r, nil, agent, invalidRequestHandler)
+// 开启统计, 把每一个通知的处理时间, 回复的字节数和非法请求的原因报告给 metrics. metrics 为 nil 则关闭统计.
+//  NOTE: 要在开始处理请求之前调用, 不是并发安全的.
+func (handler *AlarmNotifyHandler) EnableMetrics(metrics util.ServerMetrics) {
+	handler.metrics = metrics
 }
 
 // ServeAlarmNotifyHTTP 处理 http 消息请求
@@ -53,6 +63,13 @@ func (handler *AlarmNotifyHandler) ServeHTTP(w http.ResponseWriter, r *http.Requ
 func ServeAlarmNotifyHTTP(w http.ResponseWriter, r *http.Request,
 	urlValues url.Values, agent Agent, invalidRequestHandler InvalidRequestHandler) {
 
+	serveAlarmNotifyHTTP(w, r, urlValues, agent, invalidRequestHandler, nil)
+}
+
+// 同 ServeAlarmNotifyHTTP, metrics != nil 的时候报告统计信息
+func serveAlarmNotifyHTTP(w http.ResponseWriter, r *http.Request, urlValues url.Values, agent Agent,
+	invalidRequestHandler InvalidRequestHandler, metrics util.ServerMetrics) {
+
 	if r.Method != "POST" {
 		err := errors.New("request method is not POST")
 		invalidRequestHandler.ServeInvalidRequest(w, r, err)
@@ -67,27 +84,30 @@ func ServeAlarmNotifyHTTP(w http.ResponseWriter, r *http.Request,
 
 	alarmData := make(pay2.AlarmNotifyPostData)
 	if err := pay.ParseXMLToMap(bytes.NewReader(postRawXMLMsg), alarmData); err != nil {
-		invalidRequestHandler.ServeInvalidRequest(w, r, err)
+		invalidRequestHandler.ServeInvalidRequest(w, r, &XMLError{Err: err})
 		return
 	}
 
 	haveAppId := alarmData.AppId()
 	wantAppId := agent.GetAppId()
 	if len(haveAppId) != len(wantAppId) {
-		err = fmt.Errorf("AppId mismatch, have: %q, want: %q", haveAppId, wantAppId)
+		err = &MismatchError{Field: "AppId", Have: haveAppId, Want: wantAppId}
 		invalidRequestHandler.ServeInvalidRequest(w, r, err)
 		return
 	}
 	if subtle.ConstantTimeCompare([]byte(haveAppId), []byte(wantAppId)) != 1 {
-		err = fmt.Errorf("AppId mismatch, have: %q, want: %q", haveAppId, wantAppId)
+		err = &MismatchError{Field: "AppId", Have: haveAppId, Want: wantAppId}
 		invalidRequestHandler.ServeInvalidRequest(w, r, err)
 		return
 	}
 
 	if err := alarmData.CheckSignature(agent.GetAppKey()); err != nil {
-		invalidRequestHandler.ServeInvalidRequest(w, r, err)
+		invalidRequestHandler.ServeInvalidRequest(w, r, &SignatureError{Err: err})
 		return
 	}
 
-	agent.ServeAlarmNotification(w, r, alarmData, postRawXMLMsg)
+	stat := &util.MsgStat{Source: metricsSource, MsgType: "alarm_notify"}
+	util.ObserveServe(metrics, stat, w, func(w http.ResponseWriter) {
+		agent.ServeAlarmNotification(w, r, alarmData, postRawXMLMsg)
+	})
 }
@@ -0,0 +1,42 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package pay2
+
+import (
+	"fmt"
+)
+
+// 以下是传给 InvalidRequestHandler 的错误类型, 可以用类型断言区分非法请求的原因;
+// 其他的错误(请求方法不是 POST, 读取 http body 失败等)没有专门的类型.
+
+// 签名校验失败, 一般是密钥配置错误或者伪造的请求.
+type SignatureError struct {
+	Err error // 签名校验函数返回的错误
+}
+
+func (e *SignatureError) Error() string {
+	return "check signature failed: " + e.Err.Error()
+}
+
+// 请求中的 AppId 等和 Agent 的配置不一致.
+type MismatchError struct {
+	Field string // 不一致的字段, "AppId" 或者 "PartnerId"
+	Have  string // 请求中的值
+	Want  string // 期望的值
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("%s mismatch, have: %q, want: %q", e.Field, e.Have, e.Want)
+}
+
+// 解析请求的 xml 失败.
+type XMLError struct {
+	Err error
+}
+
+func (e *XMLError) Error() string {
+	return "parse xml failed: " + e.Err.Error()
+}
@@ -9,7 +9,6 @@ import (
 	"crypto/subtle"
 	"encoding/xml"
 	"errors"
-	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -66,25 +65,25 @@ func ServeFeedbackHTTP(w http.ResponseWriter, r *http.Request,
 
 	var mixedReq feedback.MixedRequest
 	if err := xml.Unmarshal(postRawXMLMsg, &mixedReq); err != nil {
-		invalidRequestHandler.ServeInvalidRequest(w, r, err)
+		invalidRequestHandler.ServeInvalidRequest(w, r, &XMLError{Err: err})
 		return
 	}
 
 	haveAppId := mixedReq.AppId
 	wantAppId := agent.GetAppId()
 	if len(haveAppId) != len(wantAppId) {
-		err = fmt.Errorf("AppId mismatch, have: %q, want: %q", haveAppId, wantAppId)
+		err = &MismatchError{Field: "AppId", Have: haveAppId, Want: wantAppId}
 		invalidRequestHandler.ServeInvalidRequest(w, r, err)
 		return
 	}
 	if subtle.ConstantTimeCompare([]byte(haveAppId), []byte(wantAppId)) != 1 {
-		err = fmt.Errorf("AppId mismatch, have: %q, want: %q", haveAppId, wantAppId)
+		err = &MismatchError{Field: "AppId", Have: haveAppId, Want: wantAppId}
 		invalidRequestHandler.ServeInvalidRequest(w, r, err)
 		return
 	}
 
 	if err := mixedReq.CheckSignature(agent.GetAppKey()); err != nil {
-		invalidRequestHandler.ServeInvalidRequest(w, r, err)
+		invalidRequestHandler.ServeInvalidRequest(w, r, &SignatureError{Err: err})
 		return
 	}
 
@@ -20,4 +20,34 @@ func (fn InvalidRequestHandlerFunc) ServeInvalidRequest(w http.ResponseWriter, r
 	fn(w, r, err)
 }
 
-var DefaultInvalidRequestHandler InvalidRequestHandler = InvalidRequestHandlerFunc(func(w http.ResponseWriter, r *http.Request, err error) {})
+// 默认的 InvalidRequestHandler, 根据 InvalidRequestStatusCode(err) 回复 http 状态码.
+var DefaultInvalidRequestHandler InvalidRequestHandler = InvalidRequestHandlerFunc(func(w http.ResponseWriter, r *http.Request, err error) {
+	code := InvalidRequestStatusCode(err)
+	http.Error(w, http.StatusText(code), code)
+})
+
+// 非法请求的错误 err 对应的 http 状态码:
+//  *SignatureError, *MismatchError 为 403, *XMLError 和其他错误为 400.
+func InvalidRequestStatusCode(err error) int {
+	switch err.(type) {
+	case *SignatureError, *MismatchError:
+		return http.StatusForbidden
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// 非法请求的错误 err 对应的原因, 用于统计:
+//  *SignatureError 为 "signature", *MismatchError 为 "mismatch", *XMLError 为 "xml", 其他错误为 "other".
+func InvalidRequestReason(err error) string {
+	switch err.(type) {
+	case *SignatureError:
+		return "signature"
+	case *MismatchError:
+		return "mismatch"
+	case *XMLError:
+		return "xml"
+	default:
+		return "other"
+	}
+}
@@ -9,19 +9,20 @@ import (
 	"bytes"
 	"crypto/subtle"
 	"errors"
-	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 
 	"github.com/chanxuehong/wechat/mp/pay"
 	"github.com/chanxuehong/wechat/mp/pay/pay2"
+	"github.com/chanxuehong/wechat/util"
 )
 
 // 用户在成功完成支付后，微信后台通知（POST）商户服务器（notify_url）支付结果的处理 Handler
 type OrderNotifyHandler struct {
 	agent                 Agent
 	invalidRequestHandler InvalidRequestHandler
+	metrics               util.ServerMetrics
 }
 
 // 创建一个新的 OrderNotifyHandler.
@@ -44,6 +45,9 @@ func NewOrderNotifyHandler(agent Agent, invalidRequestHandler InvalidRequestHand
 func (handler *OrderNotifyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	agent := handler.agent
 	invalidRequestHandler := handler.invalidRequestHandler
+	if handler.metrics != nil {
+		invalidRequestHandler = metricsInvalidRequestHandler{invalidRequestHandler, handler.metrics}
+	}
 
 	if r.URL == nil {
 		err := errors.New("input net/http.Request.URL == nil")
@@ -57,7 +61,13 @@ func (handler *OrderNotifyHandler) ServeHTTP(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	ServeOrderNotifyHTTP(w, r, urlValues, agent, invalidRequestHandler)
+	serveOrderNotifyHTTP(w, r, urlValues, agent, invalidRequestHandler, handler.metrics)
+}
+
+// 开启统计, 把每一个通知的处理时间, 回复的字节数和非法请求的原因报告给 metrics. metrics 为 nil 则关闭统计.
+//  NOTE: 要在开始处理请求之前调用, 不是并发安全的.
+func (handler *OrderNotifyHandler) EnableMetrics(metrics util.ServerMetrics) {
+	handler.metrics = metrics
 }
 
 // ServeOrderNotifyHTTP 处理 http 消息请求
@@ -65,6 +75,13 @@ func (handler *OrderNotifyHandler) ServeHTTP(w http.ResponseWriter, r *http.Requ
 func ServeOrderNotifyHTTP(w http.ResponseWriter, r *http.Request,
 	urlValues url.Values, agent Agent, invalidRequestHandler InvalidRequestHandler) {
 
+	serveOrderNotifyHTTP(w, r, urlValues, agent, invalidRequestHandler, nil)
+}
+
+// 同 ServeOrderNotifyHTTP, metrics != nil 的时候报告统计信息
+func serveOrderNotifyHTTP(w http.ResponseWriter, r *http.Request, urlValues url.Values, agent Agent,
+	invalidRequestHandler InvalidRequestHandler, metrics util.ServerMetrics) {
+
 	if r.Method != "POST" {
 		err := errors.New("request method is not POST")
 		invalidRequestHandler.ServeInvalidRequest(w, r, err)
@@ -80,25 +97,25 @@ func ServeOrderNotifyHTTP(w http.ResponseWriter, r *http.Request,
 
 	postData := make(pay2.OrderNotifyPostData)
 	if err = pay.ParseXMLToMap(bytes.NewReader(postRawXMLMsg), postData); err != nil {
-		invalidRequestHandler.ServeInvalidRequest(w, r, err)
+		invalidRequestHandler.ServeInvalidRequest(w, r, &XMLError{Err: err})
 		return
 	}
 
 	haveAppId := postData.AppId()
 	wantAppId := agent.GetAppId()
 	if len(haveAppId) != len(wantAppId) {
-		err := fmt.Errorf("AppId mismatch, have: %q, want: %q", haveAppId, wantAppId)
+		err := &MismatchError{Field: "AppId", Have: haveAppId, Want: wantAppId}
 		invalidRequestHandler.ServeInvalidRequest(w, r, err)
 		return
 	}
 	if subtle.ConstantTimeCompare([]byte(haveAppId), []byte(wantAppId)) != 1 {
-		err := fmt.Errorf("AppId mismatch, have: %q, want: %q", haveAppId, wantAppId)
+		err := &MismatchError{Field: "AppId", Have: haveAppId, Want: wantAppId}
 		invalidRequestHandler.ServeInvalidRequest(w, r, err)
 		return
 	}
 
 	if err := postData.CheckSignature(agent.GetAppKey()); err != nil {
-		invalidRequestHandler.ServeInvalidRequest(w, r, err)
+		invalidRequestHandler.ServeInvalidRequest(w, r, &SignatureError{Err: err})
 		return
 	}
 
@@ -108,20 +125,23 @@ func ServeOrderNotifyHTTP(w http.ResponseWriter, r *http.Request,
 	havePartnerId := urlData.PartnerId()
 	wantPartnerId := agent.GetPartnerId()
 	if len(havePartnerId) != len(wantPartnerId) {
-		err := fmt.Errorf("PartnerId mismatch, have: %q, want: %q", havePartnerId, wantPartnerId)
+		err := &MismatchError{Field: "PartnerId", Have: havePartnerId, Want: wantPartnerId}
 		invalidRequestHandler.ServeInvalidRequest(w, r, err)
 		return
 	}
 	if subtle.ConstantTimeCompare([]byte(havePartnerId), []byte(wantPartnerId)) != 1 {
-		err := fmt.Errorf("PartnerId mismatch, have: %q, want: %q", havePartnerId, wantPartnerId)
+		err := &MismatchError{Field: "PartnerId", Have: havePartnerId, Want: wantPartnerId}
 		invalidRequestHandler.ServeInvalidRequest(w, r, err)
 		return
 	}
 
 	if err := urlData.CheckSignature(agent.GetPartnerKey()); err != nil {
-		invalidRequestHandler.ServeInvalidRequest(w, r, err)
+		invalidRequestHandler.ServeInvalidRequest(w, r, &SignatureError{Err: err})
 		return
 	}
 
-	agent.ServeOrderNotification(w, r, urlData, postData, postRawXMLMsg)
+	stat := &util.MsgStat{Source: metricsSource, MsgType: "order_notify"}
+	util.ObserveServe(metrics, stat, w, func(w http.ResponseWriter) {
+		agent.ServeOrderNotification(w, r, urlData, postData, postRawXMLMsg)
+	})
 }
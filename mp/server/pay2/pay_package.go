@@ -9,7 +9,6 @@ import (
 	"bytes"
 	"crypto/subtle"
 	"errors"
-	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -67,25 +66,25 @@ func ServePayPackageRequestHTTP(w http.ResponseWriter, r *http.Request,
 
 	req := make(pay2.PayPackageRequest)
 	if err = pay.ParseXMLToMap(bytes.NewReader(postRawXMLMsg), req); err != nil {
-		invalidRequestHandler.ServeInvalidRequest(w, r, err)
+		invalidRequestHandler.ServeInvalidRequest(w, r, &XMLError{Err: err})
 		return
 	}
 
 	haveAppId := req.AppId()
 	wantAppId := agent.GetAppId()
 	if len(haveAppId) != len(wantAppId) {
-		err = fmt.Errorf("AppId mismatch, have: %q, want: %q", haveAppId, wantAppId)
+		err = &MismatchError{Field: "AppId", Have: haveAppId, Want: wantAppId}
 		invalidRequestHandler.ServeInvalidRequest(w, r, err)
 		return
 	}
 	if subtle.ConstantTimeCompare([]byte(haveAppId), []byte(wantAppId)) != 1 {
-		err = fmt.Errorf("AppId mismatch, have: %q, want: %q", haveAppId, wantAppId)
+		err = &MismatchError{Field: "AppId", Have: haveAppId, Want: wantAppId}
 		invalidRequestHandler.ServeInvalidRequest(w, r, err)
 		return
 	}
 
 	if err := req.CheckSignature(agent.GetAppKey()); err != nil {
-		invalidRequestHandler.ServeInvalidRequest(w, r, err)
+		invalidRequestHandler.ServeInvalidRequest(w, r, &SignatureError{Err: err})
 		return
 	}
 
@@ -9,19 +9,21 @@ import (
 	"bytes"
 	"crypto/subtle"
 	"errors"
-	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 
 	"github.com/chanxuehong/wechat/mp/pay"
 	"github.com/chanxuehong/wechat/mp/pay/pay3"
+	"github.com/chanxuehong/wechat/util"
 )
 
 // 用户在成功完成支付后，微信后台通知（POST）商户服务器（notify_url）支付结果的处理 Handler
 type OrderNotifyHandler struct {
 	agent                 Agent
 	invalidRequestHandler InvalidRequestHandler
+	replayGuard           *util.ReplayGuard
+	metrics               util.ServerMetrics
 }
 
 // 创建一个新的 OrderNotifyHandler.
@@ -44,8 +46,29 @@ func NewOrderNotifyHandler(agent Agent, invalidRequestHandler InvalidRequestHand
 func (handler *OrderNotifyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	agent := handler.agent
 	invalidRequestHandler := handler.invalidRequestHandler
+	if handler.metrics != nil {
+		invalidRequestHandler = metricsInvalidRequestHandler{invalidRequestHandler, handler.metrics}
+	}
+
+	serveOrderNotifyHTTP(w, r, nil, agent, invalidRequestHandler, handler.replayGuard, handler.metrics)
+}
 
-	ServeOrderNotifyHTTP(w, r, nil, agent, invalidRequestHandler)
+// 开启重放攻击防护, 拒绝 nonce_str 已经使用过的请求, 交给 InvalidRequestHandler 处理, 这时的 err 是 *util.ReplayError.
+//  guard 为 nil 则使用 util.NewReplayGuard(util.DefaultReplayWindow, nil);
+//  Agent 的回复的 return_code 不是 SUCCESS 的时候会撤销 nonce_str, 这样微信支付的重试不会被拒绝,
+//  自定义的 guard 的 nonceStore 要实现 util.RemovableDedupStore, 否则重试的请求也会被拒绝;
+//  NOTE: 请求没有时间戳, 只能在 guard 的时间范围内记住 nonce_str; 要在开始处理请求之前调用, 不是并发安全的.
+func (handler *OrderNotifyHandler) EnableReplayGuard(guard *util.ReplayGuard) {
+	if guard == nil {
+		guard = util.NewReplayGuard(util.DefaultReplayWindow, nil)
+	}
+	handler.replayGuard = guard
+}
+
+// 开启统计, 把每一个通知的处理时间, 回复的字节数和非法请求的原因报告给 metrics. metrics 为 nil 则关闭统计.
+//  NOTE: 要在开始处理请求之前调用, 不是并发安全的.
+func (handler *OrderNotifyHandler) EnableMetrics(metrics util.ServerMetrics) {
+	handler.metrics = metrics
 }
 
 // ServeOrderNotifyHTTP 处理 http 消息请求
@@ -53,6 +76,13 @@ func (handler *OrderNotifyHandler) ServeHTTP(w http.ResponseWriter, r *http.Requ
 func ServeOrderNotifyHTTP(w http.ResponseWriter, r *http.Request,
 	urlValues url.Values, agent Agent, invalidRequestHandler InvalidRequestHandler) {
 
+	serveOrderNotifyHTTP(w, r, urlValues, agent, invalidRequestHandler, nil, nil)
+}
+
+// 同 ServeOrderNotifyHTTP, replayGuard != nil 的时候拒绝重放的请求, metrics != nil 的时候报告统计信息
+func serveOrderNotifyHTTP(w http.ResponseWriter, r *http.Request, urlValues url.Values, agent Agent,
+	invalidRequestHandler InvalidRequestHandler, replayGuard *util.ReplayGuard, metrics util.ServerMetrics) {
+
 	if r.Method != "POST" {
 		err := errors.New("request method is not POST")
 		invalidRequestHandler.ServeInvalidRequest(w, r, err)
@@ -67,19 +97,19 @@ func ServeOrderNotifyHTTP(w http.ResponseWriter, r *http.Request,
 
 	data := make(map[string]string)
 	if err = pay.ParseXMLToMap(bytes.NewReader(postRawXMLMsg), data); err != nil {
-		invalidRequestHandler.ServeInvalidRequest(w, r, err)
+		invalidRequestHandler.ServeInvalidRequest(w, r, &XMLError{Err: err})
 		return
 	}
 
 	haveAppId := data["appid"]
 	wantAppId := agent.GetAppId()
 	if len(haveAppId) != len(wantAppId) {
-		err = fmt.Errorf("AppId mismatch, have: %q, want: %q", haveAppId, wantAppId)
+		err = &MismatchError{Field: "AppId", Have: haveAppId, Want: wantAppId}
 		invalidRequestHandler.ServeInvalidRequest(w, r, err)
 		return
 	}
 	if subtle.ConstantTimeCompare([]byte(haveAppId), []byte(wantAppId)) != 1 {
-		err = fmt.Errorf("AppId mismatch, have: %q, want: %q", haveAppId, wantAppId)
+		err = &MismatchError{Field: "AppId", Have: haveAppId, Want: wantAppId}
 		invalidRequestHandler.ServeInvalidRequest(w, r, err)
 		return
 	}
@@ -87,20 +117,32 @@ func ServeOrderNotifyHTTP(w http.ResponseWriter, r *http.Request,
 	haveMchId := data["mch_id"]
 	wantMchId := agent.GetMchId()
 	if len(haveMchId) != len(wantMchId) {
-		err = fmt.Errorf("MchId mismatch, have: %q, want: %q", haveMchId, wantMchId)
+		err = &MismatchError{Field: "MchId", Have: haveMchId, Want: wantMchId}
 		invalidRequestHandler.ServeInvalidRequest(w, r, err)
 		return
 	}
 	if subtle.ConstantTimeCompare([]byte(haveMchId), []byte(wantMchId)) != 1 {
-		err = fmt.Errorf("MchId mismatch, have: %q, want: %q", haveMchId, wantMchId)
+		err = &MismatchError{Field: "MchId", Have: haveMchId, Want: wantMchId}
 		invalidRequestHandler.ServeInvalidRequest(w, r, err)
 		return
 	}
 
 	if err := pay3.CheckMD5Signature(data, agent.GetAppKey()); err != nil {
-		invalidRequestHandler.ServeInvalidRequest(w, r, err)
+		invalidRequestHandler.ServeInvalidRequest(w, r, &SignatureError{Err: err})
 		return
 	}
 
-	agent.ServeOrderNotification(w, r, data, postRawXMLMsg)
+	if replayGuard != nil {
+		if err = replayGuard.CheckNonce(data["nonce_str"]); err != nil {
+			invalidRequestHandler.ServeInvalidRequest(w, r, err)
+			return
+		}
+	}
+
+	stat := &util.MsgStat{Source: metricsSource, MsgType: "order_notify"}
+	util.ObserveServe(metrics, stat, w, func(w http.ResponseWriter) {
+		serveWithNonce(w, replayGuard, data["nonce_str"], func(w http.ResponseWriter) {
+			agent.ServeOrderNotification(w, r, data, postRawXMLMsg)
+		})
+	})
 }
@@ -0,0 +1,85 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package pay3
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chanxuehong/wechat/mp/pay/pay3"
+)
+
+type orderNotifyTestAgent struct {
+	DefaultAgent
+	returnCodes []string // 依次回复的 return_code
+	calls       int
+}
+
+func (this *orderNotifyTestAgent) ServeOrderNotification(w http.ResponseWriter, r *http.Request, data map[string]string, postRawXMLMsg []byte) {
+	returnCode := this.returnCodes[this.calls]
+	this.calls++
+	if returnCode == "panic" {
+		panic(returnCode)
+	}
+	fmt.Fprintf(w, "<xml><return_code>%s</return_code></xml>", returnCode)
+}
+
+func TestOrderNotifyRetry(t *testing.T) {
+	agent := &orderNotifyTestAgent{
+		DefaultAgent: DefaultAgent{AppId: "wx0123456789abcdef", MchId: "1900000109", AppKey: "key"},
+		returnCodes:  []string{pay3.RET_CODE_FAIL, "panic", pay3.RET_CODE_SUCCESS},
+	}
+	handler := NewOrderNotifyHandler(agent, nil)
+	handler.EnableReplayGuard(nil)
+
+	data := map[string]string{
+		"appid":     agent.AppId,
+		"mch_id":    agent.MchId,
+		"nonce_str": "5K8264ILTKCH16CQ2502SI8ZNMTM67VS",
+		"result":    "SUCCESS",
+	}
+	pay3.SetMD5Signature(data, agent.AppKey)
+	var body bytes.Buffer
+	body.WriteString("<xml>")
+	for k, v := range data {
+		fmt.Fprintf(&body, "<%s>%s</%s>", k, v, k)
+	}
+	body.WriteString("</xml>")
+
+	notify := func() int {
+		r, err := http.NewRequest("POST", "/notify", bytes.NewReader(body.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		func() {
+			defer func() { recover() }()
+			handler.ServeHTTP(w, r)
+		}()
+		return w.Code
+	}
+
+	// 回复 FAIL 和 panic 的时候微信支付会重试, 不能当作重放
+	for i := 0; i < 3; i++ {
+		if code := notify(); code != http.StatusOK {
+			t.Fatalf("notify #%d: status = %d, want %d", i+1, code, http.StatusOK)
+		}
+	}
+	if agent.calls != 3 {
+		t.Fatalf("agent.calls = %d, want 3", agent.calls)
+	}
+
+	// 处理成功以后同一个 nonce_str 是重放
+	if code := notify(); code != http.StatusForbidden {
+		t.Errorf("replay: status = %d, want %d", code, http.StatusForbidden)
+	}
+	if agent.calls != 3 {
+		t.Errorf("agent.calls = %d, want 3", agent.calls)
+	}
+}
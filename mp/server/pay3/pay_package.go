@@ -9,19 +9,20 @@ import (
 	"bytes"
 	"crypto/subtle"
 	"errors"
-	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 
 	"github.com/chanxuehong/wechat/mp/pay"
 	"github.com/chanxuehong/wechat/mp/pay/pay3"
+	"github.com/chanxuehong/wechat/util"
 )
 
 // native api 请求订单详情的 Handler
 type PayPackageRequestHandler struct {
 	agent                 Agent
 	invalidRequestHandler InvalidRequestHandler
+	replayGuard           *util.ReplayGuard
 }
 
 // 创建一个新的 PayPackageRequestHandler.
@@ -45,7 +46,19 @@ func (handler *PayPackageRequestHandler) ServeHTTP(w http.ResponseWriter, r *htt
 	agent := handler.agent
 	invalidRequestHandler := handler.invalidRequestHandler
 
-	ServePayPackageRequestHTTP(w, r, nil, agent, invalidRequestHandler)
+	servePayPackageRequestHTTP(w, r, nil, agent, invalidRequestHandler, handler.replayGuard)
+}
+
+// 开启重放攻击防护, 拒绝 nonce_str 已经使用过的请求, 交给 InvalidRequestHandler 处理, 这时的 err 是 *util.ReplayError.
+//  guard 为 nil 则使用 util.NewReplayGuard(util.DefaultReplayWindow, nil);
+//  Agent 的回复的 return_code 不是 SUCCESS 的时候会撤销 nonce_str, 这样微信支付的重试不会被拒绝,
+//  自定义的 guard 的 nonceStore 要实现 util.RemovableDedupStore, 否则重试的请求也会被拒绝;
+//  NOTE: 请求没有时间戳, 只能在 guard 的时间范围内记住 nonce_str; 要在开始处理请求之前调用, 不是并发安全的.
+func (handler *PayPackageRequestHandler) EnableReplayGuard(guard *util.ReplayGuard) {
+	if guard == nil {
+		guard = util.NewReplayGuard(util.DefaultReplayWindow, nil)
+	}
+	handler.replayGuard = guard
 }
 
 // ServePayPackageRequestHTTP 处理 http 消息请求
@@ -53,6 +66,13 @@ func (handler *PayPackageRequestHandler) ServeHTTP(w http.ResponseWriter, r *htt
 func ServePayPackageRequestHTTP(w http.ResponseWriter, r *http.Request,
 	urlValues url.Values, agent Agent, invalidRequestHandler InvalidRequestHandler) {
 
+	servePayPackageRequestHTTP(w, r, urlValues, agent, invalidRequestHandler, nil)
+}
+
+// 同 ServePayPackageRequestHTTP, replayGuard != nil 的时候拒绝重放的请求
+func servePayPackageRequestHTTP(w http.ResponseWriter, r *http.Request, urlValues url.Values, agent Agent,
+	invalidRequestHandler InvalidRequestHandler, replayGuard *util.ReplayGuard) {
+
 	if r.Method != "POST" {
 		err := errors.New("request method is not POST")
 		invalidRequestHandler.ServeInvalidRequest(w, r, err)
@@ -67,19 +87,19 @@ func ServePayPackageRequestHTTP(w http.ResponseWriter, r *http.Request,
 
 	req := make(map[string]string)
 	if err = pay.ParseXMLToMap(bytes.NewReader(postRawXMLMsg), req); err != nil {
-		invalidRequestHandler.ServeInvalidRequest(w, r, err)
+		invalidRequestHandler.ServeInvalidRequest(w, r, &XMLError{Err: err})
 		return
 	}
 
 	haveAppId := req["appid"]
 	wantAppId := agent.GetAppId()
 	if len(haveAppId) != len(wantAppId) {
-		err = fmt.Errorf("AppId mismatch, have: %q, want: %q", haveAppId, wantAppId)
+		err = &MismatchError{Field: "AppId", Have: haveAppId, Want: wantAppId}
 		invalidRequestHandler.ServeInvalidRequest(w, r, err)
 		return
 	}
 	if subtle.ConstantTimeCompare([]byte(haveAppId), []byte(wantAppId)) != 1 {
-		err = fmt.Errorf("AppId mismatch, have: %q, want: %q", haveAppId, wantAppId)
+		err = &MismatchError{Field: "AppId", Have: haveAppId, Want: wantAppId}
 		invalidRequestHandler.ServeInvalidRequest(w, r, err)
 		return
 	}
@@ -87,20 +107,29 @@ func ServePayPackageRequestHTTP(w http.ResponseWriter, r *http.Request,
 	haveMchId := req["mch_id"]
 	wantMchId := agent.GetMchId()
 	if len(haveMchId) != len(wantMchId) {
-		err = fmt.Errorf("MchId mismatch, have: %q, want: %q", haveMchId, wantMchId)
+		err = &MismatchError{Field: "MchId", Have: haveMchId, Want: wantMchId}
 		invalidRequestHandler.ServeInvalidRequest(w, r, err)
 		return
 	}
 	if subtle.ConstantTimeCompare([]byte(haveMchId), []byte(wantMchId)) != 1 {
-		err = fmt.Errorf("MchId mismatch, have: %q, want: %q", haveMchId, wantMchId)
+		err = &MismatchError{Field: "MchId", Have: haveMchId, Want: wantMchId}
 		invalidRequestHandler.ServeInvalidRequest(w, r, err)
 		return
 	}
 
 	if err := pay3.CheckMD5Signature(req, agent.GetAppKey()); err != nil {
-		invalidRequestHandler.ServeInvalidRequest(w, r, err)
+		invalidRequestHandler.ServeInvalidRequest(w, r, &SignatureError{Err: err})
 		return
 	}
 
-	agent.ServePayPackageRequest(w, r, req, postRawXMLMsg)
+	if replayGuard != nil {
+		if err = replayGuard.CheckNonce(req["nonce_str"]); err != nil {
+			invalidRequestHandler.ServeInvalidRequest(w, r, err)
+			return
+		}
+	}
+
+	serveWithNonce(w, replayGuard, req["nonce_str"], func(w http.ResponseWriter) {
+		agent.ServePayPackageRequest(w, r, req, postRawXMLMsg)
+	})
 }
@@ -0,0 +1,43 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package pay3
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/chanxuehong/wechat/mp/pay"
+	"github.com/chanxuehong/wechat/mp/pay/pay3"
+	"github.com/chanxuehong/wechat/util"
+)
+
+// 调用 serve 处理已经通过 replayGuard 检查的请求.
+//  微信支付没有收到 return_code 为 SUCCESS 的回复会用同一个 nonce_str 重试,
+//  所以回复不是 SUCCESS(包括 serve panic)的时候撤销 nonce, 只有处理成功的 nonce 才会被当作重放拒绝.
+func serveWithNonce(w http.ResponseWriter, replayGuard *util.ReplayGuard, nonce string, serve func(w http.ResponseWriter)) {
+	if replayGuard == nil {
+		serve(w)
+		return
+	}
+
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			replayGuard.ReleaseNonce(nonce)
+		}
+	}()
+	body, _ := util.CaptureServe(w, serve)
+	succeeded = isSuccessReply(body)
+}
+
+// 回复的 return_code 是否为 SUCCESS
+func isSuccessReply(body []byte) bool {
+	reply := make(map[string]string)
+	if err := pay.ParseXMLToMap(bytes.NewReader(body), reply); err != nil {
+		return false
+	}
+	return reply["return_code"] == pay3.RET_CODE_SUCCESS
+}
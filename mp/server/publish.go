@@ -0,0 +1,39 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/chanxuehong/wechat/mp/message/passive/request"
+	"github.com/chanxuehong/wechat/util"
+)
+
+// 把消息 msgReq 发布到 publisher, 出错的时候只记录日志, 不影响消息的处理
+func publishMsg(publisher util.Publisher, msgReq *request.Request, rawXMLMsg []byte) {
+	msgJSON, err := json.Marshal(msgReq)
+	if err != nil {
+		log.Printf("wechat: encode %s message from %s failed: %v", msgReq.MsgType, msgReq.FromUserName, err)
+		return
+	}
+
+	msg := &util.PublishedMsg{
+		Source:       metricsSource,
+		AccountId:    msgReq.ToUserName,
+		MsgType:      msgReq.MsgType,
+		Event:        msgReq.Event,
+		FromUserName: msgReq.FromUserName,
+		CreateTime:   msgReq.CreateTime,
+		RawXMLMsg:    string(rawXMLMsg),
+		Msg:          msgJSON,
+		ReceivedAt:   time.Now(),
+	}
+	if err = publisher.Publish(msg); err != nil {
+		log.Printf("wechat: publish %s message from %s failed: %v", msgReq.MsgType, msgReq.FromUserName, err)
+	}
+}
@@ -0,0 +1,52 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/chanxuehong/wechat/mp/simulator"
+	"github.com/chanxuehong/wechat/util"
+)
+
+func TestFrontendPublisher(t *testing.T) {
+	const id, token, appId = "gh_0123456789ab", "token", "wx0123456789abcdef"
+
+	var agent DefaultAgent
+	agent.Init(id, token, appId, bytes.Repeat([]byte("k"), 32))
+
+	publisher := util.NewChanPublisher(10, 0)
+	frontend := NewAgentFrontend(&agent, nil)
+	frontend.EnableDedup(nil)
+	frontend.EnablePublisher(publisher)
+
+	rawXMLMsg, err := simulator.BuildMsg("text", &simulator.Params{ToUserName: id, Content: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := url.Values{"signature": {util.Sign(token, "1", "1")}, "timestamp": {"1"}, "nonce": {"1"}}
+	for i := 0; i < 2; i++ { // 重试推送的消息不会重复发布
+		frontend.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/?"+query.Encode(), bytes.NewReader(rawXMLMsg)))
+	}
+
+	if n := len(publisher.C); n != 1 {
+		t.Fatalf("published %d messages, want 1", n)
+	}
+	msg := <-publisher.C
+	if msg.Source != "mp" || msg.AccountId != id || msg.MsgType != "text" || msg.RawXMLMsg != string(rawXMLMsg) {
+		t.Errorf("msg = %+v", msg)
+	}
+	var content struct {
+		Content string
+	}
+	if err = json.Unmarshal(msg.Msg, &content); err != nil || content.Content != "hello" {
+		t.Errorf("msg.Msg = %s, err = %v", msg.Msg, err)
+	}
+}
@@ -0,0 +1,68 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/wechat/mp/simulator"
+	"github.com/chanxuehong/wechat/util"
+)
+
+func TestReplayGuard(t *testing.T) {
+	const id, token, appId = "gh_0123456789ab", "token", "wx0123456789abcdef"
+
+	var agent DefaultAgent
+	agent.Init(id, token, appId, bytes.Repeat([]byte("k"), 32))
+
+	var lastErr error
+	frontend := NewAgentFrontend(&agent, InvalidRequestHandlerFunc(func(w http.ResponseWriter, r *http.Request, err error) {
+		lastErr = err
+	}))
+	frontend.EnableReplayGuard(nil)
+
+	rawXMLMsg, err := simulator.BuildMsg("text", &simulator.Params{ToUserName: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := func(timestamp int64, nonce string) *util.ReplayError {
+		timestampStr := strconv.FormatInt(timestamp, 10)
+		query := url.Values{
+			"signature": {util.Sign(token, timestampStr, nonce)},
+			"timestamp": {timestampStr},
+			"nonce":     {nonce},
+		}
+		r := httptest.NewRequest("POST", "/?"+query.Encode(), bytes.NewReader(rawXMLMsg))
+
+		lastErr = nil
+		frontend.ServeHTTP(httptest.NewRecorder(), r)
+		if lastErr == nil {
+			return nil
+		}
+		replayErr, ok := lastErr.(*util.ReplayError)
+		if !ok {
+			t.Fatalf("err = %v, want *util.ReplayError", lastErr)
+		}
+		return replayErr
+	}
+
+	now := time.Now().Unix()
+	if err := post(now, "1234"); err != nil {
+		t.Fatal(err)
+	}
+	if err := post(now, "1234"); err == nil || !err.Reused {
+		t.Errorf("replayed request: err = %v", err)
+	}
+	if err := post(now-3600, "5678"); err == nil || err.Reused {
+		t.Errorf("stale request: err = %v", err)
+	}
+}
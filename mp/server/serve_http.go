@@ -6,12 +6,9 @@
 package server
 
 import (
-	"bytes"
 	"crypto/subtle"
 	"encoding/base64"
 	"encoding/xml"
-	"errors"
-	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -29,6 +26,23 @@ var zeroAESKey [32]byte
 func ServeHTTP(w http.ResponseWriter, r *http.Request,
 	urlValues url.Values, agent Agent, invalidRequestHandler InvalidRequestHandler) {
 
+	serveHTTP(w, r, urlValues, agent, invalidRequestHandler, serveOptions{})
+}
+
+// serveHTTP 的可选功能, 字段为 nil 表示不开启
+type serveOptions struct {
+	dedupStore   util.DedupStore    // 过滤微信服务器重试推送的消息
+	replayGuard  *util.ReplayGuard  // 拒绝重放的请求
+	metrics      util.ServerMetrics // 报告消息的统计信息
+	publisher    util.Publisher     // 把消息发布到 publisher
+	archiveStore util.ArchiveStore  // 把消息和回复存档到 archiveStore
+	middlewares  []Middleware       // 交给 Agent 处理之前经过的中间件
+}
+
+// 同 ServeHTTP, 另外按照 options 开启重复消息过滤, 重放攻击防护, 统计, 发布, 存档和中间件
+func serveHTTP(w http.ResponseWriter, r *http.Request, urlValues url.Values, agent Agent,
+	invalidRequestHandler InvalidRequestHandler, options serveOptions) {
+
 	switch r.Method {
 	case "POST": // 消息处理
 		signature1, timestampStr, nonce, encryptType, msgSignature1, err := parsePostURLQuery(urlValues)
@@ -39,7 +53,7 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request,
 
 		timestamp, err := strconv.ParseInt(timestampStr, 10, 64)
 		if err != nil {
-			err = fmt.Errorf("can not parse timestamp(==%q) to int64, error: %s", timestampStr, err.Error())
+			err = &TimestampError{Timestamp: timestampStr, Err: err}
 			invalidRequestHandler.ServeInvalidRequest(w, r, err)
 			return
 		}
@@ -60,91 +74,118 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request,
 			//}
 
 			if len(msgSignature1) != 40 {
-				err = fmt.Errorf("the length of msg_signature mismatch, have: %d, want: 40", len(msgSignature1))
+				err = &SignatureError{Name: "msg_signature", Have: msgSignature1}
 				invalidRequestHandler.ServeInvalidRequest(w, r, err)
 				return
 			}
 
 			var requestHttpBody request.RequestHttpBody
 			if err := xml.NewDecoder(r.Body).Decode(&requestHttpBody); err != nil {
-				invalidRequestHandler.ServeInvalidRequest(w, r, err)
+				invalidRequestHandler.ServeInvalidRequest(w, r, &XMLError{Err: err})
 				return
 			}
 
 			haveToUserName := requestHttpBody.ToUserName
 			wantToUserName := agent.GetId()
 			if len(haveToUserName) != len(wantToUserName) {
-				err = fmt.Errorf("the message RequestHttpBody's ToUserName mismatch, have: %s, want: %s", haveToUserName, wantToUserName)
+				err = &MismatchError{Field: "ToUserName", Have: haveToUserName, Want: wantToUserName}
 				invalidRequestHandler.ServeInvalidRequest(w, r, err)
 				return
 			}
 			if subtle.ConstantTimeCompare([]byte(haveToUserName), []byte(wantToUserName)) != 1 {
-				err = fmt.Errorf("the message RequestHttpBody's ToUserName mismatch, have: %s, want: %s", haveToUserName, wantToUserName)
+				err = &MismatchError{Field: "ToUserName", Have: haveToUserName, Want: wantToUserName}
 				invalidRequestHandler.ServeInvalidRequest(w, r, err)
 				return
 			}
 
 			msgSignature2 := util.MsgSign(agent.GetToken(), timestampStr, nonce, requestHttpBody.EncryptedMsg)
 			if subtle.ConstantTimeCompare([]byte(msgSignature1), []byte(msgSignature2)) != 1 {
-				err = fmt.Errorf("check signature failed, input: %s, local: %s", msgSignature1, msgSignature2)
+				err = &SignatureError{Name: "msg_signature", Have: msgSignature1, Want: msgSignature2}
 				invalidRequestHandler.ServeInvalidRequest(w, r, err)
 				return
 			}
 
+			if options.replayGuard != nil {
+				if err = options.replayGuard.Check(timestamp, nonce); err != nil {
+					invalidRequestHandler.ServeInvalidRequest(w, r, err)
+					return
+				}
+			}
+
 			EncryptedMsgBytes, err := base64.StdEncoding.DecodeString(requestHttpBody.EncryptedMsg)
 			if err != nil {
-				invalidRequestHandler.ServeInvalidRequest(w, r, err)
+				invalidRequestHandler.ServeInvalidRequest(w, r, &DecryptError{Err: err})
 				return
 			}
 
-			AESKey := agent.GetCurrentAESKey()
-
-			random, rawXMLMsg, err := util.AESDecryptMsg(EncryptedMsgBytes, agent.GetAppId(), AESKey)
+			random, rawXMLMsg, AESKey, keyIndex, err := decryptMsg(EncryptedMsgBytes, agent)
 			if err != nil {
-				// 尝试上一个 AESKey
-				LastAESKey := agent.GetLastAESKey()
-				if bytes.Equal(zeroAESKey[:], LastAESKey[:]) || bytes.Equal(AESKey[:], LastAESKey[:]) {
-					invalidRequestHandler.ServeInvalidRequest(w, r, err)
-					return
-				}
-
-				AESKey = LastAESKey // !!!
-
-				random, rawXMLMsg, err = util.AESDecryptMsg(EncryptedMsgBytes, agent.GetAppId(), AESKey)
-				if err != nil {
-					invalidRequestHandler.ServeInvalidRequest(w, r, err)
-					return
-				}
+				invalidRequestHandler.ServeInvalidRequest(w, r, newDecryptError(err))
+				return
 			}
 
 			var msgReq request.Request
 			if err = xml.Unmarshal(rawXMLMsg, &msgReq); err != nil {
-				invalidRequestHandler.ServeInvalidRequest(w, r, err)
+				invalidRequestHandler.ServeInvalidRequest(w, r, &XMLError{Err: err})
 				return
 			}
 
 			if haveToUserName != msgReq.ToUserName {
-				err = fmt.Errorf("the RequestHttpBody's ToUserName(==%s) mismatch the Request's ToUserName(==%s)", haveToUserName, msgReq.ToUserName)
+				err = &MismatchError{Field: "ToUserName", Have: msgReq.ToUserName, Want: haveToUserName}
 				invalidRequestHandler.ServeInvalidRequest(w, r, err)
 				return
 			}
 
-			aesMsgDispatch(w, r, &msgReq, rawXMLMsg, timestamp, nonce, AESKey, random, agent)
+			if options.dedupStore != nil && isDuplicateMsg(options.dedupStore, &msgReq) {
+				return
+			}
+			if options.publisher != nil {
+				publishMsg(options.publisher, &msgReq, rawXMLMsg)
+			}
+			stat := &util.MsgStat{Source: metricsSource, MsgType: msgReq.MsgType, Event: msgReq.Event, Encrypted: true}
+			util.ObserveServe(options.metrics, stat, w, func(w http.ResponseWriter) {
+				archiveServe(options.archiveStore, &msgReq, rawXMLMsg, &AESKey, agent.GetAppId(), w, func(w http.ResponseWriter) {
+					ctx := &Context{
+						ResponseWriter: w,
+						Request:        r,
+						CommonHead:     msgReq.CommonHead,
+						Event:          msgReq.Event,
+						Msg:            requestMsg(&msgReq),
+						RawXMLMsg:      rawXMLMsg,
+						Timestamp:      timestamp,
+						AESMode:        true,
+						Nonce:          nonce,
+						AESKey:         AESKey,
+						Random:         random,
+						AESKeyIndex:    keyIndex,
+						appId:          agent.GetAppId(),
+						token:          agent.GetToken(),
+					}
+					serveMsg(ctx, &msgReq, agent, options.middlewares)
+				})
+			})
 
 		case "", "raw": // 明文模式
 			if len(signature1) != 40 {
-				err = fmt.Errorf("the length of signature mismatch, have: %d, want: 40", len(signature1))
+				err = &SignatureError{Name: "signature", Have: signature1}
 				invalidRequestHandler.ServeInvalidRequest(w, r, err)
 				return
 			}
 
 			signature2 := util.Sign(agent.GetToken(), timestampStr, nonce)
 			if subtle.ConstantTimeCompare([]byte(signature1), []byte(signature2)) != 1 {
-				err = fmt.Errorf("check signature failed, input: %s, local: %s", signature1, signature2)
+				err = &SignatureError{Name: "signature", Have: signature1, Want: signature2}
 				invalidRequestHandler.ServeInvalidRequest(w, r, err)
 				return
 			}
 
+			if options.replayGuard != nil {
+				if err = options.replayGuard.Check(timestamp, nonce); err != nil {
+					invalidRequestHandler.ServeInvalidRequest(w, r, err)
+					return
+				}
+			}
+
 			rawXMLMsg, err := ioutil.ReadAll(r.Body)
 			if err != nil {
 				invalidRequestHandler.ServeInvalidRequest(w, r, err)
@@ -153,26 +194,48 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request,
 
 			var msgReq request.Request
 			if err = xml.Unmarshal(rawXMLMsg, &msgReq); err != nil {
-				invalidRequestHandler.ServeInvalidRequest(w, r, err)
+				invalidRequestHandler.ServeInvalidRequest(w, r, &XMLError{Err: err})
 				return
 			}
 
 			wantToUserName := agent.GetId()
 			if len(msgReq.ToUserName) != len(wantToUserName) {
-				err = fmt.Errorf("the message Request's ToUserName mismatch, have: %s, want: %s", msgReq.ToUserName, wantToUserName)
+				err = &MismatchError{Field: "ToUserName", Have: msgReq.ToUserName, Want: wantToUserName}
 				invalidRequestHandler.ServeInvalidRequest(w, r, err)
 				return
 			}
 			if subtle.ConstantTimeCompare([]byte(msgReq.ToUserName), []byte(wantToUserName)) != 1 {
-				err = fmt.Errorf("the message Request's ToUserName mismatch, have: %s, want: %s", msgReq.ToUserName, wantToUserName)
+				err = &MismatchError{Field: "ToUserName", Have: msgReq.ToUserName, Want: wantToUserName}
 				invalidRequestHandler.ServeInvalidRequest(w, r, err)
 				return
 			}
 
-			rawMsgDispatch(w, r, &msgReq, rawXMLMsg, timestamp, agent)
+			if options.dedupStore != nil && isDuplicateMsg(options.dedupStore, &msgReq) {
+				return
+			}
+			if options.publisher != nil {
+				publishMsg(options.publisher, &msgReq, rawXMLMsg)
+			}
+			stat := &util.MsgStat{Source: metricsSource, MsgType: msgReq.MsgType, Event: msgReq.Event}
+			util.ObserveServe(options.metrics, stat, w, func(w http.ResponseWriter) {
+				archiveServe(options.archiveStore, &msgReq, rawXMLMsg, nil, "", w, func(w http.ResponseWriter) {
+					ctx := &Context{
+						ResponseWriter: w,
+						Request:        r,
+						CommonHead:     msgReq.CommonHead,
+						Event:          msgReq.Event,
+						Msg:            requestMsg(&msgReq),
+						RawXMLMsg:      rawXMLMsg,
+						Timestamp:      timestamp,
+						appId:          agent.GetAppId(),
+						token:          agent.GetToken(),
+					}
+					serveMsg(ctx, &msgReq, agent, options.middlewares)
+				})
+			})
 
 		default: // 未知的加密类型
-			invalidRequestHandler.ServeInvalidRequest(w, r, errors.New("unknown encrypt_type"))
+			invalidRequestHandler.ServeInvalidRequest(w, r, &EncryptTypeError{EncryptType: encryptType})
 			return
 		}
 
@@ -184,14 +247,14 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request,
 		}
 
 		if len(signature1) != 40 {
-			err = fmt.Errorf("the length of signature mismatch, have: %d, want: 40", len(signature1))
+			err = &SignatureError{Name: "signature", Have: signature1}
 			invalidRequestHandler.ServeInvalidRequest(w, r, err)
 			return
 		}
 
 		signature2 := util.Sign(agent.GetToken(), timestamp, nonce)
 		if subtle.ConstantTimeCompare([]byte(signature1), []byte(signature2)) != 1 {
-			err = fmt.Errorf("check signature failed, input: %s, local: %s", signature1, signature2)
+			err = &SignatureError{Name: "signature", Have: signature1, Want: signature2}
 			invalidRequestHandler.ServeInvalidRequest(w, r, err)
 			return
 		}
@@ -199,3 +262,22 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request,
 		io.WriteString(w, echostr)
 	}
 }
+
+// 经过 middlewares 以后把消息交给 agent 处理.
+//  agent 是 *ServeMux 的时候直接把 ctx 交给它, 这样中间件设置的 RequestId, Context.Set 保存的值等在 ServeMux 里也能获取;
+//  否则用消息分路器调用 agent 对应的方法.
+func serveMsg(ctx *Context, msgReq *request.Request, agent Agent, middlewares []Middleware) {
+	var handler Handler
+	if mux, ok := agent.(*ServeMux); ok {
+		handler = mux
+	} else {
+		handler = HandlerFunc(func(ctx *Context) {
+			if ctx.AESMode {
+				aesMsgDispatch(ctx.ResponseWriter, ctx.Request, msgReq, ctx.RawXMLMsg, ctx.Timestamp, ctx.Nonce, ctx.AESKey, ctx.Random, agent)
+			} else {
+				rawMsgDispatch(ctx.ResponseWriter, ctx.Request, msgReq, ctx.RawXMLMsg, ctx.Timestamp, agent)
+			}
+		})
+	}
+	Chain(handler, middlewares...).ServeMsg(ctx)
+}
@@ -0,0 +1,101 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/chanxuehong/wechat/util"
+)
+
+// 用户的会话, 由 Sessions 中间件加载和保存, 通过 Context.Session 获取.
+//  NOTE: 不是并发安全的.
+type Session struct {
+	data      sessionData
+	destroyed bool
+}
+
+type sessionData struct {
+	Values map[string]string `json:"values,omitempty"`
+	Dialog *dialogState      `json:"dialog,omitempty"` // 正在进行的对话
+}
+
+func (s *Session) Get(key string) string {
+	return s.data.Values[key]
+}
+
+func (s *Session) Set(key, value string) {
+	if s.data.Values == nil {
+		s.data.Values = make(map[string]string)
+	}
+	s.data.Values[key] = value
+	s.destroyed = false
+}
+
+func (s *Session) Delete(key string) {
+	delete(s.data.Values, key)
+}
+
+// 清空会话, 包括正在进行的对话, 处理完消息后从 SessionStore 中删除.
+func (s *Session) Destroy() {
+	s.data = sessionData{}
+	s.destroyed = true
+}
+
+// 正在进行的对话的名称, 没有则返回 "".
+func (s *Session) Dialog() string {
+	if s.data.Dialog == nil {
+		return ""
+	}
+	return s.data.Dialog.Name
+}
+
+// 会话中间件, 处理消息前从 store 中加载 FromUserName 的会话, 处理完后保存, 每次保存都会延长有效期 ttl.
+//  store 为 nil 则用 util.NewMemorySessionStore(), ttl <= 0 则用 util.DefaultSessionTTL.
+//  NOTE: 和 Async 一起使用的时候要放在 Async 的后面, 这样才能在 handler 处理完以后保存.
+func Sessions(store util.SessionStore, ttl time.Duration) Middleware {
+	if store == nil {
+		store = util.NewMemorySessionStore()
+	}
+	if ttl <= 0 {
+		ttl = util.DefaultSessionTTL
+	}
+
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx *Context) {
+			key := ctx.ToUserName + ":" + ctx.FromUserName
+
+			session := new(Session)
+			if data, err := store.Get(key); err != nil {
+				log.Printf("wechat: load session %s failed: %v", key, err)
+			} else if data != nil {
+				if err = json.Unmarshal(data, &session.data); err != nil {
+					log.Printf("wechat: decode session %s failed: %v", key, err)
+				}
+			}
+			ctx.session = session
+
+			next.ServeMsg(ctx)
+
+			if session.destroyed {
+				if err := store.Delete(key); err != nil {
+					log.Printf("wechat: delete session %s failed: %v", key, err)
+				}
+				return
+			}
+			data, err := json.Marshal(&session.data)
+			if err != nil {
+				log.Printf("wechat: encode session %s failed: %v", key, err)
+				return
+			}
+			if err = store.Set(key, data, ttl); err != nil {
+				log.Printf("wechat: save session %s failed: %v", key, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+// 模拟微信服务器向开发者 URL 推送消息, 用于本地开发和调试 mp/server.
+//
+// 支持 mp/message/passive/request 里所有的消息和事件类型, 支持明文模式, 兼容模式和安全模式,
+// 会自动计算 signature, msg_signature, timestamp 和 nonce, 并且解密开发者服务器的回复:
+//
+//  s := simulator.NewSimulator("http://localhost:8080/wechat", token, appId, AESKey, simulator.MODE_AES)
+//  reply, err := s.Send("text", &simulator.Params{ToUserName: "gh_xxx", Content: "hello"})
+//  if err != nil {
+//      ...
+//  }
+//  fmt.Println(simulator.FormatXML(reply.RawXMLMsg))
+//
+// 命令行工具参考 github.com/chanxuehong/wechat/cmd/wechatsim
+package simulator
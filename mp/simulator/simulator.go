@@ -0,0 +1,285 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package simulator
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/chanxuehong/wechat/mp/message/passive/response"
+	"github.com/chanxuehong/wechat/util"
+)
+
+// 消息的加密方式
+const (
+	MODE_RAW        = "raw"        // 明文模式
+	MODE_COMPATIBLE = "compatible" // 兼容模式, 消息体同时包含明文和密文
+	MODE_AES        = "aes"        // 安全模式
+)
+
+// 模拟微信服务器, 向开发者的 URL 推送消息.
+type Simulator struct {
+	URL    string // 开发者服务器的 URL, 比如 http://localhost:8080/wechat
+	Token  string
+	AppId  string   // 兼容模式 和 安全模式 需要
+	AESKey [32]byte // 兼容模式 和 安全模式 需要
+	Mode   string   // MODE_RAW, MODE_COMPATIBLE, MODE_AES
+
+	HTTPClient *http.Client // 默认为 http.DefaultClient
+}
+
+// 创建一个新的 Simulator.
+//  明文模式下 AppId 和 AESKey 可以为空, 其他模式下 AESKey 的长度必须为 32.
+func NewSimulator(URL, Token, AppId string, AESKey []byte, Mode string) *Simulator {
+	if URL == "" {
+		panic("empty URL")
+	}
+	if Token == "" {
+		panic("empty Token")
+	}
+
+	s := &Simulator{
+		URL:   URL,
+		Token: Token,
+		AppId: AppId,
+		Mode:  Mode,
+	}
+	switch Mode {
+	case MODE_RAW:
+	case MODE_COMPATIBLE, MODE_AES:
+		if AppId == "" {
+			panic("empty AppId")
+		}
+		if len(AESKey) != 32 {
+			panic("the length of AESKey must be equal to 32")
+		}
+		copy(s.AESKey[:], AESKey)
+	default:
+		panic("unknown Mode: " + Mode)
+	}
+	return s
+}
+
+// 推送消息的结果
+type Reply struct {
+	StatusCode int
+	Body       []byte // 原始的 http body
+	RawXMLMsg  []byte // 回复的明文消息, 兼容模式 和 安全模式 下是解密后的消息; 没有回复消息则为 nil
+}
+
+// 回复的消息的类型, 没有回复消息则返回空字符串.
+func (reply *Reply) MsgType() string {
+	if len(reply.RawXMLMsg) == 0 {
+		return ""
+	}
+	var head response.CommonHead
+	xml.Unmarshal(reply.RawXMLMsg, &head)
+	return head.MsgType
+}
+
+// 模拟首次验证 URL 的 GET 请求, 检查开发者服务器是否原样返回了 echostr.
+func (s *Simulator) Verify() (err error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := randString(10)
+	echostr := randString(19)
+
+	query := make(url.Values)
+	query.Set("signature", util.Sign(s.Token, timestamp, nonce))
+	query.Set("timestamp", timestamp)
+	query.Set("nonce", nonce)
+	query.Set("echostr", echostr)
+
+	resp, err := s.httpClient().Get(s.url(query))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("http.Status: %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	if string(body) != echostr {
+		return fmt.Errorf("echostr mismatch, have: %q, want: %q", body, echostr)
+	}
+	return
+}
+
+// 构造 kind 类型的消息并推送到开发者服务器, 参考 BuildMsg.
+func (s *Simulator) Send(kind string, params *Params) (reply *Reply, err error) {
+	rawXMLMsg, err := BuildMsg(kind, params)
+	if err != nil {
+		return
+	}
+	return s.Post(rawXMLMsg)
+}
+
+// 推送明文消息 rawXMLMsg 到开发者服务器, 按照 Mode 签名和加密, 并且解密回复的消息.
+func (s *Simulator) Post(rawXMLMsg []byte) (reply *Reply, err error) {
+	req, err := s.NewRequest(rawXMLMsg)
+	if err != nil {
+		return
+	}
+
+	resp, err := s.httpClient().Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	reply = &Reply{
+		StatusCode: resp.StatusCode,
+		Body:       body,
+	}
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("http.Status: %s", resp.Status)
+		return
+	}
+	reply.RawXMLMsg, err = s.DecryptReply(body)
+	return
+}
+
+// 构造推送 rawXMLMsg 的 http 请求, 包括 URL 里的 signature, timestamp, nonce, encrypt_type, msg_signature.
+func (s *Simulator) NewRequest(rawXMLMsg []byte) (req *http.Request, err error) {
+	var head struct {
+		ToUserName string `xml:"ToUserName"`
+	}
+	if err = xml.Unmarshal(rawXMLMsg, &head); err != nil {
+		return
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := randString(10)
+
+	query := make(url.Values)
+	query.Set("signature", util.Sign(s.Token, timestamp, nonce))
+	query.Set("timestamp", timestamp)
+	query.Set("nonce", nonce)
+
+	var body []byte
+	switch s.Mode {
+	case MODE_RAW:
+		body = rawXMLMsg
+
+	case MODE_COMPATIBLE, MODE_AES:
+		random := make([]byte, 16)
+		if _, err = io.ReadFull(rand.Reader, random); err != nil {
+			return
+		}
+		encryptedMsg := base64.StdEncoding.EncodeToString(util.AESEncryptMsg(random, rawXMLMsg, s.AppId, s.AESKey))
+
+		query.Set("encrypt_type", "aes")
+		query.Set("msg_signature", util.MsgSign(s.Token, timestamp, nonce, encryptedMsg))
+
+		if s.Mode == MODE_AES {
+			body = []byte("<xml><ToUserName>" + cdata(head.ToUserName) + "</ToUserName><Encrypt>" + cdata(encryptedMsg) + "</Encrypt></xml>")
+		} else {
+			// 兼容模式下, 在明文消息的后面加上 <Encrypt>
+			i := bytes.LastIndex(rawXMLMsg, []byte("</xml>"))
+			if i == -1 {
+				err = errors.New("invalid rawXMLMsg: </xml> not found")
+				return
+			}
+			body = make([]byte, 0, len(rawXMLMsg)+len(encryptedMsg)+32)
+			body = append(body, rawXMLMsg[:i]...)
+			body = append(body, "<Encrypt>"+cdata(encryptedMsg)+"</Encrypt>\n"...)
+			body = append(body, rawXMLMsg[i:]...)
+		}
+
+	default:
+		err = fmt.Errorf("unknown Mode: %q", s.Mode)
+		return
+	}
+
+	if req, err = http.NewRequest("POST", s.url(query), bytes.NewReader(body)); err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	return
+}
+
+// 解密开发者服务器回复的 http body, 返回明文消息; 没有回复消息(空字符串或者 "success")则返回 nil.
+//  明文模式下直接返回 body; 其他模式下检查 MsgSignature 并解密.
+func (s *Simulator) DecryptReply(body []byte) (rawXMLMsg []byte, err error) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || string(body) == "success" {
+		return
+	}
+	if s.Mode == MODE_RAW {
+		rawXMLMsg = body
+		return
+	}
+
+	var responseHttpBody response.ResponseHttpBody
+	if err = xml.Unmarshal(body, &responseHttpBody); err != nil {
+		return
+	}
+	if responseHttpBody.EncryptedMsg == "" {
+		err = errors.New("the reply is not encrypted")
+		return
+	}
+
+	timestamp := strconv.FormatInt(responseHttpBody.TimeStamp, 10)
+	msgSignature := util.MsgSign(s.Token, timestamp, responseHttpBody.Nonce, responseHttpBody.EncryptedMsg)
+	if subtle.ConstantTimeCompare([]byte(msgSignature), []byte(responseHttpBody.MsgSignature)) != 1 {
+		err = fmt.Errorf("check reply signature failed, input: %s, local: %s", responseHttpBody.MsgSignature, msgSignature)
+		return
+	}
+
+	encryptedMsg, err := base64.StdEncoding.DecodeString(responseHttpBody.EncryptedMsg)
+	if err != nil {
+		return
+	}
+	_, rawXMLMsg, err = util.AESDecryptMsg(encryptedMsg, s.AppId, s.AESKey)
+	return
+}
+
+func (s *Simulator) httpClient() *http.Client {
+	if s.HTTPClient != nil {
+		return s.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (s *Simulator) url(query url.Values) string {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return s.URL + "?" + query.Encode()
+	}
+	q := u.Query()
+	for k, v := range query {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func randString(n int) string {
+	b := make([]byte, (n+1)/2)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)[:n]
+}
@@ -0,0 +1,119 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package simulator
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chanxuehong/wechat/mp/message/passive/request"
+	"github.com/chanxuehong/wechat/mp/message/passive/response"
+	"github.com/chanxuehong/wechat/mp/server"
+)
+
+const (
+	testId    = "gh_0123456789ab"
+	testToken = "token"
+	testAppId = "wx0123456789abcdef"
+)
+
+var testAESKey = []byte("0123456789abcdef0123456789abcdef")
+
+type echoAgent struct {
+	server.DefaultAgent
+	kinds []string
+}
+
+func (agent *echoAgent) ServeTextMsg(w http.ResponseWriter, r *http.Request, msg *request.Text, rawXMLMsg []byte, timestamp int64) {
+	agent.kinds = append(agent.kinds, "text")
+	server.WriteText(w, response.NewText(msg.FromUserName, msg.ToUserName, msg.Content, timestamp))
+}
+
+func (agent *echoAgent) ServeAESTextMsg(w http.ResponseWriter, r *http.Request, msg *request.Text, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+	agent.kinds = append(agent.kinds, "aes text")
+	server.WriteAESText(w, response.NewText(msg.FromUserName, msg.ToUserName, msg.Content, timestamp),
+		timestamp, nonce, AESKey, random, agent.GetAppId(), agent.GetToken())
+}
+
+func TestBuildMsg(t *testing.T) {
+	for _, kind := range Kinds() {
+		rawXMLMsg, err := BuildMsg(kind, &Params{ToUserName: testId, Content: "a < b ]]> c"})
+		if err != nil {
+			t.Errorf("BuildMsg(%q): %v", kind, err)
+			continue
+		}
+		var req request.Request
+		if err = xml.Unmarshal(rawXMLMsg, &req); err != nil {
+			t.Errorf("BuildMsg(%q): invalid xml: %v\n%s", kind, err, rawXMLMsg)
+			continue
+		}
+		if req.ToUserName != testId {
+			t.Errorf("BuildMsg(%q): ToUserName: have %q", kind, req.ToUserName)
+		}
+		if kind == "text" && req.Content != "a < b ]]> c" {
+			t.Errorf("BuildMsg(text): Content: have %q", req.Content)
+		}
+	}
+	if _, err := BuildMsg("unknown", nil); err == nil {
+		t.Error("BuildMsg(unknown): expected error")
+	}
+}
+
+func TestSimulator(t *testing.T) {
+	agent := new(echoAgent)
+	agent.Init(testId, testToken, testAppId, testAESKey)
+	invalidRequestHandler := server.InvalidRequestHandlerFunc(func(w http.ResponseWriter, r *http.Request, err error) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	})
+	ts := httptest.NewServer(server.NewAgentFrontend(agent, invalidRequestHandler))
+	defer ts.Close()
+
+	for _, mode := range []string{MODE_RAW, MODE_COMPATIBLE, MODE_AES} {
+		s := NewSimulator(ts.URL, testToken, testAppId, testAESKey, mode)
+		if err := s.Verify(); err != nil {
+			t.Errorf("%s: Verify: %v", mode, err)
+		}
+		reply, err := s.Send("text", &Params{ToUserName: testId, Content: "你好"})
+		if err != nil {
+			t.Errorf("%s: Send: %v", mode, err)
+			continue
+		}
+		if reply.MsgType() != response.MSG_TYPE_TEXT || !bytes.Contains(reply.RawXMLMsg, []byte("你好")) {
+			t.Errorf("%s: reply: have %s", mode, reply.RawXMLMsg)
+		}
+
+		// 没有回复的消息
+		if reply, err = s.Send("event.subscribe", &Params{ToUserName: testId}); err != nil || reply.RawXMLMsg != nil {
+			t.Errorf("%s: Send(event.subscribe): have %s, %v", mode, reply.Body, err)
+		}
+	}
+
+	want := []string{"text", "aes text", "aes text"}
+	if len(agent.kinds) != len(want) {
+		t.Fatalf("agent.kinds: have %v, want %v", agent.kinds, want)
+	}
+	for i := range want {
+		if agent.kinds[i] != want[i] {
+			t.Errorf("agent.kinds: have %v, want %v", agent.kinds, want)
+		}
+	}
+
+	s := NewSimulator(ts.URL, "wrong token", testAppId, testAESKey, MODE_AES)
+	if _, err := s.Send("text", &Params{ToUserName: testId}); err == nil {
+		t.Error("Send with wrong token: expected error")
+	}
+}
+
+func TestFormatXML(t *testing.T) {
+	have := FormatXML([]byte("<xml><a>1</a>\n<b><c><![CDATA[x]]></c></b></xml>"))
+	want := "<xml>\n    <a>1</a>\n    <b>\n        <c>x</c>\n    </b>\n</xml>"
+	if have != want {
+		t.Errorf("FormatXML:\nhave %s\nwant %s", have, want)
+	}
+}
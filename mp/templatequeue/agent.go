@@ -0,0 +1,59 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package templatequeue
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/chanxuehong/wechat/mp/message/passive/request"
+	"github.com/chanxuehong/wechat/mp/server"
+)
+
+var _ server.Agent = new(Agent)
+
+// 包装一个 server.Agent, 收到模板消息发送结束的事件时先交给 Queue 更新消息的送达状态,
+// 然后再调用被包装的 Agent 的对应方法, 其他消息直接由被包装的 Agent 处理.
+type Agent struct {
+	server.Agent
+	queue *Queue
+}
+
+// 创建一个新的 Agent, agent 和 queue 都不能为 nil.
+func NewAgent(agent server.Agent, queue *Queue) *Agent {
+	if agent == nil {
+		panic("agent == nil")
+	}
+	if queue == nil {
+		panic("queue == nil")
+	}
+
+	return &Agent{
+		Agent: agent,
+		queue: queue,
+	}
+}
+
+func (this *Agent) ServeTemplateSendJobFinishEvent(w http.ResponseWriter, r *http.Request,
+	event *request.TemplateSendJobFinishEvent, rawXMLMsg []byte, timestamp int64) {
+
+	this.handleTemplateSendJobFinishEvent(event)
+	this.Agent.ServeTemplateSendJobFinishEvent(w, r, event, rawXMLMsg, timestamp)
+}
+
+func (this *Agent) ServeAESTemplateSendJobFinishEvent(w http.ResponseWriter, r *http.Request,
+	event *request.TemplateSendJobFinishEvent, rawXMLMsg []byte, timestamp int64, nonce string, AESKey [32]byte, random []byte) {
+
+	this.handleTemplateSendJobFinishEvent(event)
+	this.Agent.ServeAESTemplateSendJobFinishEvent(w, r, event, rawXMLMsg, timestamp, nonce, AESKey, random)
+}
+
+// 不属于队列的事件忽略, 其他错误记录日志
+func (this *Agent) handleTemplateSendJobFinishEvent(event *request.TemplateSendJobFinishEvent) {
+	if err := this.queue.HandleTemplateSendJobFinishEvent(event); err != nil && err != ErrNotFound {
+		log.Printf("wechat: handle TEMPLATESENDJOBFINISH event %d failed: %v", event.MsgId, err)
+	}
+}
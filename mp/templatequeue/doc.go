@@ -0,0 +1,10 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+// 模板消息发送队列.
+//  消息先保存到 Store 里, 再由后台 goroutine 按照限定的速率调用 Client.MsgTemplateSend 发送,
+//  临时性的错误会按退避时间重试; 发送成功后记录 msgid, 收到模板消息发送结束的事件(TEMPLATESENDJOBFINISH)
+//  后更新消息最终的送达状态, 可以按用户查询发送记录.
+package templatequeue
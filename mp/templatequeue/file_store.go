@@ -0,0 +1,161 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package templatequeue
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+)
+
+var _ Store = new(FileStore)
+
+// 基于文件的 Store 实现.
+//  每次 Put 都把 Record 以一行 json 追加到文件末尾, 打开的时候重放整个文件恢复到内存中;
+//  文件会随着时间增长, 可以定期调用 Compact 只保留每个 Record 的最新状态.
+type FileStore struct {
+	*MemoryStore
+
+	mutex sync.Mutex // 保护 file
+	path  string
+	file  *os.File
+}
+
+// 打开(不存在则创建) path 对应的文件, 并加载其中的 Record.
+func NewFileStore(path string) (store *FileStore, err error) {
+	memoryStore := NewMemoryStore()
+	if err = loadRecords(path, memoryStore); err != nil {
+		return
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return
+	}
+
+	store = &FileStore{
+		MemoryStore: memoryStore,
+		path:        path,
+		file:        file,
+	}
+	return
+}
+
+func loadRecords(path string, store *MemoryStore) (err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var record Record
+		if err = json.Unmarshal(line, &record); err != nil {
+			// 最后一行可能因为进程中断而不完整, 忽略
+			err = nil
+			continue
+		}
+		store.Put(&record)
+	}
+	return scanner.Err()
+}
+
+func (this *FileStore) Put(record *Record) (err error) {
+	if record == nil {
+		return errors.New("record == nil")
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+
+	// 追加文件和更新内存都要持有锁, 否则 Compact 可能在两者之间重写文件而丢掉这个 Record
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if this.file == nil {
+		return errors.New("FileStore is closed")
+	}
+	if _, err = this.file.Write(data); err != nil {
+		return
+	}
+	return this.MemoryStore.Put(record)
+}
+
+// 重写文件, 只保留每个 Record 的最新状态.
+func (this *FileStore) Compact() (err error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if this.file == nil {
+		return errors.New("FileStore is closed")
+	}
+
+	tmpPath := this.path + ".tmp"
+	tmpFile, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0644)
+	if err != nil {
+		return
+	}
+
+	writer := bufio.NewWriter(tmpFile)
+	encoder := json.NewEncoder(writer)
+
+	this.MemoryStore.rwmutex.RLock()
+	for _, record := range this.MemoryStore.records {
+		if err = encoder.Encode(record); err != nil {
+			break
+		}
+	}
+	this.MemoryStore.rwmutex.RUnlock()
+
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return
+	}
+
+	if err = os.Rename(tmpPath, this.path); err != nil {
+		return
+	}
+
+	file, err := os.OpenFile(this.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	this.file.Close()
+	this.file = file
+	return
+}
+
+func (this *FileStore) Close() (err error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if this.file == nil {
+		return
+	}
+	err = this.file.Close()
+	this.file = nil
+	return
+}
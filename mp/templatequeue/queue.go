@@ -0,0 +1,308 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package templatequeue
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chanxuehong/wechat/mp/client"
+	"github.com/chanxuehong/wechat/mp/message/active/template"
+	"github.com/chanxuehong/wechat/mp/message/passive/request"
+)
+
+const (
+	DefaultRateLimit     = 10               // 默认每秒最多发送 10 条
+	DefaultMaxAttempts   = 3                // 默认最多调用 3 次发送接口
+	DefaultRetryInterval = 30 * time.Second // 默认第一次重试的间隔, 之后每次翻倍
+	DefaultPollInterval  = time.Second      // 默认没有消息时检查 Store 的间隔
+
+	errCodeSystemBusy     = -1    // 系统繁忙
+	errCodeFreqOutOfLimit = 45009 // 接口调用超过限制
+)
+
+// 队列的参数, 零值的字段使用默认值
+type Options struct {
+	RateLimit     int           // 每秒最多调用发送接口的次数, 默认为 DefaultRateLimit
+	MaxAttempts   int           // 临时性错误最多调用发送接口的次数, 默认为 DefaultMaxAttempts
+	RetryInterval time.Duration // 第一次重试的间隔, 之后每次翻倍, 默认为 DefaultRetryInterval
+	PollInterval  time.Duration // 没有消息时检查 Store 的间隔, 默认为 DefaultPollInterval
+}
+
+// 模板消息发送队列
+type Queue struct {
+	clt     *client.Client
+	store   Store
+	options Options
+
+	mutex   sync.Mutex // 保护 Record 的"读取-修改-保存", stop, sending 和 earlyEvents
+	wakeup  chan struct{}
+	stop    chan struct{}
+	stopped chan struct{}
+
+	// 正在调用发送接口的消息数; 这期间找不到 msgid 的发送结束事件可能比接口先返回,
+	// 先保存在 earlyEvents, 拿到 msgid 以后再处理
+	sending     int
+	earlyEvents map[int64]*request.TemplateSendJobFinishEvent
+}
+
+// 创建一个新的 Queue, 需要调用 Start 才开始发送.
+//  如果 store == nil 则默认用 NewMemoryStore(); 如果 options == nil 则全部使用默认值.
+func NewQueue(clt *client.Client, store Store, options *Options) *Queue {
+	if clt == nil {
+		panic("clt == nil")
+	}
+	if store == nil {
+		store = NewMemoryStore()
+	}
+
+	q := &Queue{
+		clt:    clt,
+		store:  store,
+		wakeup: make(chan struct{}, 1),
+	}
+	if options != nil {
+		q.options = *options
+	}
+	if q.options.RateLimit <= 0 {
+		q.options.RateLimit = DefaultRateLimit
+	}
+	if q.options.MaxAttempts <= 0 {
+		q.options.MaxAttempts = DefaultMaxAttempts
+	}
+	if q.options.RetryInterval <= 0 {
+		q.options.RetryInterval = DefaultRetryInterval
+	}
+	if q.options.PollInterval <= 0 {
+		q.options.PollInterval = DefaultPollInterval
+	}
+	return q
+}
+
+// 把消息加入队列, 返回 Record 的 id.
+func (q *Queue) Enqueue(msg *template.Msg) (id string, err error) {
+	if msg == nil {
+		err = errors.New("msg == nil")
+		return
+	}
+	if msg.ToUser == "" {
+		err = errors.New("msg.ToUser is empty")
+		return
+	}
+	if msg.TemplateId == "" {
+		err = errors.New("msg.TemplateId is empty")
+		return
+	}
+
+	if id, err = newRecordId(); err != nil {
+		return
+	}
+	record := &Record{
+		Id:        id,
+		Msg:       *msg,
+		Status:    STATUS_QUEUED,
+		CreatedAt: time.Now().Unix(),
+	}
+	if err = q.store.Put(record); err != nil {
+		id = ""
+		return
+	}
+
+	select {
+	case q.wakeup <- struct{}{}:
+	default:
+	}
+	return
+}
+
+// 启动后台发送的 goroutine, 重复调用无效.
+func (q *Queue) Start() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.stop != nil {
+		return
+	}
+	q.stop = make(chan struct{})
+	q.stopped = make(chan struct{})
+	go q.run(q.stop, q.stopped)
+}
+
+// 停止后台发送的 goroutine, 等待正在发送的消息完成后返回.
+func (q *Queue) Stop() {
+	q.mutex.Lock()
+	stop, stopped := q.stop, q.stopped
+	q.stop, q.stopped = nil, nil
+	q.mutex.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-stopped
+}
+
+// 获取 Record
+func (q *Queue) Get(id string) (record *Record, err error) {
+	return q.store.Get(id)
+}
+
+// 获取发给 openid 的所有消息的发送记录, 按入队时间排序.
+func (q *Queue) History(openid string) (records []*Record, err error) {
+	return q.store.ListByUser(openid)
+}
+
+// 处理模板消息发送结束的事件, 更新对应 Record 的送达状态.
+//  如果 event.MsgId 不属于队列中的任何消息返回 ErrNotFound;
+//  事件比发送接口先返回的时候先保存起来, 拿到 msgid 以后再更新, 这时返回 nil.
+func (q *Queue) HandleTemplateSendJobFinishEvent(event *request.TemplateSendJobFinishEvent) (err error) {
+	if event == nil {
+		return errors.New("event == nil")
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	record, err := q.store.GetByMsgId(event.MsgId)
+	if err == ErrNotFound && q.sending > 0 {
+		if q.earlyEvents == nil {
+			q.earlyEvents = make(map[int64]*request.TemplateSendJobFinishEvent)
+		}
+		q.earlyEvents[event.MsgId] = event
+		return nil
+	}
+	if err != nil {
+		return
+	}
+	return q.finish(record, event)
+}
+
+// 根据发送结束的事件更新 record 的送达状态, 调用者持有锁
+func (q *Queue) finish(record *Record, event *request.TemplateSendJobFinishEvent) error {
+	if event.Status == "success" {
+		record.Status = STATUS_DELIVERED
+	} else {
+		record.Status = STATUS_UNDELIVERED
+	}
+	record.DeliveryStatus = event.Status
+	record.FinishedAt = time.Now().Unix()
+	return q.store.Put(record)
+}
+
+func (q *Queue) run(stop, stopped chan struct{}) {
+	defer close(stopped)
+
+	interval := time.Second / time.Duration(q.options.RateLimit)
+	var next time.Time
+
+	for {
+		records, err := q.store.Pending(time.Now().Unix(), 100)
+		if err != nil || len(records) == 0 {
+			select {
+			case <-stop:
+				return
+			case <-q.wakeup:
+			case <-time.After(q.options.PollInterval):
+			}
+			continue
+		}
+
+		for _, record := range records {
+			if d := next.Sub(time.Now()); d > 0 {
+				select {
+				case <-stop:
+					return
+				case <-time.After(d):
+				}
+			} else {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+			}
+			next = time.Now().Add(interval)
+
+			q.send(record)
+		}
+	}
+}
+
+func (q *Queue) send(record *Record) {
+	q.mutex.Lock()
+	q.sending++
+	q.mutex.Unlock()
+
+	msgId, sendErr := q.clt.MsgTemplateSend(&record.Msg)
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.sending--
+	defer func() {
+		// 没有正在发送的消息了, 剩下的事件不属于队列
+		if q.sending == 0 {
+			q.earlyEvents = nil
+		}
+	}()
+
+	// 重新读取, 避免覆盖发送期间的修改
+	current, err := q.store.Get(record.Id)
+	if err != nil {
+		return
+	}
+	if current.Status != STATUS_QUEUED {
+		return
+	}
+
+	now := time.Now()
+	current.Attempts++
+	switch {
+	case sendErr == nil:
+		current.Status = STATUS_SENT
+		current.MsgId = msgId
+		current.LastError = ""
+		current.SentAt = now.Unix()
+		if event := q.earlyEvents[msgId]; event != nil {
+			delete(q.earlyEvents, msgId)
+			q.finish(current, event)
+			return
+		}
+	case isTemporaryError(sendErr) && current.Attempts < q.options.MaxAttempts:
+		current.LastError = sendErr.Error()
+		backoff := q.options.RetryInterval << uint(current.Attempts-1)
+		current.NextAttemptAt = now.Add(backoff).Unix()
+	default:
+		current.Status = STATUS_FAILED
+		current.LastError = sendErr.Error()
+	}
+	q.store.Put(current)
+}
+
+// 网络错误, 系统繁忙和接口调用超过限制是临时性的错误, 可以重试;
+// 其他微信服务器返回的错误(如用户已经取消关注, 模板 id 不正确)重试也没有用.
+func isTemporaryError(err error) bool {
+	if clientErr, ok := err.(*client.Error); ok {
+		return clientErr.ErrCode == errCodeSystemBusy || clientErr.ErrCode == errCodeFreqOutOfLimit
+	}
+	return true
+}
+
+// 生成 Record 的 id, 前缀是纳秒时间戳, 保证 id 的顺序和入队的顺序大致相同
+func newRecordId() (id string, err error) {
+	var random [4]byte
+	if _, err = rand.Read(random[:]); err != nil {
+		return
+	}
+	timestamp := strconv.FormatInt(time.Now().UnixNano(), 16)
+	id = strings.Repeat("0", 16-len(timestamp)) + timestamp + hex.EncodeToString(random[:])
+	return
+}
@@ -0,0 +1,171 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package templatequeue
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chanxuehong/wechat/mp/client"
+	"github.com/chanxuehong/wechat/mp/message/active/template"
+	"github.com/chanxuehong/wechat/mp/message/passive/request"
+	"github.com/chanxuehong/wechat/mp/tokenservice"
+	"github.com/chanxuehong/wechat/mp/user"
+	"github.com/chanxuehong/wechat/wechattest"
+)
+
+// 在模拟服务器上准备关注用户 OPENID
+func newTestClient(base http.RoundTripper) (srv *wechattest.Server, clt *client.Client) {
+	srv = wechattest.NewServer(nil)
+	srv.AddUser(user.UserInfo{OpenId: "OPENID"})
+	httpClient := &http.Client{Transport: wechattest.NewTransport(srv.URL(), base)}
+	clt = client.NewClient(tokenservice.NewDefaultTokenService(srv.AppId(), srv.AppSecret(), httpClient), httpClient)
+	return
+}
+
+func TestQueue(t *testing.T) {
+	srv, clt := newTestClient(nil)
+	defer srv.Close()
+
+	// 第一次调用发送接口模拟系统繁忙
+	srv.InjectError("/cgi-bin/message/template/send", -1, "system error", 1)
+
+	dir, err := ioutil.TempDir("", "templatequeue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewFileStore(filepath.Join(dir, "queue.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := NewQueue(clt, store, &Options{
+		RateLimit:     1000,
+		RetryInterval: time.Millisecond,
+		PollInterval:  10 * time.Millisecond,
+	})
+
+	// 按入队的顺序发送, 第一个消息遇到系统繁忙, 第三个消息的用户没有关注
+	ids := make([]string, 0, 3)
+	for _, openid := range []string{"OPENID", "OPENID", "BAD_OPENID"} {
+		id, err := q.Enqueue(template.NewMsg(openid, "TEMPLATE_ID", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	q.Start()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pending, _ := store.Pending(time.Now().Unix()+3600, 0)
+		if len(pending) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	q.Stop()
+
+	busy, _ := q.Get(ids[0])
+	if busy.Status != STATUS_SENT || busy.Attempts != 2 {
+		t.Errorf("busy: %+v", busy)
+	}
+	good, _ := q.Get(ids[1])
+	if good.Status != STATUS_SENT || good.MsgId == 0 {
+		t.Errorf("good: %+v", good)
+	}
+	bad, _ := q.Get(ids[2])
+	if bad.Status != STATUS_FAILED || bad.Attempts != 1 {
+		t.Errorf("bad: %+v", bad)
+	}
+	if n := len(srv.Messages()); n != 2 {
+		t.Errorf("messages: have %d, want 2", n)
+	}
+
+	event := &request.TemplateSendJobFinishEvent{MsgId: good.MsgId, Status: "failed:user block"}
+	if err = q.HandleTemplateSendJobFinishEvent(event); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// 重新打开文件, 状态应该保持不变
+	store, err = NewFileStore(filepath.Join(dir, "queue.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	history, err := store.ListByUser("OPENID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("len(history): have %d, want 2", len(history))
+	}
+	for i, record := range history {
+		if record.Id != ids[i] {
+			t.Errorf("history[%d].Id: have %s, want %s", i, record.Id, ids[i])
+		}
+	}
+	if history[1].Status != STATUS_UNDELIVERED || history[1].DeliveryStatus != "failed:user block" {
+		t.Errorf("history[1]: %+v", history[1])
+	}
+}
+
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return fn(r) }
+
+func TestQueueEarlyFinishEvent(t *testing.T) {
+	var (
+		srv *wechattest.Server
+		q   *Queue
+	)
+	errs := make(chan error, 1)
+	// 发送结束的事件比发送接口先返回
+	base := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil || r.URL.Path != "/cgi-bin/message/template/send" {
+			return resp, err
+		}
+		messages := srv.Messages()
+		errs <- q.HandleTemplateSendJobFinishEvent(&request.TemplateSendJobFinishEvent{
+			MsgId:  messages[len(messages)-1].MsgId,
+			Status: "success",
+		})
+		return resp, nil
+	})
+
+	srv, clt := newTestClient(base)
+	defer srv.Close()
+	q = NewQueue(clt, nil, nil)
+
+	id, err := q.Enqueue(template.NewMsg("OPENID", "TEMPLATE_ID", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, _ := q.Get(id)
+	q.send(record)
+
+	if err = <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if record, _ = q.Get(id); record.Status != STATUS_DELIVERED || record.MsgId != srv.Messages()[0].MsgId {
+		t.Errorf("record: %+v", record)
+	}
+	if err = q.HandleTemplateSendJobFinishEvent(&request.TemplateSendJobFinishEvent{MsgId: 9999}); err != ErrNotFound {
+		t.Errorf("unknown msgid: have %v, want ErrNotFound", err)
+	}
+}
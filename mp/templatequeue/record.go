@@ -0,0 +1,42 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package templatequeue
+
+import (
+	"github.com/chanxuehong/wechat/mp/message/active/template"
+)
+
+const (
+	STATUS_QUEUED      = "queued"      // 等待发送(包括等待重试)
+	STATUS_SENT        = "sent"        // 调用接口成功, 等待发送结束的事件
+	STATUS_FAILED      = "failed"      // 调用接口失败, 不再重试
+	STATUS_DELIVERED   = "delivered"   // 送达成功
+	STATUS_UNDELIVERED = "undelivered" // 送达失败, 原因见 Record.DeliveryStatus
+)
+
+// 队列中的一条模板消息及其发送状态
+type Record struct {
+	Id  string       `json:"id"`
+	Msg template.Msg `json:"msg"`
+
+	Status    string `json:"status"`               // STATUS_QUEUED, STATUS_SENT 等
+	Attempts  int    `json:"attempts"`             // 已经调用发送接口的次数
+	LastError string `json:"last_error,omitempty"` // 最近一次调用接口的错误
+	MsgId     int64  `json:"msgid,omitempty"`      // 发送接口返回的 msgid
+
+	// 发送结束事件的 Status, 如 "success", "failed:user block", "failed: system failed"
+	DeliveryStatus string `json:"delivery_status,omitempty"`
+
+	CreatedAt     int64 `json:"created_at"`                // 入队时间, unixtime
+	NextAttemptAt int64 `json:"next_attempt_at,omitempty"` // 下一次发送的时间, unixtime
+	SentAt        int64 `json:"sent_at,omitempty"`         // 调用接口成功的时间, unixtime
+	FinishedAt    int64 `json:"finished_at,omitempty"`     // 收到发送结束事件的时间, unixtime
+}
+
+func (record *Record) clone() *Record {
+	r := *record
+	return &r
+}
@@ -0,0 +1,143 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package templatequeue
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+var ErrNotFound = errors.New("record not found")
+
+// Record 的存储接口
+type Store interface {
+	// 添加或者覆盖 Record
+	Put(record *Record) (err error)
+
+	// 获取 Record
+	//  NOTE: 如果没有找到返回 ErrNotFound
+	Get(id string) (record *Record, err error)
+
+	// 根据发送接口返回的 msgid 获取 Record
+	//  NOTE: 如果没有找到返回 ErrNotFound
+	GetByMsgId(msgId int64) (record *Record, err error)
+
+	// 获取状态为 STATUS_QUEUED 并且 NextAttemptAt <= now 的 Record, 按入队时间排序, 最多 limit 条
+	Pending(now int64, limit int) (records []*Record, err error)
+
+	// 获取发给 openid 的所有 Record, 按入队时间排序
+	ListByUser(openid string) (records []*Record, err error)
+}
+
+var _ Store = new(MemoryStore)
+
+// 基于内存的 Store 实现
+type MemoryStore struct {
+	rwmutex sync.RWMutex
+	records map[string]*Record
+	msgIds  map[int64]string    // msgid --> record id
+	users   map[string][]string // openid --> record ids
+	queued  map[string]bool     // 状态为 STATUS_QUEUED 的 record ids
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records: make(map[string]*Record),
+		msgIds:  make(map[int64]string),
+		users:   make(map[string][]string),
+		queued:  make(map[string]bool),
+	}
+}
+
+func (this *MemoryStore) Put(record *Record) (err error) {
+	if record == nil {
+		return errors.New("record == nil")
+	}
+	record = record.clone()
+
+	this.rwmutex.Lock()
+	defer this.rwmutex.Unlock()
+
+	if _, ok := this.records[record.Id]; !ok {
+		this.users[record.Msg.ToUser] = append(this.users[record.Msg.ToUser], record.Id)
+	}
+	this.records[record.Id] = record
+	if record.MsgId != 0 {
+		this.msgIds[record.MsgId] = record.Id
+	}
+	if record.Status == STATUS_QUEUED {
+		this.queued[record.Id] = true
+	} else {
+		delete(this.queued, record.Id)
+	}
+	return
+}
+
+func (this *MemoryStore) Get(id string) (record *Record, err error) {
+	this.rwmutex.RLock()
+	record, ok := this.records[id]
+	this.rwmutex.RUnlock()
+
+	if !ok {
+		err = ErrNotFound
+		return
+	}
+	record = record.clone()
+	return
+}
+
+func (this *MemoryStore) GetByMsgId(msgId int64) (record *Record, err error) {
+	this.rwmutex.RLock()
+	id, ok := this.msgIds[msgId]
+	this.rwmutex.RUnlock()
+
+	if !ok {
+		err = ErrNotFound
+		return
+	}
+	return this.Get(id)
+}
+
+func (this *MemoryStore) Pending(now int64, limit int) (records []*Record, err error) {
+	this.rwmutex.RLock()
+	for id := range this.queued {
+		if record := this.records[id]; record.NextAttemptAt <= now {
+			records = append(records, record.clone())
+		}
+	}
+	this.rwmutex.RUnlock()
+
+	sort.Sort(byCreatedAt(records))
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	return
+}
+
+func (this *MemoryStore) ListByUser(openid string) (records []*Record, err error) {
+	this.rwmutex.RLock()
+	ids := this.users[openid]
+	records = make([]*Record, 0, len(ids))
+	for _, id := range ids {
+		records = append(records, this.records[id].clone())
+	}
+	this.rwmutex.RUnlock()
+
+	sort.Sort(byCreatedAt(records))
+	return
+}
+
+type byCreatedAt []*Record
+
+func (s byCreatedAt) Len() int      { return len(s) }
+func (s byCreatedAt) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byCreatedAt) Less(i, j int) bool {
+	if s[i].CreatedAt != s[j].CreatedAt {
+		return s[i].CreatedAt < s[j].CreatedAt
+	}
+	return s[i].Id < s[j].Id
+}
@@ -111,9 +111,11 @@ func (srv *DefaultTokenService) getNewToken() (resp *tokenResponse, err error) {
 		return
 	}
 
+	// NOTE: github.com/chanxuehong/wechat/json 会忽略非导出的嵌入字段, 所以这里不能嵌入 tokenResponse
 	var result struct {
 		Error
-		tokenResponse
+		Token     string `json:"access_token"`
+		ExpiresIn int64  `json:"expires_in"`
 	}
 	if err = json.NewDecoder(httpResp.Body).Decode(&result); err != nil {
 		return
@@ -129,22 +131,22 @@ func (srv *DefaultTokenService) getNewToken() (resp *tokenResponse, err error) {
 	switch {
 	case result.ExpiresIn > 60*60: // 返回的过期时间大于 1 个小时, 缓冲区为 10 分钟
 		result.ExpiresIn -= 60 * 10
-		resp = &result.tokenResponse
+		resp = &tokenResponse{Token: result.Token, ExpiresIn: result.ExpiresIn}
 
 	case result.ExpiresIn > 60*30: // 返回的过期时间大于 30 分钟, 缓冲区为 5 分钟
 		result.ExpiresIn -= 60 * 5
-		resp = &result.tokenResponse
+		resp = &tokenResponse{Token: result.Token, ExpiresIn: result.ExpiresIn}
 
 	case result.ExpiresIn > 60*5: // 返回的过期时间大于 5 分钟, 缓冲区为 1 分钟
 		result.ExpiresIn -= 60
-		resp = &result.tokenResponse
+		resp = &tokenResponse{Token: result.Token, ExpiresIn: result.ExpiresIn}
 
 	case result.ExpiresIn > 60: // 返回的过期时间大于 1 分钟, 缓冲区为 10 秒
 		result.ExpiresIn -= 10
-		resp = &result.tokenResponse
+		resp = &tokenResponse{Token: result.Token, ExpiresIn: result.ExpiresIn}
 
 	case result.ExpiresIn > 0: // 没有办法了, 死马当做活马医了
-		resp = &result.tokenResponse
+		resp = &tokenResponse{Token: result.Token, ExpiresIn: result.ExpiresIn}
 
 	default:
 		err = fmt.Errorf("expires_in 应该是正整数, 现在为: %d", result.ExpiresIn)
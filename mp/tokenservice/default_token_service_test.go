@@ -0,0 +1,48 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package tokenservice
+
+import (
+	"testing"
+
+	"github.com/chanxuehong/wechat/wechattest"
+)
+
+func TestDefaultTokenService(t *testing.T) {
+	srv := wechattest.NewServer(nil)
+	defer srv.Close()
+
+	tokenService := NewDefaultTokenService(srv.AppId(), srv.AppSecret(), srv.Client())
+
+	// access_token 和 expires_in 不能因为解析的时候被忽略而为空
+	token, err := tokenService.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token == "" {
+		t.Error("Token: have empty access_token")
+	}
+	if n := srv.Calls("/cgi-bin/token"); n != 1 {
+		t.Errorf("Calls(/cgi-bin/token) = %d, want 1", n)
+	}
+
+	newToken, err := tokenService.TokenRefresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newToken == "" || newToken == token {
+		t.Errorf("TokenRefresh: have %q, old token %q", newToken, token)
+	}
+	if n := srv.Calls("/cgi-bin/token"); n != 2 {
+		t.Errorf("Calls(/cgi-bin/token) = %d, want 2", n)
+	}
+
+	// AppSecret 错误的时候 Token 返回错误
+	badService := NewDefaultTokenService(srv.AppId(), "bad secret", srv.Client())
+	if token, err = badService.Token(); err == nil {
+		t.Errorf("bad secret: Token = %q, want error", token)
+	}
+}
@@ -67,7 +67,18 @@ func AESEncryptMsg(random, rawXMLMsg []byte, AppId string, AESKey [32]byte) (enc
 	return
 }
 
+// 解密成功, 但是消息里的 AppId 和期望的不一致, 由 AESDecryptMsg 返回.
+type AppIdMismatchError struct {
+	Have string // 消息里的 AppId
+	Want string // 期望的 AppId
+}
+
+func (e *AppIdMismatchError) Error() string {
+	return fmt.Sprintf("AppId mismatch, have: %s, want: %s", e.Have, e.Want)
+}
+
 // encryptedMsg = AES_Encrypt[random(16B) + msg_len(4B) + rawXMLMsg + AppId]
+//  消息里的 AppId 不一致的时候返回 *AppIdMismatchError.
 func AESDecryptMsg(encryptedMsg []byte, AppId string, AESKey [32]byte) (random, rawXMLMsg []byte, err error) {
 	const BLOCK_SIZE = 32 // PKCS#7
 
@@ -118,7 +129,7 @@ func AESDecryptMsg(encryptedMsg []byte, AppId string, AESKey [32]byte) (random,
 
 	AppIdHave := string(plain[msgEnd:])
 	if AppIdHave != AppId { // crypto/subtle.ConstantTimeCompare ???
-		err = fmt.Errorf("AppId mismatch, have: %s, want: %s", AppIdHave, AppId)
+		err = &AppIdMismatchError{Have: AppIdHave, Want: AppId}
 		return
 	}
 
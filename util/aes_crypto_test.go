@@ -0,0 +1,39 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package util
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAESDecryptMsg(t *testing.T) {
+	var AESKey [32]byte
+	copy(AESKey[:], "0123456789abcdef0123456789abcdef")
+	random := []byte("0123456789abcdef")
+	rawXMLMsg := []byte("<xml><Content>hello</Content></xml>")
+
+	encryptedMsg := AESEncryptMsg(random, rawXMLMsg, "wx0123456789abcdef", AESKey)
+	haveRandom, haveMsg, err := AESDecryptMsg(encryptedMsg, "wx0123456789abcdef", AESKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(haveRandom, random) || !bytes.Equal(haveMsg, rawXMLMsg) {
+		t.Errorf("AESDecryptMsg: random = %q, rawXMLMsg = %q", haveRandom, haveMsg)
+	}
+
+	_, _, err = AESDecryptMsg(encryptedMsg, "wxfedcba9876543210", AESKey)
+	if e, ok := err.(*AppIdMismatchError); !ok || e.Have != "wx0123456789abcdef" || e.Want != "wxfedcba9876543210" {
+		t.Errorf("AppId mismatch: err = %#v", err)
+	}
+
+	AESKey[0] ^= 1
+	if _, _, err = AESDecryptMsg(encryptedMsg, "wx0123456789abcdef", AESKey); err == nil {
+		t.Error("wrong AESKey: want error")
+	} else if _, ok := err.(*AppIdMismatchError); ok {
+		t.Errorf("wrong AESKey: err = %#v", err)
+	}
+}
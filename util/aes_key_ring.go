@@ -0,0 +1,152 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package util
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+type previousAESKey struct {
+	key      [32]byte
+	expireAt time.Time // 零值表示不过期
+}
+
+// 保存当前的 AES key 和之前的若干个 AES key, 用于更换 EncodingAESKey 的时候不丢失用旧 key 加密的消息.
+// 之前的 key 可以设置过期时间, 过期以后不再用于解密. 并发安全.
+type AESKeyRing struct {
+	rwmutex  sync.RWMutex
+	current  [32]byte
+	previous []previousAESKey // 越新的 key 越靠前
+}
+
+// 创建一个新的 AESKeyRing, AESKey 是当前的 key.
+func NewAESKeyRing(AESKey [32]byte) *AESKeyRing {
+	return &AESKeyRing{current: AESKey}
+}
+
+// 创建一个新的 AESKeyRing, encodedAESKey 是微信管理后台的 43 个字符的 EncodingAESKey.
+func NewAESKeyRingFromEncoded(encodedAESKey string) (ring *AESKeyRing, err error) {
+	AESKey, err := decodeAESKey(encodedAESKey)
+	if err != nil {
+		return
+	}
+	ring = NewAESKeyRing(AESKey)
+	return
+}
+
+func decodeAESKey(encodedAESKey string) (AESKey [32]byte, err error) {
+	key, err := AESKeyDecode(encodedAESKey)
+	if err != nil {
+		return
+	}
+	if len(key) != 32 {
+		err = errors.New("the length of decoded AESKey must be equal to 32")
+		return
+	}
+	copy(AESKey[:], key)
+	return
+}
+
+// 当前的 AES key, 回复消息和主动发送消息的时候用这个 key 加密.
+func (ring *AESKeyRing) Current() (AESKey [32]byte) {
+	ring.rwmutex.RLock()
+	AESKey = ring.current
+	ring.rwmutex.RUnlock()
+	return
+}
+
+// 更换当前的 AES key 为 AESKey, 原来的 key 在 ttl 时间内还可以解密消息.
+//  ttl < 0 表示原来的 key 立即失效, ttl == 0 表示原来的 key 不过期.
+func (ring *AESKeyRing) Rotate(AESKey [32]byte, ttl time.Duration) {
+	ring.rwmutex.Lock()
+	defer ring.rwmutex.Unlock()
+
+	if AESKey == ring.current {
+		return
+	}
+	old := ring.current
+	ring.current = AESKey
+	ring.removePrevious(AESKey)
+
+	if ttl < 0 {
+		return
+	}
+	var expireAt time.Time
+	if ttl > 0 {
+		expireAt = time.Now().Add(ttl)
+	}
+	ring.removePrevious(old)
+	ring.previous = append([]previousAESKey{{key: old, expireAt: expireAt}}, ring.previous...)
+}
+
+// 同 Rotate, encodedAESKey 是 43 个字符的 EncodingAESKey.
+func (ring *AESKeyRing) RotateEncoded(encodedAESKey string, ttl time.Duration) (err error) {
+	AESKey, err := decodeAESKey(encodedAESKey)
+	if err != nil {
+		return
+	}
+	ring.Rotate(AESKey, ttl)
+	return
+}
+
+// 添加一个之前的 AES key, 在 expireAt 之前可以解密消息, expireAt 为零值表示不过期.
+//  比如进程重启以后从配置里恢复之前的 key. AESKey 等于当前的 key 的时候不做任何事情.
+func (ring *AESKeyRing) AddPrevious(AESKey [32]byte, expireAt time.Time) {
+	ring.rwmutex.Lock()
+	defer ring.rwmutex.Unlock()
+
+	if AESKey == ring.current {
+		return
+	}
+	ring.removePrevious(AESKey)
+	ring.previous = append(ring.previous, previousAESKey{key: AESKey, expireAt: expireAt})
+}
+
+// 删除之前的 key 里等于 AESKey 的, 调用者持有写锁
+func (ring *AESKeyRing) removePrevious(AESKey [32]byte) {
+	previous := ring.previous[:0]
+	for _, k := range ring.previous {
+		if k.key != AESKey {
+			previous = append(previous, k)
+		}
+	}
+	ring.previous = previous
+}
+
+// 所有有效的 AES key, 第一个是当前的 key, 后面是没有过期的之前的 key, 越新的越靠前.
+func (ring *AESKeyRing) Keys() (keys [][32]byte) {
+	now := time.Now()
+
+	ring.rwmutex.RLock()
+	defer ring.rwmutex.RUnlock()
+
+	keys = make([][32]byte, 1, 1+len(ring.previous))
+	keys[0] = ring.current
+	for _, k := range ring.previous {
+		if k.expireAt.IsZero() || now.Before(k.expireAt) {
+			keys = append(keys, k.key)
+		}
+	}
+	return
+}
+
+// 依次用 Keys 返回的 key 解密 encryptedMsg, 返回解密成功的 key 和它在 Keys 中的序号 index,
+// index == 0 表示当前的 key. 所有的 key 都解密失败的时候返回用当前的 key 解密的错误.
+func (ring *AESKeyRing) Decrypt(encryptedMsg []byte, AppId string) (random, rawXMLMsg []byte, AESKey [32]byte, index int, err error) {
+	keys := ring.Keys()
+	for i, key := range keys {
+		r, msg, err2 := AESDecryptMsg(encryptedMsg, AppId, key)
+		if err2 == nil {
+			return r, msg, key, i, nil
+		}
+		if i == 0 {
+			err = err2
+		}
+	}
+	return
+}
@@ -0,0 +1,60 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package util
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestAESKeyRing(t *testing.T) {
+	const appId = "wx0123456789abcdef"
+
+	if _, err := NewAESKeyRingFromEncoded("too-short"); err == nil {
+		t.Fatal("want error for invalid EncodingAESKey")
+	}
+	ring, err := NewAESKeyRingFromEncoded("abcdefghijklmnopqrstuvwxyz0123456789ABCDEFG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key1 := ring.Current()
+
+	var key2, key3 [32]byte
+	copy(key2[:], bytes.Repeat([]byte("2"), 32))
+	copy(key3[:], bytes.Repeat([]byte("3"), 32))
+
+	random := bytes.Repeat([]byte("r"), 16)
+	msg1 := AESEncryptMsg(random, []byte("<xml>1</xml>"), appId, key1)
+	msg2 := AESEncryptMsg(random, []byte("<xml>2</xml>"), appId, key2)
+
+	ring.Rotate(key2, time.Hour)
+	ring.Rotate(key3, -1) // key2 立即失效
+
+	if keys := ring.Keys(); len(keys) != 2 || keys[0] != key3 || keys[1] != key1 {
+		t.Fatalf("Keys() = %x", keys)
+	}
+
+	_, rawXMLMsg, key, index, err := ring.Decrypt(msg1, appId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rawXMLMsg) != "<xml>1</xml>" || key != key1 || index != 1 {
+		t.Fatalf("Decrypt = %q, %x, %d", rawXMLMsg, key, index)
+	}
+	if _, _, _, _, err = ring.Decrypt(msg2, appId); err == nil {
+		t.Fatal("want error for expired key")
+	}
+
+	ring.AddPrevious(key2, time.Now().Add(-time.Second)) // 已经过期
+	if keys := ring.Keys(); len(keys) != 2 {
+		t.Fatalf("Keys() = %x", keys)
+	}
+	ring.AddPrevious(key2, time.Time{})
+	if _, _, key, index, err = ring.Decrypt(msg2, appId); err != nil || key != key2 || index != 2 {
+		t.Fatalf("Decrypt = %x, %d, %v", key, index, err)
+	}
+}
@@ -0,0 +1,117 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const (
+	ArchiveInbound  = "inbound"  // 微信服务器推送过来的消息(事件)和我们的回复
+	ArchiveOutbound = "outbound" // 主动发送的消息: 客服消息, 模板消息, 群发消息
+)
+
+// 存档的一条记录, 对应一个推送过来的消息(事件)或者一次主动发送的消息.
+type ArchiveRecord struct {
+	Direction  string          `json:"direction"`            // ArchiveInbound 或者 ArchiveOutbound
+	Source     string          `json:"source"`               // "mp" 或者 "corp"
+	Kind       string          `json:"kind,omitempty"`       // 主动发送的消息的种类, 比如 "custom", "template", "mass_by_openid"
+	AccountId  string          `json:"account_id,omitempty"` // 接收消息的帐号, 公众号原始ID 或者企业号的 CorpId; 主动发送的消息为空
+	AgentId    int64           `json:"agent_id,omitempty"`   // 企业号应用的 AgentId, 公众号为 0
+	OpenId     string          `json:"openid,omitempty"`     // 推送的消息的 FromUserName, 主动发送的消息的 touser
+	OpenIds    []string        `json:"openids,omitempty"`    // 根据用户列表群发的 touser
+	MsgType    string          `json:"msg_type"`
+	Event      string          `json:"event,omitempty"`  // 事件类型, 只有事件才有
+	MsgId      int64           `json:"msg_id,omitempty"` // 推送的消息的 MsgId, 模板消息和群发消息返回的 msgid
+	CreateTime int64           `json:"create_time,omitempty"`
+	RawXMLMsg  string          `json:"raw_xml,omitempty"`   // 推送的 "明文" xml 消息体
+	Msg        json.RawMessage `json:"msg,omitempty"`       // 推送的消息解析后的 request.Request 结构体, 或者主动发送的 json 消息体
+	Reply      string          `json:"reply,omitempty"`     // 回复微信服务器的 http body
+	ReplyXML   string          `json:"reply_xml,omitempty"` // 加密模式下解密以后的 "明文" 回复
+	Latency    time.Duration   `json:"latency"`             // Agent 处理的时间, 或者调用发送接口的时间
+	Error      string          `json:"error,omitempty"`     // 主动发送失败的错误
+	ArchivedAt time.Time       `json:"archived_at"`
+}
+
+// 消息存档的存储, 实现要并发安全.
+type ArchiveStore interface {
+	// 追加一条记录, 返回的错误只记录日志, 不影响消息的处理.
+	Append(record *ArchiveRecord) error
+	// 查询满足条件 query 的记录, 按照存档的先后排序.
+	Query(query *ArchiveQuery) ([]*ArchiveRecord, error)
+}
+
+// 存档的查询条件, 零值的字段表示不限制.
+type ArchiveQuery struct {
+	Direction string
+	Source    string
+	AccountId string
+	OpenId    string // 匹配 ArchiveRecord.OpenId 或者 ArchiveRecord.OpenIds 里的任何一个
+	MsgType   string
+	Event     string
+	Start     time.Time // ArchivedAt >= Start
+	End       time.Time // ArchivedAt < End
+	Limit     int       // 最多返回的记录数, <= 0 表示不限制
+}
+
+// 判断记录 record 是否满足查询条件.
+func (query *ArchiveQuery) Match(record *ArchiveRecord) bool {
+	if query.Direction != "" && query.Direction != record.Direction {
+		return false
+	}
+	if query.Source != "" && query.Source != record.Source {
+		return false
+	}
+	if query.AccountId != "" && query.AccountId != record.AccountId {
+		return false
+	}
+	if query.MsgType != "" && query.MsgType != record.MsgType {
+		return false
+	}
+	if query.Event != "" && query.Event != record.Event {
+		return false
+	}
+	if !query.Start.IsZero() && record.ArchivedAt.Before(query.Start) {
+		return false
+	}
+	if !query.End.IsZero() && !record.ArchivedAt.Before(query.End) {
+		return false
+	}
+	if query.OpenId != "" && query.OpenId != record.OpenId {
+		for _, openid := range record.OpenIds {
+			if openid == query.OpenId {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// 保存写入的 http body 的 http.ResponseWriter
+type captureResponseWriter struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *captureResponseWriter) Write(p []byte) (n int, err error) {
+	n, err = w.ResponseWriter.Write(p)
+	w.body.Write(p[:n])
+	return
+}
+
+// 调用 serve 处理请求, 返回写入 w 的 http body 和处理时间, 用于存档回复的消息.
+func CaptureServe(w http.ResponseWriter, serve func(w http.ResponseWriter)) (body []byte, latency time.Duration) {
+	cw := &captureResponseWriter{ResponseWriter: w}
+	start := time.Now()
+	serve(cw)
+	latency = time.Since(start)
+	body = cw.body.Bytes()
+	return
+}
@@ -0,0 +1,177 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const archiveFileDateLayout = "20060102"
+
+// 把记录以 JSON Lines 的格式追加到本地文件的 ArchiveStore, 只追加不修改.
+// 每天(按照 ArchivedAt 的 UTC 日期)一个文件 dir/archive-{yyyymmdd}.jsonl, 按照时间查询的时候只读取相关日期的文件.
+// 并发安全.
+type FileArchiveStore struct {
+	dir string
+
+	mutex sync.Mutex
+	file  *os.File
+	date  string // file 的日期
+}
+
+// 创建一个新的 FileArchiveStore, dir 不存在则创建.
+func NewFileArchiveStore(dir string) (*FileArchiveStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileArchiveStore{dir: dir}, nil
+}
+
+func (s *FileArchiveStore) path(date string) string {
+	return filepath.Join(s.dir, "archive-"+date+".jsonl")
+}
+
+// 打开(或者新建) date 的文件, 调用者持有锁
+func (s *FileArchiveStore) open(date string) error {
+	if s.file != nil {
+		if s.date == date {
+			return nil
+		}
+		s.file.Close()
+		s.file = nil
+	}
+
+	file, err := os.OpenFile(s.path(date), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	// 进程崩溃的时候可能写了半行, 补一个换行, 不影响后面追加的记录
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if size := info.Size(); size > 0 {
+		last := make([]byte, 1)
+		if _, err = file.ReadAt(last, size-1); err != nil {
+			file.Close()
+			return err
+		}
+		if last[0] != '\n' {
+			if _, err = file.Write([]byte{'\n'}); err != nil {
+				file.Close()
+				return err
+			}
+		}
+	}
+
+	s.file = file
+	s.date = date
+	return nil
+}
+
+// 追加一条记录, record.ArchivedAt 为零值则设置为当前时间.
+func (s *FileArchiveStore) Append(record *ArchiveRecord) error {
+	if record.ArchivedAt.IsZero() {
+		record.ArchivedAt = time.Now()
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err = s.open(record.ArchivedAt.UTC().Format(archiveFileDateLayout)); err != nil {
+		return err
+	}
+	_, err = s.file.Write(line)
+	return err
+}
+
+// 查询满足条件 query 的记录, 按照日期和追加的先后排序.
+//  NOTE: 不能解析的行(进程崩溃的时候写了一半的记录)会被跳过.
+func (s *FileArchiveStore) Query(query *ArchiveQuery) (records []*ArchiveRecord, err error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "archive-*.jsonl"))
+	if err != nil {
+		return
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		name := filepath.Base(path)
+		date, err2 := time.Parse(archiveFileDateLayout, strings.TrimSuffix(strings.TrimPrefix(name, "archive-"), ".jsonl"))
+		if err2 != nil {
+			continue
+		}
+		if !query.Start.IsZero() && !date.Add(24*time.Hour).After(query.Start) {
+			continue
+		}
+		if !query.End.IsZero() && !date.Before(query.End) {
+			continue
+		}
+
+		if records, err = s.queryFile(path, query, records); err != nil {
+			return
+		}
+		if query.Limit > 0 && len(records) >= query.Limit {
+			return
+		}
+	}
+	return
+}
+
+// 把文件 path 里满足条件 query 的记录追加到 records
+func (s *FileArchiveStore) queryFile(path string, query *ArchiveQuery, records []*ArchiveRecord) ([]*ArchiveRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return records, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			record := new(ArchiveRecord)
+			if json.Unmarshal(line, record) == nil && query.Match(record) {
+				records = append(records, record)
+				if query.Limit > 0 && len(records) >= query.Limit {
+					return records, nil
+				}
+			}
+		}
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+	}
+}
+
+// 关闭正在写的文件, 之后调用 Append 会重新打开.
+func (s *FileArchiveStore) Close() (err error) {
+	s.mutex.Lock()
+	if s.file != nil {
+		err = s.file.Close()
+		s.file = nil
+	}
+	s.mutex.Unlock()
+	return
+}
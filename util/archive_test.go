@@ -0,0 +1,89 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileArchiveStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wechat-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewFileArchiveStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day1 := time.Date(2015, 3, 1, 10, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	records := []*ArchiveRecord{
+		{Direction: ArchiveInbound, Source: "mp", OpenId: "alice", MsgType: "text", ArchivedAt: day1},
+		{Direction: ArchiveInbound, Source: "mp", OpenId: "bob", MsgType: "event", Event: "subscribe", ArchivedAt: day1.Add(time.Hour)},
+		{Direction: ArchiveOutbound, Source: "mp", Kind: "mass_by_openid", OpenIds: []string{"alice", "bob"}, MsgType: "text", ArchivedAt: day2},
+		{Direction: ArchiveInbound, Source: "mp", OpenId: "alice", MsgType: "image", ArchivedAt: day2.Add(time.Hour)},
+	}
+	for _, record := range records {
+		if err = store.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟进程崩溃的时候写了半行
+	file, err := os.OpenFile(filepath.Join(dir, "archive-20150302.jsonl"), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"direction":"inbound","openid":"alice`)
+	file.Close()
+	if err = store.Append(&ArchiveRecord{Direction: ArchiveInbound, Source: "mp", OpenId: "alice", MsgType: "voice", ArchivedAt: day2.Add(2 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query ArchiveQuery
+		want  []string // MsgType
+	}{
+		{ArchiveQuery{}, []string{"text", "event", "text", "image", "voice"}},
+		{ArchiveQuery{OpenId: "alice"}, []string{"text", "text", "image", "voice"}},
+		{ArchiveQuery{OpenId: "bob", Start: day1.Add(time.Minute)}, []string{"event", "text"}},
+		{ArchiveQuery{MsgType: "text", End: day2}, []string{"text"}},
+		{ArchiveQuery{Start: day2, End: day2.Add(2 * time.Hour)}, []string{"text", "image"}},
+		{ArchiveQuery{Direction: ArchiveOutbound}, []string{"text"}},
+		{ArchiveQuery{OpenId: "alice", Limit: 2}, []string{"text", "text"}},
+		{ArchiveQuery{Start: day2.Add(24 * time.Hour)}, nil},
+	}
+	for i, tt := range tests {
+		have, err := store.Query(&tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var haveTypes []string
+		for _, record := range have {
+			haveTypes = append(haveTypes, record.MsgType)
+		}
+		if len(haveTypes) != len(tt.want) {
+			t.Errorf("#%d: have %v, want %v", i, haveTypes, tt.want)
+			continue
+		}
+		for j := range haveTypes {
+			if haveTypes[j] != tt.want[j] {
+				t.Errorf("#%d: have %v, want %v", i, haveTypes, tt.want)
+				break
+			}
+		}
+	}
+}
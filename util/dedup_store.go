@@ -0,0 +1,107 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package util
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultDedupStoreSize = 10000 // 默认的 LRUDedupStore 容量
+	// 默认的去重有效期, 微信服务器 5 秒内收不到回复会重试, 最多重试三次, 一分钟足够覆盖所有的重试
+	DefaultDedupTTL = time.Minute
+)
+
+// 消息去重的存储, 用于过滤微信服务器重试推送的消息, 可以用 redis 等实现多个服务器之间共享.
+type DedupStore interface {
+	// key 不存在或者已经过期则保存 key 并返回 true, 否则返回 false;
+	// 返回错误的时候调用者会当作不重复的消息处理.
+	Add(key string) (added bool, err error)
+}
+
+// 可以删除 key 的 DedupStore, ReplayGuard.ReleaseNonce 用它撤销已经记录的 nonce.
+type RemovableDedupStore interface {
+	DedupStore
+	// 删除 key, key 不存在的时候什么也不做.
+	Remove(key string) error
+}
+
+type lruDedupEntry struct {
+	key      string
+	expireAt time.Time
+}
+
+// 基于内存的 LRU DedupStore, 并发安全.
+//  超过容量的时候淘汰最早添加的 key, 所以容量要大于 ttl 时间内可能收到的消息数量.
+type LRUDedupStore struct {
+	mutex   sync.Mutex
+	size    int
+	ttl     time.Duration
+	list    *list.List               // 元素是 *lruDedupEntry, 最近添加的在前面
+	entries map[string]*list.Element // map[key]element
+}
+
+// 创建一个新的 LRUDedupStore, size 是容量, ttl 是 key 的有效期, 都要大于 0.
+func NewLRUDedupStore(size int, ttl time.Duration) *LRUDedupStore {
+	if size <= 0 {
+		panic("size must be positive")
+	}
+	if ttl <= 0 {
+		panic("ttl must be positive")
+	}
+
+	return &LRUDedupStore{
+		size:    size,
+		ttl:     ttl,
+		list:    list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (store *LRUDedupStore) Add(key string) (added bool, err error) {
+	now := time.Now()
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if elem := store.entries[key]; elem != nil {
+		entry := elem.Value.(*lruDedupEntry)
+		if now.Before(entry.expireAt) {
+			return false, nil
+		}
+		entry.expireAt = now.Add(store.ttl)
+		store.list.MoveToFront(elem)
+		return true, nil
+	}
+
+	store.entries[key] = store.list.PushFront(&lruDedupEntry{key: key, expireAt: now.Add(store.ttl)})
+	for store.list.Len() > store.size {
+		elem := store.list.Back()
+		store.list.Remove(elem)
+		delete(store.entries, elem.Value.(*lruDedupEntry).key)
+	}
+	return true, nil
+}
+
+func (store *LRUDedupStore) Remove(key string) error {
+	store.mutex.Lock()
+	if elem := store.entries[key]; elem != nil {
+		store.list.Remove(elem)
+		delete(store.entries, key)
+	}
+	store.mutex.Unlock()
+	return nil
+}
+
+// 当前保存的 key 的数量, 包括已经过期但是还没有被淘汰的.
+func (store *LRUDedupStore) Len() int {
+	store.mutex.Lock()
+	n := store.list.Len()
+	store.mutex.Unlock()
+	return n
+}
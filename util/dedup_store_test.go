@@ -0,0 +1,41 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUDedupStore(t *testing.T) {
+	store := NewLRUDedupStore(2, 50*time.Millisecond)
+
+	add := func(key string, want bool) {
+		added, err := store.Add(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if added != want {
+			t.Fatalf("Add(%q) = %t, want %t", key, added, want)
+		}
+	}
+
+	add("a", true)
+	add("a", false)
+	add("b", true)
+	add("c", true) // 淘汰 a
+	if store.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", store.Len())
+	}
+	add("a", true)
+	add("c", false)
+	store.Remove("c")
+	add("c", true)
+
+	time.Sleep(60 * time.Millisecond)
+	add("c", true) // 过期
+	add("c", false)
+}
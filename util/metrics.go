@@ -0,0 +1,58 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package util
+
+import (
+	"net/http"
+	"time"
+)
+
+// 服务端的统计信息, 由 mp/server, corp/server 的 AgentFrontend, MultiAgentFrontend
+// 和微信支付的通知 Handler 报告, 可以对接 Prometheus, StatsD 等. 实现要并发安全.
+type ServerMetrics interface {
+	// 每一个通过校验的请求交给 Agent 处理完成后调用
+	ObserveMsg(stat *MsgStat)
+	// 每一个非法请求调用一次, source 同 MsgStat.Source, reason 是各个包的 InvalidRequestReason(err)
+	ObserveInvalidRequest(source, reason string)
+}
+
+// 一次请求的统计信息
+type MsgStat struct {
+	Source    string        // 请求的来源, "mp", "corp", "pay2" 或者 "pay3"
+	MsgType   string        // 消息类型; 微信支付的通知是通知的种类, 比如 "order_notify"
+	Event     string        // 事件类型, 只有事件才有
+	Encrypted bool          // 消息是否加密, 公众号的兼容模式, 安全模式和企业号为 true
+	Latency   time.Duration // Agent 处理的时间
+	ReplySize int           // 回复的 http body 的字节数
+}
+
+// 统计写入的字节数的 http.ResponseWriter
+type countingResponseWriter struct {
+	http.ResponseWriter
+	n int
+}
+
+func (w *countingResponseWriter) Write(p []byte) (n int, err error) {
+	n, err = w.ResponseWriter.Write(p)
+	w.n += n
+	return
+}
+
+// 调用 serve 处理请求, 把处理时间和回复的字节数填入 stat 以后报告给 metrics.
+//  metrics 为 nil 则直接调用 serve(w).
+func ObserveServe(metrics ServerMetrics, stat *MsgStat, w http.ResponseWriter, serve func(w http.ResponseWriter)) {
+	if metrics == nil {
+		serve(w)
+		return
+	}
+
+	cw := &countingResponseWriter{ResponseWriter: w}
+	start := time.Now()
+	serve(cw)
+	stat.Latency = time.Since(start)
+	stat.ReplySize = cw.n
+	metrics.ObserveMsg(stat)
+}
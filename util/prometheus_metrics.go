@@ -0,0 +1,230 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// 默认的处理时间的 histogram 分桶, 单位为秒
+	DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+	// 默认的回复大小的 histogram 分桶, 单位为字节
+	DefaultReplySizeBuckets = []float64{0, 64, 256, 1024, 4096, 16384, 65536}
+)
+
+type histogram struct {
+	counts []uint64 // 和 buckets 一一对应, 不累加
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(buckets []float64, v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(buckets))
+	}
+	if i := sort.SearchFloat64s(buckets, v); i < len(buckets) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+// ServerMetrics 的实现, 同时是 http.Handler, 以 Prometheus 的文本格式输出统计信息, 不依赖 Prometheus 的客户端库.
+// 并发安全. 输出的指标(namespace 默认为 wechat):
+//  wechat_messages_total{source,msg_type,event,encrypted}      处理的消息(事件)数
+//  wechat_invalid_requests_total{source,reason}               非法请求数
+//  wechat_handler_duration_seconds{source,msg_type}           Agent 处理的时间, histogram
+//  wechat_reply_size_bytes{source,msg_type}                   回复的字节数, histogram
+//
+//  http.Handle("/metrics", metrics)
+type PrometheusMetrics struct {
+	namespace        string
+	latencyBuckets   []float64
+	replySizeBuckets []float64
+
+	mutex     sync.Mutex
+	msgs      map[[4]string]uint64 // map[{source,msg_type,event,encrypted}]count
+	invalid   map[[2]string]uint64 // map[{source,reason}]count
+	latency   map[[2]string]*histogram
+	replySize map[[2]string]*histogram
+}
+
+var _ ServerMetrics = new(PrometheusMetrics)
+
+// 创建一个新的 PrometheusMetrics, namespace 是指标名称的前缀, 为空则用 "wechat".
+//  latencyBuckets, replySizeBuckets 是 histogram 的分桶, 从小到大排列, 为 nil 则用 DefaultLatencyBuckets, DefaultReplySizeBuckets.
+func NewPrometheusMetrics(namespace string, latencyBuckets, replySizeBuckets []float64) *PrometheusMetrics {
+	if namespace == "" {
+		namespace = "wechat"
+	}
+	if latencyBuckets == nil {
+		latencyBuckets = DefaultLatencyBuckets
+	}
+	if replySizeBuckets == nil {
+		replySizeBuckets = DefaultReplySizeBuckets
+	}
+	if !sort.Float64sAreSorted(latencyBuckets) || !sort.Float64sAreSorted(replySizeBuckets) {
+		panic("buckets must be sorted in increasing order")
+	}
+
+	return &PrometheusMetrics{
+		namespace:        namespace,
+		latencyBuckets:   latencyBuckets,
+		replySizeBuckets: replySizeBuckets,
+		msgs:             make(map[[4]string]uint64),
+		invalid:          make(map[[2]string]uint64),
+		latency:          make(map[[2]string]*histogram),
+		replySize:        make(map[[2]string]*histogram),
+	}
+}
+
+func (m *PrometheusMetrics) ObserveMsg(stat *MsgStat) {
+	key := [2]string{stat.Source, stat.MsgType}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.msgs[[4]string{stat.Source, stat.MsgType, stat.Event, strconv.FormatBool(stat.Encrypted)}]++
+
+	h := m.latency[key]
+	if h == nil {
+		h = new(histogram)
+		m.latency[key] = h
+	}
+	h.observe(m.latencyBuckets, stat.Latency.Seconds())
+
+	if h = m.replySize[key]; h == nil {
+		h = new(histogram)
+		m.replySize[key] = h
+	}
+	h.observe(m.replySizeBuckets, float64(stat.ReplySize))
+}
+
+func (m *PrometheusMetrics) ObserveInvalidRequest(source, reason string) {
+	m.mutex.Lock()
+	m.invalid[[2]string{source, reason}]++
+	m.mutex.Unlock()
+}
+
+// 以 Prometheus 的文本格式输出所有的统计信息
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(m.Bytes())
+}
+
+// 返回 Prometheus 文本格式的统计信息
+func (m *PrometheusMetrics) Bytes() []byte {
+	var buf bytes.Buffer
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	name := m.namespace + "_messages_total"
+	fmt.Fprintf(&buf, "# HELP %s Messages and events handled by the agents.\n# TYPE %s counter\n", name, name)
+	msgKeys := make([][4]string, 0, len(m.msgs))
+	for key := range m.msgs {
+		msgKeys = append(msgKeys, key)
+	}
+	sort.Sort(msgKeySlice(msgKeys))
+	for _, key := range msgKeys {
+		fmt.Fprintf(&buf, "%s{%s} %d\n", name,
+			formatLabels([]string{"source", "msg_type", "event", "encrypted"}, key[:]), m.msgs[key])
+	}
+
+	name = m.namespace + "_invalid_requests_total"
+	fmt.Fprintf(&buf, "# HELP %s Invalid requests rejected, by reason.\n# TYPE %s counter\n", name, name)
+	invalidKeys := sortedKeys(m.invalid)
+	for _, key := range invalidKeys {
+		fmt.Fprintf(&buf, "%s{%s} %d\n", name, formatLabels([]string{"source", "reason"}, key[:]), m.invalid[key])
+	}
+
+	writeHistograms(&buf, m.namespace+"_handler_duration_seconds", "Time spent by the agents handling messages.",
+		m.latencyBuckets, m.latency)
+	writeHistograms(&buf, m.namespace+"_reply_size_bytes", "Size of the reply http body.",
+		m.replySizeBuckets, m.replySize)
+
+	return buf.Bytes()
+}
+
+func writeHistograms(buf *bytes.Buffer, name, help string, buckets []float64, histograms map[[2]string]*histogram) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	names := []string{"source", "msg_type", "le"}
+	for _, key := range sortedHistogramKeys(histograms) {
+		h := histograms[key]
+		var cumulative uint64
+		for i, le := range buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(buf, "%s_bucket{%s} %d\n", name,
+				formatLabels(names, []string{key[0], key[1], strconv.FormatFloat(le, 'g', -1, 64)}), cumulative)
+		}
+		fmt.Fprintf(buf, "%s_bucket{%s} %d\n", name, formatLabels(names, []string{key[0], key[1], "+Inf"}), h.count)
+		fmt.Fprintf(buf, "%s_sum{%s} %s\n", name, formatLabels(names[:2], key[:]), strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(buf, "%s_count{%s} %d\n", name, formatLabels(names[:2], key[:]), h.count)
+	}
+}
+
+func sortedKeys(m map[[2]string]uint64) [][2]string {
+	keys := make([][2]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Sort(labelKeySlice(keys))
+	return keys
+}
+
+func sortedHistogramKeys(m map[[2]string]*histogram) [][2]string {
+	keys := make([][2]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Sort(labelKeySlice(keys))
+	return keys
+}
+
+// 按照标签的值排序, 输出的顺序才是固定的
+type msgKeySlice [][4]string
+
+func (s msgKeySlice) Len() int           { return len(s) }
+func (s msgKeySlice) Less(i, j int) bool { return lessKey(s[i][:], s[j][:]) }
+func (s msgKeySlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+type labelKeySlice [][2]string
+
+func (s labelKeySlice) Len() int           { return len(s) }
+func (s labelKeySlice) Less(i, j int) bool { return lessKey(s[i][:], s[j][:]) }
+func (s labelKeySlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func lessKey(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string) string {
+	var buf bytes.Buffer
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(name)
+		buf.WriteString(`="`)
+		buf.WriteString(labelValueReplacer.Replace(values[i]))
+		buf.WriteByte('"')
+	}
+	return buf.String()
+}
@@ -0,0 +1,49 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package util
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	metrics := NewPrometheusMetrics("", []float64{0.1, 1}, []float64{10})
+
+	metrics.ObserveMsg(&MsgStat{Source: "mp", MsgType: "text", Encrypted: true, Latency: 50 * time.Millisecond, ReplySize: 5})
+	metrics.ObserveMsg(&MsgStat{Source: "mp", MsgType: "text", Encrypted: true, Latency: 2 * time.Second, ReplySize: 20})
+	metrics.ObserveMsg(&MsgStat{Source: "mp", MsgType: "event", Event: "CLICK"})
+	metrics.ObserveInvalidRequest("mp", "signature")
+	metrics.ObserveInvalidRequest("pay3", `a"b`)
+
+	w := httptest.NewRecorder()
+	metrics.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	body := w.Body.String()
+	for _, line := range []string{
+		"# TYPE wechat_messages_total counter",
+		`wechat_messages_total{source="mp",msg_type="event",event="CLICK",encrypted="false"} 1`,
+		`wechat_messages_total{source="mp",msg_type="text",event="",encrypted="true"} 2`,
+		`wechat_invalid_requests_total{source="mp",reason="signature"} 1`,
+		`wechat_invalid_requests_total{source="pay3",reason="a\"b"} 1`,
+		"# TYPE wechat_handler_duration_seconds histogram",
+		`wechat_handler_duration_seconds_bucket{source="mp",msg_type="text",le="0.1"} 1`,
+		`wechat_handler_duration_seconds_bucket{source="mp",msg_type="text",le="1"} 1`,
+		`wechat_handler_duration_seconds_bucket{source="mp",msg_type="text",le="+Inf"} 2`,
+		`wechat_handler_duration_seconds_count{source="mp",msg_type="text"} 2`,
+		`wechat_reply_size_bytes_bucket{source="mp",msg_type="text",le="10"} 1`,
+		`wechat_reply_size_bytes_sum{source="mp",msg_type="text"} 25`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, body)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// 发布到 Publisher 的消息(事件), 已经通过校验并且解密.
+type PublishedMsg struct {
+	Source       string          `json:"source"`             // 消息的来源, "mp" 或者 "corp"
+	AccountId    string          `json:"account_id"`         // 接收消息的帐号, 公众号原始ID 或者企业号的 CorpId
+	AgentId      int64           `json:"agent_id,omitempty"` // 企业号应用的 AgentId, 公众号为 0
+	MsgType      string          `json:"msg_type"`
+	Event        string          `json:"event,omitempty"` // 事件类型, 只有事件才有
+	FromUserName string          `json:"from_user_name"`
+	CreateTime   int64           `json:"create_time"`
+	RawXMLMsg    string          `json:"raw_xml"`     // "明文" xml 消息体
+	Msg          json.RawMessage `json:"msg"`         // 消息的 json 格式, 是解析后的 request.Request 结构体
+	ReceivedAt   time.Time       `json:"received_at"` // 收到消息的时间
+}
+
+// 消息的发布者, 比如消息队列, 用于在其他的服务里异步处理消息. 实现要并发安全.
+//  NOTE: Publish 在回复微信服务器之前同步调用, 和 Agent 的处理共用微信服务器 5 秒的超时
+//  (mp/server, corp/server 的 Async 中间件默认还要占用 4 秒), 所以 Publish 要在 1 秒以内返回,
+//  最好是几百毫秒; 超时以后微信服务器重试推送, 开启了重复消息过滤的话重试的消息会被丢弃.
+//  耗时不确定的发布(比如调用远程服务)可以先发送到 ChanPublisher, 在后台的 goroutine 里转发.
+type Publisher interface {
+	// 发布消息 msg, 在回复微信服务器之前调用, 见上面的说明; 返回的错误只记录日志, 不影响消息的处理.
+	Publish(msg *PublishedMsg) error
+}
+
+type PublisherFunc func(msg *PublishedMsg) error
+
+func (fn PublisherFunc) Publish(msg *PublishedMsg) error {
+	return fn(msg)
+}
+
+var ErrPublisherFull = errors.New("wechat: the publisher channel is full")
+
+// 把消息发送到 channel C 的 Publisher, 在同一个进程里异步处理消息.
+type ChanPublisher struct {
+	C       chan *PublishedMsg
+	timeout time.Duration
+}
+
+// 创建一个新的 ChanPublisher, size 是 channel 的缓冲大小;
+//  channel 满的时候最多等待 timeout, 超时返回 ErrPublisherFull, timeout <= 0 表示不等待.
+func NewChanPublisher(size int, timeout time.Duration) *ChanPublisher {
+	if size < 0 {
+		panic("size must be non-negative")
+	}
+	return &ChanPublisher{
+		C:       make(chan *PublishedMsg, size),
+		timeout: timeout,
+	}
+}
+
+func (p *ChanPublisher) Publish(msg *PublishedMsg) error {
+	if p.timeout <= 0 {
+		select {
+		case p.C <- msg:
+			return nil
+		default:
+			return ErrPublisherFull
+		}
+	}
+
+	timer := time.NewTimer(p.timeout)
+	defer timer.Stop()
+	select {
+	case p.C <- msg:
+		return nil
+	case <-timer.C:
+		return ErrPublisherFull
+	}
+}
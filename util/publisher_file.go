@@ -0,0 +1,134 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package util
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const DefaultSpoolFileMaxSize = 64 << 20 // 默认的 spool 文件的最大字节数
+
+// 把消息以 JSON Lines 的格式追加到本地文件的 Publisher, 由其他的进程读取处理.
+// 正在写的文件是 dir/messages.jsonl, 超过 maxSize 的时候改名为 dir/messages-{unixnano}.jsonl 并且新建一个文件,
+// 读取的进程只处理改过名的文件就不会读到写了一半的行. 并发安全.
+type FileSpoolPublisher struct {
+	dir     string
+	maxSize int64
+
+	mutex sync.Mutex
+	file  *os.File
+	size  int64
+}
+
+// 创建一个新的 FileSpoolPublisher, dir 不存在则创建; maxSize <= 0 则用 DefaultSpoolFileMaxSize.
+func NewFileSpoolPublisher(dir string, maxSize int64) (*FileSpoolPublisher, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultSpoolFileMaxSize
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	p := &FileSpoolPublisher{
+		dir:     dir,
+		maxSize: maxSize,
+	}
+	if err := p.open(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *FileSpoolPublisher) currentPath() string {
+	return filepath.Join(p.dir, "messages.jsonl")
+}
+
+// 打开(或者新建)正在写的文件, 调用者持有锁
+func (p *FileSpoolPublisher) open() error {
+	file, err := os.OpenFile(p.currentPath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	p.file = file
+	p.size = info.Size()
+	return nil
+}
+
+func (p *FileSpoolPublisher) Publish(msg *PublishedMsg) error {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.file == nil {
+		if err = p.open(); err != nil {
+			return err
+		}
+	}
+	if p.size > 0 && p.size+int64(len(line)) > p.maxSize {
+		if err = p.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := p.file.Write(line)
+	p.size += int64(n)
+	return err
+}
+
+// 把正在写的文件改名并且新建一个, 调用者持有锁
+func (p *FileSpoolPublisher) rotate() error {
+	if err := p.file.Close(); err != nil {
+		return err
+	}
+	p.file = nil
+
+	rotated := filepath.Join(p.dir, "messages-"+strconv.FormatInt(time.Now().UnixNano(), 10)+".jsonl")
+	if err := os.Rename(p.currentPath(), rotated); err != nil {
+		return err
+	}
+	return p.open()
+}
+
+// 马上改名正在写的文件, 比如定时调用, 让读取的进程及时处理; 文件是空的时候不做任何事情.
+func (p *FileSpoolPublisher) Rotate() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.file == nil {
+		if err := p.open(); err != nil {
+			return err
+		}
+	}
+	if p.size == 0 {
+		return nil
+	}
+	return p.rotate()
+}
+
+// 关闭正在写的文件, 之后调用 Publish 会重新打开.
+func (p *FileSpoolPublisher) Close() (err error) {
+	p.mutex.Lock()
+	if p.file != nil {
+		err = p.file.Close()
+		p.file = nil
+	}
+	p.mutex.Unlock()
+	return
+}
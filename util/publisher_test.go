@@ -0,0 +1,103 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package util
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChanPublisher(t *testing.T) {
+	p := NewChanPublisher(1, 0)
+	msg := &PublishedMsg{MsgType: "text"}
+	if err := p.Publish(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Publish(msg); err != ErrPublisherFull {
+		t.Fatalf("err = %v, want ErrPublisherFull", err)
+	}
+	if got := <-p.C; got != msg {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestFileSpoolPublisher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wechat-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p, err := NewFileSpoolPublisher(dir, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err = p.Publish(&PublishedMsg{MsgType: "text", FromUserName: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rotated, err := filepath.Glob(filepath.Join(dir, "messages-*.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) == 0 {
+		t.Fatal("want rotated files")
+	}
+
+	var ids []string
+	for _, name := range append(rotated, filepath.Join(dir, "messages.jsonl")) {
+		file, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var msg PublishedMsg
+			if err = json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, msg.FromUserName)
+		}
+		file.Close()
+	}
+	if len(ids) != 3 {
+		t.Fatalf("ids = %v", ids)
+	}
+}
+
+func TestWebhookPublisher(t *testing.T) {
+	secret := []byte("secret")
+	var got PublishedMsg
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if !CheckWebhookSignature(secret, body, r.Header.Get(WebhookSignatureHeader)) {
+			http.Error(w, "bad signature", http.StatusForbidden)
+			return
+		}
+		json.Unmarshal(body, &got)
+	}))
+	defer server.Close()
+
+	if err := NewWebhookPublisher(server.URL, secret, nil).Publish(&PublishedMsg{MsgType: "text"}); err != nil {
+		t.Fatal(err)
+	}
+	if got.MsgType != "text" {
+		t.Errorf("got %+v", got)
+	}
+	if err := NewWebhookPublisher(server.URL, []byte("wrong"), nil).Publish(&PublishedMsg{}); err == nil {
+		t.Error("want error for bad signature")
+	}
+}
@@ -0,0 +1,94 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package util
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const (
+	// WebhookPublisher 请求里 body 签名的 http header, 值为 "sha256=" + hex(HMAC-SHA256(secret, body))
+	WebhookSignatureHeader = "X-Wechat-Signature"
+
+	// NewWebhookPublisher 默认的 http.Client 的超时, 见 Publisher 的说明
+	DefaultWebhookTimeout = 500 * time.Millisecond
+)
+
+// 把消息 POST 到 webhook 的 Publisher, body 是 PublishedMsg 的 JSON,
+// 用 HMAC-SHA256 签名以后放在 WebhookSignatureHeader 里, 接收方可以用 CheckWebhookSignature 校验.
+type WebhookPublisher struct {
+	url        string
+	secret     []byte
+	httpClient *http.Client
+}
+
+// 创建一个新的 WebhookPublisher, url 和 secret 不能为空;
+//  httpClient 为 nil 则使用超时为 DefaultWebhookTimeout 的 http.Client, 这样不会耽误回复微信服务器;
+//  自己设置 httpClient 的时候超时也不要超过 1 秒.
+func NewWebhookPublisher(url string, secret []byte, httpClient *http.Client) *WebhookPublisher {
+	if url == "" {
+		panic(`url == ""`)
+	}
+	if len(secret) == 0 {
+		panic("empty secret")
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultWebhookTimeout}
+	}
+
+	return &WebhookPublisher{
+		url:        url,
+		secret:     secret,
+		httpClient: httpClient,
+	}
+}
+
+func (p *WebhookPublisher) Publish(msg *PublishedMsg) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set(WebhookSignatureHeader, WebhookSignature(p.secret, body))
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook %s: http.Status: %s", p.url, resp.Status)
+	}
+	return nil
+}
+
+// 计算 body 的签名, 格式为 "sha256=" + hex(HMAC-SHA256(secret, body)).
+func WebhookSignature(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// 校验 webhook 请求的签名 signature(WebhookSignatureHeader 的值), 用于接收方.
+func CheckWebhookSignature(secret, body []byte, signature string) bool {
+	return hmac.Equal([]byte(signature), []byte(WebhookSignature(secret, body)))
+}
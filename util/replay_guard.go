@@ -0,0 +1,86 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const DefaultReplayWindow = 5 * time.Minute // 默认允许的请求时间戳和本地时间的最大偏差
+
+// 重放的请求, 由 ReplayGuard 返回, 可以在 InvalidRequestHandler 里用类型断言区分.
+type ReplayError struct {
+	Timestamp int64  // 请求的时间戳, 没有时间戳的请求为 0
+	Nonce     string // 请求的随机数
+	Reused    bool   // true 表示 Nonce 已经使用过, false 表示 Timestamp 超出了允许的范围
+}
+
+func (e *ReplayError) Error() string {
+	if e.Reused {
+		return fmt.Sprintf("replayed request: nonce %q has been used", e.Nonce)
+	}
+	return fmt.Sprintf("replayed request: timestamp %d is out of the allowed window", e.Timestamp)
+}
+
+// 防止重放攻击, 拒绝时间戳和本地时间偏差超过 window 的请求, 并且在这个时间范围内记住用过的 nonce.
+// 并发安全.
+type ReplayGuard struct {
+	window     time.Duration
+	nonceStore DedupStore
+}
+
+// 创建一个新的 ReplayGuard.
+//  window <= 0 则使用 DefaultReplayWindow;
+//  nonceStore 为 nil 则使用 NewLRUDedupStore(DefaultDedupStoreSize, 2*window),
+//  自定义的 nonceStore 的有效期要不小于 2*window, 否则过期的 nonce 可能在时间范围内被重放.
+//  NOTE: LRUDedupStore 超过容量的时候会淘汰还没有过期的 nonce, 默认的 nonceStore 只能记住 DefaultDedupStoreSize 个,
+//  2*window 时间内的请求数可能超过这个数量的话, 请传入容量更大的 LRUDedupStore 或者 redis 等实现的 nonceStore,
+//  否则被淘汰的 nonce 可以在时间范围内被重放.
+func NewReplayGuard(window time.Duration, nonceStore DedupStore) *ReplayGuard {
+	if window <= 0 {
+		window = DefaultReplayWindow
+	}
+	if nonceStore == nil {
+		nonceStore = NewLRUDedupStore(DefaultDedupStoreSize, 2*window)
+	}
+	return &ReplayGuard{
+		window:     window,
+		nonceStore: nonceStore,
+	}
+}
+
+// 检查请求的时间戳 timestamp(unixtime) 和随机数 nonce, 重放的请求返回 *ReplayError.
+//  NOTE: 要在验证签名之后调用, 否则伪造的请求会占用 nonce.
+func (guard *ReplayGuard) Check(timestamp int64, nonce string) error {
+	skew := time.Since(time.Unix(timestamp, 0))
+	if skew > guard.window || skew < -guard.window {
+		return &ReplayError{Timestamp: timestamp, Nonce: nonce}
+	}
+	return guard.checkNonce(strconv.FormatInt(timestamp, 10)+":"+nonce, timestamp, nonce)
+}
+
+// 只检查随机数 nonce, 用于没有时间戳的请求, 比如微信支付的通知, 重放的请求返回 *ReplayError.
+func (guard *ReplayGuard) CheckNonce(nonce string) error {
+	return guard.checkNonce(nonce, 0, nonce)
+}
+
+// 撤销 CheckNonce 记录的 nonce, 用于请求没有处理成功, 需要接受对方用同一个 nonce 重试的场景, 比如微信支付的通知.
+//  nonceStore 没有实现 RemovableDedupStore 则什么也不做, 这时重试的请求仍然会被拒绝.
+func (guard *ReplayGuard) ReleaseNonce(nonce string) {
+	if store, ok := guard.nonceStore.(RemovableDedupStore); ok {
+		store.Remove(nonce)
+	}
+}
+
+func (guard *ReplayGuard) checkNonce(key string, timestamp int64, nonce string) error {
+	// 和 DedupStore 的约定一致, 存储出错的时候当作没有用过的 nonce
+	if added, err := guard.nonceStore.Add(key); err == nil && !added {
+		return &ReplayError{Timestamp: timestamp, Nonce: nonce, Reused: true}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReplayGuard(t *testing.T) {
+	guard := NewReplayGuard(time.Minute, nil)
+	now := time.Now().Unix()
+
+	check := func(err error, reused bool) {
+		replayErr, ok := err.(*ReplayError)
+		if !ok {
+			t.Fatalf("err = %v, want *ReplayError", err)
+		}
+		if replayErr.Reused != reused {
+			t.Fatalf("Reused = %t, want %t", replayErr.Reused, reused)
+		}
+	}
+
+	if err := guard.Check(now, "a"); err != nil {
+		t.Fatal(err)
+	}
+	check(guard.Check(now, "a"), true)
+	if err := guard.Check(now-1, "a"); err != nil { // 不同的时间戳
+		t.Fatal(err)
+	}
+	check(guard.Check(now-120, "b"), false)
+	check(guard.Check(now+120, "b"), false)
+
+	if err := guard.CheckNonce("c"); err != nil {
+		t.Fatal(err)
+	}
+	check(guard.CheckNonce("c"), true)
+	guard.ReleaseNonce("c")
+	if err := guard.CheckNonce("c"); err != nil {
+		t.Fatal(err)
+	}
+	check(guard.CheckNonce("c"), true)
+}
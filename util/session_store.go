@@ -0,0 +1,183 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package util
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const DefaultSessionTTL = 30 * time.Minute // 默认的会话有效期
+
+// 会话数据的存储, 可以用 redis 等实现多个服务器之间共享.
+type SessionStore interface {
+	// 获取 key 对应的数据, key 不存在或者已经过期返回 nil, nil
+	Get(key string) (data []byte, err error)
+	// 保存 key 对应的数据, ttl 后过期
+	Set(key string, data []byte, ttl time.Duration) error
+	// 删除 key 对应的数据, key 不存在不是错误
+	Delete(key string) error
+}
+
+type memorySessionEntry struct {
+	data     []byte
+	expireAt time.Time
+}
+
+// 基于内存的 SessionStore, 并发安全.
+type MemorySessionStore struct {
+	mutex   sync.Mutex
+	entries map[string]memorySessionEntry
+	gcAt    time.Time // 下一次清理过期数据的时间
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		entries: make(map[string]memorySessionEntry),
+	}
+}
+
+func (store *MemorySessionStore) Get(key string) (data []byte, err error) {
+	now := time.Now()
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	entry, ok := store.entries[key]
+	if !ok {
+		return
+	}
+	if !now.Before(entry.expireAt) {
+		delete(store.entries, key)
+		return
+	}
+	data = entry.data
+	return
+}
+
+func (store *MemorySessionStore) Set(key string, data []byte, ttl time.Duration) error {
+	now := time.Now()
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	// 每分钟最多清理一次过期数据
+	if !now.Before(store.gcAt) {
+		for k, entry := range store.entries {
+			if !now.Before(entry.expireAt) {
+				delete(store.entries, k)
+			}
+		}
+		store.gcAt = now.Add(time.Minute)
+	}
+
+	store.entries[key] = memorySessionEntry{
+		data:     append([]byte(nil), data...),
+		expireAt: now.Add(ttl),
+	}
+	return nil
+}
+
+func (store *MemorySessionStore) Delete(key string) error {
+	store.mutex.Lock()
+	delete(store.entries, key)
+	store.mutex.Unlock()
+	return nil
+}
+
+// 基于文件的 SessionStore, 每个 key 保存为 dir 目录下的一个文件, 进程重启后会话不会丢失.
+//  文件的第一行是过期时间(unix 纳秒), 后面是数据; 过期的文件在 Get 的时候删除.
+type FileSessionStore struct {
+	dir string
+}
+
+// 创建一个新的 FileSessionStore, dir 不存在的话在第一次 Set 的时候创建.
+func NewFileSessionStore(dir string) *FileSessionStore {
+	if dir == "" {
+		panic("empty dir")
+	}
+	return &FileSessionStore{dir: dir}
+}
+
+func (store *FileSessionStore) filename(key string) string {
+	hashSumArray := sha1.Sum([]byte(key))
+	return filepath.Join(store.dir, hex.EncodeToString(hashSumArray[:]))
+}
+
+func (store *FileSessionStore) Get(key string) (data []byte, err error) {
+	filename := store.filename(key)
+
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	i := bytes.IndexByte(content, '\n')
+	if i < 0 {
+		os.Remove(filename) // 损坏的文件
+		return
+	}
+	expireAt, err := strconv.ParseInt(string(content[:i]), 10, 64)
+	if err != nil {
+		err = nil
+		os.Remove(filename)
+		return
+	}
+	if time.Now().UnixNano() >= expireAt {
+		os.Remove(filename)
+		return
+	}
+	data = content[i+1:]
+	return
+}
+
+func (store *FileSessionStore) Set(key string, data []byte, ttl time.Duration) (err error) {
+	if err = os.MkdirAll(store.dir, 0700); err != nil {
+		return
+	}
+
+	file, err := ioutil.TempFile(store.dir, ".tmp")
+	if err != nil {
+		return
+	}
+	tmpname := file.Name()
+
+	content := strconv.AppendInt(nil, time.Now().Add(ttl).UnixNano(), 10)
+	content = append(content, '\n')
+	content = append(content, data...)
+	if _, err = file.Write(content); err != nil {
+		file.Close()
+		os.Remove(tmpname)
+		return
+	}
+	if err = file.Close(); err != nil {
+		os.Remove(tmpname)
+		return
+	}
+
+	// rename 是原子操作, 并发的 Get 不会读到写了一半的文件
+	if err = os.Rename(tmpname, store.filename(key)); err != nil {
+		os.Remove(tmpname)
+	}
+	return
+}
+
+func (store *FileSessionStore) Delete(key string) (err error) {
+	if err = os.Remove(store.filename(key)); os.IsNotExist(err) {
+		err = nil
+	}
+	return
+}
@@ -0,0 +1,54 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSessionStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wechat-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, store := range []SessionStore{NewMemorySessionStore(), NewFileSessionStore(dir)} {
+		get := func(key, want string) {
+			data, err := store.Get(key)
+			if err != nil {
+				t.Fatalf("%T: %v", store, err)
+			}
+			if string(data) != want {
+				t.Fatalf("%T: Get(%q) = %q, want %q", store, key, data, want)
+			}
+		}
+
+		get("a", "")
+		if err := store.Set("a", []byte("1"), time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Set("b", []byte("2\n2"), 30*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		get("a", "1")
+		get("b", "2\n2")
+
+		if err := store.Delete("a"); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Delete("a"); err != nil {
+			t.Fatal(err)
+		}
+		get("a", "")
+
+		time.Sleep(40 * time.Millisecond)
+		get("b", "") // 过期
+	}
+}
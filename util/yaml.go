@@ -0,0 +1,326 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 把 yaml 转换为 json, 用于从 yaml 格式的配置文件(比如自定义菜单)加载数据, 这样就可以复用结构体的 json tag.
+//  只支持 yaml 的一个子集, 足够表示 json 能表示的数据:
+//  缩进表示的 mapping 和 sequence(只能用空格缩进), "- key: value" 形式的 sequence 元素,
+//  plain, 单引号和双引号的标量, 空的 [] 和 {}, 以及 # 开头的注释;
+//  不支持 flow 集合(空的除外), 多行字符串(| 和 >), anchor, alias, tag 和多个文档.
+//  标量的类型和 yaml 一致: true/false 是布尔值, null/~ 是 null, 十进制的数字是数字, 其他都是字符串,
+//  所以纯数字的字符串要加引号, 比如 key: "1001".
+func YAMLToJSON(data []byte) (jsonData []byte, err error) {
+	p, err := newYAMLParser(string(data))
+	if err != nil {
+		return
+	}
+
+	var v interface{}
+	if len(p.lines) > 0 {
+		if v, err = p.parseBlock(p.lines[0].indent); err != nil {
+			return
+		}
+		if p.pos < len(p.lines) {
+			err = p.errorf("bad indentation")
+			return
+		}
+	}
+	return json.Marshal(v)
+}
+
+type yamlLine struct {
+	num    int    // 行号, 从 1 开始
+	indent int    // 缩进的空格数
+	text   string // 去掉缩进和行尾空白的内容
+}
+
+type yamlParser struct {
+	lines []yamlLine // 不包括空行和注释行
+	pos   int        // 下一个要解析的行
+}
+
+func newYAMLParser(data string) (p *yamlParser, err error) {
+	p = new(yamlParser)
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		text := strings.TrimLeft(line, " ")
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		if text[0] == '\t' {
+			return nil, fmt.Errorf("yaml: line %d: found a tab character in indentation", i+1)
+		}
+		if len(p.lines) == 0 && text == "---" { // 文档开始的标记
+			continue
+		}
+		if text == "..." { // 文档结束的标记
+			break
+		}
+		p.lines = append(p.lines, yamlLine{
+			num:    i + 1,
+			indent: len(line) - len(text),
+			text:   text,
+		})
+	}
+	return
+}
+
+func (p *yamlParser) errorf(format string, args ...interface{}) error {
+	num := 0
+	if p.pos < len(p.lines) {
+		num = p.lines[p.pos].num
+	} else if len(p.lines) > 0 {
+		num = p.lines[len(p.lines)-1].num
+	}
+	return fmt.Errorf("yaml: line %d: %s", num, fmt.Sprintf(format, args...))
+}
+
+// 解析从当前行开始, 缩进为 indent 的 mapping 或者 sequence
+func (p *yamlParser) parseBlock(indent int) (interface{}, error) {
+	if isYAMLSeqItem(p.lines[p.pos].text) {
+		return p.parseSeq(indent)
+	}
+	return p.parseMap(indent)
+}
+
+func (p *yamlParser) parseSeq(indent int) (interface{}, error) {
+	list := make([]interface{}, 0)
+
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isYAMLSeqItem(p.lines[p.pos].text) {
+		line := p.lines[p.pos]
+		rest := strings.TrimLeft(line.text[1:], " ")
+
+		var v interface{}
+		var err error
+		switch {
+		case rest == "" || rest[0] == '#':
+			p.pos++
+			if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+				v, err = p.parseBlock(p.lines[p.pos].indent)
+			}
+		case isYAMLSeqItem(rest) || isYAMLMapItem(rest):
+			// "- key: value" 或者 "- - value", 把 "- " 之后的内容当作缩进更深的一行
+			line.indent += len(line.text) - len(rest)
+			line.text = rest
+			p.lines[p.pos] = line
+			v, err = p.parseBlock(line.indent)
+		default:
+			v, err = parseYAMLScalar(rest)
+			if err != nil {
+				err = p.errorf("%v", err)
+			}
+			p.pos++
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+
+	if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+		return nil, p.errorf("bad indentation of a sequence entry")
+	}
+	return list, nil
+}
+
+func (p *yamlParser) parseMap(indent int) (interface{}, error) {
+	m := make(map[string]interface{})
+
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent {
+		line := p.lines[p.pos]
+		if isYAMLSeqItem(line.text) {
+			return nil, p.errorf("unexpected sequence entry in a mapping")
+		}
+		key, value, err := splitYAMLMapItem(line.text)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		if _, ok := m[key]; ok {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		p.pos++
+
+		var v interface{}
+		if value == "" || value[0] == '#' {
+			// 值在下面缩进更深的行, sequence 也可以和 key 的缩进相同
+			if p.pos < len(p.lines) {
+				next := p.lines[p.pos]
+				if next.indent > indent || (next.indent == indent && isYAMLSeqItem(next.text)) {
+					if v, err = p.parseBlock(next.indent); err != nil {
+						return nil, err
+					}
+				}
+			}
+		} else {
+			if v, err = parseYAMLScalar(value); err != nil {
+				p.pos--
+				return nil, p.errorf("%v", err)
+			}
+		}
+		m[key] = v
+	}
+
+	if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+		return nil, p.errorf("bad indentation of a mapping entry")
+	}
+	return m, nil
+}
+
+func isYAMLSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func isYAMLMapItem(text string) bool {
+	_, _, err := splitYAMLMapItem(text)
+	return err == nil
+}
+
+// 把 "key: value" 拆分为 key 和 value, value 可能为空或者是注释
+func splitYAMLMapItem(text string) (key, value string, err error) {
+	var rest string
+	if text[0] == '"' || text[0] == '\'' {
+		var n int
+		if key, n, err = parseYAMLQuoted(text); err != nil {
+			return
+		}
+		rest = strings.TrimLeft(text[n:], " ")
+		if !strings.HasPrefix(rest, ":") {
+			err = fmt.Errorf("could not find expected ':'")
+			return
+		}
+		rest = rest[1:]
+	} else {
+		i := strings.Index(text, ": ")
+		if i < 0 {
+			if !strings.HasSuffix(text, ":") {
+				err = fmt.Errorf("could not find expected ':'")
+				return
+			}
+			i = len(text) - 1
+		}
+		key = strings.TrimRight(text[:i], " ")
+		rest = text[i+1:]
+	}
+
+	if rest != "" && rest[0] != ' ' {
+		err = fmt.Errorf("could not find expected ':'")
+		return
+	}
+	value = strings.TrimLeft(rest, " ")
+	return
+}
+
+// 解析标量, text 不为空
+func parseYAMLScalar(text string) (interface{}, error) {
+	switch text[0] {
+	case '"', '\'':
+		s, n, err := parseYAMLQuoted(text)
+		if err != nil {
+			return nil, err
+		}
+		if rest := strings.TrimLeft(text[n:], " "); rest != "" && rest[0] != '#' {
+			return nil, fmt.Errorf("unexpected characters after quoted scalar: %q", rest)
+		}
+		return s, nil
+	case '|', '>':
+		return nil, fmt.Errorf("block scalar is not supported")
+	case '&', '*', '!':
+		return nil, fmt.Errorf("anchor, alias and tag are not supported")
+	}
+
+	// plain 标量, " #" 之后是注释
+	if i := strings.Index(text, " #"); i >= 0 {
+		text = strings.TrimRight(text[:i], " ")
+	}
+	switch text {
+	case "[]":
+		return make([]interface{}, 0), nil
+	case "{}":
+		return make(map[string]interface{}), nil
+	case "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	if text[0] == '[' || text[0] == '{' {
+		return nil, fmt.Errorf("flow collection is not supported")
+	}
+	if isYAMLNumber(text) {
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return n, nil
+		}
+		if f, err := strconv.ParseFloat(text, 64); err == nil {
+			return f, nil
+		}
+	}
+	return text, nil
+}
+
+// 解析 text 开头的单引号或者双引号字符串, n 是包括引号在内的长度
+func parseYAMLQuoted(text string) (s string, n int, err error) {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++ // 跳过转义的字符
+		case text[i] != quote:
+		case quote == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++ // 单引号字符串里 '' 表示 '
+		case quote == '\'':
+			return strings.Replace(text[1:i], "''", "'", -1), i + 1, nil
+		default:
+			if s, err = strconv.Unquote(text[:i+1]); err != nil {
+				err = fmt.Errorf("invalid double-quoted scalar: %s", text[:i+1])
+				return
+			}
+			return s, i + 1, nil
+		}
+	}
+	err = fmt.Errorf("found unterminated quoted scalar")
+	return
+}
+
+// 十进制的整数或者浮点数, 比如 -1, 3.14, 1e10
+func isYAMLNumber(text string) bool {
+	i := 0
+	if text[i] == '-' || text[i] == '+' {
+		i++
+	}
+	digits := func() int {
+		start := i
+		for i < len(text) && text[i] >= '0' && text[i] <= '9' {
+			i++
+		}
+		return i - start
+	}
+
+	if digits() == 0 {
+		return false
+	}
+	if i < len(text) && text[i] == '.' {
+		i++
+		digits()
+	}
+	if i < len(text) && (text[i] == 'e' || text[i] == 'E') {
+		i++
+		if i < len(text) && (text[i] == '-' || text[i] == '+') {
+			i++
+		}
+		if digits() == 0 {
+			return false
+		}
+	}
+	return i == len(text)
+}
@@ -0,0 +1,68 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package util
+
+import (
+	"testing"
+)
+
+func TestYAMLToJSON(t *testing.T) {
+	tests := []struct {
+		yaml string
+		json string // 为空表示要返回错误
+	}{
+		{"", `null`},
+		{"# 只有注释\n---\n", `null`},
+		{"a: 1\nb: -2.5\nc: true\nd: ~\ne: hello world # 注释\n", `{"a":1,"b":-2.5,"c":true,"d":null,"e":"hello world"}`},
+		{"a: \"1001\"\nb: 'it''s'\nc: \"\\u4e2d\\n\"\n\"d e\": x\n", `{"a":"1001","b":"it's","c":"中\n","d e":"x"}`},
+		{"url: http://www.soso.com/?a=b#c\n", `{"url":"http://www.soso.com/?a=b#c"}`},
+		{"a: []\nb: {}\nc:\n", `{"a":[],"b":{},"c":null}`},
+		{
+			"button:\n" +
+				"  - type: click\n" +
+				"    name: 今日歌曲\n" +
+				"\n" +
+				"  - name: 菜单\n" +
+				"    sub_button:\n" +
+				"    - type: view\n" +
+				"      url: http://www.soso.com/\n" +
+				"    -\n" +
+				"      type: click\n" +
+				"list:\n" +
+				"- - 1\n" +
+				"  - 2\n" +
+				"- x\n",
+			`{"button":[{"name":"今日歌曲","type":"click"},{"name":"菜单","sub_button":[{"type":"view","url":"http://www.soso.com/"},{"type":"click"}]}],"list":[[1,2],"x"]}`,
+		},
+		{"\t- a\n", ""},
+		{"a: 1\na: 2\n", ""},
+		{"a: 1\n  b: 2\n", ""},
+		{"a:\n    b: 1\n  c: 2\n", ""},
+		{"a: [1, 2]\n", ""},
+		{"a: |\n  text\n", ""},
+		{"a: &x 1\n", ""},
+		{"a: \"unterminated\n", ""},
+		{"just a scalar\n", ""},
+		{"- a\nb: 1\n", ""},
+	}
+
+	for _, tt := range tests {
+		have, err := YAMLToJSON([]byte(tt.yaml))
+		if tt.json == "" {
+			if err == nil {
+				t.Errorf("YAMLToJSON(%q): want error, have %s", tt.yaml, have)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("YAMLToJSON(%q): %v", tt.yaml, err)
+			continue
+		}
+		if string(have) != tt.json {
+			t.Errorf("YAMLToJSON(%q):\nhave %s\nwant %s", tt.yaml, have, tt.json)
+		}
+	}
+}
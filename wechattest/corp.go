@@ -0,0 +1,776 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package wechattest
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chanxuehong/wechat/corp/addresslist"
+	"github.com/chanxuehong/wechat/corp/media"
+	"github.com/chanxuehong/wechat/corp/menu"
+)
+
+// 成员的关注状态
+const (
+	corpUserStatusSubscribed   = 1
+	corpUserStatusDisabled     = 2
+	corpUserStatusUnsubscribed = 4
+)
+
+const corpTagUserLimit = 1000 // 增加/删除标签成员每次最多的成员个数
+
+// 企业号的状态; 所有字段都由 Server.mutex 保护.
+type corpState struct {
+	departments      map[int64]*addresslist.Department
+	nextDepartmentId int64
+	users            map[string]*addresslist.UserInfo
+	tags             map[int64]*corpTag
+	nextTagId        int64
+	menus            map[int64]*menu.Menu // map[agentid]*menu.Menu
+	media            mediaStore
+}
+
+type corpTag struct {
+	name  string
+	users map[string]bool
+}
+
+func (state *corpState) init() {
+	state.departments = map[int64]*addresslist.Department{
+		1: {Id: 1, Name: "wechattest", ParentId: 0},
+	}
+	state.nextDepartmentId = 2
+	state.users = make(map[string]*addresslist.UserInfo)
+	state.tags = make(map[int64]*corpTag)
+	state.nextTagId = 1
+	state.menus = make(map[int64]*menu.Menu)
+	state.media.init(media.MEDIA_TYPE_IMAGE, media.MEDIA_TYPE_VOICE, media.MEDIA_TYPE_VIDEO, media.MEDIA_TYPE_FILE)
+}
+
+// 增加一个企业号成员, 如果 info.Department 为空则属于根部门(id 为 1), 已经存在则覆盖.
+//  info.Status == 0 时设置为已关注.
+func (srv *Server) AddCorpUser(info addresslist.UserInfo) {
+	if len(info.Department) == 0 {
+		info.Department = []int64{1}
+	}
+	if info.Status == 0 {
+		info.Status = corpUserStatusSubscribed
+	}
+
+	srv.mutex.Lock()
+	srv.corp.users[info.Id] = &info
+	srv.mutex.Unlock()
+}
+
+// 直接增加一个企业号的多媒体文件, 返回 media_id.
+func (srv *Server) AddCorpMedia(mediaType, filename string, data []byte) (mediaId string) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	return srv.corp.media.add(mediaType, filename, "", data).MediaId
+}
+
+// 获取企业号成员的信息.
+func (srv *Server) CorpUser(userid string) (info addresslist.UserInfo, ok bool) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	u := srv.corp.users[userid]
+	if u == nil {
+		return
+	}
+	return *u, true
+}
+
+// 获取企业号应用当前的菜单, 没有菜单 ok == false.
+func (srv *Server) CorpMenu(agentId int64) (menu_ menu.Menu, ok bool) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	m := srv.corp.menus[agentId]
+	if m == nil {
+		return
+	}
+	return *m, true
+}
+
+func (srv *Server) serveCorp(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/cgi-bin/gettoken" {
+		srv.corpToken(w, r)
+		return
+	}
+
+	var handler func(w http.ResponseWriter, r *http.Request)
+	switch r.URL.Path {
+	case "/cgi-bin/department/create":
+		handler = srv.corpDepartmentCreate
+	case "/cgi-bin/department/update":
+		handler = srv.corpDepartmentUpdate
+	case "/cgi-bin/department/delete":
+		handler = srv.corpDepartmentDelete
+	case "/cgi-bin/department/list":
+		handler = srv.corpDepartmentList
+	case "/cgi-bin/user/create":
+		handler = srv.corpUserCreate
+	case "/cgi-bin/user/update":
+		handler = srv.corpUserUpdate
+	case "/cgi-bin/user/delete":
+		handler = srv.corpUserDelete
+	case "/cgi-bin/user/get":
+		handler = srv.corpUserGet
+	case "/cgi-bin/user/simplelist":
+		handler = srv.corpUserSimpleList
+	case "/cgi-bin/tag/create":
+		handler = srv.corpTagCreate
+	case "/cgi-bin/tag/update":
+		handler = srv.corpTagUpdate
+	case "/cgi-bin/tag/delete":
+		handler = srv.corpTagDelete
+	case "/cgi-bin/tag/get":
+		handler = srv.corpTagGet
+	case "/cgi-bin/tag/addtagusers":
+		handler = srv.corpTagAddUsers
+	case "/cgi-bin/tag/deltagusers":
+		handler = srv.corpTagDelUsers
+	case "/cgi-bin/menu/create":
+		handler = srv.corpMenuCreate
+	case "/cgi-bin/menu/get":
+		handler = srv.corpMenuGet
+	case "/cgi-bin/menu/delete":
+		handler = srv.corpMenuDelete
+	case "/cgi-bin/media/upload":
+		handler = srv.corpMediaUpload
+	case "/cgi-bin/media/get":
+		handler = srv.corpMediaGet
+	case "/cgi-bin/message/send":
+		handler = srv.corpMsgSend
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if !srv.checkToken(w, r) {
+		return
+	}
+	handler(w, r)
+}
+
+func (srv *Server) corpToken(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	switch {
+	case query.Get("corpid") != srv.config.CorpId:
+		writeError(w, errCodeInvalidAppId, "invalid corpid")
+	case query.Get("corpsecret") != srv.config.CorpSecret:
+		writeError(w, errCodeInvalidSecret, "invalid credential")
+	default:
+		token, expiresIn := srv.newToken()
+		writeJSON(w, map[string]interface{}{
+			"access_token": token,
+			"expires_in":   expiresIn,
+		})
+	}
+}
+
+func queryInt64(r *http.Request, name string) int64 {
+	n, _ := strconv.ParseInt(r.URL.Query().Get(name), 10, 64)
+	return n
+}
+
+func (srv *Server) corpDepartmentCreate(w http.ResponseWriter, r *http.Request) {
+	var request addresslist.DepartmentCreateParameters
+	if !readJSON(w, r, &request) {
+		return
+	}
+	if request.Name == "" {
+		writeError(w, 60001, "invalid department name")
+		return
+	}
+
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	if srv.corp.departments[request.ParentId] == nil {
+		writeError(w, 60004, "parent department not found")
+		return
+	}
+	for _, dept := range srv.corp.departments {
+		if dept.ParentId == request.ParentId && dept.Name == request.Name {
+			writeError(w, errCodeDepartmentExists, "department exists")
+			return
+		}
+	}
+
+	id := srv.corp.nextDepartmentId
+	srv.corp.nextDepartmentId++
+	srv.corp.departments[id] = &addresslist.Department{
+		Id:       id,
+		Name:     request.Name,
+		ParentId: request.ParentId,
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"errcode": errCodeOK,
+		"errmsg":  "created",
+		"id":      id,
+	})
+}
+
+func (srv *Server) corpDepartmentUpdate(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Id       int64   `json:"id"`
+		Name     *string `json:"name"`
+		ParentId *int64  `json:"parentid"`
+	}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	dept := srv.corp.departments[request.Id]
+	if dept == nil {
+		writeError(w, errCodeDepartmentMissing, "department not found")
+		return
+	}
+	if request.ParentId != nil {
+		if srv.corp.departments[*request.ParentId] == nil || *request.ParentId == dept.Id {
+			writeError(w, 60004, "parent department not found")
+			return
+		}
+		dept.ParentId = *request.ParentId
+	}
+	if request.Name != nil {
+		dept.Name = *request.Name
+	}
+
+	writeError(w, errCodeOK, "updated")
+}
+
+func (srv *Server) corpDepartmentDelete(w http.ResponseWriter, r *http.Request) {
+	id := queryInt64(r, "id")
+
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	if srv.corp.departments[id] == nil || id == 1 {
+		writeError(w, errCodeDepartmentMissing, "department not found")
+		return
+	}
+	for _, dept := range srv.corp.departments {
+		if dept.ParentId == id {
+			writeError(w, 60006, "department has sub-department")
+			return
+		}
+	}
+	for _, u := range srv.corp.users {
+		if containsInt64(u.Department, id) {
+			writeError(w, errCodeDepartmentNoEmpty, "department has member")
+			return
+		}
+	}
+	delete(srv.corp.departments, id)
+
+	writeError(w, errCodeOK, "deleted")
+}
+
+func (srv *Server) corpDepartmentList(w http.ResponseWriter, r *http.Request) {
+	srv.mutex.Lock()
+	departments := make([]addresslist.Department, 0, len(srv.corp.departments))
+	for _, dept := range srv.corp.departments {
+		departments = append(departments, *dept)
+	}
+	srv.mutex.Unlock()
+
+	sort.Sort(departmentsById(departments))
+	writeJSON(w, map[string]interface{}{
+		"errcode":    errCodeOK,
+		"errmsg":     "ok",
+		"department": departments,
+	})
+}
+
+type departmentsById []addresslist.Department
+
+func (s departmentsById) Len() int           { return len(s) }
+func (s departmentsById) Less(i, j int) bool { return s[i].Id < s[j].Id }
+func (s departmentsById) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (srv *Server) corpUserCreate(w http.ResponseWriter, r *http.Request) {
+	var request addresslist.UserCreateParameters
+	if !readJSON(w, r, &request) {
+		return
+	}
+	if request.UserId == "" || request.Name == "" {
+		writeError(w, 60103, "invalid userid or name")
+		return
+	}
+	if len(request.Department) == 0 {
+		request.Department = []int64{1}
+	}
+
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	if srv.corp.users[request.UserId] != nil {
+		writeError(w, errCodeUserExists, "userid existed")
+		return
+	}
+	for _, id := range request.Department {
+		if srv.corp.departments[id] == nil {
+			writeError(w, errCodeDepartmentMissing, "department not found")
+			return
+		}
+	}
+	srv.corp.users[request.UserId] = &addresslist.UserInfo{
+		Id:         request.UserId,
+		Name:       request.Name,
+		Department: request.Department,
+		Position:   request.Position,
+		Mobile:     request.Mobile,
+		Gender:     request.Gender,
+		Tel:        request.Tel,
+		Email:      request.Email,
+		WeixinId:   request.WeixinId,
+		Status:     corpUserStatusUnsubscribed,
+	}
+
+	writeError(w, errCodeOK, "created")
+}
+
+func (srv *Server) corpUserUpdate(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		UserId     string  `json:"userid"`
+		Name       *string `json:"name"`
+		Department []int64 `json:"department"`
+		Position   *string `json:"position"`
+		Mobile     *string `json:"mobile"`
+		Gender     *int    `json:"gender"`
+		Tel        *string `json:"tel"`
+		Email      *string `json:"email"`
+		WeixinId   *string `json:"weixinid"`
+		Enable     *int    `json:"enable"`
+	}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	u := srv.corp.users[request.UserId]
+	if u == nil {
+		writeError(w, errCodeUserMissing, "userid not found")
+		return
+	}
+	for _, id := range request.Department {
+		if srv.corp.departments[id] == nil {
+			writeError(w, errCodeDepartmentMissing, "department not found")
+			return
+		}
+	}
+
+	if request.Name != nil {
+		u.Name = *request.Name
+	}
+	if request.Department != nil {
+		u.Department = request.Department
+	}
+	if request.Position != nil {
+		u.Position = *request.Position
+	}
+	if request.Mobile != nil {
+		u.Mobile = *request.Mobile
+	}
+	if request.Gender != nil {
+		u.Gender = *request.Gender
+	}
+	if request.Tel != nil {
+		u.Tel = *request.Tel
+	}
+	if request.Email != nil {
+		u.Email = *request.Email
+	}
+	if request.WeixinId != nil {
+		u.WeixinId = *request.WeixinId
+	}
+	if request.Enable != nil {
+		switch {
+		case *request.Enable == 0:
+			u.Status = corpUserStatusDisabled
+		case u.Status == corpUserStatusDisabled:
+			u.Status = corpUserStatusUnsubscribed
+		}
+	}
+
+	writeError(w, errCodeOK, "updated")
+}
+
+func (srv *Server) corpUserDelete(w http.ResponseWriter, r *http.Request) {
+	userid := r.URL.Query().Get("userid")
+
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	if srv.corp.users[userid] == nil {
+		writeError(w, errCodeUserMissing, "userid not found")
+		return
+	}
+	delete(srv.corp.users, userid)
+	for _, tag := range srv.corp.tags {
+		delete(tag.users, userid)
+	}
+
+	writeError(w, errCodeOK, "deleted")
+}
+
+func (srv *Server) corpUserGet(w http.ResponseWriter, r *http.Request) {
+	srv.mutex.Lock()
+	u := srv.corp.users[r.URL.Query().Get("userid")]
+	var info addresslist.UserInfo
+	if u != nil {
+		info = *u
+	}
+	srv.mutex.Unlock()
+
+	if u == nil {
+		writeError(w, errCodeUserMissing, "userid not found")
+		return
+	}
+	writeJSON(w, &info)
+}
+
+func (srv *Server) corpUserSimpleList(w http.ResponseWriter, r *http.Request) {
+	departmentId := queryInt64(r, "department_id")
+	fetchChild := queryInt64(r, "fetch_child") == 1
+	status := int(queryInt64(r, "status"))
+
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	if srv.corp.departments[departmentId] == nil {
+		writeError(w, errCodeDepartmentMissing, "department not found")
+		return
+	}
+
+	departments := map[int64]bool{departmentId: true}
+	for fetchChild { // 一直找到没有新的子部门为止
+		found := false
+		for _, dept := range srv.corp.departments {
+			if departments[dept.ParentId] && !departments[dept.Id] {
+				departments[dept.Id] = true
+				found = true
+			}
+		}
+		if !found {
+			break
+		}
+	}
+
+	userList := make([]addresslist.UserInfoBase, 0, 16)
+	for _, u := range srv.corp.users {
+		if status != 0 && status&u.Status == 0 {
+			continue
+		}
+		for _, id := range u.Department {
+			if departments[id] {
+				userList = append(userList, addresslist.UserInfoBase{Id: u.Id, Name: u.Name})
+				break
+			}
+		}
+	}
+	sort.Sort(usersById(userList))
+
+	writeJSON(w, map[string]interface{}{
+		"errcode":  errCodeOK,
+		"errmsg":   "ok",
+		"userlist": userList,
+	})
+}
+
+type usersById []addresslist.UserInfoBase
+
+func (s usersById) Len() int           { return len(s) }
+func (s usersById) Less(i, j int) bool { return s[i].Id < s[j].Id }
+func (s usersById) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (srv *Server) corpTagCreate(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Name string `json:"tagname"`
+	}
+	if !readJSON(w, r, &request) {
+		return
+	}
+	if request.Name == "" {
+		writeError(w, 40072, "invalid tag name")
+		return
+	}
+
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	for _, tag := range srv.corp.tags {
+		if tag.name == request.Name {
+			writeError(w, errCodeTagExists, "tag name existed")
+			return
+		}
+	}
+	id := srv.corp.nextTagId
+	srv.corp.nextTagId++
+	srv.corp.tags[id] = &corpTag{
+		name:  request.Name,
+		users: make(map[string]bool),
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"errcode": errCodeOK,
+		"errmsg":  "created",
+		"tagid":   id,
+	})
+}
+
+func (srv *Server) corpTagUpdate(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Id   int64  `json:"tagid"`
+		Name string `json:"tagname"`
+	}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	tag := srv.corp.tags[request.Id]
+	if tag == nil {
+		writeError(w, errCodeTagMissing, "invalid tagid")
+		return
+	}
+	tag.name = request.Name
+
+	writeError(w, errCodeOK, "updated")
+}
+
+func (srv *Server) corpTagDelete(w http.ResponseWriter, r *http.Request) {
+	id := queryInt64(r, "tagid")
+
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	if srv.corp.tags[id] == nil {
+		writeError(w, errCodeTagMissing, "invalid tagid")
+		return
+	}
+	delete(srv.corp.tags, id)
+
+	writeError(w, errCodeOK, "deleted")
+}
+
+func (srv *Server) corpTagGet(w http.ResponseWriter, r *http.Request) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	tag := srv.corp.tags[queryInt64(r, "tagid")]
+	if tag == nil {
+		writeError(w, errCodeTagMissing, "invalid tagid")
+		return
+	}
+
+	userList := make([]addresslist.UserInfoBase, 0, len(tag.users))
+	for userid := range tag.users {
+		if u := srv.corp.users[userid]; u != nil {
+			userList = append(userList, addresslist.UserInfoBase{Id: u.Id, Name: u.Name})
+		}
+	}
+	sort.Sort(usersById(userList))
+
+	writeJSON(w, map[string]interface{}{
+		"errcode":  errCodeOK,
+		"errmsg":   "ok",
+		"userlist": userList,
+	})
+}
+
+func (srv *Server) corpTagAddUsers(w http.ResponseWriter, r *http.Request) {
+	srv.corpTagUsers(w, r, true)
+}
+
+func (srv *Server) corpTagDelUsers(w http.ResponseWriter, r *http.Request) {
+	srv.corpTagUsers(w, r, false)
+}
+
+func (srv *Server) corpTagUsers(w http.ResponseWriter, r *http.Request, add bool) {
+	var request struct {
+		TagId int64    `json:"tagid"`
+		Users []string `json:"userlist"`
+	}
+	if !readJSON(w, r, &request) {
+		return
+	}
+	if len(request.Users) > corpTagUserLimit {
+		writeError(w, errCodeInvalidParameter, "userlist size out of limit")
+		return
+	}
+
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	tag := srv.corp.tags[request.TagId]
+	if tag == nil {
+		writeError(w, errCodeTagMissing, "invalid tagid")
+		return
+	}
+
+	var invalid []string
+	for _, userid := range request.Users {
+		if srv.corp.users[userid] == nil {
+			invalid = append(invalid, userid)
+			continue
+		}
+		if add {
+			tag.users[userid] = true
+		} else {
+			delete(tag.users, userid)
+		}
+	}
+
+	switch {
+	case len(invalid) == 0:
+		writeOK(w)
+	case len(invalid) == len(request.Users):
+		writeError(w, 40070, "all userid are invalid")
+	default:
+		writeJSON(w, map[string]interface{}{
+			"errcode":     errCodeOK,
+			"errmsg":      "ok",
+			"invalidlist": strings.Join(invalid, "|"),
+		})
+	}
+}
+
+func (srv *Server) corpMenuCreate(w http.ResponseWriter, r *http.Request) {
+	var menu_ menu.Menu
+	if !readJSON(w, r, &menu_) {
+		return
+	}
+	if err := menu_.Validate(); err != nil {
+		writeError(w, 40016, "invalid button: "+err.Error())
+		return
+	}
+
+	srv.mutex.Lock()
+	srv.corp.menus[queryInt64(r, "agentid")] = &menu_
+	srv.mutex.Unlock()
+
+	writeOK(w)
+}
+
+func (srv *Server) corpMenuGet(w http.ResponseWriter, r *http.Request) {
+	srv.mutex.Lock()
+	menu_ := srv.corp.menus[queryInt64(r, "agentid")]
+	srv.mutex.Unlock()
+
+	if menu_ == nil {
+		writeError(w, errCodeMenuNotExist, "menu no exist")
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"menu": menu_,
+	})
+}
+
+func (srv *Server) corpMenuDelete(w http.ResponseWriter, r *http.Request) {
+	srv.mutex.Lock()
+	delete(srv.corp.menus, queryInt64(r, "agentid"))
+	srv.mutex.Unlock()
+
+	writeOK(w)
+}
+
+func (srv *Server) corpMediaUpload(w http.ResponseWriter, r *http.Request) {
+	m := srv.mediaUpload(w, r, &srv.corp.media)
+	if m == nil {
+		return
+	}
+	writeJSON(w, &media.MediaInfo{
+		MediaType: m.MediaType,
+		MediaId:   m.MediaId,
+		CreatedAt: m.CreatedAt,
+	})
+}
+
+func (srv *Server) corpMediaGet(w http.ResponseWriter, r *http.Request) {
+	srv.mediaGet(w, r, &srv.corp.media)
+}
+
+func (srv *Server) corpMsgSend(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		ToUser  string `json:"touser"`
+		ToParty string `json:"toparty"`
+		ToTag   string `json:"totag"`
+		MsgType string `json:"msgtype"`
+	}
+	body, ok := readBody(w, r, &request)
+	if !ok {
+		return
+	}
+	if request.MsgType == "" {
+		writeError(w, 40008, "invalid message type")
+		return
+	}
+	if request.ToUser == "" && request.ToParty == "" && request.ToTag == "" {
+		writeError(w, 40031, "invalid user list")
+		return
+	}
+
+	var invalidUser, invalidParty, invalidTag []string
+	if request.ToUser != "@all" {
+		srv.mutex.Lock()
+		for _, userid := range splitList(request.ToUser) {
+			if srv.corp.users[userid] == nil {
+				invalidUser = append(invalidUser, userid)
+			}
+		}
+		for _, id := range splitList(request.ToParty) {
+			if n, err := strconv.ParseInt(id, 10, 64); err != nil || srv.corp.departments[n] == nil {
+				invalidParty = append(invalidParty, id)
+			}
+		}
+		for _, id := range splitList(request.ToTag) {
+			if n, err := strconv.ParseInt(id, 10, 64); err != nil || srv.corp.tags[n] == nil {
+				invalidTag = append(invalidTag, id)
+			}
+		}
+		srv.mutex.Unlock()
+	}
+
+	srv.addMessage(r.URL.Path, body)
+	writeJSON(w, map[string]interface{}{
+		"errcode":      errCodeOK,
+		"errmsg":       "ok",
+		"invaliduser":  strings.Join(invalidUser, "|"),
+		"invalidparty": strings.Join(invalidParty, "|"),
+		"invalidtag":   strings.Join(invalidTag, "|"),
+	})
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "|")
+}
+
+func containsInt64(s []int64, n int64) bool {
+	for _, v := range s {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+// 基于 net/http/httptest 的微信 api 模拟服务器, 用于集成测试.
+//
+// Server 在内存里维护了公众号(用户, 分组, 菜单, 多媒体, 消息, 二维码),
+// 企业号(部门, 成员, 标签, 菜单, 多媒体, 消息) 和 支付(v3: 下单, 查询, 关单, 退款) 的状态,
+// 并且可以注入错误码, 延迟和 access_token 过期.
+//
+// Server.Client() 返回的 *http.Client 会把所有请求都转发到模拟服务器, 只要把它传给
+// mp/tokenservice.NewDefaultTokenService, mp/client.NewClient, corp/client.NewClient,
+// mp/client/pay3.NewClient 等, 就可以在不访问腾讯服务器的情况下测试:
+//
+//  srv := wechattest.NewServer(nil)
+//  defer srv.Close()
+//
+//  tokenService := tokenservice.NewDefaultTokenService(srv.AppId(), srv.AppSecret(), srv.Client())
+//  clt := client.NewClient(tokenService, srv.Client())
+//
+// Recorder 是一个录制/回放的 http.RoundTripper: 录制模式下访问真实的服务器, 把脱敏后的交互记录到 golden 文件;
+// 回放模式下从 golden 文件里返回匹配的响应, 这样任何 client(包括 merchant 和 pay2.TenpayClient) 都可以不写桩代码测试:
+//
+//  rec, err := wechattest.NewRecorder("testdata/user_info.json", wechattest.ModeReplay, nil)
+//  ...
+//  rec.AddSecret(partnerKey)
+//  clt := pay2.NewTenpayClient(partnerId, partnerKey, rec.Client())
+//
+package wechattest
@@ -0,0 +1,137 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package wechattest
+
+import (
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 上传到 Server 的多媒体文件
+type Media struct {
+	MediaType   string
+	MediaId     string
+	Filename    string
+	ContentType string
+	Data        []byte
+	CreatedAt   int64
+}
+
+// 多媒体文件的存储, 公众号和企业号各有一个; 调用者负责加锁.
+type mediaStore struct {
+	types map[string]bool // 允许上传的文件类型
+	media map[string]*Media
+}
+
+func (store *mediaStore) init(types ...string) {
+	store.types = make(map[string]bool, len(types))
+	for _, t := range types {
+		store.types[t] = true
+	}
+	store.media = make(map[string]*Media)
+}
+
+func (store *mediaStore) add(mediaType, filename, contentType string, data []byte) *Media {
+	if contentType == "" {
+		if contentType = mime.TypeByExtension(path.Ext(filename)); contentType == "" {
+			contentType = "application/octet-stream"
+		}
+	}
+
+	m := &Media{
+		MediaType:   mediaType,
+		MediaId:     randString(64),
+		Filename:    filename,
+		ContentType: contentType,
+		Data:        data,
+		CreatedAt:   time.Now().Unix(),
+	}
+	store.media[m.MediaId] = m
+	return m
+}
+
+// 处理 multipart/form-data 上传, 成功返回 Media, 失败写入错误并返回 nil.
+func (srv *Server) mediaUpload(w http.ResponseWriter, r *http.Request, store *mediaStore) *Media {
+	mediaType := r.URL.Query().Get("type")
+
+	srv.mutex.Lock()
+	ok := store.types[mediaType]
+	srv.mutex.Unlock()
+	if !ok {
+		writeError(w, errCodeInvalidMediaType, "invalid media type")
+		return nil
+	}
+
+	//  NOTE: client 生成的 boundary 包含了没有用引号括起来的特殊字符, mime.ParseMediaType 会解析失败,
+	//  所以这里直接截取 boundary= 后面的内容.
+	contentType := r.Header.Get("Content-Type")
+	i := strings.Index(contentType, "boundary=")
+	if i == -1 {
+		writeError(w, errCodeInvalidParameter, "request Content-Type isn't multipart/form-data")
+		return nil
+	}
+	boundary := strings.Trim(contentType[i+len("boundary="):], `"`)
+
+	reader := multipart.NewReader(r.Body, boundary)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeError(w, errCodeInvalidParameter, "invalid multipart form: "+err.Error())
+			return nil
+		}
+		filename := part.FileName()
+		if filename == "" {
+			part.Close()
+			continue
+		}
+		data, err := ioutil.ReadAll(part)
+		part.Close()
+		if err != nil {
+			writeError(w, errCodeSystemBusy, err.Error())
+			return nil
+		}
+
+		partContentType := part.Header.Get("Content-Type")
+		if partContentType == "application/octet-stream" {
+			partContentType = ""
+		}
+
+		srv.mutex.Lock()
+		m := store.add(mediaType, filename, partContentType, data)
+		srv.mutex.Unlock()
+		return m
+	}
+
+	writeError(w, errCodeInvalidParameter, "media data missing")
+	return nil
+}
+
+// 下载多媒体文件
+func (srv *Server) mediaGet(w http.ResponseWriter, r *http.Request, store *mediaStore) {
+	srv.mutex.Lock()
+	m := store.media[r.URL.Query().Get("media_id")]
+	srv.mutex.Unlock()
+
+	if m == nil {
+		writeError(w, errCodeInvalidMediaId, "invalid media_id")
+		return
+	}
+
+	w.Header().Set("Content-Type", m.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": m.Filename}))
+	w.Header().Set("Content-Length", strconv.Itoa(len(m.Data)))
+	w.Write(m.Data)
+}
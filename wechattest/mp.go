@@ -0,0 +1,774 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package wechattest
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chanxuehong/wechat/mp/media"
+	"github.com/chanxuehong/wechat/mp/menu"
+	"github.com/chanxuehong/wechat/mp/user"
+)
+
+// 公众号的状态; 所有字段都由 Server.mutex 保护.
+type mpState struct {
+	users       map[string]*mpUser
+	openids     []string // 按关注的先后顺序
+	groups      map[int64]string
+	nextGroupId int64
+	menu        *menu.Menu // nil 表示没有菜单
+	media       mediaStore
+	qrcodes     map[string]int64 // map[ticket]过期时间, 0 表示永久二维码
+	massMsgIds  map[int64]bool
+}
+
+type mpUser struct {
+	info    user.UserInfo
+	groupId int64
+}
+
+func (state *mpState) init() {
+	state.users = make(map[string]*mpUser)
+	state.groups = map[int64]string{
+		0: "未分组",
+		1: "黑名单",
+		2: "星标组",
+	}
+	state.nextGroupId = 100
+	state.media.init(media.MEDIA_TYPE_IMAGE, media.MEDIA_TYPE_VOICE, media.MEDIA_TYPE_VIDEO, media.MEDIA_TYPE_THUMB)
+	state.qrcodes = make(map[string]int64)
+	state.massMsgIds = make(map[int64]bool)
+}
+
+// 增加一个关注用户, 如果 info.SubscribeTime == 0 则设置为当前时间, 已经存在则覆盖.
+func (srv *Server) AddUser(info user.UserInfo) {
+	if info.SubscribeTime == 0 {
+		info.SubscribeTime = time.Now().Unix()
+	}
+
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	if u := srv.mp.users[info.OpenId]; u != nil {
+		u.info = info
+		return
+	}
+	srv.mp.users[info.OpenId] = &mpUser{info: info}
+	srv.mp.openids = append(srv.mp.openids, info.OpenId)
+}
+
+// 获取关注用户的信息和所在分组.
+func (srv *Server) User(openid string) (info user.UserInfo, groupId int64, ok bool) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	u := srv.mp.users[openid]
+	if u == nil {
+		return
+	}
+	return u.info, u.groupId, true
+}
+
+// 获取公众号当前的菜单, 没有菜单 ok == false.
+func (srv *Server) Menu() (menu_ menu.Menu, ok bool) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	if srv.mp.menu == nil {
+		return
+	}
+	return *srv.mp.menu, true
+}
+
+// 直接增加一个公众号的多媒体文件, 返回 media_id.
+func (srv *Server) AddMedia(mediaType, filename string, data []byte) (mediaId string) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	return srv.mp.media.add(mediaType, filename, "", data).MediaId
+}
+
+func (srv *Server) serveMP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/cgi-bin/token":
+		srv.mpToken(w, r)
+		return
+	case "/cgi-bin/showqrcode": // 不需要 access_token
+		srv.mpShowQRCode(w, r)
+		return
+	}
+
+	var handler func(w http.ResponseWriter, r *http.Request)
+	switch r.URL.Path {
+	case "/cgi-bin/getcallbackip":
+		handler = srv.mpGetCallbackIP
+	case "/cgi-bin/user/get":
+		handler = srv.mpUserGet
+	case "/cgi-bin/user/info":
+		handler = srv.mpUserInfo
+	case "/cgi-bin/user/info/updateremark":
+		handler = srv.mpUserUpdateRemark
+	case "/cgi-bin/groups/create":
+		handler = srv.mpGroupCreate
+	case "/cgi-bin/groups/get":
+		handler = srv.mpGroupGet
+	case "/cgi-bin/groups/update":
+		handler = srv.mpGroupUpdate
+	case "/cgi-bin/groups/getid":
+		handler = srv.mpGroupGetId
+	case "/cgi-bin/groups/members/update":
+		handler = srv.mpGroupMembersUpdate
+	case "/cgi-bin/menu/create":
+		handler = srv.mpMenuCreate
+	case "/cgi-bin/menu/get":
+		handler = srv.mpMenuGet
+	case "/cgi-bin/menu/delete":
+		handler = srv.mpMenuDelete
+	case "/cgi-bin/media/upload":
+		handler = srv.mpMediaUpload
+	case "/cgi-bin/media/get":
+		handler = srv.mpMediaGet
+	case "/cgi-bin/media/uploadnews":
+		handler = srv.mpMediaUploadNews
+	case "/cgi-bin/media/uploadvideo":
+		handler = srv.mpMediaUploadVideo
+	case "/cgi-bin/message/custom/send":
+		handler = srv.mpMsgCustomSend
+	case "/cgi-bin/message/template/send":
+		handler = srv.mpMsgTemplateSend
+	case "/cgi-bin/message/mass/sendall":
+		handler = srv.mpMsgMassSendAll
+	case "/cgi-bin/message/mass/send":
+		handler = srv.mpMsgMassSend
+	case "/cgi-bin/message/mass/delete", "//cgi-bin/message/mass/delete":
+		handler = srv.mpMsgMassDelete
+	case "/cgi-bin/qrcode/create":
+		handler = srv.mpQRCodeCreate
+	case "/cgi-bin/shorturl":
+		handler = srv.mpShortURL
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if !srv.checkToken(w, r) {
+		return
+	}
+	handler(w, r)
+}
+
+func (srv *Server) mpToken(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	switch {
+	case query.Get("grant_type") != "client_credential":
+		writeError(w, 40002, "invalid grant_type")
+	case query.Get("appid") != srv.config.AppId:
+		writeError(w, errCodeInvalidAppId, "invalid appid")
+	case query.Get("secret") != srv.config.AppSecret:
+		writeError(w, errCodeInvalidSecret, "invalid credential, access_token is invalid or not latest")
+	default:
+		token, expiresIn := srv.newToken()
+		writeJSON(w, map[string]interface{}{
+			"access_token": token,
+			"expires_in":   expiresIn,
+		})
+	}
+}
+
+func (srv *Server) mpGetCallbackIP(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]interface{}{
+		"ip_list": []string{"127.0.0.1"},
+	})
+}
+
+func (srv *Server) mpUserGet(w http.ResponseWriter, r *http.Request) {
+	nextOpenId := r.URL.Query().Get("next_openid")
+
+	srv.mutex.Lock()
+	openids := srv.mp.openids
+	begin := 0
+	if nextOpenId != "" {
+		begin = len(openids)
+		for i, openid := range openids {
+			if openid == nextOpenId {
+				begin = i + 1
+				break
+			}
+		}
+	}
+	end := begin + user.UserPageSizeLimit
+	if end > len(openids) {
+		end = len(openids)
+	}
+	page := append([]string(nil), openids[begin:end]...)
+	total := len(openids)
+	srv.mutex.Unlock()
+
+	var result user.UserListResult
+	result.TotalCount = total
+	result.GotCount = len(page)
+	result.Data.OpenId = page
+	if len(page) > 0 {
+		result.NextOpenId = page[len(page)-1]
+	}
+	writeJSON(w, &result)
+}
+
+func (srv *Server) mpUserInfo(w http.ResponseWriter, r *http.Request) {
+	srv.mutex.Lock()
+	u := srv.mp.users[r.URL.Query().Get("openid")]
+	var info user.UserInfo
+	if u != nil {
+		info = u.info
+	}
+	srv.mutex.Unlock()
+
+	if u == nil {
+		writeError(w, errCodeInvalidOpenId, "invalid openid")
+		return
+	}
+	writeJSON(w, struct {
+		Subscribe int `json:"subscribe"`
+		user.UserInfo
+	}{
+		Subscribe: 1,
+		UserInfo:  info,
+	})
+}
+
+func (srv *Server) mpUserUpdateRemark(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		OpenId string `json:"openid"`
+		Remark string `json:"remark"`
+	}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	srv.mutex.Lock()
+	u := srv.mp.users[request.OpenId]
+	if u != nil {
+		u.info.Remark = request.Remark
+	}
+	srv.mutex.Unlock()
+
+	if u == nil {
+		writeError(w, errCodeInvalidOpenId, "invalid openid")
+		return
+	}
+	writeOK(w)
+}
+
+func (srv *Server) mpGroupCreate(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Group struct {
+			Name string `json:"name"`
+		} `json:"group"`
+	}
+	if !readJSON(w, r, &request) {
+		return
+	}
+	if request.Group.Name == "" {
+		writeError(w, errCodeInvalidParameter, "invalid group name")
+		return
+	}
+
+	srv.mutex.Lock()
+	id := srv.mp.nextGroupId
+	srv.mp.nextGroupId++
+	srv.mp.groups[id] = request.Group.Name
+	srv.mutex.Unlock()
+
+	var result struct {
+		Group struct {
+			Id   int64  `json:"id"`
+			Name string `json:"name"`
+		} `json:"group"`
+	}
+	result.Group.Id = id
+	result.Group.Name = request.Group.Name
+	writeJSON(w, &result)
+}
+
+func (srv *Server) mpGroupGet(w http.ResponseWriter, r *http.Request) {
+	srv.mutex.Lock()
+	groups := make([]user.Group, 0, len(srv.mp.groups))
+	for id, name := range srv.mp.groups {
+		group := user.Group{Id: id, Name: name}
+		for _, u := range srv.mp.users {
+			if u.groupId == id {
+				group.UserCount++
+			}
+		}
+		groups = append(groups, group)
+	}
+	srv.mutex.Unlock()
+
+	sort.Sort(groupsById(groups))
+	writeJSON(w, map[string]interface{}{
+		"groups": groups,
+	})
+}
+
+type groupsById []user.Group
+
+func (s groupsById) Len() int           { return len(s) }
+func (s groupsById) Less(i, j int) bool { return s[i].Id < s[j].Id }
+func (s groupsById) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (srv *Server) mpGroupUpdate(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Group struct {
+			Id   int64  `json:"id"`
+			Name string `json:"name"`
+		} `json:"group"`
+	}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	srv.mutex.Lock()
+	_, ok := srv.mp.groups[request.Group.Id]
+	if ok {
+		srv.mp.groups[request.Group.Id] = request.Group.Name
+	}
+	srv.mutex.Unlock()
+
+	if !ok {
+		writeError(w, errCodeInvalidGroupId, "invalid group id")
+		return
+	}
+	writeOK(w)
+}
+
+func (srv *Server) mpGroupGetId(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		OpenId string `json:"openid"`
+	}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	srv.mutex.Lock()
+	u := srv.mp.users[request.OpenId]
+	var groupId int64
+	if u != nil {
+		groupId = u.groupId
+	}
+	srv.mutex.Unlock()
+
+	if u == nil {
+		writeError(w, errCodeInvalidOpenId, "invalid openid")
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"groupid": groupId,
+	})
+}
+
+func (srv *Server) mpGroupMembersUpdate(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		OpenId    string `json:"openid"`
+		ToGroupId int64  `json:"to_groupid"`
+	}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	srv.mutex.Lock()
+	u := srv.mp.users[request.OpenId]
+	_, groupExists := srv.mp.groups[request.ToGroupId]
+	if u != nil && groupExists {
+		u.groupId = request.ToGroupId
+	}
+	srv.mutex.Unlock()
+
+	switch {
+	case u == nil:
+		writeError(w, errCodeInvalidOpenId, "invalid openid")
+	case !groupExists:
+		writeError(w, errCodeInvalidGroupId, "invalid group id")
+	default:
+		writeOK(w)
+	}
+}
+
+func (srv *Server) mpMenuCreate(w http.ResponseWriter, r *http.Request) {
+	var menu_ menu.Menu
+	if !readJSON(w, r, &menu_) {
+		return
+	}
+	if err := menu_.Validate(); err != nil {
+		writeError(w, 40016, "invalid button: "+err.Error())
+		return
+	}
+
+	srv.mutex.Lock()
+	srv.mp.menu = &menu_
+	srv.mutex.Unlock()
+
+	writeOK(w)
+}
+
+func (srv *Server) mpMenuGet(w http.ResponseWriter, r *http.Request) {
+	srv.mutex.Lock()
+	menu_ := srv.mp.menu
+	srv.mutex.Unlock()
+
+	if menu_ == nil {
+		writeError(w, errCodeMenuNotExist, "menu no exist")
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"menu": menu_,
+	})
+}
+
+func (srv *Server) mpMenuDelete(w http.ResponseWriter, r *http.Request) {
+	srv.mutex.Lock()
+	srv.mp.menu = nil
+	srv.mutex.Unlock()
+
+	writeOK(w)
+}
+
+func (srv *Server) mpMediaUpload(w http.ResponseWriter, r *http.Request) {
+	m := srv.mediaUpload(w, r, &srv.mp.media)
+	if m == nil {
+		return
+	}
+
+	if m.MediaType == media.MEDIA_TYPE_THUMB { // 返回的是 thumb_media_id 而不是 media_id
+		writeJSON(w, map[string]interface{}{
+			"type":           m.MediaType,
+			"thumb_media_id": m.MediaId,
+			"created_at":     m.CreatedAt,
+		})
+		return
+	}
+	writeJSON(w, &media.MediaInfo{
+		MediaType: m.MediaType,
+		MediaId:   m.MediaId,
+		CreatedAt: m.CreatedAt,
+	})
+}
+
+// 视频文件不直接返回, 返回的是 video_url, 由 serveVideo 提供下载
+func (srv *Server) mpMediaGet(w http.ResponseWriter, r *http.Request) {
+	mediaId := r.URL.Query().Get("media_id")
+
+	srv.mutex.Lock()
+	m := srv.mp.media.media[mediaId]
+	srv.mutex.Unlock()
+
+	if m != nil && m.MediaType == media.MEDIA_TYPE_VIDEO {
+		writeJSON(w, map[string]string{
+			"video_url": "http://" + videoHost + "/" + mediaId + ".mp4",
+		})
+		return
+	}
+	srv.mediaGet(w, r, &srv.mp.media)
+}
+
+// 下载公众号视频文件的 video_url, 路径为 /MEDIA_ID.mp4
+func (srv *Server) serveVideo(w http.ResponseWriter, r *http.Request) {
+	mediaId := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), ".mp4")
+
+	srv.mutex.Lock()
+	m := srv.mp.media.media[mediaId]
+	srv.mutex.Unlock()
+
+	if m == nil || m.MediaType != media.MEDIA_TYPE_VIDEO {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", m.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(m.Data)))
+	w.Write(m.Data)
+}
+
+func (srv *Server) mpMediaUploadNews(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Articles []media.NewsArticle `json:"articles"`
+	}
+	if !readJSON(w, r, &request) {
+		return
+	}
+	if len(request.Articles) == 0 || len(request.Articles) > media.NewsArticleCountLimit {
+		writeError(w, 45008, "article size out of limit")
+		return
+	}
+
+	srv.mutex.Lock()
+	for _, article := range request.Articles {
+		if m := srv.mp.media.media[article.ThumbMediaId]; m == nil || m.MediaType != media.MEDIA_TYPE_THUMB {
+			srv.mutex.Unlock()
+			writeError(w, errCodeInvalidMediaId, "invalid thumb_media_id")
+			return
+		}
+	}
+	data, _ := json.Marshal(request.Articles)
+	m := srv.mp.media.add(media.MEDIA_TYPE_NEWS, "news.json", "application/json", data)
+	srv.mutex.Unlock()
+
+	writeJSON(w, &media.MediaInfo{
+		MediaType: m.MediaType,
+		MediaId:   m.MediaId,
+		CreatedAt: m.CreatedAt,
+	})
+}
+
+func (srv *Server) mpMediaUploadVideo(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		MediaId     string `json:"media_id"`
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	srv.mutex.Lock()
+	src := srv.mp.media.media[request.MediaId]
+	var m *Media
+	if src != nil && src.MediaType == media.MEDIA_TYPE_VIDEO {
+		m = srv.mp.media.add(media.MEDIA_TYPE_VIDEO, src.Filename, src.ContentType, src.Data)
+	}
+	srv.mutex.Unlock()
+
+	if m == nil {
+		writeError(w, errCodeInvalidMediaId, "invalid media_id")
+		return
+	}
+	writeJSON(w, &media.MediaInfo{
+		MediaType: m.MediaType,
+		MediaId:   m.MediaId,
+		CreatedAt: m.CreatedAt,
+	})
+}
+
+// 检查 openid 是否关注了公众号, 没有关注写入错误并返回 false
+func (srv *Server) mpCheckOpenId(w http.ResponseWriter, openid string) bool {
+	srv.mutex.Lock()
+	u := srv.mp.users[openid]
+	srv.mutex.Unlock()
+
+	if u == nil {
+		writeError(w, errCodeInvalidOpenId, "invalid openid")
+		return false
+	}
+	return true
+}
+
+func (srv *Server) mpMsgCustomSend(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		ToUser  string `json:"touser"`
+		MsgType string `json:"msgtype"`
+	}
+	body, ok := readBody(w, r, &request)
+	if !ok {
+		return
+	}
+	if request.MsgType == "" {
+		writeError(w, 40008, "invalid message type")
+		return
+	}
+	if !srv.mpCheckOpenId(w, request.ToUser) {
+		return
+	}
+
+	srv.addMessage(r.URL.Path, body)
+	writeOK(w)
+}
+
+func (srv *Server) mpMsgTemplateSend(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		ToUser     string `json:"touser"`
+		TemplateId string `json:"template_id"`
+	}
+	body, ok := readBody(w, r, &request)
+	if !ok {
+		return
+	}
+	if request.TemplateId == "" {
+		writeError(w, 40037, "invalid template_id")
+		return
+	}
+	if !srv.mpCheckOpenId(w, request.ToUser) {
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"errcode": errCodeOK,
+		"errmsg":  "ok",
+		"msgid":   srv.addMessage(r.URL.Path, body),
+	})
+}
+
+func (srv *Server) mpMsgMassSendAll(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Filter struct {
+			GroupId json.Number `json:"group_id"`
+		} `json:"filter"`
+	}
+	body, ok := readBody(w, r, &request)
+	if !ok {
+		return
+	}
+
+	groupId, err := strconv.ParseInt(request.Filter.GroupId.String(), 10, 64)
+	if err == nil {
+		srv.mutex.Lock()
+		_, ok = srv.mp.groups[groupId]
+		srv.mutex.Unlock()
+	}
+	if err != nil || !ok {
+		writeError(w, errCodeInvalidGroupId, "invalid group id")
+		return
+	}
+
+	srv.mpMassSent(w, r.URL.Path, body)
+}
+
+func (srv *Server) mpMsgMassSend(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		ToUser []string `json:"touser"`
+	}
+	body, ok := readBody(w, r, &request)
+	if !ok {
+		return
+	}
+	if len(request.ToUser) == 0 {
+		writeError(w, errCodeInvalidOpenId, "invalid openid")
+		return
+	}
+	for _, openid := range request.ToUser {
+		if !srv.mpCheckOpenId(w, openid) {
+			return
+		}
+	}
+
+	srv.mpMassSent(w, r.URL.Path, body)
+}
+
+func (srv *Server) mpMassSent(w http.ResponseWriter, path string, body []byte) {
+	msgId := srv.addMessage(path, body)
+
+	srv.mutex.Lock()
+	srv.mp.massMsgIds[msgId] = true
+	srv.mutex.Unlock()
+
+	writeJSON(w, map[string]interface{}{
+		"errcode": errCodeOK,
+		"errmsg":  "send job submission success",
+		"msg_id":  msgId,
+	})
+}
+
+func (srv *Server) mpMsgMassDelete(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		MsgId int64 `json:"msgid"`
+	}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	srv.mutex.Lock()
+	ok := srv.mp.massMsgIds[request.MsgId]
+	delete(srv.mp.massMsgIds, request.MsgId)
+	srv.mutex.Unlock()
+
+	if !ok {
+		writeError(w, errCodeInvalidMsgId, "invalid msgid")
+		return
+	}
+	writeOK(w)
+}
+
+func (srv *Server) mpQRCodeCreate(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		ExpireSeconds int    `json:"expire_seconds"`
+		ActionName    string `json:"action_name"`
+		ActionInfo    struct {
+			Scene struct {
+				SceneId uint32 `json:"scene_id"`
+			} `json:"scene"`
+		} `json:"action_info"`
+	}
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	ticket := randString(96)
+	result := map[string]interface{}{
+		"ticket": ticket,
+		"url":    "http://weixin.qq.com/q/" + ticket[:32],
+	}
+
+	var expiresAt int64
+	switch request.ActionName {
+	case "QR_SCENE":
+		if request.ExpireSeconds <= 0 || request.ExpireSeconds > 1800 {
+			request.ExpireSeconds = 1800
+		}
+		expiresAt = time.Now().Unix() + int64(request.ExpireSeconds)
+		result["expire_seconds"] = request.ExpireSeconds
+	case "QR_LIMIT_SCENE":
+		if id := request.ActionInfo.Scene.SceneId; id < 1 || id > 100000 {
+			writeError(w, 40097, "invalid scene_id")
+			return
+		}
+	default:
+		writeError(w, 40097, "invalid action_name")
+		return
+	}
+
+	srv.mutex.Lock()
+	srv.mp.qrcodes[ticket] = expiresAt
+	srv.mutex.Unlock()
+
+	writeJSON(w, result)
+}
+
+// 一个最小的 1x1 gif 图片
+var qrcodeImage = []byte("GIF89a\x01\x00\x01\x00\x80\x00\x00\x00\x00\x00\xff\xff\xff!\xf9\x04\x01\x00\x00\x00\x00,\x00\x00\x00\x00\x01\x00\x01\x00\x00\x02\x02D\x01\x00;")
+
+func (srv *Server) mpShowQRCode(w http.ResponseWriter, r *http.Request) {
+	srv.mutex.Lock()
+	expiresAt, ok := srv.mp.qrcodes[r.URL.Query().Get("ticket")]
+	srv.mutex.Unlock()
+
+	if !ok || (expiresAt != 0 && expiresAt <= time.Now().Unix()) {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "image/gif")
+	w.Write(qrcodeImage)
+}
+
+func (srv *Server) mpShortURL(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Action  string `json:"action"`
+		LongURL string `json:"long_url"`
+	}
+	if !readJSON(w, r, &request) {
+		return
+	}
+	if request.Action != "long2short" || request.LongURL == "" {
+		writeError(w, errCodeInvalidURL, "invalid url")
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"errcode":   errCodeOK,
+		"errmsg":    "ok",
+		"short_url": "http://w.url.cn/s/" + randString(7),
+	})
+}
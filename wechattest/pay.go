@@ -0,0 +1,366 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package wechattest
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chanxuehong/wechat/mp/pay"
+	"github.com/chanxuehong/wechat/mp/pay/pay3"
+)
+
+// 订单的交易状态
+const (
+	TRADE_STATE_SUCCESS = "SUCCESS" // 支付成功
+	TRADE_STATE_REFUND  = "REFUND"  // 转入退款
+	TRADE_STATE_NOTPAY  = "NOTPAY"  // 未支付
+	TRADE_STATE_CLOSED  = "CLOSED"  // 已关闭
+)
+
+// 通过统一支付接口创建的订单
+type Order struct {
+	OutTradeNo    string
+	TransactionId string // 支付成功后才有
+	PrepayId      string
+	TradeType     string
+	TradeState    string
+	OpenId        string
+	Body          string
+	TotalFee      int64
+	RefundFee     int64 // 累计退款金额
+	TimeEnd       string
+}
+
+type refund struct {
+	outRefundNo string
+	refundId    string
+	outTradeNo  string
+	refundFee   int64
+}
+
+// 支付的状态; 所有字段都由 Server.mutex 保护.
+type payState struct {
+	orders  map[string]*Order // map[out_trade_no]*Order
+	refunds []*refund
+}
+
+func (state *payState) init() {
+	state.orders = make(map[string]*Order)
+}
+
+// 获取订单.
+func (srv *Server) Order(outTradeNo string) (order Order, ok bool) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	o := srv.pay.orders[outTradeNo]
+	if o == nil {
+		return
+	}
+	return *o, true
+}
+
+// 模拟用户支付了订单, 只有未支付的订单才能支付.
+func (srv *Server) PayOrder(outTradeNo string) (transactionId string, err error) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	o := srv.pay.orders[outTradeNo]
+	if o == nil {
+		err = fmt.Errorf("订单 %s 不存在", outTradeNo)
+		return
+	}
+	if o.TradeState != TRADE_STATE_NOTPAY {
+		err = fmt.Errorf("订单 %s 的状态为 %s, 不能支付", outTradeNo, o.TradeState)
+		return
+	}
+
+	o.TradeState = TRADE_STATE_SUCCESS
+	o.TransactionId = "1" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	o.TimeEnd = time.Now().Format("20060102150405")
+	transactionId = o.TransactionId
+	return
+}
+
+func (srv *Server) servePay(w http.ResponseWriter, r *http.Request) {
+	var handler func(req map[string]string) (resp map[string]string, errCode string)
+	switch r.URL.Path {
+	case "/pay/unifiedorder":
+		handler = srv.payUnifiedOrder
+	case "/pay/orderquery":
+		handler = srv.payOrderQuery
+	case "/pay/closeorder":
+		handler = srv.payCloseOrder
+	case "/secapi/pay/refund":
+		handler = srv.payRefund
+	case "/pay/refundquery":
+		handler = srv.payRefundQuery
+	case "/tools/shorturl":
+		handler = srv.payShortURL
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	req := make(map[string]string)
+	if err := pay.ParseXMLToMap(r.Body, req); err != nil {
+		writePayFail(w, "XML格式错误")
+		return
+	}
+	switch {
+	case req["appid"] != srv.config.AppId:
+		writePayFail(w, "appid不存在")
+		return
+	case req["mch_id"] != srv.config.MchId:
+		writePayFail(w, "mch_id不存在")
+		return
+	case req["nonce_str"] == "":
+		writePayFail(w, "缺少参数nonce_str")
+		return
+	}
+	if err := pay3.CheckMD5Signature(req, srv.config.PayKey); err != nil {
+		writePayFail(w, "签名错误")
+		return
+	}
+
+	resp, errCode := handler(req)
+	if resp == nil {
+		resp = make(map[string]string)
+	}
+	resp["return_code"] = pay3.RET_CODE_SUCCESS
+	resp["return_msg"] = "OK"
+	resp["appid"] = srv.config.AppId
+	resp["mch_id"] = srv.config.MchId
+	resp["nonce_str"] = randString(16)
+	if errCode == "" {
+		resp["result_code"] = pay3.RESULT_CODE_SUCCESS
+	} else {
+		resp["result_code"] = pay3.RESULT_CODE_FAIL
+		resp["err_code"] = errCode
+		resp["err_code_des"] = errCode
+	}
+	pay3.SetMD5Signature(resp, srv.config.PayKey)
+
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	pay.FormatMapToXML(w, resp)
+}
+
+func writePayFail(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	pay.FormatMapToXML(w, map[string]string{
+		"return_code": pay3.RET_CODE_FAIL,
+		"return_msg":  msg,
+	})
+}
+
+func (srv *Server) payUnifiedOrder(req map[string]string) (resp map[string]string, errCode string) {
+	for _, name := range []string{"body", "out_trade_no", "total_fee", "spbill_create_ip", "notify_url", "trade_type"} {
+		if req[name] == "" {
+			return nil, "PARAM_ERROR"
+		}
+	}
+	totalFee, err := strconv.ParseInt(req["total_fee"], 10, 64)
+	if err != nil || totalFee <= 0 {
+		return nil, "PARAM_ERROR"
+	}
+	tradeType := req["trade_type"]
+	switch tradeType {
+	case pay3.TRADE_TYPE_JSAPI:
+		if req["openid"] == "" {
+			return nil, "PARAM_ERROR"
+		}
+	case pay3.TRADE_TYPE_NATIVE, pay3.TRADE_TYPE_APP:
+	default:
+		return nil, "PARAM_ERROR"
+	}
+
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	if srv.pay.orders[req["out_trade_no"]] != nil {
+		return nil, "OUT_TRADE_NO_USED"
+	}
+	o := &Order{
+		OutTradeNo: req["out_trade_no"],
+		PrepayId:   "wx" + randString(30),
+		TradeType:  tradeType,
+		TradeState: TRADE_STATE_NOTPAY,
+		OpenId:     req["openid"],
+		Body:       req["body"],
+		TotalFee:   totalFee,
+	}
+	srv.pay.orders[o.OutTradeNo] = o
+
+	resp = map[string]string{
+		"trade_type": o.TradeType,
+		"prepay_id":  o.PrepayId,
+	}
+	if tradeType == pay3.TRADE_TYPE_NATIVE {
+		resp["code_url"] = "weixin://wxpay/bizpayurl?sr=" + randString(7)
+	}
+	return
+}
+
+// 根据 transaction_id 或者 out_trade_no 查找订单; 调用者负责加锁.
+func (srv *Server) findOrder(req map[string]string) *Order {
+	if id := req["transaction_id"]; id != "" {
+		for _, o := range srv.pay.orders {
+			if o.TransactionId == id {
+				return o
+			}
+		}
+		return nil
+	}
+	return srv.pay.orders[req["out_trade_no"]]
+}
+
+func (srv *Server) payOrderQuery(req map[string]string) (resp map[string]string, errCode string) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	o := srv.findOrder(req)
+	if o == nil {
+		return nil, "ORDERNOTEXIST"
+	}
+
+	resp = map[string]string{
+		"trade_state":  o.TradeState,
+		"trade_type":   o.TradeType,
+		"out_trade_no": o.OutTradeNo,
+		"total_fee":    strconv.FormatInt(o.TotalFee, 10),
+	}
+	if o.OpenId != "" {
+		resp["openid"] = o.OpenId
+	}
+	if o.TransactionId != "" {
+		resp["transaction_id"] = o.TransactionId
+		resp["time_end"] = o.TimeEnd
+		resp["bank_type"] = "CFT"
+		resp["fee_type"] = "CNY"
+	}
+	return
+}
+
+func (srv *Server) payCloseOrder(req map[string]string) (resp map[string]string, errCode string) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	o := srv.pay.orders[req["out_trade_no"]]
+	switch {
+	case o == nil:
+		return nil, "ORDERNOTEXIST"
+	case o.TradeState == TRADE_STATE_SUCCESS, o.TradeState == TRADE_STATE_REFUND:
+		return nil, "ORDERPAID"
+	case o.TradeState == TRADE_STATE_CLOSED:
+		return nil, "ORDERCLOSED"
+	}
+	o.TradeState = TRADE_STATE_CLOSED
+	return
+}
+
+func (srv *Server) payRefund(req map[string]string) (resp map[string]string, errCode string) {
+	for _, name := range []string{"out_refund_no", "total_fee", "refund_fee", "op_user_id"} {
+		if req[name] == "" {
+			return nil, "PARAM_ERROR"
+		}
+	}
+	totalFee, err1 := strconv.ParseInt(req["total_fee"], 10, 64)
+	refundFee, err2 := strconv.ParseInt(req["refund_fee"], 10, 64)
+	if err1 != nil || err2 != nil || refundFee <= 0 {
+		return nil, "PARAM_ERROR"
+	}
+
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	o := srv.findOrder(req)
+	switch {
+	case o == nil:
+		return nil, "ORDERNOTEXIST"
+	case o.TradeState != TRADE_STATE_SUCCESS && o.TradeState != TRADE_STATE_REFUND:
+		return nil, "TRADE_STATE_ERROR"
+	case totalFee != o.TotalFee:
+		return nil, "PARAM_ERROR"
+	case o.RefundFee+refundFee > o.TotalFee:
+		return nil, "NOTENOUGH"
+	}
+	for _, rf := range srv.pay.refunds {
+		if rf.outRefundNo == req["out_refund_no"] {
+			return nil, "PARAM_ERROR"
+		}
+	}
+
+	rf := &refund{
+		outRefundNo: req["out_refund_no"],
+		refundId:    "2" + strconv.FormatInt(time.Now().UnixNano(), 10),
+		outTradeNo:  o.OutTradeNo,
+		refundFee:   refundFee,
+	}
+	srv.pay.refunds = append(srv.pay.refunds, rf)
+	o.RefundFee += refundFee
+	o.TradeState = TRADE_STATE_REFUND
+
+	resp = map[string]string{
+		"transaction_id": o.TransactionId,
+		"out_trade_no":   o.OutTradeNo,
+		"out_refund_no":  rf.outRefundNo,
+		"refund_id":      rf.refundId,
+		"refund_fee":     strconv.FormatInt(rf.refundFee, 10),
+		"total_fee":      strconv.FormatInt(o.TotalFee, 10),
+	}
+	return
+}
+
+func (srv *Server) payRefundQuery(req map[string]string) (resp map[string]string, errCode string) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	var refunds []*refund
+	for _, rf := range srv.pay.refunds {
+		switch {
+		case req["out_refund_no"] != "":
+			if rf.outRefundNo == req["out_refund_no"] {
+				refunds = append(refunds, rf)
+			}
+		case req["refund_id"] != "":
+			if rf.refundId == req["refund_id"] {
+				refunds = append(refunds, rf)
+			}
+		default:
+			if o := srv.findOrder(req); o != nil && rf.outTradeNo == o.OutTradeNo {
+				refunds = append(refunds, rf)
+			}
+		}
+	}
+	if len(refunds) == 0 {
+		return nil, "REFUNDNOTEXIST"
+	}
+
+	o := srv.pay.orders[refunds[0].outTradeNo]
+	resp = map[string]string{
+		"transaction_id": o.TransactionId,
+		"out_trade_no":   o.OutTradeNo,
+		"refund_count":   strconv.Itoa(len(refunds)),
+	}
+	for i, rf := range refunds {
+		n := strconv.Itoa(i)
+		resp["out_refund_no_"+n] = rf.outRefundNo
+		resp["refund_id_"+n] = rf.refundId
+		resp["refund_fee_"+n] = strconv.FormatInt(rf.refundFee, 10)
+		resp["refund_status_"+n] = "SUCCESS"
+	}
+	return
+}
+
+func (srv *Server) payShortURL(req map[string]string) (resp map[string]string, errCode string) {
+	if req["long_url"] == "" {
+		return nil, "PARAM_ERROR"
+	}
+	return map[string]string{"short_url": "weixin://wxpay/s/" + randString(7)}, ""
+}
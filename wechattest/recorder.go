@@ -0,0 +1,504 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package wechattest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/chanxuehong/wechat/mp/pay"
+)
+
+// Recorder 的工作模式
+type RecorderMode int
+
+const (
+	ModeReplay RecorderMode = iota // 从 golden 文件回放, 不访问网络
+	ModeRecord                     // 访问真实的服务器, 并记录到 golden 文件
+)
+
+// 脱敏后的值
+const Redacted = "REDACTED"
+
+// 默认需要脱敏的字段(不区分大小写), 在 url 的 query, json 和 xml 里都会脱敏.
+//  NOTE: 没有包含 "key", 因为菜单按钮等也有 key 字段; 支付密钥请使用 Recorder.AddSecret 脱敏.
+var DefaultRedactedFields = []string{
+	"access_token",
+	"secret", // /cgi-bin/token?grant_type=client_credential&appid=APPID&secret=APPSECRET
+	"appsecret",
+	"corpsecret",
+	"appkey",
+	"paysignkey",
+	"partnerkey",
+	"partner_key",
+	"op_user_passwd",
+}
+
+// 默认匹配请求时忽略的字段(不区分大小写), 这些字段每次请求一般都不一样.
+var DefaultIgnoredFields = []string{
+	"sign",
+	"app_signature",
+	"paysign",
+	"nonce_str",
+	"noncestr",
+	"timestamp",
+	"time_stamp",
+}
+
+// golden 文件里记录的一次 http 交互
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Method     string `json:"method"`
+	URL        string `json:"url"`
+	Body       string `json:"body,omitempty"`
+	BodyBase64 bool   `json:"body_base64,omitempty"` // Body 不是合法的 utf8 字符串时用 base64 编码
+}
+
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 bool        `json:"body_base64,omitempty"` // Body 不是合法的 utf8 字符串时用 base64 编码
+}
+
+// 录制/回放 http 交互的 http.RoundTripper.
+//
+//  ModeRecord 模式下把请求转发给 base, 并把脱敏后的请求和响应记录下来, 调用 Save 写入 golden 文件;
+//  ModeReplay 模式下从 golden 文件里查找 method, url path, query 和 规范化后的请求体(json 或者 xml)
+//  都匹配的记录并返回它的响应, 找不到则返回错误.
+//
+//  NOTE: 所有的方法都是并发安全的; RedactedFields 和 IgnoredFields 要在第一次请求之前设置.
+type Recorder struct {
+	RedactedFields []string // 需要脱敏的字段, 默认为 DefaultRedactedFields
+	IgnoredFields  []string // 匹配请求时忽略的字段, 默认为 DefaultIgnoredFields
+
+	mode     RecorderMode
+	filename string
+	base     http.RoundTripper
+
+	mutex        sync.Mutex
+	secrets      []string // 需要在任何地方都脱敏的字符串, 比如支付密钥
+	interactions []*Interaction
+	used         []bool // 回放时标记已经使用过的记录
+}
+
+// 创建一个新的 Recorder.
+//  ModeReplay 模式下会读取 filename, 文件不存在返回错误;
+//  ModeRecord 模式下 base 为 nil 则使用 http.DefaultTransport.
+func NewRecorder(filename string, mode RecorderMode, base http.RoundTripper) (*Recorder, error) {
+	rec := &Recorder{
+		RedactedFields: DefaultRedactedFields,
+		IgnoredFields:  DefaultIgnoredFields,
+
+		mode:     mode,
+		filename: filename,
+		base:     base,
+	}
+
+	switch mode {
+	case ModeRecord:
+		if rec.base == nil {
+			rec.base = http.DefaultTransport
+		}
+	case ModeReplay:
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(data, &rec.interactions); err != nil {
+			return nil, fmt.Errorf("invalid golden file %s: %s", filename, err)
+		}
+		rec.used = make([]bool, len(rec.interactions))
+	default:
+		return nil, fmt.Errorf("invalid RecorderMode: %d", mode)
+	}
+	return rec, nil
+}
+
+// 添加需要脱敏的字符串, 比如 AppSecret, 支付密钥; 这些字符串出现在 url 和 消息体 的任何地方都会被替换成 Redacted.
+func (rec *Recorder) AddSecret(secrets ...string) {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	for _, secret := range secrets {
+		if secret != "" {
+			rec.secrets = append(rec.secrets, secret)
+		}
+	}
+}
+
+// 返回使用这个 Recorder 的 *http.Client.
+func (rec *Recorder) Client() *http.Client {
+	return &http.Client{Transport: rec}
+}
+
+// 返回所有的记录.
+func (rec *Recorder) Interactions() []Interaction {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	interactions := make([]Interaction, len(rec.interactions))
+	for i, interaction := range rec.interactions {
+		interactions[i] = *interaction
+	}
+	return interactions
+}
+
+// ModeRecord 模式下把记录写入 golden 文件, 会自动创建所在的目录; ModeReplay 模式下什么都不做.
+func (rec *Recorder) Save() (err error) {
+	if rec.mode != ModeRecord {
+		return
+	}
+
+	rec.mutex.Lock()
+	interactions := rec.interactions
+	if interactions == nil {
+		interactions = make([]*Interaction, 0)
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false) // golden 文件里有很多 xml, 不转义方便阅读
+	encoder.SetIndent("", "\t")
+	err = encoder.Encode(interactions)
+	rec.mutex.Unlock()
+	if err != nil {
+		return
+	}
+
+	if err = os.MkdirAll(filepath.Dir(rec.filename), 0755); err != nil {
+		return
+	}
+	return ioutil.WriteFile(rec.filename, buf.Bytes(), 0644)
+}
+
+func (rec *Recorder) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	var body []byte
+	if req.Body != nil {
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return
+		}
+	}
+
+	if rec.mode == ModeReplay {
+		return rec.replay(req, body)
+	}
+	return rec.record(req, body)
+}
+
+func (rec *Recorder) record(req *http.Request, body []byte) (resp *http.Response, err error) {
+	// 按照 http.RoundTripper 的约定, 不能修改 req, 所以要复制一份
+	req2 := new(http.Request)
+	*req2 = *req
+	if req.Body != nil {
+		req2.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	resp, err = rec.base.RoundTrip(req2)
+	if err != nil {
+		return
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	interaction := &Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    rec.redactURL(req.URL),
+		},
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     make(http.Header),
+		},
+	}
+	interaction.Request.Body, interaction.Request.BodyBase64 = encodeBody(rec.redactBody(body))
+	interaction.Response.Body, interaction.Response.BodyBase64 = encodeBody(rec.redactBody(respBody))
+	for k, v := range resp.Header {
+		switch k {
+		case "Date", "Set-Cookie", "Content-Length":
+			continue
+		}
+		interaction.Response.Header[k] = append([]string(nil), v...)
+	}
+
+	rec.mutex.Lock()
+	rec.interactions = append(rec.interactions, interaction)
+	rec.mutex.Unlock()
+	return
+}
+
+func (rec *Recorder) replay(req *http.Request, body []byte) (resp *http.Response, err error) {
+	redactedURL := rec.redactURL(req.URL)
+	key := rec.matchKey(req.Method, redactedURL, rec.redactBody(body))
+
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	// 优先使用第一个没有使用过的记录, 如果都使用过了则使用最后一个匹配的记录
+	found := -1
+	for i, interaction := range rec.interactions {
+		request := &interaction.Request
+		recordedBody, err := decodeBody(request.Body, request.BodyBase64)
+		if err != nil {
+			return nil, err
+		}
+		if rec.matchKey(request.Method, request.URL, recordedBody) != key {
+			continue
+		}
+		found = i
+		if !rec.used[i] {
+			break
+		}
+	}
+	if found == -1 {
+		return nil, fmt.Errorf("wechattest: no recorded interaction matches %s %s", req.Method, redactedURL)
+	}
+	rec.used[found] = true
+
+	recorded := &rec.interactions[found].Response
+	respBody, err := decodeBody(recorded.Body, recorded.BodyBase64)
+	if err != nil {
+		return
+	}
+
+	resp = &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          ioutil.NopCloser(bytes.NewReader(respBody)),
+		ContentLength: int64(len(respBody)),
+		Request:       req,
+	}
+	for k, v := range recorded.Header {
+		resp.Header[k] = append([]string(nil), v...)
+	}
+	return
+}
+
+// 脱敏 url, 返回脱敏后的 url 字符串.
+func (rec *Recorder) redactURL(u *url.URL) string {
+	u2 := *u
+	if u2.RawQuery != "" {
+		query := u2.Query()
+		for name := range query {
+			if containsFold(rec.RedactedFields, name) {
+				query.Set(name, Redacted)
+			}
+		}
+		u2.RawQuery = query.Encode()
+	}
+	return rec.redactSecrets(u2.String())
+}
+
+// 脱敏消息体; 如果消息体是 json 或者 xml 则脱敏 RedactedFields 里的字段.
+func (rec *Recorder) redactBody(body []byte) []byte {
+	if len(body) == 0 {
+		return body
+	}
+
+	switch trimmed := bytes.TrimSpace(body); trimmed[0] {
+	case '{', '[':
+		var v interface{}
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		decoder.UseNumber()
+		if err := decoder.Decode(&v); err == nil && redactJSON(v, rec.RedactedFields) {
+			if data, err := json.Marshal(v); err == nil {
+				body = data
+			}
+		}
+	case '<':
+		m := make(map[string]string)
+		if err := pay.ParseXMLToMap(bytes.NewReader(trimmed), m); err == nil {
+			changed := false
+			for k := range m {
+				if containsFold(rec.RedactedFields, k) {
+					m[k] = Redacted
+					changed = true
+				}
+			}
+			if changed {
+				var buf bytes.Buffer
+				if err = pay.FormatMapToXML(&buf, m); err == nil {
+					body = buf.Bytes()
+				}
+			}
+		}
+	}
+	return []byte(rec.redactSecrets(string(body)))
+}
+
+func (rec *Recorder) redactSecrets(s string) string {
+	rec.mutex.Lock()
+	secrets := rec.secrets
+	rec.mutex.Unlock()
+
+	for _, secret := range secrets {
+		s = strings.Replace(s, secret, Redacted, -1)
+		if escaped := url.QueryEscape(secret); escaped != secret {
+			s = strings.Replace(s, escaped, Redacted, -1)
+		}
+	}
+	return s
+}
+
+// 脱敏 json 对象 v 里的 fields 字段, 有字段被脱敏则返回 true.
+func redactJSON(v interface{}, fields []string) (changed bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, value := range v {
+			if _, ok := value.(string); ok && containsFold(fields, k) {
+				v[k] = Redacted
+				changed = true
+				continue
+			}
+			if redactJSON(value, fields) {
+				changed = true
+			}
+		}
+	case []interface{}:
+		for _, value := range v {
+			if redactJSON(value, fields) {
+				changed = true
+			}
+		}
+	}
+	return
+}
+
+// 计算用于匹配请求的 key, rawURL 和 body 都是脱敏后的.
+func (rec *Recorder) matchKey(method, rawURL string, body []byte) string {
+	var buf bytes.Buffer
+	buf.WriteString(method)
+	buf.WriteByte(' ')
+
+	if u, err := url.Parse(rawURL); err == nil {
+		buf.WriteString(u.Host)
+		buf.WriteString(u.Path)
+		query := u.Query()
+		for name := range query {
+			if containsFold(rec.IgnoredFields, name) {
+				delete(query, name)
+			}
+		}
+		buf.WriteByte('?')
+		buf.WriteString(query.Encode())
+	} else {
+		buf.WriteString(rawURL)
+	}
+	buf.WriteByte('\n')
+	buf.Write(rec.normalizeBody(body))
+	return buf.String()
+}
+
+// 规范化消息体: json 重新编码(字段按照字典序排列), xml 按照 key=value 的字典序排列, 并且去掉 IgnoredFields 里的字段.
+func (rec *Recorder) normalizeBody(body []byte) []byte {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return trimmed
+	}
+
+	switch trimmed[0] {
+	case '{', '[':
+		var v interface{}
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		decoder.UseNumber()
+		if err := decoder.Decode(&v); err == nil {
+			removeJSONFields(v, rec.IgnoredFields)
+			if data, err := json.Marshal(v); err == nil {
+				return data
+			}
+		}
+	case '<':
+		m := make(map[string]string)
+		if err := pay.ParseXMLToMap(bytes.NewReader(trimmed), m); err == nil {
+			keys := make([]string, 0, len(m))
+			for k := range m {
+				if !containsFold(rec.IgnoredFields, k) {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+
+			var buf bytes.Buffer
+			for _, k := range keys {
+				buf.WriteString(k)
+				buf.WriteByte('=')
+				buf.WriteString(m[k])
+				buf.WriteByte('\n')
+			}
+			return buf.Bytes()
+		}
+	}
+	return trimmed
+}
+
+func removeJSONFields(v interface{}, fields []string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, value := range v {
+			if containsFold(fields, k) {
+				delete(v, k)
+				continue
+			}
+			removeJSONFields(value, fields)
+		}
+	case []interface{}:
+		for _, value := range v {
+			removeJSONFields(value, fields)
+		}
+	}
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeBody(body []byte) (s string, isBase64 bool) {
+	if utf8.Valid(body) {
+		return string(body), false
+	}
+	return base64.StdEncoding.EncodeToString(body), true
+}
+
+func decodeBody(s string, isBase64 bool) ([]byte, error) {
+	if !isBase64 {
+		return []byte(s), nil
+	}
+	body, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid base64 body: " + err.Error())
+	}
+	return body, nil
+}
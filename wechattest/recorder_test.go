@@ -0,0 +1,101 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package wechattest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chanxuehong/wechat/mp/client"
+	"github.com/chanxuehong/wechat/mp/client/pay3"
+	pay3_ "github.com/chanxuehong/wechat/mp/pay/pay3"
+	"github.com/chanxuehong/wechat/mp/tokenservice"
+	"github.com/chanxuehong/wechat/mp/user"
+)
+
+func TestRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wechattest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "testdata", "golden.json")
+
+	srv := NewServer(nil)
+	srv.AddUser(user.UserInfo{OpenId: "openid-1", Nickname: "张三"})
+
+	// 录制
+	rec, err := NewRecorder(filename, ModeRecord, srv.Client().Transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.AddSecret(srv.PayKey())
+	run := func(rec *Recorder) {
+		httpClient := rec.Client()
+		tokenService := tokenservice.NewDefaultTokenService(srv.AppId(), srv.AppSecret(), httpClient)
+		clt := client.NewClient(tokenService, httpClient)
+		info, err := clt.UserInfo("openid-1", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Nickname != "张三" {
+			t.Errorf("Nickname: have %q, want %q", info.Nickname, "张三")
+		}
+
+		req := map[string]string{
+			"appid":            srv.AppId(),
+			"mch_id":           srv.MchId(),
+			"nonce_str":        randString(16), // 匹配的时候会忽略 nonce_str 和 sign
+			"body":             "测试商品",
+			"out_trade_no":     "order-1",
+			"total_fee":        "100",
+			"spbill_create_ip": "127.0.0.1",
+			"notify_url":       "http://example.com/notify",
+			"trade_type":       pay3_.TRADE_TYPE_NATIVE,
+		}
+		pay3_.SetMD5Signature(req, srv.PayKey())
+		resp, err := pay3.NewClient(srv.AppId(), srv.MchId(), srv.PayKey(), httpClient).UnifiedOrder(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp["prepay_id"] == "" {
+			t.Errorf("UnifiedOrder: have %v", resp)
+		}
+	}
+	run(rec)
+	if err = rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{srv.AppSecret(), srv.PayKey()} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("golden file contains secret %q", secret)
+		}
+	}
+	if body := rec.Interactions()[0].Response.Body; !strings.Contains(body, `"access_token":"`+Redacted+`"`) {
+		t.Errorf("access_token is not redacted: %s", body)
+	}
+
+	// 回放, 服务器已经关闭了
+	rec, err = NewRecorder(filename, ModeReplay, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run(rec)
+
+	clt := client.NewClient(tokenservice.NewDefaultTokenService(srv.AppId(), srv.AppSecret(), rec.Client()), rec.Client())
+	if _, err = clt.UserInfo("openid-2", ""); err == nil {
+		t.Error("UserInfo(openid-2): expected error for unrecorded request")
+	}
+}
@@ -0,0 +1,378 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package wechattest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultAppId      = "wx0123456789abcdef"
+	DefaultAppSecret  = "wechattest-appsecret"
+	DefaultCorpId     = "wx0123456789corpid"
+	DefaultCorpSecret = "wechattest-corpsecret"
+	DefaultMchId      = "1234567890"
+	DefaultPayKey     = "wechattest-paykey-0123456789abcd" // 32 bytes
+
+	DefaultTokenExpiresIn = 7200 // access_token 的有效时间, 单位为秒
+
+	videoHost = "vweixinf.tc.qq.com" // 公众号视频文件 video_url 的域名
+)
+
+// 常用的错误码
+const (
+	errCodeOK                = 0
+	errCodeSystemBusy        = -1
+	errCodeInvalidSecret     = 40001 // 获取 access_token 时 AppSecret 错误, 或者 access_token 无效
+	errCodeInvalidOpenId     = 40003
+	errCodeInvalidMediaType  = 40004
+	errCodeInvalidMediaId    = 40007
+	errCodeInvalidAppId      = 40013
+	errCodeInvalidGroupId    = 40050
+	errCodeMissingToken      = 41001
+	errCodeTokenExpired      = 42001
+	errCodeInvalidParameter  = 40035
+	errCodeMenuNotExist      = 46003
+	errCodeJSONParseError    = 47001
+	errCodeInvalidURL        = 40039
+	errCodeInvalidMsgId      = 40114 // 群发消息 msgid 不存在
+	errCodeDepartmentExists  = 60008
+	errCodeDepartmentMissing = 60003
+	errCodeDepartmentNoEmpty = 60005
+	errCodeUserExists        = 60102
+	errCodeUserMissing       = 60111
+	errCodeTagExists         = 40071
+	errCodeTagMissing        = 40068
+)
+
+// Server 的配置, 零值的字段使用对应的 DefaultXxx.
+type Config struct {
+	AppId     string
+	AppSecret string
+
+	CorpId     string
+	CorpSecret string
+
+	MchId  string
+	PayKey string // 商户支付密钥Key
+
+	TokenExpiresIn int64 // access_token 的有效时间, 单位为秒
+}
+
+type injectedError struct {
+	errCode int64
+	errMsg  string
+	count   int // <= 0 表示一直有效, 直到调用 ClearErrors
+}
+
+// 模拟的微信 api 服务器.
+//  NOTE: 所有的方法都是并发安全的.
+type Server struct {
+	config Config
+	server *httptest.Server
+	client *http.Client
+
+	mutex sync.Mutex
+
+	tokens  map[string]time.Time // map[access_token]过期时间
+	latency time.Duration
+	errors  map[string]*injectedError // map[path]*injectedError
+	calls   map[string]int            // map[path]调用次数
+
+	messages  []Message
+	nextMsgId int64
+
+	mp   mpState
+	corp corpState
+	pay  payState
+}
+
+// 通过 api 发送的消息
+type Message struct {
+	Path  string          // 发送消息的 api 路径, 比如 /cgi-bin/message/custom/send
+	Body  json.RawMessage // 请求的 json 消息体
+	MsgId int64           // Server 分配的消息 id
+}
+
+// 创建并启动一个新的 Server, config 可以为 nil.
+func NewServer(config *Config) *Server {
+	srv := &Server{
+		tokens: make(map[string]time.Time),
+		errors: make(map[string]*injectedError),
+		calls:  make(map[string]int),
+
+		nextMsgId: 1000,
+	}
+	if config != nil {
+		srv.config = *config
+	}
+	srv.config.setDefaults()
+	srv.mp.init()
+	srv.corp.init()
+	srv.pay.init()
+
+	srv.server = httptest.NewServer(http.HandlerFunc(srv.serveHTTP))
+	srv.client = &http.Client{
+		Transport: NewTransport(srv.server.URL, nil),
+	}
+	return srv
+}
+
+func (config *Config) setDefaults() {
+	if config.AppId == "" {
+		config.AppId = DefaultAppId
+	}
+	if config.AppSecret == "" {
+		config.AppSecret = DefaultAppSecret
+	}
+	if config.CorpId == "" {
+		config.CorpId = DefaultCorpId
+	}
+	if config.CorpSecret == "" {
+		config.CorpSecret = DefaultCorpSecret
+	}
+	if config.MchId == "" {
+		config.MchId = DefaultMchId
+	}
+	if config.PayKey == "" {
+		config.PayKey = DefaultPayKey
+	}
+	if config.TokenExpiresIn <= 0 {
+		config.TokenExpiresIn = DefaultTokenExpiresIn
+	}
+}
+
+// 关闭 Server.
+func (srv *Server) Close() {
+	srv.server.Close()
+}
+
+// Server 监听的地址, 比如 http://127.0.0.1:12345
+func (srv *Server) URL() string {
+	return srv.server.URL
+}
+
+// 返回一个把所有请求都转发到 Server 的 *http.Client.
+func (srv *Server) Client() *http.Client {
+	return srv.client
+}
+
+func (srv *Server) AppId() string      { return srv.config.AppId }
+func (srv *Server) AppSecret() string  { return srv.config.AppSecret }
+func (srv *Server) CorpId() string     { return srv.config.CorpId }
+func (srv *Server) CorpSecret() string { return srv.config.CorpSecret }
+func (srv *Server) MchId() string      { return srv.config.MchId }
+func (srv *Server) PayKey() string     { return srv.config.PayKey }
+
+// 设置每个请求的延迟.
+func (srv *Server) SetLatency(d time.Duration) {
+	srv.mutex.Lock()
+	srv.latency = d
+	srv.mutex.Unlock()
+}
+
+// 注入错误, 接下来 count 次请求 path 都返回错误码 errCode, count <= 0 表示一直返回这个错误, 直到调用 ClearErrors.
+//  path 是不带 host 和 query 的路径, 比如 "/cgi-bin/user/info", "/pay/unifiedorder";
+//  对于支付接口, 返回 return_code 为 FAIL, return_msg 为 errMsg 的错误.
+func (srv *Server) InjectError(path string, errCode int64, errMsg string, count int) {
+	srv.mutex.Lock()
+	srv.errors[path] = &injectedError{
+		errCode: errCode,
+		errMsg:  errMsg,
+		count:   count,
+	}
+	srv.mutex.Unlock()
+}
+
+// 清除所有注入的错误.
+func (srv *Server) ClearErrors() {
+	srv.mutex.Lock()
+	srv.errors = make(map[string]*injectedError)
+	srv.mutex.Unlock()
+}
+
+// 让所有已经发放的 access_token 都过期, 之后使用这些 access_token 都会返回 42001 错误.
+func (srv *Server) ExpireTokens() {
+	srv.mutex.Lock()
+	now := time.Now()
+	for token := range srv.tokens {
+		srv.tokens[token] = now
+	}
+	srv.mutex.Unlock()
+}
+
+// 获取 path 被请求的次数, 包括失败的请求.
+func (srv *Server) Calls(path string) int {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	return srv.calls[path]
+}
+
+// 获取所有通过 api 发送的消息, 包括公众号的客服消息, 模板消息, 群发消息 和 企业号的消息.
+func (srv *Server) Messages() []Message {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	return append([]Message(nil), srv.messages...)
+}
+
+// 记录发送的消息, 返回分配的消息 id
+func (srv *Server) addMessage(path string, body []byte) (msgId int64) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	srv.nextMsgId++
+	msgId = srv.nextMsgId
+	srv.messages = append(srv.messages, Message{
+		Path:  path,
+		Body:  json.RawMessage(body),
+		MsgId: msgId,
+	})
+	return
+}
+
+func (srv *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	srv.mutex.Lock()
+	latency := srv.latency
+	srv.calls[r.URL.Path]++
+	injected := srv.errors[r.URL.Path]
+	if injected != nil && injected.count > 0 {
+		if injected.count--; injected.count == 0 {
+			delete(srv.errors, r.URL.Path)
+		}
+	}
+	srv.mutex.Unlock()
+
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+
+	switch hostname(r.Host) {
+	case "api.mch.weixin.qq.com":
+		if injected != nil {
+			writePayFail(w, injected.errMsg)
+			return
+		}
+		srv.servePay(w, r)
+
+	case videoHost:
+		srv.serveVideo(w, r)
+
+	case "qyapi.weixin.qq.com":
+		if injected != nil {
+			writeError(w, injected.errCode, injected.errMsg)
+			return
+		}
+		srv.serveCorp(w, r)
+
+	default: // api.weixin.qq.com, file.api.weixin.qq.com, mp.weixin.qq.com
+		if injected != nil {
+			writeError(w, injected.errCode, injected.errMsg)
+			return
+		}
+		srv.serveMP(w, r)
+	}
+}
+
+// 发放一个新的 access_token
+func (srv *Server) newToken() (token string, expiresIn int64) {
+	token = randString(32)
+	expiresIn = srv.config.TokenExpiresIn
+
+	srv.mutex.Lock()
+	srv.tokens[token] = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	srv.mutex.Unlock()
+	return
+}
+
+// 检查请求里的 access_token, 不合法则写入错误并返回 false
+func (srv *Server) checkToken(w http.ResponseWriter, r *http.Request) bool {
+	token := r.URL.Query().Get("access_token")
+	if token == "" {
+		writeError(w, errCodeMissingToken, "access_token missing")
+		return false
+	}
+
+	srv.mutex.Lock()
+	expiresAt, ok := srv.tokens[token]
+	srv.mutex.Unlock()
+
+	switch {
+	case !ok:
+		writeError(w, errCodeInvalidSecret, "invalid credential, access_token is invalid or not latest")
+		return false
+	case !time.Now().Before(expiresAt):
+		writeError(w, errCodeTokenExpired, "access_token expired")
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; encoding=utf-8")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, errCode int64, errMsg string) {
+	writeJSON(w, map[string]interface{}{
+		"errcode": errCode,
+		"errmsg":  errMsg,
+	})
+}
+
+func writeOK(w http.ResponseWriter) {
+	writeError(w, errCodeOK, "ok")
+}
+
+// 解析 json 请求体, 失败则写入错误并返回 false
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, errCodeJSONParseError, "data format error: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// 读取并解析 json 请求体, 同时返回原始的请求体; 失败则写入错误并返回 false
+func readBody(w http.ResponseWriter, r *http.Request, v interface{}) (body []byte, ok bool) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, errCodeSystemBusy, err.Error())
+		return
+	}
+	if err = json.Unmarshal(body, v); err != nil {
+		writeError(w, errCodeJSONParseError, "data format error: "+err.Error())
+		return
+	}
+	ok = true
+	return
+}
+
+func hostname(host string) string {
+	for i := len(host) - 1; i >= 0; i-- {
+		switch host[i] {
+		case ':':
+			return host[:i]
+		case ']':
+			return host
+		}
+	}
+	return host
+}
+
+func randString(n int) string {
+	b := make([]byte, (n+1)/2)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)[:n]
+}
@@ -0,0 +1,236 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package wechattest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	corpaddresslist "github.com/chanxuehong/wechat/corp/addresslist"
+	corpclient "github.com/chanxuehong/wechat/corp/client"
+	"github.com/chanxuehong/wechat/corp/message/active/common"
+	"github.com/chanxuehong/wechat/corp/tokencache"
+	"github.com/chanxuehong/wechat/mp/client"
+	"github.com/chanxuehong/wechat/mp/client/pay3"
+	"github.com/chanxuehong/wechat/mp/media"
+	"github.com/chanxuehong/wechat/mp/menu"
+	"github.com/chanxuehong/wechat/mp/message/active/custom"
+	pay3_ "github.com/chanxuehong/wechat/mp/pay/pay3"
+	"github.com/chanxuehong/wechat/mp/tokenservice"
+	"github.com/chanxuehong/wechat/mp/user"
+)
+
+func newMPClient(srv *Server) (*client.Client, *tokenservice.DefaultTokenService) {
+	tokenService := tokenservice.NewDefaultTokenService(srv.AppId(), srv.AppSecret(), srv.Client())
+	return client.NewClient(tokenService, srv.Client()), tokenService
+}
+
+func TestMPClient(t *testing.T) {
+	srv := NewServer(nil)
+	defer srv.Close()
+
+	srv.AddUser(user.UserInfo{OpenId: "openid-1", Nickname: "张三"})
+	srv.AddUser(user.UserInfo{OpenId: "openid-2", Nickname: "李四"})
+
+	clt, _ := newMPClient(srv)
+
+	info, err := clt.UserInfo("openid-1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Nickname != "张三" {
+		t.Errorf("Nickname: have %q, want %q", info.Nickname, "张三")
+	}
+	if _, err = clt.UserInfo("openid-x", ""); err == nil {
+		t.Error("UserInfo(openid-x): expected error")
+	}
+
+	list, err := clt.UserList("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.TotalCount != 2 || len(list.Data.OpenId) != 2 {
+		t.Errorf("UserList: have %+v", list)
+	}
+
+	group, err := clt.UserGroupCreate("测试")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = clt.UserMoveToGroup("openid-2", group.Id); err != nil {
+		t.Fatal(err)
+	}
+	if groupId, err := clt.UserInWhichGroup("openid-2"); err != nil || groupId != group.Id {
+		t.Errorf("UserInWhichGroup: have %d, %v, want %d", groupId, err, group.Id)
+	}
+
+	var mn menu.Menu
+	mn.Buttons = make([]menu.Button, 1)
+	mn.Buttons[0].InitToClickButton("今日歌曲", "V1001_TODAY_MUSIC")
+	if err = clt.MenuCreate(mn); err != nil {
+		t.Fatal(err)
+	}
+	got, err := clt.MenuGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Buttons) != 1 || got.Buttons[0].Key != "V1001_TODAY_MUSIC" {
+		t.Errorf("MenuGet: have %+v", got)
+	}
+
+	mediaInfo, err := clt.MediaUploadImageFromReader("a.jpg", strings.NewReader("jpeg data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	downloadInfo, err := clt.MediaDownloadToWriterWithInfo(mediaInfo.MediaId, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "jpeg data" || downloadInfo.Filename != "a.jpg" {
+		t.Errorf("MediaDownload: have %q, %+v", buf.String(), downloadInfo)
+	}
+	thumb, err := clt.MediaUploadThumbFromReader("b.jpg", strings.NewReader("thumb data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thumb.MediaType != media.MEDIA_TYPE_THUMB || thumb.MediaId == "" {
+		t.Errorf("MediaUploadThumb: have %+v", thumb)
+	}
+
+	if err = clt.MsgCustomSendText(custom.NewText("openid-1", "hello")); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := srv.Messages(); len(msgs) != 1 || msgs[0].Path != "/cgi-bin/message/custom/send" {
+		t.Errorf("Messages: have %+v", msgs)
+	}
+}
+
+func TestMPClientTokenExpiredAndInjectedError(t *testing.T) {
+	srv := NewServer(nil)
+	defer srv.Close()
+
+	srv.AddUser(user.UserInfo{OpenId: "openid-1"})
+	clt, tokenService := newMPClient(srv)
+
+	srv.ExpireTokens()
+	go tokenService.TokenRefresh()                                                     // 模拟中控服务器刷新 access_token
+	if err := clt.MsgCustomSendText(custom.NewText("openid-1", "hello")); err != nil { // client 会等待新的 access_token 并重试
+		t.Fatal(err)
+	}
+	if n := srv.Calls("/cgi-bin/token"); n != 2 {
+		t.Errorf("Calls(/cgi-bin/token): have %d, want 2", n)
+	}
+
+	srv.InjectError("/cgi-bin/user/info", 45009, "api freq out of limit", 1)
+	_, err := clt.UserInfo("openid-1", "")
+	if e, ok := err.(*client.Error); !ok || e.ErrCode != 45009 {
+		t.Errorf("UserInfo: have %v, want errcode 45009", err)
+	}
+	if _, err = clt.UserInfo("openid-1", ""); err != nil {
+		t.Errorf("UserInfo after injected error: %v", err)
+	}
+}
+
+func TestCorpClient(t *testing.T) {
+	srv := NewServer(nil)
+	defer srv.Close()
+
+	clt := corpclient.NewClient(srv.CorpId(), srv.CorpSecret(), new(tokencache.DefaultTokenCache), srv.Client())
+
+	deptId, err := clt.DepartmentCreate(&corpaddresslist.DepartmentCreateParameters{Name: "研发部", ParentId: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = clt.UserCreate(&corpaddresslist.UserCreateParameters{UserId: "zhangsan", Name: "张三", Department: []int64{deptId}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := clt.UserSimpleList(1, true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].Id != "zhangsan" {
+		t.Errorf("UserSimpleList: have %+v", users)
+	}
+
+	tagId, err := clt.TagCreate("标签")
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalid, err := clt.TagUserAdd(tagId, []string{"zhangsan", "lisi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invalid) != 1 || invalid[0] != "lisi" {
+		t.Errorf("TagUserAdd: have %v, want [lisi]", invalid)
+	}
+
+	var text common.Text
+	text.ToUser = "zhangsan|lisi"
+	text.MsgType = "text"
+	text.AgentId = 1
+	text.Text.Content = "hello"
+	result, err := clt.MsgSendText(&text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.InvalidUser != "lisi" {
+		t.Errorf("InvalidUser: have %q, want lisi", result.InvalidUser)
+	}
+}
+
+func TestPay3Client(t *testing.T) {
+	srv := NewServer(nil)
+	defer srv.Close()
+
+	clt := pay3.NewClient(srv.AppId(), srv.MchId(), srv.PayKey(), srv.Client())
+
+	req := map[string]string{
+		"appid":            srv.AppId(),
+		"mch_id":           srv.MchId(),
+		"nonce_str":        "nonce",
+		"body":             "测试商品",
+		"out_trade_no":     "order-1",
+		"total_fee":        "100",
+		"spbill_create_ip": "127.0.0.1",
+		"notify_url":       "http://example.com/notify",
+		"trade_type":       pay3_.TRADE_TYPE_NATIVE,
+	}
+	pay3_.SetMD5Signature(req, srv.PayKey())
+	resp, err := clt.UnifiedOrder(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp["result_code"] != pay3_.RESULT_CODE_SUCCESS || resp["prepay_id"] == "" || resp["code_url"] == "" {
+		t.Fatalf("UnifiedOrder: have %v", resp)
+	}
+
+	if _, err = srv.PayOrder("order-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	query := map[string]string{
+		"appid":        srv.AppId(),
+		"mch_id":       srv.MchId(),
+		"nonce_str":    "nonce",
+		"out_trade_no": "order-1",
+	}
+	pay3_.SetMD5Signature(query, srv.PayKey())
+	resp, err = clt.OrderQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp["trade_state"] != TRADE_STATE_SUCCESS || resp["transaction_id"] == "" {
+		t.Errorf("OrderQuery: have %v", resp)
+	}
+
+	req["sign"] = strings.Repeat("0", 32)
+	if _, err = clt.UnifiedOrder(req); err == nil {
+		t.Error("UnifiedOrder with bad sign: expected error")
+	}
+}
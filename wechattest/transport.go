@@ -0,0 +1,60 @@
+// @description wechat 是腾讯微信公众平台 api 的 golang 语言封装
+// @link        https://github.com/chanxuehong/wechat for the canonical source repository
+// @license     https://github.com/chanxuehong/wechat/blob/master/LICENSE
+// @authors     chanxuehong(chanxuehong@gmail.com)
+
+package wechattest
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// 把所有请求都转发到 serverURL 的 http.RoundTripper.
+//  转发的时候保留原来的 Host, 这样 Server 就能区分 api.weixin.qq.com, qyapi.weixin.qq.com 和 api.mch.weixin.qq.com;
+//  如果 base == nil 则使用 http.DefaultTransport.
+func NewTransport(serverURL string, base http.RoundTripper) http.RoundTripper {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		panic(err)
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &transport{
+		scheme: u.Scheme,
+		host:   u.Host,
+		base:   base,
+	}
+}
+
+type transport struct {
+	scheme string
+	host   string
+	base   http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// 按照 http.RoundTripper 的约定, 不能修改 req, 所以要复制一份
+	req2 := new(http.Request)
+	*req2 = *req
+
+	u := *req.URL
+	u.Scheme = t.scheme
+	u.Host = t.host
+	req2.URL = &u
+
+	if req.Host != "" {
+		req2.Host = req.Host
+	} else {
+		req2.Host = req.URL.Host
+	}
+
+	req2.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		req2.Header[k] = append([]string(nil), v...)
+	}
+
+	return t.base.RoundTrip(req2)
+}